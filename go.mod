@@ -1,10 +1,11 @@
 module github.com/KNICEX/trading-agent
 
-go 1.21.3
+go 1.22
 
 require (
 	github.com/adshao/go-binance/v2 v2.8.2
 	github.com/google/generative-ai-go v0.19.0
+	github.com/klauspost/compress v1.18.0
 	github.com/samber/lo v1.52.0
 	github.com/shopspring/decimal v1.4.0
 	github.com/spf13/pflag v1.0.6
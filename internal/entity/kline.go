@@ -0,0 +1,32 @@
+package entity
+
+import (
+	"time"
+)
+
+// Kline K线缓存，时间为毫秒时间戳，价格以字符串保存避免精度损失
+type Kline struct {
+	Id          int64  `gorm:"primaryKey;autoIncrement"`
+	Symbol      string `gorm:"uniqueIndex:kline_idx"`
+	Interval    string `gorm:"uniqueIndex:kline_idx"`
+	OpenTime    int64  `gorm:"uniqueIndex:kline_idx"`
+	CloseTime   int64
+	Open        string
+	High        string
+	Low         string
+	Close       string
+	Volume      string
+	QuoteVolume string
+}
+
+// KlineRange 已缓存的K线时间范围 [StartTime, EndTime)
+// 范围内没有K线（如上市之前、交易所维护）也算已缓存，不需要重新获取
+type KlineRange struct {
+	Id        int64  `gorm:"primaryKey;autoIncrement"`
+	Symbol    string `gorm:"index:kline_range_idx"`
+	Interval  string `gorm:"index:kline_range_idx"`
+	StartTime int64
+	EndTime   int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
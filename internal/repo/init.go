@@ -6,5 +6,5 @@ import (
 )
 
 func InitTables(db *gorm.DB) error {
-	return db.AutoMigrate(&entity.Symbol{}, &entity.Abnormal{})
+	return db.AutoMigrate(&entity.Symbol{}, &entity.Abnormal{}, &entity.Kline{}, &entity.KlineRange{})
 }
@@ -0,0 +1,88 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/KNICEX/trading-agent/internal/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type KlineRepo interface {
+	// FindKlines 查询 [start, end) 范围内的K线，按开盘时间升序
+	FindKlines(ctx context.Context, symbol, interval string, start, end int64) ([]entity.Kline, error)
+	// FindRanges 查询与 [start, end) 有交集的已缓存范围，按开始时间升序
+	FindRanges(ctx context.Context, symbol, interval string, start, end int64) ([]entity.KlineRange, error)
+	// SaveKlines 保存K线并把 [start, end) 标记为已缓存，与重叠或相邻的范围合并
+	SaveKlines(ctx context.Context, symbol, interval string, start, end int64, klines []entity.Kline) error
+}
+
+type klineRepo struct {
+	db *gorm.DB
+}
+
+func NewKlineRepo(db *gorm.DB) KlineRepo {
+	return &klineRepo{
+		db: db,
+	}
+}
+
+func (r *klineRepo) FindKlines(ctx context.Context, symbol, interval string, start, end int64) ([]entity.Kline, error) {
+	var klines []entity.Kline
+	err := r.db.WithContext(ctx).
+		Where("symbol = ? AND interval = ? AND open_time >= ? AND open_time < ?", symbol, interval, start, end).
+		Order("open_time").
+		Find(&klines).Error
+	if err != nil {
+		return nil, err
+	}
+	return klines, nil
+}
+
+func (r *klineRepo) FindRanges(ctx context.Context, symbol, interval string, start, end int64) ([]entity.KlineRange, error) {
+	var ranges []entity.KlineRange
+	err := r.db.WithContext(ctx).
+		Where("symbol = ? AND interval = ? AND start_time < ? AND end_time > ?", symbol, interval, end, start).
+		Order("start_time").
+		Find(&ranges).Error
+	if err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
+
+func (r *klineRepo) SaveKlines(ctx context.Context, symbol, interval string, start, end int64, klines []entity.Kline) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(klines) > 0 {
+			// 重复的K线以新数据为准
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "symbol"}, {Name: "interval"}, {Name: "open_time"}},
+				DoUpdates: clause.AssignmentColumns([]string{"close_time", "open", "high", "low", "close", "volume", "quote_volume"}),
+			}).CreateInBatches(klines, 100).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		// 合并重叠或相邻的范围
+		var overlaps []entity.KlineRange
+		err := tx.Where("symbol = ? AND interval = ? AND start_time <= ? AND end_time >= ?", symbol, interval, end, start).
+			Find(&overlaps).Error
+		if err != nil {
+			return err
+		}
+		merged := entity.KlineRange{Symbol: symbol, Interval: interval, StartTime: start, EndTime: end}
+		ids := make([]int64, 0, len(overlaps))
+		for _, o := range overlaps {
+			merged.StartTime = min(merged.StartTime, o.StartTime)
+			merged.EndTime = max(merged.EndTime, o.EndTime)
+			ids = append(ids, o.Id)
+		}
+		if len(ids) > 0 {
+			if err := tx.Delete(&entity.KlineRange{}, ids).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&merged).Error
+	})
+}
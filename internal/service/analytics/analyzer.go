@@ -3,6 +3,8 @@ package analytics
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/KNICEX/trading-agent/internal/service/exchange"
@@ -21,15 +23,97 @@ type Analyzer struct {
 	accountSvc  exchange.AccountService
 	marketSvc   exchange.MarketService
 	positionSvc exchange.PositionService
+
+	mu             sync.Mutex
+	initialBalance decimal.Decimal
+	startTime      time.Time
+	equity         []EquityPoint
 }
 
+// Initialize 记录初始资金，开始新一轮统计
 func (a *Analyzer) Initialize(ctx context.Context) error {
 	// 获取账户初始资金
+	account, err := a.accountSvc.GetAccountInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("get initial account info failed: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.initialBalance = account.TotalBalance.Add(account.UnrealizedPnl)
+	a.startTime = time.Time{}
+	a.equity = nil
+	return nil
+}
+
+// RecordEquity 记录一个资金曲线点（账户权益 = 钱包余额 + 未实现盈亏）
+// 回测时每根K线调用一次，多个策略并发调用是安全的；与上一个点时间相同时覆盖上一个点
+func (a *Analyzer) RecordEquity(ctx context.Context, timestamp time.Time) error {
+	account, err := a.accountSvc.GetAccountInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("get account info failed: %w", err)
+	}
+	positions, err := a.positionSvc.GetActivePositions(ctx, []exchange.TradingPair{})
+	if err != nil {
+		return fmt.Errorf("get active positions failed: %w", err)
+	}
+
+	equity := account.TotalBalance.Add(account.UnrealizedPnl)
+	// 杠杆 = 持仓名义价值 / 账户权益
+	notional := decimal.Zero
+	for _, position := range positions {
+		notional = notional.Add(position.Quantity.Mul(position.MarkPrice).Abs())
+	}
+	leverage := decimal.Zero
+	if equity.IsPositive() {
+		leverage = notional.Div(equity)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.startTime.IsZero() || timestamp.Before(a.startTime) {
+		a.startTime = timestamp
+	}
+	point := EquityPoint{
+		Timestamp: timestamp,
+		Balance:   equity,
+		Leverage:  leverage,
+	}
+	if n := len(a.equity); n > 0 && a.equity[n-1].Timestamp.Equal(timestamp) {
+		a.equity[n-1] = point
+		return nil
+	}
+	a.equity = append(a.equity, point)
 	return nil
 }
 
+// Analyze 根据资金曲线和历史仓位生成报告
 func (a *Analyzer) Analyze(ctx context.Context) (Report, error) {
-	return Report{}, nil
+	histories, err := a.positionSvc.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{})
+	if err != nil {
+		return Report{}, fmt.Errorf("get history positions failed: %w", err)
+	}
+
+	a.mu.Lock()
+	initialBalance := a.initialBalance
+	startTime := a.startTime
+	equity := append([]EquityPoint(nil), a.equity...)
+	a.mu.Unlock()
+
+	endTime := startTime
+	for _, point := range equity {
+		if point.Timestamp.After(endTime) {
+			endTime = point.Timestamp
+		}
+	}
+
+	return BuildReport(ReportInput{
+		InitialBalance: initialBalance,
+		StartTime:      startTime,
+		EndTime:        endTime,
+		Equity:         equity,
+		Histories:      histories,
+	}), nil
 }
 
 // ========== 性能报告（输出结果）==========
@@ -123,11 +207,14 @@ type RiskMetrics struct {
 
 	MaxLeverage decimal.Decimal
 	AvgLeverage decimal.Decimal
+
+	Liquidations int // 强平次数
 }
 
 // EquityPoint 资金曲线点
 type EquityPoint struct {
 	Timestamp time.Time
 	Balance   decimal.Decimal
-	Drawdown  decimal.Decimal
+	Drawdown  decimal.Decimal // 距离前高的回撤百分比
+	Leverage  decimal.Decimal // 持仓名义价值 / 账户权益
 }
@@ -0,0 +1,394 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+)
+
+// 加密货币 7x24 交易，按自然年年化
+const yearDuration = 365 * 24 * time.Hour
+
+// ReportInput 生成报告所需的原始数据
+type ReportInput struct {
+	StrategyName   string
+	TradingPair    exchange.TradingPair
+	InitialBalance decimal.Decimal
+	StartTime      time.Time
+	EndTime        time.Time
+	Equity         []EquityPoint
+	Histories      []exchange.PositionHistory
+}
+
+// BuildReport 由资金曲线和历史仓位计算完整报告
+// 纯函数，不依赖交易所，回测、分段回测都可以复用
+func BuildReport(input ReportInput) Report {
+	equity := normalizeEquity(input.Equity)
+
+	trades := make([]exchange.PositionHistory, 0, len(input.Histories))
+	for _, h := range input.Histories {
+		// 只统计已平仓的仓位
+		if !h.ClosedAt.IsZero() {
+			trades = append(trades, h)
+		}
+	}
+
+	report := Report{
+		StrategyName: input.StrategyName,
+		TradingPair:  input.TradingPair,
+		StartTime:    input.StartTime,
+		EndTime:      input.EndTime,
+		Duration:     input.EndTime.Sub(input.StartTime),
+		Equity:       equity,
+		Events:       collectEvents(trades),
+		GeneratedAt:  time.Now(),
+	}
+
+	returns := periodReturns(equity)
+	periodsPerYear := estimatePeriodsPerYear(equity)
+
+	report.Risk = computeRiskMetrics(equity, returns, periodsPerYear)
+	report.Risk.Liquidations = countLiquidations(trades)
+	report.Account = computeAccountMetrics(input.InitialBalance, equity, returns, periodsPerYear, report.Duration, report.Risk)
+	report.Trading = computeTradingMetrics(trades, report.Duration)
+	return report
+}
+
+// normalizeEquity 按时间排序并计算每个点的回撤
+func normalizeEquity(points []EquityPoint) []EquityPoint {
+	equity := append([]EquityPoint(nil), points...)
+	sort.SliceStable(equity, func(i, j int) bool {
+		return equity[i].Timestamp.Before(equity[j].Timestamp)
+	})
+
+	peak := decimal.Zero
+	for i := range equity {
+		if equity[i].Balance.GreaterThan(peak) {
+			peak = equity[i].Balance
+		}
+		equity[i].Drawdown = decimal.Zero
+		if peak.IsPositive() {
+			equity[i].Drawdown = peak.Sub(equity[i].Balance).Div(peak)
+		}
+	}
+	return equity
+}
+
+// periodReturns 资金曲线的逐期收益率
+func periodReturns(equity []EquityPoint) []float64 {
+	if len(equity) < 2 {
+		return nil
+	}
+	returns := make([]float64, 0, len(equity)-1)
+	for i := 1; i < len(equity); i++ {
+		prev := equity[i-1].Balance.InexactFloat64()
+		if prev <= 0 {
+			continue
+		}
+		returns = append(returns, equity[i].Balance.InexactFloat64()/prev-1)
+	}
+	return returns
+}
+
+// estimatePeriodsPerYear 用资金曲线采样间隔的中位数估算每年的期数
+func estimatePeriodsPerYear(equity []EquityPoint) float64 {
+	if len(equity) < 2 {
+		return 0
+	}
+	gaps := make([]time.Duration, 0, len(equity)-1)
+	for i := 1; i < len(equity); i++ {
+		if gap := equity[i].Timestamp.Sub(equity[i-1].Timestamp); gap > 0 {
+			gaps = append(gaps, gap)
+		}
+	}
+	if len(gaps) == 0 {
+		return 0
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+	return float64(yearDuration) / float64(gaps[len(gaps)/2])
+}
+
+func computeAccountMetrics(initialBalance decimal.Decimal, equity []EquityPoint, returns []float64, periodsPerYear float64, duration time.Duration, risk RiskMetrics) AccountMetrics {
+	metrics := AccountMetrics{
+		InitialBalance: initialBalance,
+		FinalBalance:   initialBalance,
+		PeakBalance:    initialBalance,
+	}
+	for _, point := range equity {
+		if point.Balance.GreaterThan(metrics.PeakBalance) {
+			metrics.PeakBalance = point.Balance
+		}
+	}
+	if len(equity) > 0 {
+		metrics.FinalBalance = equity[len(equity)-1].Balance
+	}
+
+	metrics.TotalPnL = metrics.FinalBalance.Sub(initialBalance)
+	if initialBalance.IsPositive() {
+		metrics.TotalReturn = metrics.TotalPnL.Div(initialBalance)
+	}
+
+	// 年化收益率：(期末/期初)^(1/年数) - 1
+	if initialBalance.IsPositive() && duration > 0 {
+		ratio := metrics.FinalBalance.Div(initialBalance).InexactFloat64()
+		years := float64(duration) / float64(yearDuration)
+		if ratio > 0 {
+			metrics.CAGR = floatDecimal(math.Pow(ratio, 1/years) - 1)
+		} else {
+			metrics.CAGR = decimal.NewFromInt(-1)
+		}
+	}
+
+	// 夏普/索提诺：无风险利率按 0 计算
+	mean, std := meanStd(returns)
+	annualFactor := math.Sqrt(periodsPerYear)
+	if std > 0 {
+		metrics.SharpeRatio = floatDecimal(mean / std * annualFactor)
+	}
+	if downside := downsideDeviation(returns); downside > 0 {
+		metrics.SortinoRatio = floatDecimal(mean / downside * annualFactor)
+	}
+	if risk.MaxDrawdownPercent.IsPositive() {
+		metrics.CalmarRatio = metrics.CAGR.Div(risk.MaxDrawdownPercent)
+	}
+	return metrics
+}
+
+func computeRiskMetrics(equity []EquityPoint, returns []float64, periodsPerYear float64) RiskMetrics {
+	metrics := RiskMetrics{}
+
+	// 回撤：逐点计算，回撤区间从前高开始到重新创新高结束
+	peak := decimal.Zero
+	var peakTime time.Time
+	inDrawdown := false
+	episodeMax := decimal.Zero
+	var episodes []decimal.Decimal
+	for _, point := range equity {
+		if point.Balance.GreaterThanOrEqual(peak) {
+			if inDrawdown {
+				episodes = append(episodes, episodeMax)
+				if d := point.Timestamp.Sub(peakTime); d > metrics.MaxDrawdownDuration {
+					metrics.MaxDrawdownDuration = d
+				}
+				inDrawdown = false
+				episodeMax = decimal.Zero
+			}
+			peak = point.Balance
+			peakTime = point.Timestamp
+			continue
+		}
+
+		inDrawdown = true
+		if dd := peak.Sub(point.Balance); dd.GreaterThan(metrics.MaxDrawdown) {
+			metrics.MaxDrawdown = dd
+		}
+		if point.Drawdown.GreaterThan(metrics.MaxDrawdownPercent) {
+			metrics.MaxDrawdownPercent = point.Drawdown
+		}
+		if point.Drawdown.GreaterThan(episodeMax) {
+			episodeMax = point.Drawdown
+		}
+	}
+	if inDrawdown {
+		// 到回测结束仍未恢复
+		episodes = append(episodes, episodeMax)
+		if d := equity[len(equity)-1].Timestamp.Sub(peakTime); d > metrics.MaxDrawdownDuration {
+			metrics.MaxDrawdownDuration = d
+		}
+	}
+	if len(episodes) > 0 {
+		sum := decimal.Zero
+		for _, dd := range episodes {
+			sum = sum.Add(dd)
+		}
+		metrics.AvgDrawdown = sum.Div(decimal.NewFromInt(int64(len(episodes))))
+	}
+
+	// 波动率（年化）和下行偏差（年化）
+	_, std := meanStd(returns)
+	annualFactor := math.Sqrt(periodsPerYear)
+	metrics.Volatility = floatDecimal(std * annualFactor)
+	metrics.DownsideDeviation = floatDecimal(downsideDeviation(returns) * annualFactor)
+
+	// 历史模拟法 VaR/CVaR，以正数表示单期损失比例
+	metrics.VaR95, metrics.CVaR95 = historicalVaR(returns, 0.95)
+
+	// 杠杆
+	if len(equity) > 0 {
+		sum := decimal.Zero
+		for _, point := range equity {
+			sum = sum.Add(point.Leverage)
+			if point.Leverage.GreaterThan(metrics.MaxLeverage) {
+				metrics.MaxLeverage = point.Leverage
+			}
+		}
+		metrics.AvgLeverage = sum.Div(decimal.NewFromInt(int64(len(equity))))
+	}
+	return metrics
+}
+
+func computeTradingMetrics(trades []exchange.PositionHistory, duration time.Duration) TradingMetrics {
+	metrics := TradingMetrics{TotalTrades: len(trades)}
+	if len(trades) == 0 {
+		return metrics
+	}
+
+	grossProfit, grossLoss := decimal.Zero, decimal.Zero
+	longWins, shortWins := 0, 0
+	var holdDuration time.Duration
+	for _, trade := range trades {
+		// 按净盈亏（扣除手续费、计入资金费）统计胜负
+		pnl := trade.NetPnl()
+		switch {
+		case pnl.IsPositive():
+			metrics.WinningTrades++
+			grossProfit = grossProfit.Add(pnl)
+			if pnl.GreaterThan(metrics.LargestWin) {
+				metrics.LargestWin = pnl
+			}
+		case pnl.IsNegative():
+			metrics.LosingTrades++
+			grossLoss = grossLoss.Add(pnl)
+			if pnl.LessThan(metrics.LargestLoss) {
+				metrics.LargestLoss = pnl
+			}
+		default:
+			metrics.BreakevenTrades++
+		}
+
+		if trade.PositionSide == exchange.PositionSideLong {
+			metrics.LongTrades++
+			if pnl.IsPositive() {
+				longWins++
+			}
+		} else {
+			metrics.ShortTrades++
+			if pnl.IsPositive() {
+				shortWins++
+			}
+		}
+		holdDuration += trade.ClosedAt.Sub(trade.OpenedAt)
+	}
+
+	metrics.WinRate = ratio(metrics.WinningTrades, metrics.TotalTrades)
+	metrics.LongWinRate = ratio(longWins, metrics.LongTrades)
+	metrics.ShortWinRate = ratio(shortWins, metrics.ShortTrades)
+	if metrics.WinningTrades > 0 {
+		metrics.AvgWin = grossProfit.Div(decimal.NewFromInt(int64(metrics.WinningTrades)))
+	}
+	if metrics.LosingTrades > 0 {
+		metrics.AvgLoss = grossLoss.Div(decimal.NewFromInt(int64(metrics.LosingTrades)))
+	}
+	// 没有亏损交易时盈亏比无意义，保持为 0
+	if grossLoss.IsNegative() {
+		metrics.ProfitFactor = grossProfit.Div(grossLoss.Abs())
+	}
+
+	metrics.AvgHoldDuration = holdDuration / time.Duration(len(trades))
+	if days := duration.Hours() / 24; days > 0 {
+		metrics.AvgTradesPerDay = floatDecimal(float64(len(trades)) / days)
+	}
+	return metrics
+}
+
+// countLiquidations 统计被强平的仓位数量
+func countLiquidations(trades []exchange.PositionHistory) int {
+	count := 0
+	for _, trade := range trades {
+		for _, event := range trade.Events {
+			if event.EventType == exchange.PositionEventTypeLiquidation {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// collectEvents 汇总所有仓位事件，按时间排序
+func collectEvents(trades []exchange.PositionHistory) []exchange.PositionEvent {
+	var events []exchange.PositionEvent
+	for _, trade := range trades {
+		events = append(events, trade.Events...)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+	return events
+}
+
+func meanStd(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	// 样本标准差
+	variance /= float64(len(values) - 1)
+	return mean, math.Sqrt(variance)
+}
+
+// downsideDeviation 下行偏差：只统计负收益（目标收益为 0）
+func downsideDeviation(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		if v < 0 {
+			sum += v * v
+		}
+	}
+	return math.Sqrt(sum / float64(len(values)))
+}
+
+// historicalVaR 历史模拟法计算 VaR 和 CVaR
+func historicalVaR(returns []float64, confidence float64) (decimal.Decimal, decimal.Decimal) {
+	if len(returns) == 0 {
+		return decimal.Zero, decimal.Zero
+	}
+	sorted := append([]float64(nil), returns...)
+	sort.Float64s(sorted)
+
+	tail := int(math.Floor(float64(len(sorted)) * (1 - confidence)))
+	if tail < 1 {
+		tail = 1
+	}
+	varValue := -sorted[tail-1]
+
+	sum := 0.0
+	for _, r := range sorted[:tail] {
+		sum += r
+	}
+	cvarValue := -sum / float64(tail)
+
+	return floatDecimal(math.Max(varValue, 0)), floatDecimal(math.Max(cvarValue, 0))
+}
+
+func ratio(part, total int) decimal.Decimal {
+	if total == 0 {
+		return decimal.Zero
+	}
+	return decimal.NewFromInt(int64(part)).Div(decimal.NewFromInt(int64(total)))
+}
+
+func floatDecimal(v float64) decimal.Decimal {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return decimal.Zero
+	}
+	return decimal.NewFromFloat(v)
+}
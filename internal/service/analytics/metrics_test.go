@@ -0,0 +1,156 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func equityCurve(start time.Time, step time.Duration, balances ...float64) []EquityPoint {
+	points := make([]EquityPoint, 0, len(balances))
+	for i, b := range balances {
+		points = append(points, EquityPoint{
+			Timestamp: start.Add(time.Duration(i) * step),
+			Balance:   decimal.NewFromFloat(b),
+		})
+	}
+	return points
+}
+
+func trade(side exchange.PositionSide, pnl float64, openedAt time.Time, hold time.Duration) exchange.PositionHistory {
+	return exchange.PositionHistory{
+		PositionSide: side,
+		RealizedPnl:  decimal.NewFromFloat(pnl),
+		OpenedAt:     openedAt,
+		ClosedAt:     openedAt.Add(hold),
+	}
+}
+
+// TestBuildReport_Drawdown 测试回撤金额、百分比和持续时间
+func TestBuildReport_Drawdown(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 峰值 1200 → 谷底 900（回撤 25%），第 6 个点恢复到 1250
+	equity := equityCurve(start, time.Hour, 1000, 1200, 1100, 900, 1000, 1250, 1200)
+
+	report := BuildReport(ReportInput{
+		InitialBalance: decimal.NewFromInt(1000),
+		StartTime:      start,
+		EndTime:        start.Add(6 * time.Hour),
+		Equity:         equity,
+	})
+
+	assert.True(t, report.Risk.MaxDrawdown.Equal(decimal.NewFromInt(300)), "max drawdown: %s", report.Risk.MaxDrawdown)
+	assert.True(t, report.Risk.MaxDrawdownPercent.Equal(decimal.NewFromFloat(0.25)), "max drawdown percent: %s", report.Risk.MaxDrawdownPercent)
+	// 从 1200 的峰值（第 1 小时）到恢复（第 5 小时）
+	assert.Equal(t, 4*time.Hour, report.Risk.MaxDrawdownDuration)
+
+	assert.True(t, report.Account.PeakBalance.Equal(decimal.NewFromInt(1250)))
+	assert.True(t, report.Account.FinalBalance.Equal(decimal.NewFromInt(1200)))
+	assert.True(t, report.Account.TotalReturn.Equal(decimal.NewFromFloat(0.2)))
+	assert.True(t, report.Equity[3].Drawdown.Equal(decimal.NewFromFloat(0.25)))
+}
+
+// TestBuildReport_ReturnsAndRatios 测试收益率类指标
+func TestBuildReport_ReturnsAndRatios(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 一年翻倍，按天采样
+	balances := make([]float64, 366)
+	for i := range balances {
+		balances[i] = 1000 * (1 + float64(i)/365)
+		if i%7 == 3 {
+			balances[i] -= 5
+		}
+	}
+	equity := equityCurve(start, 24*time.Hour, balances...)
+
+	report := BuildReport(ReportInput{
+		InitialBalance: decimal.NewFromInt(1000),
+		StartTime:      start,
+		EndTime:        start.Add(365 * 24 * time.Hour),
+		Equity:         equity,
+	})
+
+	assert.InDelta(t, 1.0, report.Account.CAGR.InexactFloat64(), 1e-6)
+	assert.True(t, report.Account.SharpeRatio.IsPositive())
+	assert.True(t, report.Account.SortinoRatio.GreaterThan(report.Account.SharpeRatio), "有回撤但以上涨为主，索提诺应高于夏普")
+	assert.True(t, report.Account.CalmarRatio.IsPositive())
+	assert.True(t, report.Risk.Volatility.IsPositive())
+	assert.True(t, report.Risk.VaR95.IsPositive())
+	assert.True(t, report.Risk.CVaR95.GreaterThanOrEqual(report.Risk.VaR95))
+}
+
+// TestBuildReport_TradingMetrics 测试交易统计
+func TestBuildReport_TradingMetrics(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	histories := []exchange.PositionHistory{
+		trade(exchange.PositionSideLong, 300, start, 2*time.Hour),
+		trade(exchange.PositionSideLong, -100, start.Add(3*time.Hour), 4*time.Hour),
+		trade(exchange.PositionSideShort, 200, start.Add(8*time.Hour), 6*time.Hour),
+		trade(exchange.PositionSideShort, -200, start.Add(15*time.Hour), 4*time.Hour),
+		trade(exchange.PositionSideShort, 0, start.Add(20*time.Hour), 4*time.Hour),
+		// 未平仓的仓位不统计
+		{PositionSide: exchange.PositionSideLong, OpenedAt: start.Add(30 * time.Hour)},
+	}
+
+	report := BuildReport(ReportInput{
+		InitialBalance: decimal.NewFromInt(1000),
+		StartTime:      start,
+		EndTime:        start.Add(48 * time.Hour),
+		Histories:      histories,
+	})
+
+	metrics := report.Trading
+	require.Equal(t, 5, metrics.TotalTrades)
+	assert.Equal(t, 2, metrics.WinningTrades)
+	assert.Equal(t, 2, metrics.LosingTrades)
+	assert.Equal(t, 1, metrics.BreakevenTrades)
+	assert.True(t, metrics.WinRate.Equal(decimal.NewFromFloat(0.4)))
+	assert.True(t, metrics.AvgWin.Equal(decimal.NewFromInt(250)))
+	assert.True(t, metrics.AvgLoss.Equal(decimal.NewFromInt(-150)))
+	// 500 / 300
+	assert.InDelta(t, 5.0/3.0, metrics.ProfitFactor.InexactFloat64(), 1e-9)
+	assert.True(t, metrics.LargestWin.Equal(decimal.NewFromInt(300)))
+	assert.True(t, metrics.LargestLoss.Equal(decimal.NewFromInt(-200)))
+	assert.Equal(t, 4*time.Hour, metrics.AvgHoldDuration)
+	assert.True(t, metrics.AvgTradesPerDay.Equal(decimal.NewFromFloat(2.5)))
+
+	assert.Equal(t, 2, metrics.LongTrades)
+	assert.Equal(t, 3, metrics.ShortTrades)
+	assert.True(t, metrics.LongWinRate.Equal(decimal.NewFromFloat(0.5)))
+	assert.InDelta(t, 1.0/3.0, metrics.ShortWinRate.InexactFloat64(), 1e-9)
+}
+
+// TestBuildReport_Empty 测试没有数据时不 panic
+func TestBuildReport_Empty(t *testing.T) {
+	report := BuildReport(ReportInput{InitialBalance: decimal.NewFromInt(1000)})
+	assert.Equal(t, 0, report.Trading.TotalTrades)
+	assert.True(t, report.Account.FinalBalance.Equal(decimal.NewFromInt(1000)))
+	assert.True(t, report.Risk.MaxDrawdown.IsZero())
+}
+
+// TestBuildReport_Liquidations 测试强平次数统计
+func TestBuildReport_Liquidations(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	liquidated := trade(exchange.PositionSideLong, -100, start, time.Hour)
+	liquidated.Events = []exchange.PositionEvent{
+		{EventType: exchange.PositionEventTypeCreate},
+		{EventType: exchange.PositionEventTypeLiquidation},
+	}
+	closed := trade(exchange.PositionSideShort, 50, start.Add(2*time.Hour), time.Hour)
+	closed.Events = []exchange.PositionEvent{
+		{EventType: exchange.PositionEventTypeCreate},
+		{EventType: exchange.PositionEventTypeClose},
+	}
+
+	report := BuildReport(ReportInput{
+		InitialBalance: decimal.NewFromInt(1000),
+		StartTime:      start,
+		EndTime:        start.Add(24 * time.Hour),
+		Histories:      []exchange.PositionHistory{liquidated, closed},
+	})
+	assert.Equal(t, 1, report.Risk.Liquidations)
+}
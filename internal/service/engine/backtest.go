@@ -3,7 +3,9 @@ package engine
 import (
 	"context"
 	"fmt"
+	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/KNICEX/trading-agent/internal/service/analytics"
@@ -15,13 +17,27 @@ import (
 
 var _ strategy.Context = (*BacktestContext)(nil)
 
+// LookAheadPolicy 策略读取模拟时钟之后的数据时的处理方式
+type LookAheadPolicy int
+
+const (
+	// LookAheadWarn 截断到模拟时钟并打印警告（默认）
+	LookAheadWarn LookAheadPolicy = iota
+	// LookAheadError 返回 strategy.ErrLookAhead
+	LookAheadError
+)
+
+// BacktestContext 回测策略上下文，所有数据都截止到模拟时钟，防止策略读取未来数据
 type BacktestContext struct {
 	tradingPair exchange.TradingPair
 	marketSvc   exchange.MarketService
 	positionSvc exchange.PositionService
+	lookAhead   LookAheadPolicy
 
 	clockMu sync.RWMutex
 	clock   time.Time
+
+	violations atomic.Int64
 }
 
 func NewBacktestContext(marketSvc exchange.MarketService, positionSvc exchange.PositionService) *BacktestContext {
@@ -31,17 +47,97 @@ func NewBacktestContext(marketSvc exchange.MarketService, positionSvc exchange.P
 	}
 }
 
+// SetFlattenAtEnd 设置回测结束时是否撤销挂单并市价平掉全部持仓（计入手续费和滑点），默认不平仓
+func (e *BacktestEngine) SetFlattenAtEnd(flatten bool) {
+	e.flatten = flatten
+}
+
+// SetLookAheadPolicy 设置读取未来数据时的处理方式
+func (c *BacktestContext) SetLookAheadPolicy(policy LookAheadPolicy) {
+	c.lookAhead = policy
+}
+
+// GetKlines 获取模拟时钟之前已经收盘的K线
+// EndTime 为空时截断到当前时间，晚于当前时间时按 LookAheadPolicy 处理
 func (c *BacktestContext) GetKlines(ctx context.Context, req strategy.GetKlinesReq) ([]exchange.Kline, error) {
-	return c.marketSvc.GetKlines(ctx, exchange.GetKlinesReq{
-		TradingPair: c.tradingPair,
+	now := c.Now()
+	endTime := req.EndTime
+	if endTime.IsZero() {
+		endTime = now
+	}
+	if endTime.After(now) {
+		if err := c.lookAheadViolation("klines until %s", endTime.Format(time.RFC3339)); err != nil {
+			return nil, err
+		}
+		endTime = now
+	}
+	if req.StartTime.After(endTime) {
+		if err := c.lookAheadViolation("klines from %s", req.StartTime.Format(time.RFC3339)); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	klines, err := c.marketSvc.GetKlines(ctx, exchange.GetKlinesReq{
+		TradingPair: c.klinePair(req),
 		Interval:    req.Interval,
 		StartTime:   req.StartTime,
-		EndTime:     req.EndTime,
+		EndTime:     endTime,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return closedKlines(klines, now), nil
+}
+
+// closedKlines 去掉 now 时还没收盘的K线（例如在 5m 策略里读取 1h K线时当前这一小时的K线）
+// 返回新的切片，klines 可能是K线提供器的缓存，不能原地修改
+func closedKlines(klines []exchange.Kline, now time.Time) []exchange.Kline {
+	closed := make([]exchange.Kline, 0, len(klines))
+	for _, kline := range klines {
+		if !kline.CloseTime.After(now) {
+			closed = append(closed, kline)
+		}
+	}
+	return closed
 }
 
+// GetPositions 获取当前持仓，不包含模拟时钟之后才开的仓位
 func (c *BacktestContext) GetPositions(ctx context.Context) ([]exchange.Position, error) {
-	return c.positionSvc.GetActivePositions(ctx, []exchange.TradingPair{})
+	positions, err := c.positionSvc.GetActivePositions(ctx, []exchange.TradingPair{})
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.Now()
+	visible := make([]exchange.Position, 0, len(positions))
+	for _, position := range positions {
+		if position.CreatedAt.After(now) {
+			if err := c.lookAheadViolation("position %s %s opened at %s", position.TradingPair.ToString(), position.PositionSide, position.CreatedAt.Format(time.RFC3339)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		visible = append(visible, position)
+	}
+	return visible, nil
+}
+
+// LookAheadViolations 策略尝试读取未来数据的次数
+func (c *BacktestContext) LookAheadViolations() int64 {
+	return c.violations.Load()
+}
+
+// lookAheadViolation 记录一次读取未来数据，LookAheadError 时返回错误
+func (c *BacktestContext) lookAheadViolation(format string, args ...any) error {
+	c.violations.Add(1)
+	detail := fmt.Sprintf(format, args...)
+	if c.lookAhead == LookAheadError {
+		return fmt.Errorf("%w: %s, now %s", strategy.ErrLookAhead, detail, c.Now().Format(time.RFC3339))
+	}
+	log.Printf("[backtest] look-ahead %s: %s after now %s, clamped", c.tradingPair.ToString(), detail, c.Now().Format(time.RFC3339))
+	return nil
 }
 
 func (c *BacktestContext) Now() time.Time {
@@ -60,6 +156,14 @@ func (c *BacktestContext) TradingPair() exchange.TradingPair {
 	return c.tradingPair
 }
 
+// klinePair 请求的交易对，为空时使用策略的主交易对
+func (c *BacktestContext) klinePair(req strategy.GetKlinesReq) exchange.TradingPair {
+	if req.TradingPair.IsZero() {
+		return c.tradingPair
+	}
+	return req.TradingPair
+}
+
 type BacktestEngine struct {
 	exchangeSvc exchange.Service
 
@@ -70,6 +174,12 @@ type BacktestEngine struct {
 
 	startTime time.Time
 	endTime   time.Time
+	lookAhead LookAheadPolicy
+	quiet     bool // 不打印报告和执行日志（参数优化时大量回测）
+	flatten   bool // 回测结束时平掉全部持仓，期末资金不含未实现盈亏
+
+	reportMu sync.RWMutex
+	report   analytics.Report
 }
 
 func NewBacktestEngine(startTime, endTime time.Time, exchangeSvc exchange.Service) *BacktestEngine {
@@ -77,103 +187,201 @@ func NewBacktestEngine(startTime, endTime time.Time, exchangeSvc exchange.Servic
 		exchangeSvc: exchangeSvc,
 		startTime:   startTime,
 		endTime:     endTime,
-		executor: &Executor{
-			tradingSvc:  exchange.NewTradingService(exchangeSvc, &backtest.PercisionProvider{}),
-			orderSvc:    exchangeSvc.OrderService(),
-			positionSvc: exchangeSvc.PositionService(),
-		},
+	}
+}
+
+// symbolRulesSource 可以提供交易对规则的交易所（backtest.ExchangeService）
+type symbolRulesSource interface {
+	SymbolRulesProvider() exchange.SymbolRulesProvider
+}
+
+// symbolRulesProvider 执行器使用的交易对规则，与交易所校验订单的规则一致，
+// 交易所没有设置规则时使用默认的数量精度
+func (e *BacktestEngine) symbolRulesProvider() exchange.SymbolRulesProvider {
+	if source, ok := e.exchangeSvc.(symbolRulesSource); ok {
+		if provider := source.SymbolRulesProvider(); provider != nil {
+			return provider
+		}
+	}
+	return &backtest.PercisionProvider{}
+}
+
+// SetLookAheadPolicy 设置策略读取模拟时钟之后的数据时的处理方式，默认截断并打印警告
+func (e *BacktestEngine) SetLookAheadPolicy(policy LookAheadPolicy) {
+	e.lookAhead = policy
+}
+
+// newContext 创建策略上下文，时钟从回测开始时间起步
+func (e *BacktestEngine) newContext(sg strategy.Strategy) *BacktestContext {
+	return &BacktestContext{
+		tradingPair: sg.TradingPair(),
+		marketSvc:   e.exchangeSvc.MarketService(),
+		positionSvc: e.exchangeSvc.PositionService(),
+		lookAhead:   e.lookAhead,
+		clock:       e.startTime,
 	}
 }
 
 func (e *BacktestEngine) Run(ctx context.Context) error {
+	r, ok := e.exchangeSvc.(replayer)
+	if !ok {
+		return fmt.Errorf("backtest engine requires an exchange that supports replay, got %T", e.exchangeSvc)
+	}
+	// 在 Run 时读取规则，交易所可以在创建引擎之后再设置规则
+	e.executor = NewExecutor(e.exchangeSvc, e.symbolRulesProvider())
+	e.executor.SetQuiet(e.quiet)
+
 	analyzer := analytics.NewAnalyzer(e.exchangeSvc)
 	err := analyzer.Initialize(ctx)
 	if err != nil {
 		return err
 	}
+	// 资金曲线起点
+	if err := analyzer.RecordEquity(ctx, e.startTime); err != nil {
+		return err
+	}
+
+	if err := e.runReplay(ctx, r, analyzer); err != nil {
+		return err
+	}
+	if e.flatten {
+		if err := e.flattenPositions(ctx, analyzer); err != nil {
+			return err
+		}
+	}
+
+	report, err := analyzer.Analyze(ctx)
+	if err != nil {
+		return err
+	}
+	if len(e.strategies) == 1 {
+		report.StrategyName = e.strategies[0].Name()
+		report.TradingPair = e.strategies[0].TradingPair()
+	}
+	if !e.quiet {
+		fmt.Println(report.String())
+	}
+
+	e.reportMu.Lock()
+	e.report = report
+	e.reportMu.Unlock()
+
+	return nil
+}
+
+// replayer 支持确定性回放的回测交易所（backtest.ExchangeService），回测引擎只通过回放驱动策略
+type replayer interface {
+	Replay(ctx context.Context, subs []backtest.KlineSubscription, handler backtest.ReplayHandler) error
+}
+
+// flattener 可以一次平掉全部持仓的回测交易所（backtest.ExchangeService）
+type flattener interface {
+	Flatten(ctx context.Context) error
+}
+
+// flattenPositions 回测结束时平掉全部持仓，并在结束时间记录平仓后的权益
+func (e *BacktestEngine) flattenPositions(ctx context.Context, analyzer *analytics.Analyzer) error {
+	f, ok := e.exchangeSvc.(flattener)
+	if !ok {
+		return fmt.Errorf("flatten at end requires an exchange that supports Flatten, got %T", e.exchangeSvc)
+	}
+	if err := f.Flatten(ctx); err != nil {
+		return fmt.Errorf("flatten positions failed: %w", err)
+	}
+	return analyzer.RecordEquity(ctx, e.endTime)
+}
 
-	wg := sync.WaitGroup{}
+// runReplay 使用交易所的模拟时钟按时间顺序回放所有策略的K线，同一输入总是得到相同结果
+func (e *BacktestEngine) runReplay(ctx context.Context, r replayer, analyzer *analytics.Analyzer) error {
+	handler := &backtestReplayHandler{engine: e, analyzer: analyzer}
+	subs := make([]backtest.KlineSubscription, 0, len(e.strategies))
 	for _, sg := range e.strategies {
+		sgCtx := e.newContext(sg)
+		if err := sg.Initialize(ctx, sgCtx); err != nil {
+			fmt.Printf("initialize strategy %s error: %v\n", sg.Name(), err)
+			continue
+		}
+		sgSubs := strategy.SubscriptionsOf(sg)
+		handler.strategies = append(handler.strategies, replayStrategy{strategy: sg, ctx: sgCtx, subs: sgSubs})
+		for _, sub := range sgSubs {
+			subs = append(subs, backtest.KlineSubscription{TradingPair: sub.TradingPair, Interval: sub.Interval})
+		}
+	}
 
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			sgCtx := &BacktestContext{
-				tradingPair: sg.TradingPair(),
-				marketSvc:   e.exchangeSvc.MarketService(),
-				positionSvc: e.exchangeSvc.PositionService(),
-				clock:       e.startTime,
-			}
+	return r.Replay(ctx, subs, handler)
+}
 
-			err := sg.Initialize(ctx, sgCtx)
-			if err != nil {
-				return
-			}
-			klineChan, err := e.exchangeSvc.MarketService().
-				SubscribeKline(ctx, sg.TradingPair(), sg.Interval())
-			if err != nil {
-				return
-			}
+type replayStrategy struct {
+	strategy strategy.Strategy
+	ctx      *BacktestContext
+	subs     []strategy.Subscription
+}
 
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case kline, ok := <-klineChan:
-					if !ok {
-						return
-					}
-					// 更新ctx时钟
-					sgCtx.setTime(kline.CloseTime)
-
-					if kline.CloseTime.After(e.endTime) {
-						// 结束回测，生成报告
-						return
-					}
-					signal, err := sg.OnKline(context.Background(), kline)
-					if err != nil {
-						continue
-					}
-
-					if signal.Action == strategy.SignalActionHold {
-						// do nothing
-						continue
-					}
-
-					fmt.Println("signal", signal)
-
-					enhancedSignal, err := e.positionSizer.HandleSignal(context.Background(), signal)
-					if err != nil {
-						continue
-					}
-
-					if !enhancedSignal.Validated {
-						fmt.Println("enhancedSignal not validated", enhancedSignal.Reason)
-						continue
-					}
-
-					err = e.executor.Execute(context.Background(), enhancedSignal.EnhancedSignal)
-					if err != nil {
-						fmt.Println("execute error", err)
-						continue
-					}
-
-				}
-			}
-		}()
+// subscribed 策略是否订阅了这一路K线
+func (s replayStrategy) subscribed(sub strategy.Subscription) bool {
+	for _, sgSub := range s.subs {
+		if sgSub == sub {
+			return true
+		}
 	}
+	return false
+}
 
-	wg.Wait()
+// backtestReplayHandler 把回放的K线分发给订阅的策略，同一根K线按添加顺序依次调用
+type backtestReplayHandler struct {
+	engine     *BacktestEngine
+	analyzer   *analytics.Analyzer
+	strategies []replayStrategy
+}
 
-	report, err := analyzer.Analyze(ctx)
-	if err != nil {
-		return err
+func (h *backtestReplayHandler) OnKline(ctx context.Context, sub backtest.KlineSubscription, kline exchange.Kline) error {
+	if kline.CloseTime.After(h.engine.endTime) {
+		return nil
+	}
+	sgSub := strategy.Subscription{TradingPair: sub.TradingPair, Interval: sub.Interval}
+	for _, s := range h.strategies {
+		if !s.subscribed(sgSub) {
+			continue
+		}
+		s.ctx.setTime(kline.CloseTime)
+		h.engine.handleKline(ctx, s.strategy, sgSub, kline)
 	}
-	fmt.Println(report.String())
+	return nil
+}
 
+// OnTick 同一时刻的K线处理完之后记录一次资金曲线
+func (h *backtestReplayHandler) OnTick(ctx context.Context, t time.Time) error {
+	if t.After(h.engine.endTime) {
+		return nil
+	}
+	if err := h.analyzer.RecordEquity(ctx, t); err != nil {
+		fmt.Println("record equity error", err)
+	}
 	return nil
 }
 
+// handleKline 把一路K线交给策略处理并执行返回的信号
+func (e *BacktestEngine) handleKline(ctx context.Context, sg strategy.Strategy, sub strategy.Subscription, kline exchange.Kline) {
+	signals, err := strategySignals(ctx, sg, sub, kline)
+	if err != nil {
+		return
+	}
+	for _, signal := range signals {
+		if err := processSignal(ctx, e.positionSizer, e.executor, signal); err != nil {
+			if !e.quiet {
+				log.Printf("[backtest] strategy %s execute error: %v", sg.Name(), err)
+			}
+		}
+	}
+}
+
+// Report 返回最近一次 Run 生成的性能报告
+func (e *BacktestEngine) Report() analytics.Report {
+	e.reportMu.RLock()
+	defer e.reportMu.RUnlock()
+	return e.report
+}
+
 func (e *BacktestEngine) Stop(ctx context.Context) error {
 	return nil
 }
@@ -151,3 +151,320 @@ func TestBacktestEngine_WithBinanceData(t *testing.T) {
 	// 验证测试完成
 	assert.NotNil(t, accountInfo, "账户信息不应为空")
 }
+
+// TestBacktestEngine_ReplayDeterministic 测试回测引擎使用回放时钟，不等待且每次结果相同
+func TestBacktestEngine_ReplayDeterministic(t *testing.T) {
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	endTime := startTime.Add(24 * time.Hour)
+	pairs := []exchange.TradingPair{{Base: "BTC", Quote: "USDT"}, {Base: "ETH", Quote: "USDT"}}
+
+	run := func() ([]*countingStrategy, []string) {
+		provider := backtest.NewMockKlineProvider()
+		for _, pair := range pairs {
+			provider.GenerateKlines(pair, exchange.Interval5m, startTime, 1000, 288, "volatile")
+		}
+		exchangeSvc := backtest.NewExchangeService(startTime, endTime, decimal.NewFromInt(10000), provider)
+		engine := NewBacktestEngine(startTime, endTime, exchangeSvc)
+
+		var strategies []*countingStrategy
+		for _, pair := range pairs {
+			sg := &countingStrategy{pair: pair}
+			strategies = append(strategies, sg)
+			require.NoError(t, engine.AddStrategy(context.Background(), sg))
+		}
+		require.NoError(t, engine.Run(context.Background()))
+
+		var equity []string
+		for _, point := range engine.Report().Equity {
+			equity = append(equity, point.Timestamp.Format(time.RFC3339)+" "+point.Balance.String())
+		}
+		return strategies, equity
+	}
+
+	begin := time.Now()
+	strategies, first := run()
+	// 回放没有逐根等待
+	assert.Less(t, time.Since(begin), 2*time.Second)
+	for _, sg := range strategies {
+		assert.Equal(t, int64(288), sg.klines.Load())
+	}
+	// 起点 + 每个收盘时刻一个点
+	assert.Len(t, first, 289)
+
+	_, second := run()
+	assert.Equal(t, first, second)
+}
+
+// TestBacktestEngine_RequiresReplay 测试交易所不支持回放时 Run 直接返回错误，不会退回到订阅驱动
+func TestBacktestEngine_RequiresReplay(t *testing.T) {
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	endTime := startTime.Add(time.Hour)
+	exchangeSvc := backtest.NewExchangeService(startTime, endTime, decimal.NewFromInt(10000), backtest.NewMockKlineProvider())
+
+	// 只暴露 exchange.Service 接口，隐藏 Replay
+	engine := NewBacktestEngine(startTime, endTime, struct{ exchange.Service }{exchangeSvc})
+	require.NoError(t, engine.AddStrategy(context.Background(), &countingStrategy{pair: exchange.TradingPair{Base: "BTC", Quote: "USDT"}}))
+	err := engine.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "supports replay")
+}
+
+// TestBacktestEngine_FlattenAtEnd 测试回测结束时平掉持仓：期末资金已实现，持仓计入历史和交易统计
+func TestBacktestEngine_FlattenAtEnd(t *testing.T) {
+	ctx := context.Background()
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	interval := exchange.Interval5m
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	endTime := startTime.Add(6 * interval.Duration())
+
+	run := func(flatten bool) (*backtest.ExchangeService, *BacktestEngine) {
+		provider := backtest.NewMockKlineProvider()
+		provider.GenerateKlines(pair, interval, startTime, 100, 6, "up")
+		exchangeSvc := backtest.NewExchangeService(startTime, endTime, decimal.NewFromInt(10000), provider)
+		exchangeSvc.SetFeeSchedule(backtest.DefaultFeeSchedule())
+		require.NoError(t, exchangeSvc.SetLeverage(ctx, exchange.SetLeverageReq{TradingPair: pair, Leverage: 10}))
+
+		sizer := portfolio.NewSimplePositionSizer(exchangeSvc)
+		require.NoError(t, sizer.Initialize(ctx, portfolio.RiskConfig{
+			MaxStopLossRatio:    0.5,
+			MaxLeverage:         10,
+			ConfidenceThreshold: 0.6,
+		}))
+		// 第一根K线开多，之后一直持有
+		sg := &scriptedStrategy{
+			pair:     pair,
+			orderSvc: exchangeSvc.OrderService(),
+			signals: []strategy.Signal{
+				{Action: strategy.SignalActionLong, Confidence: 0.8, StopLoss: decimal.NewFromInt(90), TakeProfit: decimal.NewFromInt(200)},
+			},
+		}
+		engine := NewBacktestEngine(startTime, endTime, exchangeSvc)
+		engine.positionSizer = sizer
+		engine.SetFlattenAtEnd(flatten)
+		require.NoError(t, engine.AddStrategy(ctx, sg))
+		require.NoError(t, engine.Run(ctx))
+		return exchangeSvc, engine
+	}
+
+	// 默认不平仓：持仓留在交易所，期末资金按标记价格计算
+	exchangeSvc, engine := run(false)
+	positions, err := exchangeSvc.GetActivePositions(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	assert.Equal(t, 0, engine.Report().Trading.TotalTrades)
+	markToMarket := engine.Report().Account.FinalBalance
+
+	exchangeSvc, engine = run(true)
+	positions, err = exchangeSvc.GetActivePositions(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, positions)
+	orders, err := exchangeSvc.GetOrders(ctx, exchange.GetOrdersReq{})
+	require.NoError(t, err)
+	assert.Empty(t, orders, "take profit and stop loss should be cancelled")
+
+	report := engine.Report()
+	assert.Equal(t, 1, report.Trading.TotalTrades)
+	require.NotEmpty(t, report.Equity)
+	last := report.Equity[len(report.Equity)-1]
+	assert.Equal(t, endTime, last.Timestamp)
+	account, err := exchangeSvc.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Account.FinalBalance.Equal(account.TotalBalance), "%s != %s", report.Account.FinalBalance, account.TotalBalance)
+	// 平仓手续费计入期末资金
+	assert.True(t, report.Account.FinalBalance.LessThan(markToMarket), "%s should be less than %s", report.Account.FinalBalance, markToMarket)
+}
+
+// TestBacktestContext_LookAhead 测试策略上下文只返回模拟时钟之前已经收盘的数据
+func TestBacktestContext_LookAhead(t *testing.T) {
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	endTime := startTime.Add(24 * time.Hour)
+
+	provider := backtest.NewMockKlineProvider()
+	provider.GenerateKlines(pair, exchange.Interval5m, startTime, 1000, 288, "sideways")
+	provider.GenerateKlines(pair, exchange.Interval1h, startTime, 1000, 24, "sideways")
+	exchangeSvc := backtest.NewExchangeService(startTime, endTime, decimal.NewFromInt(10000), provider)
+
+	sgCtx := NewBacktestContext(exchangeSvc, exchangeSvc)
+	sgCtx.tradingPair = pair
+	// 第 6 根 5m K线刚收盘
+	sgCtx.setTime(startTime.Add(30 * time.Minute))
+	ctx := context.Background()
+
+	// EndTime 为空时截断到当前时间，不算读取未来数据
+	klines, err := sgCtx.GetKlines(ctx, strategy.GetKlinesReq{Interval: exchange.Interval5m, StartTime: startTime})
+	require.NoError(t, err)
+	assert.Len(t, klines, 6)
+	assert.Equal(t, int64(0), sgCtx.LookAheadViolations())
+
+	// 请求未来的K线时截断并记录
+	klines, err = sgCtx.GetKlines(ctx, strategy.GetKlinesReq{Interval: exchange.Interval5m, StartTime: startTime, EndTime: endTime})
+	require.NoError(t, err)
+	require.Len(t, klines, 6)
+	assert.False(t, klines[len(klines)-1].CloseTime.After(sgCtx.Now()))
+	assert.Equal(t, int64(1), sgCtx.LookAheadViolations())
+
+	// 当前这一小时的 1h K线还没收盘
+	klines, err = sgCtx.GetKlines(ctx, strategy.GetKlinesReq{Interval: exchange.Interval1h, StartTime: startTime})
+	require.NoError(t, err)
+	assert.Empty(t, klines)
+
+	// 严格模式返回错误
+	sgCtx.SetLookAheadPolicy(LookAheadError)
+	_, err = sgCtx.GetKlines(ctx, strategy.GetKlinesReq{Interval: exchange.Interval5m, StartTime: startTime, EndTime: endTime})
+	assert.ErrorIs(t, err, strategy.ErrLookAhead)
+	_, err = sgCtx.GetKlines(ctx, strategy.GetKlinesReq{Interval: exchange.Interval5m, StartTime: startTime.Add(time.Hour)})
+	assert.ErrorIs(t, err, strategy.ErrLookAhead)
+	assert.Equal(t, int64(3), sgCtx.LookAheadViolations())
+}
+
+// TestClosedKlines_KeepsInput 测试过滤未收盘K线时不修改传入的切片（可能是K线提供器的缓存）
+func TestClosedKlines_KeepsInput(t *testing.T) {
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	klines := []exchange.Kline{
+		{OpenTime: startTime.Add(-time.Hour), CloseTime: startTime.Add(-time.Minute)},
+		{OpenTime: startTime, CloseTime: startTime.Add(time.Hour)}, // 还没收盘
+		{OpenTime: startTime.Add(-2 * time.Hour), CloseTime: startTime.Add(-time.Hour)},
+	}
+	original := append([]exchange.Kline(nil), klines...)
+
+	closed := closedKlines(klines, startTime)
+	require.Len(t, closed, 2)
+	assert.Equal(t, original, klines)
+
+	closed[0].Close = decimal.NewFromInt(1)
+	assert.True(t, klines[0].Close.IsZero())
+}
+
+// basketStrategy 订阅 BTC 5m、BTC 1h 和 ETH 5m，用 1h 收盘确认后在 ETH 上开仓
+type basketStrategy struct {
+	btc, eth    exchange.TradingPair
+	strategyCtx strategy.Context
+
+	counts       map[strategy.Subscription]int
+	hourlyClosed []bool // 每次收到 1h K线时是否能通过 Context 读取到它
+	signalSent   bool
+}
+
+func (s *basketStrategy) Name() string                      { return "basket_strategy" }
+func (s *basketStrategy) TradingPair() exchange.TradingPair { return s.btc }
+func (s *basketStrategy) Interval() exchange.Interval       { return exchange.Interval5m }
+func (s *basketStrategy) Initialize(ctx context.Context, strategyCtx strategy.Context) error {
+	s.strategyCtx = strategyCtx
+	s.counts = make(map[strategy.Subscription]int)
+	return nil
+}
+func (s *basketStrategy) OnKline(ctx context.Context, kline exchange.Kline) (strategy.Signal, error) {
+	panic("multi stream strategy should receive OnStreamKline")
+}
+func (s *basketStrategy) Shutdown(ctx context.Context) error { return nil }
+
+func (s *basketStrategy) Subscriptions() []strategy.Subscription {
+	return []strategy.Subscription{
+		{TradingPair: s.btc, Interval: exchange.Interval5m},
+		{TradingPair: s.btc, Interval: exchange.Interval1h},
+		{TradingPair: s.eth, Interval: exchange.Interval5m},
+	}
+}
+
+func (s *basketStrategy) OnStreamKline(ctx context.Context, sub strategy.Subscription, kline exchange.Kline) ([]strategy.Signal, error) {
+	s.counts[sub]++
+	if sub.Interval != exchange.Interval1h {
+		return nil, nil
+	}
+
+	klines, err := s.strategyCtx.GetKlines(ctx, strategy.GetKlinesReq{
+		TradingPair: s.btc,
+		Interval:    exchange.Interval1h,
+		StartTime:   kline.OpenTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.hourlyClosed = append(s.hourlyClosed, len(klines) == 1 && klines[0].OpenTime.Equal(kline.OpenTime))
+
+	if s.signalSent {
+		return nil, nil
+	}
+	s.signalSent = true
+	return []strategy.Signal{
+		{TradingPair: s.eth, Action: strategy.SignalActionLong, Confidence: 0.8, StopLoss: decimal.NewFromInt(950), Timestamp: kline.CloseTime},
+		// 没有订阅的交易对的信号被丢弃
+		{TradingPair: exchange.TradingPair{Base: "SOL", Quote: "USDT"}, Action: strategy.SignalActionLong, Confidence: 0.8, StopLoss: decimal.NewFromInt(1)},
+	}, nil
+}
+
+// TestBacktestEngine_MultiStream 测试多交易对、多周期策略：按订阅分发K线，可以为其他交易对发出信号
+func TestBacktestEngine_MultiStream(t *testing.T) {
+	ctx := context.Background()
+	btc := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	eth := exchange.TradingPair{Base: "ETH", Quote: "USDT"}
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	endTime := startTime.Add(6 * time.Hour)
+
+	provider := backtest.NewMockKlineProvider()
+	provider.GenerateKlines(btc, exchange.Interval5m, startTime, 50000, 72, "sideways")
+	provider.GenerateKlines(btc, exchange.Interval1h, startTime, 50000, 6, "sideways")
+	provider.GenerateKlines(eth, exchange.Interval5m, startTime, 1000, 72, "sideways")
+	exchangeSvc := backtest.NewExchangeService(startTime, endTime, decimal.NewFromInt(10000), provider)
+	require.NoError(t, exchangeSvc.SetLeverage(ctx, exchange.SetLeverageReq{TradingPair: eth, Leverage: 20}))
+
+	sizer := portfolio.NewSimplePositionSizer(exchangeSvc)
+	require.NoError(t, sizer.Initialize(ctx, portfolio.RiskConfig{
+		MaxStopLossRatio:    0.5,
+		MaxLeverage:         10,
+		ConfidenceThreshold: 0.6,
+	}))
+
+	sg := &basketStrategy{btc: btc, eth: eth}
+	engine := NewBacktestEngine(startTime, endTime, exchangeSvc)
+	engine.positionSizer = sizer
+	require.NoError(t, engine.AddStrategy(ctx, sg))
+	require.NoError(t, engine.Run(ctx))
+
+	assert.Equal(t, 72, sg.counts[strategy.Subscription{TradingPair: btc, Interval: exchange.Interval5m}])
+	assert.Equal(t, 6, sg.counts[strategy.Subscription{TradingPair: btc, Interval: exchange.Interval1h}])
+	assert.Equal(t, 72, sg.counts[strategy.Subscription{TradingPair: eth, Interval: exchange.Interval5m}])
+	assert.Equal(t, []bool{true, true, true, true, true, true}, sg.hourlyClosed, "1h K线回调时已经可以读取到这根K线")
+
+	ethOrders, err := exchangeSvc.GetOrders(ctx, exchange.GetOrdersReq{TradingPair: eth, IncludeClosed: true})
+	require.NoError(t, err)
+	assert.NotEmpty(t, ethOrders, "应该在 ETH 上开仓")
+
+	solOrders, err := exchangeSvc.GetOrders(ctx, exchange.GetOrdersReq{TradingPair: exchange.TradingPair{Base: "SOL", Quote: "USDT"}, IncludeClosed: true})
+	require.NoError(t, err)
+	assert.Empty(t, solOrders)
+}
+
+// reusedSignalsStrategy 每次返回同一个信号切片
+type reusedSignalsStrategy struct {
+	basketStrategy
+	signals []strategy.Signal
+}
+
+func (s *reusedSignalsStrategy) OnStreamKline(ctx context.Context, sub strategy.Subscription, kline exchange.Kline) ([]strategy.Signal, error) {
+	return s.signals, nil
+}
+
+// TestStrategySignals_KeepsStrategySlice 测试丢弃未订阅交易对的信号时不修改策略返回的切片
+func TestStrategySignals_KeepsStrategySlice(t *testing.T) {
+	btc := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	eth := exchange.TradingPair{Base: "ETH", Quote: "USDT"}
+	sol := exchange.TradingPair{Base: "SOL", Quote: "USDT"}
+	sg := &reusedSignalsStrategy{
+		basketStrategy: basketStrategy{btc: btc, eth: eth},
+		signals: []strategy.Signal{
+			{TradingPair: sol, Action: strategy.SignalActionLong},
+			{Action: strategy.SignalActionHold},
+		},
+	}
+	sub := strategy.Subscription{TradingPair: btc, Interval: exchange.Interval5m}
+
+	signals, err := strategySignals(context.Background(), sg, sub, exchange.Kline{})
+	require.NoError(t, err)
+	require.Len(t, signals, 1)
+	assert.Equal(t, btc, signals[0].TradingPair)
+
+	assert.Equal(t, sol, sg.signals[0].TradingPair, "策略持有的切片不能被改写")
+	assert.True(t, sg.signals[1].TradingPair.IsZero())
+}
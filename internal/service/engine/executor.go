@@ -3,18 +3,74 @@ package engine
 import (
 	"context"
 	"fmt"
+	"log"
 
 	"github.com/KNICEX/trading-agent/internal/service/exchange"
 	"github.com/KNICEX/trading-agent/internal/service/portfolio"
+	"github.com/KNICEX/trading-agent/internal/service/strategy"
+	"github.com/shopspring/decimal"
 )
 
 type Executor struct {
 	tradingSvc  exchange.TradingService
 	orderSvc    exchange.OrderService
 	positionSvc exchange.PositionService
+	quiet       bool // 不打印信号和下单日志（参数优化时大量回测）
+}
+
+// NewExecutor 创建信号执行器
+func NewExecutor(exchangeSvc exchange.Service, rulesProvider exchange.SymbolRulesProvider) *Executor {
+	return &Executor{
+		tradingSvc:  exchange.NewTradingService(exchangeSvc, rulesProvider),
+		orderSvc:    exchangeSvc.OrderService(),
+		positionSvc: exchangeSvc.PositionService(),
+	}
+}
+
+// SetQuiet 设置是否关闭信号和下单日志
+func (e *Executor) SetQuiet(quiet bool) {
+	e.quiet = quiet
+}
+
+// logf 打印执行日志，quiet 时不打印
+func (e *Executor) logf(format string, args ...any) {
+	if e.quiet {
+		return
+	}
+	log.Printf("[executor] "+format, args...)
+}
+
+// processSignal 信号处理流水线：策略信号 → 仓位管理（风控） → 执行器下单
+// 回测引擎和实盘引擎共用同一套流程
+func processSignal(ctx context.Context, sizer portfolio.PositionSizer, executor *Executor, signal strategy.Signal) error {
+	if signal.Action == strategy.SignalActionHold {
+		// do nothing
+		return nil
+	}
+
+	enhancedSignal, err := sizer.HandleSignal(ctx, signal)
+	if err != nil {
+		return fmt.Errorf("handle signal failed: %w", err)
+	}
+
+	if !enhancedSignal.Validated {
+		return nil
+	}
+
+	if err := executor.Execute(ctx, enhancedSignal.EnhancedSignal); err != nil {
+		return fmt.Errorf("execute signal failed: %w", err)
+	}
+	return nil
 }
 
 func (e *Executor) Execute(ctx context.Context, signal portfolio.EnhancedSignal) error {
+	switch signal.Action {
+	case strategy.SignalActionAdd:
+		return e.addPosition(ctx, signal)
+	case strategy.SignalActionReduce, strategy.SignalActionClose:
+		return e.reducePosition(ctx, signal)
+	}
+
 	// 1. 获取当前持仓
 	positions, err := e.positionSvc.GetActivePositions(ctx, []exchange.TradingPair{signal.TradingPair})
 	if err != nil {
@@ -47,7 +103,7 @@ func (e *Executor) Execute(ctx context.Context, signal portfolio.EnhancedSignal)
 			}
 
 			// 有空单，先平空
-			fmt.Println("检测到空单，先平空单再开多单")
+			e.logf("%s 检测到空单，先平空单再开多单", signal.TradingPair.ToString())
 			err = e.closePosition(ctx, signal.TradingPair, exchange.PositionSideShort, shortPosition.Quantity.Abs())
 			if err != nil {
 				return fmt.Errorf("failed to close short position: %w", err)
@@ -57,9 +113,9 @@ func (e *Executor) Execute(ctx context.Context, signal portfolio.EnhancedSignal)
 
 		// 开多单或加多仓
 		if longPosition != nil {
-			fmt.Println("加多仓")
+			e.logf("%s 加多仓", signal.TradingPair.ToString())
 		} else {
-			fmt.Println("开多单")
+			e.logf("%s 开多单", signal.TradingPair.ToString())
 		}
 		return e.openPosition(ctx, signal)
 
@@ -75,7 +131,7 @@ func (e *Executor) Execute(ctx context.Context, signal portfolio.EnhancedSignal)
 			}
 
 			// 有多单，先平多
-			fmt.Println("检测到多单，先平多单再开空单")
+			e.logf("%s 检测到多单，先平多单再开空单", signal.TradingPair.ToString())
 			err = e.closePosition(ctx, signal.TradingPair, exchange.PositionSideLong, longPosition.Quantity.Abs())
 			if err != nil {
 				return fmt.Errorf("failed to close long position: %w", err)
@@ -85,9 +141,9 @@ func (e *Executor) Execute(ctx context.Context, signal portfolio.EnhancedSignal)
 
 		// 开空单或加空仓
 		if shortPosition != nil {
-			fmt.Println("加空仓")
+			e.logf("%s 加空仓", signal.TradingPair.ToString())
 		} else {
-			fmt.Println("开空单")
+			e.logf("%s 开空单", signal.TradingPair.ToString())
 		}
 		return e.openPosition(ctx, signal)
 	}
@@ -95,6 +151,127 @@ func (e *Executor) Execute(ctx context.Context, signal portfolio.EnhancedSignal)
 	return fmt.Errorf("unsupported position side: %s", signal.PositionSide)
 }
 
+// addPosition 加仓，并把该方向的止盈止损调整为加仓后的数量
+func (e *Executor) addPosition(ctx context.Context, signal portfolio.EnhancedSignal) error {
+	position, err := e.getPosition(ctx, signal.TradingPair, signal.PositionSide)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.tradingSvc.OpenPosition(ctx, exchange.OpenPositionReq{
+		TradingPair:  signal.TradingPair,
+		PositionSide: signal.PositionSide,
+		Quantity:     signal.Quantity,
+		Timestamp:    signal.Timestamp,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add position: %w", err)
+	}
+	return e.resizeStopOrders(ctx, signal, position.Quantity.Abs().Add(signal.Quantity))
+}
+
+// reducePosition 减仓或平仓，剩余仓位的止盈止损调整为剩余数量
+func (e *Executor) reducePosition(ctx context.Context, signal portfolio.EnhancedSignal) error {
+	position, err := e.getPosition(ctx, signal.TradingPair, signal.PositionSide)
+	if err != nil {
+		return err
+	}
+
+	if signal.CloseAll {
+		// 先撤掉止盈止损，避免平仓后残留条件单
+		if err := e.resizeStopOrders(ctx, signal, decimal.Zero); err != nil {
+			return err
+		}
+		if err := e.closePosition(ctx, signal.TradingPair, signal.PositionSide, position.Quantity.Abs()); err != nil {
+			return fmt.Errorf("failed to close position: %w", err)
+		}
+		return nil
+	}
+
+	_, err = e.tradingSvc.ClosePosition(ctx, exchange.ClosePositionReq{
+		TradingPair:  signal.TradingPair,
+		PositionSide: signal.PositionSide,
+		Quantity:     signal.Quantity,
+		Timestamp:    signal.Timestamp,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reduce position: %w", err)
+	}
+	return e.resizeStopOrders(ctx, signal, position.Quantity.Abs().Sub(signal.Quantity))
+}
+
+// getPosition 获取指定方向的持仓
+func (e *Executor) getPosition(ctx context.Context, tradingPair exchange.TradingPair, positionSide exchange.PositionSide) (*exchange.Position, error) {
+	positions, err := e.positionSvc.GetActivePositions(ctx, []exchange.TradingPair{tradingPair})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active positions: %w", err)
+	}
+	for i := range positions {
+		if positions[i].PositionSide == positionSide && !positions[i].Quantity.IsZero() {
+			return &positions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no active position found for %s %s", tradingPair.ToString(), positionSide)
+}
+
+// resizeStopOrders 撤掉该方向原有的止盈止损，按新的数量重新创建
+// 信号没有指定止盈或止损价格时沿用原来的触发价格，跟踪止损沿用原来的参数（重新开始跟踪），quantity <= 0 时只撤单
+func (e *Executor) resizeStopOrders(ctx context.Context, signal portfolio.EnhancedSignal, quantity decimal.Decimal) error {
+	orders, err := e.orderSvc.GetOrders(ctx, exchange.GetOrdersReq{TradingPair: signal.TradingPair})
+	if err != nil {
+		return fmt.Errorf("failed to get orders: %w", err)
+	}
+
+	takeProfit, stopLoss := signal.TakeProfit, signal.StopLoss
+	var trailing exchange.TrailingStop
+	var ids []exchange.OrderId
+	for _, order := range orders {
+		if !order.Conditional.IsConditional() || order.OrderType != exchange.OrderTypeClose || order.PositionSide != signal.PositionSide {
+			continue
+		}
+		ids = append(ids, exchange.OrderId(order.Id))
+		switch order.Conditional {
+		case exchange.ConditionalTypeTakeProfitMarket:
+			if takeProfit.IsZero() {
+				takeProfit = order.TriggerPrice
+			}
+		case exchange.ConditionalTypeStopMarket:
+			if stopLoss.IsZero() {
+				stopLoss = order.TriggerPrice
+			}
+		case exchange.ConditionalTypeTrailingStopMarket:
+			trailing = exchange.TrailingStop{
+				CallbackRate:     order.CallbackRate,
+				CallbackDistance: order.CallbackDistance,
+				ActivationPrice:  order.ActivationPrice,
+			}
+		}
+	}
+
+	if len(ids) > 0 {
+		if err := e.orderSvc.CancelOrders(ctx, exchange.CancelOrdersReq{TradingPair: signal.TradingPair, Ids: ids}); err != nil {
+			return fmt.Errorf("failed to cancel stop orders: %w", err)
+		}
+	}
+
+	if !quantity.IsPositive() || (takeProfit.IsZero() && stopLoss.IsZero() && !trailing.IsValid()) {
+		return nil
+	}
+	_, err = e.tradingSvc.SetStopOrders(ctx, exchange.SetStopOrdersReq{
+		TradingPair:  signal.TradingPair,
+		PositionSide: signal.PositionSide,
+		TakeProfit:   exchange.StopOrder{Price: takeProfit},
+		StopLoss:     exchange.StopOrder{Price: stopLoss},
+		TrailingStop: trailing,
+		Quantity:     quantity,
+		Timestamp:    signal.Timestamp,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to resize stop orders: %w", err)
+	}
+	return nil
+}
+
 // openPosition 开仓或加仓
 func (e *Executor) openPosition(ctx context.Context, signal portfolio.EnhancedSignal) error {
 	_, err := e.tradingSvc.OpenPosition(ctx, exchange.OpenPositionReq{
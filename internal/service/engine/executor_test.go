@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/KNICEX/trading-agent/internal/service/exchange/backtest"
+	"github.com/KNICEX/trading-agent/internal/service/portfolio"
+	"github.com/KNICEX/trading-agent/internal/service/strategy"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scaleSnapshot 每根K线收盘时的持仓和止盈止损状态
+type scaleSnapshot struct {
+	quantity   decimal.Decimal
+	takeProfit exchange.OrderInfo
+	stopLoss   exchange.OrderInfo
+	stopOrders int
+}
+
+// scriptedStrategy 按K线序号依次发出预设信号，并记录每根K线收盘时的状态
+type scriptedStrategy struct {
+	pair        exchange.TradingPair
+	orderSvc    exchange.OrderService
+	signals     []strategy.Signal
+	snapshots   []scaleSnapshot
+	strategyCtx strategy.Context
+}
+
+func (s *scriptedStrategy) Name() string                      { return "scripted_strategy" }
+func (s *scriptedStrategy) TradingPair() exchange.TradingPair { return s.pair }
+func (s *scriptedStrategy) Interval() exchange.Interval       { return exchange.Interval5m }
+func (s *scriptedStrategy) Initialize(ctx context.Context, strategyCtx strategy.Context) error {
+	s.strategyCtx = strategyCtx
+	return nil
+}
+func (s *scriptedStrategy) Shutdown(ctx context.Context) error { return nil }
+
+func (s *scriptedStrategy) OnKline(ctx context.Context, kline exchange.Kline) (strategy.Signal, error) {
+	snapshot := scaleSnapshot{quantity: decimal.Zero}
+	positions, err := s.strategyCtx.GetPositions(ctx)
+	if err != nil {
+		return strategy.Signal{}, err
+	}
+	for _, position := range positions {
+		if position.TradingPair == s.pair && position.PositionSide == exchange.PositionSideLong {
+			snapshot.quantity = position.Quantity.Abs()
+		}
+	}
+	orders, err := s.orderSvc.GetOrders(ctx, exchange.GetOrdersReq{TradingPair: s.pair})
+	if err != nil {
+		return strategy.Signal{}, err
+	}
+	for _, order := range orders {
+		switch order.Conditional {
+		case exchange.ConditionalTypeTakeProfitMarket:
+			snapshot.takeProfit = order
+			snapshot.stopOrders++
+		case exchange.ConditionalTypeStopMarket:
+			snapshot.stopLoss = order
+			snapshot.stopOrders++
+		}
+	}
+
+	idx := len(s.snapshots)
+	s.snapshots = append(s.snapshots, snapshot)
+	if idx >= len(s.signals) {
+		return strategy.Signal{TradingPair: s.pair, Action: strategy.SignalActionHold}, nil
+	}
+	signal := s.signals[idx]
+	signal.TradingPair = s.pair
+	signal.Timestamp = kline.CloseTime
+	return signal, nil
+}
+
+// TestExecutor_AddReduceClose 测试 LONG → ADD → REDUCE → CLOSE 全流程，止盈止损随持仓数量调整
+func TestExecutor_AddReduceClose(t *testing.T) {
+	ctx := context.Background()
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	interval := exchange.Interval5m
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	endTime := startTime.Add(8 * interval.Duration())
+
+	// 价格横盘在 100 附近，不会触发止盈止损
+	klines := make([]exchange.Kline, 0, 8)
+	for i := 0; i < 8; i++ {
+		openTime := startTime.Add(time.Duration(i) * interval.Duration())
+		klines = append(klines, exchange.Kline{
+			OpenTime:  openTime,
+			CloseTime: openTime.Add(interval.Duration()),
+			Open:      decimal.NewFromInt(100),
+			High:      decimal.NewFromInt(101),
+			Low:       decimal.NewFromInt(99),
+			Close:     decimal.NewFromInt(100),
+			Volume:    decimal.NewFromInt(1000),
+		})
+	}
+	provider := backtest.NewMockKlineProvider()
+	provider.AddKlines(pair, interval, klines)
+
+	exchangeSvc := backtest.NewExchangeService(startTime, endTime, decimal.NewFromInt(10000), provider)
+	require.NoError(t, exchangeSvc.SetLeverage(ctx, exchange.SetLeverageReq{TradingPair: pair, Leverage: 20}))
+
+	sizer := portfolio.NewSimplePositionSizer(exchangeSvc)
+	require.NoError(t, sizer.Initialize(ctx, portfolio.RiskConfig{
+		MaxStopLossRatio:    0.5,
+		MaxLeverage:         10,
+		ConfidenceThreshold: 0.6,
+	}))
+
+	sg := &scriptedStrategy{
+		pair:     pair,
+		orderSvc: exchangeSvc.OrderService(),
+		signals: []strategy.Signal{
+			{Action: strategy.SignalActionLong, Confidence: 0.8, StopLoss: decimal.NewFromInt(95), TakeProfit: decimal.NewFromInt(130)},
+			{Action: strategy.SignalActionAdd, Confidence: 0.8, StopLoss: decimal.NewFromInt(96)},
+			{Action: strategy.SignalActionReduce, Percent: decimal.NewFromInt(50)},
+			{Action: strategy.SignalActionClose},
+		},
+	}
+	engine := NewBacktestEngine(startTime, endTime, exchangeSvc)
+	engine.positionSizer = sizer
+	require.NoError(t, engine.AddStrategy(ctx, sg))
+	require.NoError(t, engine.Run(ctx))
+	require.GreaterOrEqual(t, len(sg.snapshots), 5)
+
+	// 第 1 根K线：开仓成交，止盈止损数量等于持仓
+	opened := sg.snapshots[1]
+	require.True(t, opened.quantity.IsPositive())
+	assert.True(t, opened.stopLoss.Quantity.Equal(opened.quantity))
+	assert.True(t, opened.stopLoss.TriggerPrice.Equal(decimal.NewFromInt(95)))
+
+	// 第 2 根K线：加仓成交，止损更新为 96，止盈沿用 130，数量都调整为加仓后的持仓
+	added := sg.snapshots[2]
+	require.True(t, added.quantity.GreaterThan(opened.quantity))
+	assert.Equal(t, 2, added.stopOrders)
+	assert.True(t, added.stopLoss.Quantity.Equal(added.quantity))
+	assert.True(t, added.stopLoss.TriggerPrice.Equal(decimal.NewFromInt(96)))
+	assert.True(t, added.takeProfit.Quantity.Equal(added.quantity))
+	assert.True(t, added.takeProfit.TriggerPrice.Equal(decimal.NewFromInt(130)))
+
+	// 第 3 根K线：减仓 50%，止盈止损调整为剩余数量
+	reduced := sg.snapshots[3]
+	assert.True(t, reduced.quantity.Equal(added.quantity.Sub(added.quantity.Div(decimal.NewFromInt(2)).Truncate(3))))
+	assert.Equal(t, 2, reduced.stopOrders)
+	assert.True(t, reduced.stopLoss.Quantity.Equal(reduced.quantity))
+	assert.True(t, reduced.takeProfit.Quantity.Equal(reduced.quantity))
+
+	// 第 4 根K线：全部平仓，没有残留的止盈止损
+	closed := sg.snapshots[4]
+	assert.True(t, closed.quantity.IsZero())
+	assert.Equal(t, 0, closed.stopOrders)
+}
+
+// TestBacktestEngine_SymbolRules 测试回测引擎下单时使用交易所设置的交易对规则，
+// 数量按 0.01 步长、止盈止损价格按 0.5 价格步长取整后不会被交易所拒绝
+func TestBacktestEngine_SymbolRules(t *testing.T) {
+	ctx := context.Background()
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	interval := exchange.Interval5m
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	endTime := startTime.Add(4 * interval.Duration())
+
+	klines := make([]exchange.Kline, 0, 4)
+	for i := 0; i < 4; i++ {
+		openTime := startTime.Add(time.Duration(i) * interval.Duration())
+		klines = append(klines, exchange.Kline{
+			OpenTime:  openTime,
+			CloseTime: openTime.Add(interval.Duration()),
+			Open:      decimal.NewFromInt(100),
+			High:      decimal.NewFromInt(101),
+			Low:       decimal.NewFromInt(99),
+			Close:     decimal.NewFromInt(100),
+			Volume:    decimal.NewFromInt(1000),
+		})
+	}
+	provider := backtest.NewMockKlineProvider()
+	provider.AddKlines(pair, interval, klines)
+
+	exchangeSvc := backtest.NewExchangeService(startTime, endTime, decimal.NewFromInt(10000), provider)
+	require.NoError(t, exchangeSvc.SetLeverage(ctx, exchange.SetLeverageReq{TradingPair: pair, Leverage: 20}))
+
+	sizer := portfolio.NewSimplePositionSizer(exchangeSvc)
+	require.NoError(t, sizer.Initialize(ctx, portfolio.RiskConfig{
+		MaxStopLossRatio:    0.5,
+		MaxLeverage:         10,
+		ConfidenceThreshold: 0.6,
+	}))
+
+	sg := &scriptedStrategy{
+		pair:     pair,
+		orderSvc: exchangeSvc.OrderService(),
+		signals: []strategy.Signal{
+			{Action: strategy.SignalActionLong, Confidence: 0.8, StopLoss: decimal.NewFromFloat(95.3), TakeProfit: decimal.NewFromFloat(130.2)},
+		},
+	}
+	engine := NewBacktestEngine(startTime, endTime, exchangeSvc)
+	engine.positionSizer = sizer
+
+	// 创建引擎之后再设置规则，引擎在 Run 时读取
+	rules := &backtest.PercisionProvider{}
+	rules.SetSymbolRules(exchange.SymbolRules{
+		TradingPair:       pair,
+		QuantityPrecision: 2,
+		TickSize:          decimal.NewFromFloat(0.5),
+		StepSize:          decimal.NewFromFloat(0.01),
+		MinQuantity:       decimal.NewFromFloat(0.01),
+	})
+	exchangeSvc.SetSymbolRulesProvider(rules)
+
+	require.NoError(t, engine.AddStrategy(ctx, sg))
+	require.NoError(t, engine.Run(ctx))
+	require.GreaterOrEqual(t, len(sg.snapshots), 2)
+
+	opened := sg.snapshots[1]
+	require.True(t, opened.quantity.IsPositive(), "开仓单没有被交易所拒绝")
+	assert.True(t, opened.quantity.Mod(decimal.NewFromFloat(0.01)).IsZero(), "quantity %s", opened.quantity)
+	assert.True(t, opened.stopLoss.TriggerPrice.Equal(decimal.NewFromFloat(95.5)), "stop loss %s", opened.stopLoss.TriggerPrice)
+	assert.True(t, opened.takeProfit.TriggerPrice.Equal(decimal.NewFromInt(130)), "take profit %s", opened.takeProfit.TriggerPrice)
+	assert.True(t, opened.stopLoss.Quantity.Equal(opened.quantity))
+}
@@ -1 +1,309 @@
 package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/KNICEX/trading-agent/internal/service/portfolio"
+	"github.com/KNICEX/trading-agent/internal/service/strategy"
+)
+
+var _ strategy.Context = (*LiveContext)(nil)
+
+// LiveContext 实盘策略上下文
+// 时间取系统时钟，数据直接来自交易所
+type LiveContext struct {
+	tradingPair exchange.TradingPair
+	marketSvc   exchange.MarketService
+	positionSvc exchange.PositionService
+}
+
+func NewLiveContext(tradingPair exchange.TradingPair, marketSvc exchange.MarketService, positionSvc exchange.PositionService) *LiveContext {
+	return &LiveContext{
+		tradingPair: tradingPair,
+		marketSvc:   marketSvc,
+		positionSvc: positionSvc,
+	}
+}
+
+// GetKlines 获取已经收盘的K线，交易所返回的最后一根正在形成的K线会被去掉
+func (c *LiveContext) GetKlines(ctx context.Context, req strategy.GetKlinesReq) ([]exchange.Kline, error) {
+	pair := req.TradingPair
+	if pair.IsZero() {
+		pair = c.tradingPair
+	}
+	klines, err := c.marketSvc.GetKlines(ctx, exchange.GetKlinesReq{
+		TradingPair: pair,
+		Interval:    req.Interval,
+		StartTime:   req.StartTime,
+		EndTime:     req.EndTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return closedKlines(klines, c.Now()), nil
+}
+
+func (c *LiveContext) GetPositions(ctx context.Context) ([]exchange.Position, error) {
+	return c.positionSvc.GetActivePositions(ctx, []exchange.TradingPair{})
+}
+
+func (c *LiveContext) Now() time.Time {
+	return time.Now()
+}
+
+func (c *LiveContext) TradingPair() exchange.TradingPair {
+	return c.tradingPair
+}
+
+var _ Engine = (*LiveEngine)(nil)
+
+// LiveEngine 实盘引擎
+// 每个策略订阅自己的K线流，收盘K线驱动 OnKline，信号经过 PositionSizer → Executor 下单
+type LiveEngine struct {
+	exchangeSvc exchange.LiveService
+
+	strategies    []strategy.Strategy
+	positionSizer portfolio.PositionSizer
+
+	executor *Executor
+	// 多个策略可能同时产生信号，串行执行避免同一交易对的持仓判断互相干扰
+	executeMu sync.Mutex
+
+	// 订单组（OCO）对账，止盈止损一个成交或仓位被平掉后撤销同组的其余订单
+	groupReconciler  *exchange.OrderGroupReconciler
+	reconcileEnabled bool
+
+	// 账户推送（订单、成交、持仓、余额）的外部处理函数，例如实时统计
+	userDataHandler func(event exchange.UserDataEvent)
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewLiveEngine 创建实盘引擎
+func NewLiveEngine(
+	exchangeSvc exchange.LiveService,
+	positionSizer portfolio.PositionSizer,
+	rulesProvider exchange.SymbolRulesProvider,
+) *LiveEngine {
+	return &LiveEngine{
+		exchangeSvc:   exchangeSvc,
+		positionSizer: positionSizer,
+		executor:      NewExecutor(exchangeSvc, rulesProvider),
+
+		groupReconciler:  exchange.NewOrderGroupReconciler(exchangeSvc),
+		reconcileEnabled: true,
+	}
+}
+
+// SetOrderGroupReconcileInterval 设置订单组对账间隔，interval <= 0 时关闭对账
+// 需要在 Run 之前调用
+func (e *LiveEngine) SetOrderGroupReconcileInterval(interval time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.reconcileEnabled = interval > 0
+	if e.reconcileEnabled {
+		e.groupReconciler.SetInterval(interval)
+	}
+}
+
+// SetUserDataHandler 设置账户推送的处理函数，需要在 Run 之前调用
+// 处理函数在推送协程中串行调用，不应该阻塞
+func (e *LiveEngine) SetUserDataHandler(handler func(event exchange.UserDataEvent)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.userDataHandler = handler
+}
+
+// Run 启动所有策略并阻塞，直到 ctx 被取消或调用 Stop
+func (e *LiveEngine) Run(ctx context.Context) error {
+	e.mu.Lock()
+	if e.running {
+		e.mu.Unlock()
+		return errors.New("live engine is already running")
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	e.running = true
+	e.cancel = cancel
+	e.done = make(chan struct{})
+	strategies := append([]strategy.Strategy(nil), e.strategies...)
+	reconcileEnabled := e.reconcileEnabled
+	userDataHandler := e.userDataHandler
+	e.mu.Unlock()
+
+	defer func() {
+		cancel()
+
+		e.mu.Lock()
+		e.running = false
+		close(e.done)
+		e.mu.Unlock()
+	}()
+
+	// 1. 初始化策略并订阅K线，任何一个失败都不启动
+	streamChans := make([]chan streamKline, len(strategies))
+	for i, sg := range strategies {
+		sgCtx := NewLiveContext(sg.TradingPair(), e.exchangeSvc.MarketService(), e.exchangeSvc.PositionService())
+		if err := sg.Initialize(runCtx, sgCtx); err != nil {
+			e.shutdownStrategies(strategies[:i])
+			return fmt.Errorf("initialize strategy %s failed: %w", sg.Name(), err)
+		}
+
+		streamChan, err := subscribeStreams(runCtx, e.exchangeSvc.KlineStreamService(), strategy.SubscriptionsOf(sg))
+		if err != nil {
+			e.shutdownStrategies(strategies[:i+1])
+			return fmt.Errorf("subscribe kline for strategy %s failed: %w", sg.Name(), err)
+		}
+		streamChans[i] = streamChan
+	}
+
+	// 2. 每个策略一个协程消费K线
+	wg := sync.WaitGroup{}
+	for i, sg := range strategies {
+		sg := sg
+		streamChan := streamChans[i]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.runStrategy(runCtx, sg, streamChan)
+		}()
+	}
+
+	// 3. 订单组对账，跟随 runCtx 退出
+	reconcileDone := make(chan struct{})
+	go func() {
+		defer close(reconcileDone)
+		if reconcileEnabled {
+			e.groupReconciler.Run(runCtx, strategyPairs(strategies))
+		}
+	}()
+
+	// 4. 账户推送：订单结束或持仓变化时立即对账，订阅失败时只靠定期对账
+	userDataDone := make(chan struct{})
+	userDataChan, err := e.exchangeSvc.UserDataService().SubscribeUserData(runCtx)
+	if err != nil {
+		log.Printf("[live] subscribe user data failed, falling back to polling: %v", err)
+		close(userDataDone)
+	} else {
+		go func() {
+			defer close(userDataDone)
+			e.consumeUserData(userDataChan, reconcileEnabled, userDataHandler)
+		}()
+	}
+
+	wg.Wait()
+	cancel()
+	<-reconcileDone
+	<-userDataDone
+
+	// 5. 所有K线流结束（Stop / ctx 取消 / 连接断开），关闭策略
+	e.shutdownStrategies(strategies)
+	return nil
+}
+
+// consumeUserData 消费账户推送直到通道关闭
+func (e *LiveEngine) consumeUserData(userDataChan chan exchange.UserDataEvent, reconcile bool, handler func(event exchange.UserDataEvent)) {
+	for event := range userDataChan {
+		if reconcile && needsReconcile(event) {
+			e.groupReconciler.Trigger()
+		}
+		if handler != nil {
+			handler(event)
+		}
+	}
+}
+
+// needsReconcile 订单结束或持仓变化后订单组可能需要撤单
+func needsReconcile(event exchange.UserDataEvent) bool {
+	switch event.Type {
+	case exchange.UserDataEventTypeOrder:
+		return event.Order != nil && event.Order.Status.IsClosed()
+	case exchange.UserDataEventTypePosition:
+		return true
+	}
+	return false
+}
+
+// runStrategy 消费单个策略的K线流，多路K线串行交给策略处理
+func (e *LiveEngine) runStrategy(ctx context.Context, sg strategy.Strategy, streamChan chan streamKline) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sk, ok := <-streamChan:
+			if !ok {
+				log.Printf("[live] kline stream of strategy %s closed", sg.Name())
+				return
+			}
+
+			signals, err := strategySignals(ctx, sg, sk.sub, sk.kline)
+			if err != nil {
+				log.Printf("[live] strategy %s on kline error: %v", sg.Name(), err)
+				continue
+			}
+
+			e.executeMu.Lock()
+			for _, signal := range signals {
+				if err := processSignal(ctx, e.positionSizer, e.executor, signal); err != nil {
+					log.Printf("[live] strategy %s execute error: %v", sg.Name(), err)
+				}
+			}
+			e.executeMu.Unlock()
+		}
+	}
+}
+
+// shutdownStrategies 关闭策略，使用独立的 ctx，避免运行 ctx 已取消导致无法清理
+func (e *LiveEngine) shutdownStrategies(strategies []strategy.Strategy) {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, sg := range strategies {
+		if err := sg.Shutdown(shutdownCtx); err != nil {
+			log.Printf("[live] shutdown strategy %s error: %v", sg.Name(), err)
+		}
+	}
+}
+
+// Stop 取消所有K线订阅，等待策略协程退出并完成 Shutdown
+func (e *LiveEngine) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	if !e.running {
+		e.mu.Unlock()
+		return nil
+	}
+	cancel := e.cancel
+	done := e.done
+	e.mu.Unlock()
+
+	cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// AddStrategy 添加策略，需要在 Run 之前调用
+func (e *LiveEngine) AddStrategy(ctx context.Context, strategy strategy.Strategy) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.running {
+		return errors.New("cannot add strategy while live engine is running")
+	}
+	e.strategies = append(e.strategies, strategy)
+	return nil
+}
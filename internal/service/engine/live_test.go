@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/KNICEX/trading-agent/internal/service/exchange/backtest"
+	"github.com/KNICEX/trading-agent/internal/service/portfolio"
+	"github.com/KNICEX/trading-agent/internal/service/strategy"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStrategy 只统计收到的K线数量，始终观望
+type countingStrategy struct {
+	pair     exchange.TradingPair
+	klines   atomic.Int64
+	shutdown atomic.Bool
+}
+
+func (s *countingStrategy) Name() string                      { return "counting_strategy" }
+func (s *countingStrategy) TradingPair() exchange.TradingPair { return s.pair }
+func (s *countingStrategy) Interval() exchange.Interval       { return exchange.Interval5m }
+func (s *countingStrategy) Initialize(ctx context.Context, strategyCtx strategy.Context) error {
+	return nil
+}
+func (s *countingStrategy) OnKline(ctx context.Context, kline exchange.Kline) (strategy.Signal, error) {
+	s.klines.Add(1)
+	return strategy.Signal{TradingPair: s.pair, Action: strategy.SignalActionHold}, nil
+}
+func (s *countingStrategy) Shutdown(ctx context.Context) error {
+	s.shutdown.Store(true)
+	return nil
+}
+
+// streamingExchange 回测交易所加上推送K线的行情，模拟实盘K线流：推送完之后保持连接直到取消
+type streamingExchange struct {
+	*backtest.ExchangeService
+	klines []exchange.Kline
+}
+
+func (e *streamingExchange) KlineStreamService() exchange.KlineStreamService { return e }
+
+func (e *streamingExchange) SubscribeKline(ctx context.Context, tradingPair exchange.TradingPair, interval exchange.Interval) (chan exchange.Kline, error) {
+	ch := make(chan exchange.Kline)
+	go func() {
+		defer close(ch)
+		for _, kline := range e.klines {
+			select {
+			case ch <- kline:
+			case <-ctx.Done():
+				return
+			}
+		}
+		<-ctx.Done()
+	}()
+	return ch, nil
+}
+
+// TestLiveEngine_RunAndStop 测试实盘引擎消费K线流并能优雅停止
+func TestLiveEngine_RunAndStop(t *testing.T) {
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	endTime := startTime.Add(1000 * exchange.Interval5m.Duration())
+
+	provider := backtest.NewMockKlineProvider()
+	provider.GenerateKlines(pair, exchange.Interval5m, startTime, 50000, 1000, "sideways")
+
+	klines, err := provider.GetKlines(context.Background(), exchange.GetKlinesReq{
+		TradingPair: pair,
+		Interval:    exchange.Interval5m,
+		StartTime:   startTime,
+		EndTime:     endTime,
+	})
+	require.NoError(t, err)
+	exchangeSvc := &streamingExchange{
+		ExchangeService: backtest.NewExchangeService(startTime, endTime, decimal.NewFromInt(10000), provider),
+		klines:          klines,
+	}
+	sizer := portfolio.NewSimplePositionSizer(exchangeSvc)
+
+	engine := NewLiveEngine(exchangeSvc, sizer, &backtest.PercisionProvider{})
+	sg := &countingStrategy{pair: pair}
+	require.NoError(t, engine.AddStrategy(context.Background(), sg))
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- engine.Run(context.Background())
+	}()
+
+	// 等待收到K线
+	require.Eventually(t, func() bool { return sg.klines.Load() > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// 运行中不允许添加策略
+	assert.Error(t, engine.AddStrategy(context.Background(), &countingStrategy{pair: pair}))
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, engine.Stop(stopCtx))
+
+	select {
+	case err := <-runErr:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run 应该在 Stop 之后返回")
+	}
+
+	assert.True(t, sg.shutdown.Load(), "Stop 之后应该调用 Strategy.Shutdown")
+}
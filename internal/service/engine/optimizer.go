@@ -0,0 +1,431 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/analytics"
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/KNICEX/trading-agent/internal/service/exchange/backtest"
+	"github.com/KNICEX/trading-agent/internal/service/portfolio"
+	"github.com/KNICEX/trading-agent/internal/service/strategy"
+	"github.com/shopspring/decimal"
+)
+
+// OptimizeMetric 参数优化的排序指标，取自 analytics.Report
+type OptimizeMetric string
+
+const (
+	MetricTotalReturn  OptimizeMetric = "total_return"
+	MetricCAGR         OptimizeMetric = "cagr"
+	MetricSharpeRatio  OptimizeMetric = "sharpe"
+	MetricSortinoRatio OptimizeMetric = "sortino"
+	MetricCalmarRatio  OptimizeMetric = "calmar"
+	MetricProfitFactor OptimizeMetric = "profit_factor"
+	MetricWinRate      OptimizeMetric = "win_rate"
+	// 最大回撤百分比，越小越好
+	MetricMaxDrawdown OptimizeMetric = "max_drawdown"
+)
+
+// Value 从报告中取出指标值
+func (m OptimizeMetric) Value(report analytics.Report) (decimal.Decimal, error) {
+	switch m {
+	case MetricTotalReturn:
+		return report.Account.TotalReturn, nil
+	case MetricCAGR:
+		return report.Account.CAGR, nil
+	case MetricSharpeRatio:
+		return report.Account.SharpeRatio, nil
+	case MetricSortinoRatio:
+		return report.Account.SortinoRatio, nil
+	case MetricCalmarRatio:
+		return report.Account.CalmarRatio, nil
+	case MetricProfitFactor:
+		return report.Trading.ProfitFactor, nil
+	case MetricWinRate:
+		return report.Trading.WinRate, nil
+	case MetricMaxDrawdown:
+		return report.Risk.MaxDrawdownPercent, nil
+	}
+	return decimal.Zero, fmt.Errorf("unknown optimize metric: %s", m)
+}
+
+// lowerIsBetter 指标是否越小越好
+func (m OptimizeMetric) lowerIsBetter() bool {
+	return m == MetricMaxDrawdown
+}
+
+// Params 一组策略参数，key 为参数名
+type Params map[string]float64
+
+// Int 按整数读取参数
+func (p Params) Int(name string) int {
+	return int(math.Round(p[name]))
+}
+
+// Float 读取参数
+func (p Params) Float(name string) float64 {
+	return p[name]
+}
+
+// String 按参数名排序输出，例如 long=20 short=5
+func (p Params) String() string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+strconv.FormatFloat(p[name], 'g', -1, 64))
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParamRange 一个参数的候选值
+type ParamRange struct {
+	Name   string
+	Values []float64
+}
+
+// IntRange [min, max] 内步长为 step 的整数候选值
+func IntRange(name string, min, max, step int) ParamRange {
+	r := ParamRange{Name: name}
+	for v := min; step > 0 && v <= max; v += step {
+		r.Values = append(r.Values, float64(v))
+	}
+	return r
+}
+
+// FloatRange [min, max] 内步长为 step 的候选值
+func FloatRange(name string, min, max, step float64) ParamRange {
+	r := ParamRange{Name: name}
+	// 按下标计算，避免累加的浮点误差漏掉 max
+	for i := 0; step > 0; i++ {
+		v := min + float64(i)*step
+		if v > max+step*1e-9 {
+			break
+		}
+		r.Values = append(r.Values, v)
+	}
+	return r
+}
+
+// ParamSpace 参数空间，网格为各参数候选值的笛卡尔积
+type ParamSpace []ParamRange
+
+// Size 网格中的参数组合数量
+func (s ParamSpace) Size() int {
+	if len(s) == 0 {
+		return 0
+	}
+	size := 1
+	for _, r := range s {
+		size *= len(r.Values)
+	}
+	return size
+}
+
+// Grid 按顺序列出所有参数组合，最后一个参数变化最快
+func (s ParamSpace) Grid() []Params {
+	size := s.Size()
+	grid := make([]Params, 0, size)
+	for i := 0; i < size; i++ {
+		grid = append(grid, s.at(i))
+	}
+	return grid
+}
+
+// Sample 从网格中不重复地随机抽取 n 组参数，n 不小于网格大小时返回整个网格
+func (s ParamSpace) Sample(n int, rng *rand.Rand) []Params {
+	size := s.Size()
+	if n >= size {
+		return s.Grid()
+	}
+	picked := make(map[int]bool, n)
+	samples := make([]Params, 0, n)
+	for len(samples) < n {
+		i := rng.Intn(size)
+		if picked[i] {
+			continue
+		}
+		picked[i] = true
+		samples = append(samples, s.at(i))
+	}
+	return samples
+}
+
+// at 第 index 组参数（混合进制展开）
+func (s ParamSpace) at(index int) Params {
+	params := make(Params, len(s))
+	for i := len(s) - 1; i >= 0; i-- {
+		values := s[i].Values
+		params[s[i].Name] = values[index%len(values)]
+		index /= len(values)
+	}
+	return params
+}
+
+func (s ParamSpace) validate() error {
+	if len(s) == 0 {
+		return fmt.Errorf("empty param space")
+	}
+	seen := make(map[string]bool, len(s))
+	for _, r := range s {
+		if r.Name == "" {
+			return fmt.Errorf("param name is empty")
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("duplicate param: %s", r.Name)
+		}
+		seen[r.Name] = true
+		if len(r.Values) == 0 {
+			return fmt.Errorf("param %s has no values", r.Name)
+		}
+	}
+	return nil
+}
+
+// StrategyFactory 按参数创建一个新的策略实例，参数组合无效时返回错误（该组合记为失败）
+type StrategyFactory func(params Params) (strategy.Strategy, error)
+
+// OptimizeResult 一组参数的回测结果
+type OptimizeResult struct {
+	Rank   int // 按指标排名，从 1 开始，失败的组合为 0
+	Params Params
+	Score  decimal.Decimal  // 排序指标的值
+	Report analytics.Report // 不含资金曲线和仓位事件，避免大量回测占用内存
+	Err    error
+}
+
+// Optimizer 参数优化：对每组参数运行一次独立的回测，按指标排序
+//
+// 每次回测使用独立的 BacktestEngine、backtest.ExchangeService 和仓位管理器，
+// 多个 worker 并行运行，K线通过 MemoryKlineProvider 共享，只从上游加载一次。
+type Optimizer struct {
+	startTime      time.Time
+	endTime        time.Time
+	initialBalance decimal.Decimal
+	klineProvider  backtest.KlineProvider
+	riskConfig     portfolio.RiskConfig
+	factory        StrategyFactory
+
+	workers int
+	metric  OptimizeMetric
+	setup   func(ctx context.Context, svc *backtest.ExchangeService) error
+	flatten bool // 每次回测结束时平掉全部持仓，见 BacktestEngine.SetFlattenAtEnd
+}
+
+// NewOptimizer 创建参数优化器，provider 需要能一次返回整个请求范围的K线（见 MemoryKlineProvider）
+func NewOptimizer(
+	startTime, endTime time.Time,
+	initialBalance decimal.Decimal,
+	provider backtest.KlineProvider,
+	riskConfig portfolio.RiskConfig,
+	factory StrategyFactory,
+) *Optimizer {
+	return &Optimizer{
+		startTime:      startTime,
+		endTime:        endTime,
+		initialBalance: initialBalance,
+		klineProvider:  backtest.NewMemoryKlineProvider(provider),
+		riskConfig:     riskConfig,
+		factory:        factory,
+		workers:        runtime.NumCPU(),
+		metric:         MetricSharpeRatio,
+	}
+}
+
+// SetWorkers 设置并行回测的数量，默认为 CPU 核数
+func (o *Optimizer) SetWorkers(workers int) {
+	if workers > 0 {
+		o.workers = workers
+	}
+}
+
+// SetMetric 设置排序指标，默认夏普比率
+func (o *Optimizer) SetMetric(metric OptimizeMetric) {
+	o.metric = metric
+}
+
+// SetExchangeSetup 设置每次回测前对交易所的配置，例如杠杆、手续费、滑点
+func (o *Optimizer) SetExchangeSetup(setup func(ctx context.Context, svc *backtest.ExchangeService) error) {
+	o.setup = setup
+}
+
+// GridSearch 网格搜索：回测参数空间内的所有组合
+func (o *Optimizer) GridSearch(ctx context.Context, space ParamSpace) ([]OptimizeResult, error) {
+	if err := space.validate(); err != nil {
+		return nil, err
+	}
+	return o.run(ctx, space.Grid())
+}
+
+// RandomSearch 随机搜索：从参数空间的网格中不重复地抽取 samples 组参数回测，seed 相同时结果可复现
+func (o *Optimizer) RandomSearch(ctx context.Context, space ParamSpace, samples int, seed int64) ([]OptimizeResult, error) {
+	if err := space.validate(); err != nil {
+		return nil, err
+	}
+	if samples <= 0 {
+		return nil, fmt.Errorf("invalid samples: %d", samples)
+	}
+	return o.run(ctx, space.Sample(samples, rand.New(rand.NewSource(seed))))
+}
+
+// run 并行回测所有参数组合并排序，ctx 取消时返回 ctx 的错误
+func (o *Optimizer) run(ctx context.Context, paramsList []Params) ([]OptimizeResult, error) {
+	if _, err := o.metric.Value(analytics.Report{}); err != nil {
+		return nil, err
+	}
+
+	results := make([]OptimizeResult, len(paramsList))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < o.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = o.runOne(ctx, paramsList[i])
+			}
+		}()
+	}
+
+	for i := range paramsList {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rankResults(results, o.metric)
+	return results, nil
+}
+
+// runOne 用一组参数运行一次独立的回测
+func (o *Optimizer) runOne(ctx context.Context, params Params) OptimizeResult {
+	result := OptimizeResult{Params: params}
+	report, _, err := o.runBacktest(ctx, params)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	report.Equity = nil
+	report.Events = nil
+	result.Report = report
+	result.Score, _ = o.metric.Value(report)
+	return result
+}
+
+// runBacktest 用一组参数运行一次独立的回测，返回完整报告和历史仓位
+func (o *Optimizer) runBacktest(ctx context.Context, params Params) (analytics.Report, []exchange.PositionHistory, error) {
+	sg, err := o.factory(params)
+	if err != nil {
+		return analytics.Report{}, nil, fmt.Errorf("create strategy failed: %w", err)
+	}
+
+	exchangeSvc := backtest.NewExchangeService(o.startTime, o.endTime, o.initialBalance, o.klineProvider)
+	if o.setup != nil {
+		if err := o.setup(ctx, exchangeSvc); err != nil {
+			return analytics.Report{}, nil, fmt.Errorf("setup exchange failed: %w", err)
+		}
+	}
+
+	sizer := portfolio.NewSimplePositionSizer(exchangeSvc)
+	if err := sizer.Initialize(ctx, o.riskConfig); err != nil {
+		return analytics.Report{}, nil, fmt.Errorf("initialize position sizer failed: %w", err)
+	}
+
+	engine := NewBacktestEngine(o.startTime, o.endTime, exchangeSvc)
+	engine.positionSizer = sizer
+	engine.quiet = true
+	engine.flatten = o.flatten
+	if err := engine.AddStrategy(ctx, sg); err != nil {
+		return analytics.Report{}, nil, fmt.Errorf("add strategy failed: %w", err)
+	}
+	if err := engine.Run(ctx); err != nil {
+		return analytics.Report{}, nil, fmt.Errorf("run backtest failed: %w", err)
+	}
+
+	histories, err := exchangeSvc.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{})
+	if err != nil {
+		return analytics.Report{}, nil, fmt.Errorf("get history positions failed: %w", err)
+	}
+	return engine.Report(), histories, nil
+}
+
+// withRange 复制一个回测区间和初始资金不同的优化器，共享K线缓存和其他配置
+func (o *Optimizer) withRange(startTime, endTime time.Time, initialBalance decimal.Decimal) *Optimizer {
+	clone := *o
+	clone.startTime = startTime
+	clone.endTime = endTime
+	clone.initialBalance = initialBalance
+	return &clone
+}
+
+// rankResults 按指标排序，失败的组合排在最后，指标相同时保持参数组合的顺序
+func rankResults(results []OptimizeResult, metric OptimizeMetric) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if (a.Err == nil) != (b.Err == nil) {
+			return a.Err == nil
+		}
+		if metric.lowerIsBetter() {
+			return a.Score.LessThan(b.Score)
+		}
+		return a.Score.GreaterThan(b.Score)
+	})
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Rank = i + 1
+		}
+	}
+}
+
+// WriteResultsTable 以对齐的表格输出优化结果
+func WriteResultsTable(w io.Writer, results []OptimizeResult, metric OptimizeMetric) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "RANK\tPARAMS\t%s\tRETURN\tMAX_DD\tSHARPE\tTRADES\tWIN_RATE\tERROR\n", strings.ToUpper(string(metric)))
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(tw, "-\t%s\t-\t-\t-\t-\t-\t-\t%v\n", r.Params, r.Err)
+			continue
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t\n",
+			r.Rank,
+			r.Params,
+			r.Score.StringFixed(4),
+			percent(r.Report.Account.TotalReturn),
+			percent(r.Report.Risk.MaxDrawdownPercent),
+			r.Report.Account.SharpeRatio.StringFixed(2),
+			r.Report.Trading.TotalTrades,
+			percent(r.Report.Trading.WinRate),
+		)
+	}
+	return tw.Flush()
+}
+
+func percent(ratio decimal.Decimal) string {
+	return ratio.Mul(decimal.NewFromInt(100)).StringFixed(2) + "%"
+}
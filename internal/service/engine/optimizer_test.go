@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/KNICEX/trading-agent/internal/service/exchange/backtest"
+	"github.com/KNICEX/trading-agent/internal/service/portfolio"
+	"github.com/KNICEX/trading-agent/internal/service/strategy"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParamSpace 测试网格展开和随机抽样
+func TestParamSpace(t *testing.T) {
+	space := ParamSpace{
+		IntRange("short", 3, 7, 2),
+		FloatRange("ratio", 0.1, 0.3, 0.1),
+	}
+	assert.Equal(t, 9, space.Size())
+
+	grid := space.Grid()
+	require.Len(t, grid, 9)
+	// 最后一个参数变化最快
+	assert.Equal(t, "ratio=0.1 short=3", grid[0].String())
+	assert.Equal(t, "ratio=0.2 short=3", grid[1].String())
+	assert.Equal(t, 7, grid[8].Int("short"))
+	assert.InDelta(t, 0.3, grid[8].Float("ratio"), 1e-9)
+
+	// 相同种子抽样结果相同，且不重复
+	a := space.Sample(5, rand.New(rand.NewSource(42)))
+	b := space.Sample(5, rand.New(rand.NewSource(42)))
+	assert.Equal(t, a, b)
+	seen := make(map[string]bool)
+	for _, params := range a {
+		assert.False(t, seen[params.String()], "duplicate sample %s", params)
+		seen[params.String()] = true
+	}
+	// 抽样数量超过网格大小时返回整个网格
+	assert.Len(t, space.Sample(100, rand.New(rand.NewSource(1))), 9)
+
+	assert.Error(t, ParamSpace{{Name: "short"}}.validate())
+	assert.Error(t, ParamSpace{IntRange("short", 1, 2, 1), IntRange("short", 1, 2, 1)}.validate())
+}
+
+// TestOptimizer_GridSearch 测试网格搜索：每组参数独立回测、并行结果与串行一致、按指标排序并输出表格
+func TestOptimizer_GridSearch(t *testing.T) {
+	ctx := context.Background()
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	interval := exchange.Interval1h
+	// 留出策略初始化需要的历史K线
+	dataStart := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	startTime := dataStart.Add(3 * 24 * time.Hour)
+	endTime := startTime.Add(10 * 24 * time.Hour)
+
+	provider := sineKlineProvider(pair, interval, dataStart, 13*24)
+
+	newOptimizer := func(workers int) *Optimizer {
+		optimizer := NewOptimizer(startTime, endTime, decimal.NewFromInt(10000), provider, testOptimizerRiskConfig, maStrategyFactory(pair))
+		optimizer.SetWorkers(workers)
+		optimizer.SetMetric(MetricTotalReturn)
+		optimizer.SetExchangeSetup(func(ctx context.Context, svc *backtest.ExchangeService) error {
+			return svc.SetLeverage(ctx, exchange.SetLeverageReq{TradingPair: pair, Leverage: 10})
+		})
+		return optimizer
+	}
+	// short=10 long=10 无效，记为失败
+	space := ParamSpace{
+		IntRange("short", 3, 10, 7),
+		IntRange("long", 10, 20, 10),
+	}
+
+	// 参数优化时回测引擎不打印信号和下单日志
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	results, err := newOptimizer(4).GridSearch(ctx, space)
+	log.SetOutput(os.Stderr)
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	assert.NotContains(t, logs.String(), "[executor]")
+	assert.NotContains(t, logs.String(), "execute error")
+
+	last := results[len(results)-1]
+	assert.Error(t, last.Err)
+	assert.Equal(t, 0, last.Rank)
+	assert.Equal(t, "long=10 short=10", last.Params.String())
+
+	traded := false
+	for i, r := range results[:3] {
+		require.NoError(t, r.Err)
+		assert.Equal(t, i+1, r.Rank)
+		assert.True(t, r.Score.Equal(r.Report.Account.TotalReturn))
+		assert.Nil(t, r.Report.Equity)
+		if i > 0 {
+			assert.True(t, r.Score.LessThanOrEqual(results[i-1].Score), "results should be sorted by score")
+		}
+		traded = traded || r.Report.Trading.TotalTrades > 0
+	}
+	assert.True(t, traded, "at least one param set should trade")
+
+	// 并行回测互不影响，与串行的结果一致
+	serial, err := newOptimizer(1).GridSearch(ctx, space)
+	require.NoError(t, err)
+	for i := range results {
+		assert.Equal(t, results[i].Params, serial[i].Params)
+		assert.True(t, results[i].Score.Equal(serial[i].Score), "params %s: %s != %s", results[i].Params, results[i].Score, serial[i].Score)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteResultsTable(&buf, results, MetricTotalReturn))
+	assert.Contains(t, buf.String(), "TOTAL_RETURN")
+	assert.Contains(t, buf.String(), "long=20 short=3")
+	assert.Contains(t, buf.String(), "invalid ma periods")
+}
+
+var testOptimizerRiskConfig = portfolio.RiskConfig{
+	MaxStopLossRatio:    0.03,
+	MaxLeverage:         10,
+	MinProfitLossRatio:  2,
+	ConfidenceThreshold: 0.6,
+}
+
+// sineKlineProvider 生成从 start 开始的 n 根正弦走势K线，均线反复交叉
+func sineKlineProvider(pair exchange.TradingPair, interval exchange.Interval, start time.Time, n int) *backtest.MockKlineProvider {
+	provider := backtest.NewMockKlineProvider()
+	var klines []exchange.Kline
+	for i := 0; i < n; i++ {
+		price := 100 + 10*math.Sin(float64(i)/12)
+		openTime := start.Add(time.Duration(i) * interval.Duration())
+		klines = append(klines, exchange.Kline{
+			OpenTime:  openTime,
+			CloseTime: openTime.Add(interval.Duration()),
+			Open:      decimal.NewFromFloat(price * 0.999),
+			High:      decimal.NewFromFloat(price * 1.003),
+			Low:       decimal.NewFromFloat(price * 0.997),
+			Close:     decimal.NewFromFloat(price),
+			Volume:    decimal.NewFromInt(1000),
+		})
+	}
+	provider.AddKlines(pair, interval, klines)
+	return provider
+}
+
+// maStrategyFactory 按 short、long 参数创建均线交叉策略
+func maStrategyFactory(pair exchange.TradingPair) StrategyFactory {
+	return func(params Params) (strategy.Strategy, error) {
+		sg := strategy.NewSimpleTestStrategy(pair)
+		if err := sg.SetPeriods(params.Int("short"), params.Int("long")); err != nil {
+			return nil, err
+		}
+		return sg, nil
+	}
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/KNICEX/trading-agent/internal/service/strategy"
+)
+
+// streamKline 某一路K线流收到的一根K线
+type streamKline struct {
+	sub   strategy.Subscription
+	kline exchange.Kline
+}
+
+// subscribeStreams 订阅策略的全部K线流并合并到一个通道，所有流结束或 ctx 取消后关闭
+// 任何一路订阅失败时取消已经订阅的流并返回错误
+func subscribeStreams(ctx context.Context, streamSvc exchange.KlineStreamService, subs []strategy.Subscription) (chan streamKline, error) {
+	streamCtx, cancel := context.WithCancel(ctx)
+
+	klineChans := make([]chan exchange.Kline, 0, len(subs))
+	for _, sub := range subs {
+		klineChan, err := streamSvc.SubscribeKline(streamCtx, sub.TradingPair, sub.Interval)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("subscribe kline %s %s failed: %w", sub.TradingPair.ToString(), sub.Interval.ToString(), err)
+		}
+		klineChans = append(klineChans, klineChan)
+	}
+
+	out := make(chan streamKline)
+	wg := sync.WaitGroup{}
+	for i, klineChan := range klineChans {
+		sub := subs[i]
+		klineChan := klineChan
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for kline := range klineChan {
+				select {
+				case out <- streamKline{sub: sub, kline: kline}:
+				case <-streamCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(out)
+	}()
+	return out, nil
+}
+
+// strategySignals 把一路K线交给策略处理，返回需要执行的信号
+// 没有填写交易对的信号使用这一路K线的交易对，不属于策略订阅的交易对的信号会被丢弃
+func strategySignals(ctx context.Context, sg strategy.Strategy, sub strategy.Subscription, kline exchange.Kline) ([]strategy.Signal, error) {
+	signals, err := strategy.HandleKline(ctx, sg, sub, kline)
+	if err != nil {
+		return nil, err
+	}
+
+	subs := strategy.SubscriptionsOf(sg)
+	// 策略可能复用返回的切片，过滤结果写入新的切片
+	valid := make([]strategy.Signal, 0, len(signals))
+	for _, signal := range signals {
+		if signal.TradingPair.IsZero() {
+			signal.TradingPair = sub.TradingPair
+		}
+		if !subscribesPair(subs, signal.TradingPair) {
+			log.Printf("strategy %s emitted signal for unsubscribed pair %s, dropped", sg.Name(), signal.TradingPair.ToString())
+			continue
+		}
+		valid = append(valid, signal)
+	}
+	return valid, nil
+}
+
+func subscribesPair(subs []strategy.Subscription, pair exchange.TradingPair) bool {
+	for _, sub := range subs {
+		if sub.TradingPair == pair {
+			return true
+		}
+	}
+	return false
+}
+
+// strategyPairs 策略涉及的交易对（去重）
+func strategyPairs(strategies []strategy.Strategy) []exchange.TradingPair {
+	seen := make(map[exchange.TradingPair]bool)
+	pairs := make([]exchange.TradingPair, 0, len(strategies))
+	for _, sg := range strategies {
+		for _, sub := range strategy.SubscriptionsOf(sg) {
+			if !seen[sub.TradingPair] {
+				seen[sub.TradingPair] = true
+				pairs = append(pairs, sub.TradingPair)
+			}
+		}
+	}
+	return pairs
+}
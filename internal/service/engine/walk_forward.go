@@ -0,0 +1,264 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/analytics"
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+)
+
+// walkForwardYear 年化收益按自然年计算，与 analytics 一致
+const walkForwardYear = 365 * 24 * time.Hour
+
+// WalkForwardMode 样本内窗口的划分方式
+type WalkForwardMode int
+
+const (
+	// WalkForwardRolling 样本内窗口长度固定，随样本外窗口一起向后滚动
+	WalkForwardRolling WalkForwardMode = iota
+	// WalkForwardAnchored 样本内窗口起点固定在开始时间，逐步变长
+	WalkForwardAnchored
+)
+
+func (m WalkForwardMode) String() string {
+	if m == WalkForwardAnchored {
+		return "anchored"
+	}
+	return "rolling"
+}
+
+// WalkForwardWindow 一轮前进分析的样本内 [InSampleStart, InSampleEnd) 和样本外 [OutOfSampleStart, OutOfSampleEnd) 区间
+type WalkForwardWindow struct {
+	InSampleStart    time.Time
+	InSampleEnd      time.Time
+	OutOfSampleStart time.Time
+	OutOfSampleEnd   time.Time
+}
+
+// SplitWalkForward 把 [startTime, endTime) 划分为前后相接的样本外窗口，每个窗口之前是对应的样本内窗口
+// 样本外窗口依次向后移动 outOfSample，最后一个不足 outOfSample 时截断到 endTime
+func SplitWalkForward(startTime, endTime time.Time, inSample, outOfSample time.Duration, mode WalkForwardMode) ([]WalkForwardWindow, error) {
+	if inSample <= 0 || outOfSample <= 0 {
+		return nil, fmt.Errorf("invalid walk forward windows: in-sample=%s, out-of-sample=%s", inSample, outOfSample)
+	}
+	if !startTime.Add(inSample).Before(endTime) {
+		return nil, fmt.Errorf("range %s - %s is too short for in-sample window %s",
+			startTime.Format(time.RFC3339), endTime.Format(time.RFC3339), inSample)
+	}
+
+	var windows []WalkForwardWindow
+	for oosStart := startTime.Add(inSample); oosStart.Before(endTime); oosStart = oosStart.Add(outOfSample) {
+		window := WalkForwardWindow{
+			InSampleStart:    oosStart.Add(-inSample),
+			InSampleEnd:      oosStart,
+			OutOfSampleStart: oosStart,
+			OutOfSampleEnd:   oosStart.Add(outOfSample),
+		}
+		if mode == WalkForwardAnchored {
+			window.InSampleStart = startTime
+		}
+		if window.OutOfSampleEnd.After(endTime) {
+			window.OutOfSampleEnd = endTime
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// WalkForwardWindowResult 一轮前进分析的结果
+type WalkForwardWindowResult struct {
+	Window      WalkForwardWindow
+	Params      Params           // 样本内最优参数
+	InSample    analytics.Report // 最优参数的样本内报告，不含资金曲线
+	OutOfSample analytics.Report // 最优参数的样本外报告
+	// Efficiency 前进效率：样本外年化收益 / 样本内年化收益
+	Efficiency decimal.Decimal
+}
+
+// WalkForwardReport 前进分析报告
+type WalkForwardReport struct {
+	Mode    WalkForwardMode
+	Windows []WalkForwardWindowResult
+
+	// Report 拼接所有样本外资金曲线和仓位后的完整报告
+	Report analytics.Report
+	// Efficiency 整体前进效率：各轮样本外年化收益的均值 / 样本内年化收益的均值，
+	// 样本内年化收益不为正时为 0
+	Efficiency decimal.Decimal
+}
+
+// WalkForward 前进分析：在样本内窗口优化参数，用最优参数回测紧随其后的样本外窗口，
+// 再把各轮样本外结果拼接成一条资金曲线评估策略
+//
+// 回测区间、初始资金、策略工厂、风控和排序指标都来自 optimizer；
+// 每轮样本外回测结束时撤销挂单并市价平掉全部持仓（计入手续费和滑点），
+// 下一轮以平仓后的期末资金作为初始资金，资金曲线首尾相接。
+type WalkForward struct {
+	optimizer   *Optimizer
+	inSample    time.Duration
+	outOfSample time.Duration
+	mode        WalkForwardMode
+
+	samples int // 随机搜索的组合数量，0 表示网格搜索
+	seed    int64
+}
+
+// NewWalkForward 创建前进分析，默认滚动窗口、网格搜索
+func NewWalkForward(optimizer *Optimizer, inSample, outOfSample time.Duration) *WalkForward {
+	return &WalkForward{
+		optimizer:   optimizer,
+		inSample:    inSample,
+		outOfSample: outOfSample,
+		mode:        WalkForwardRolling,
+	}
+}
+
+// SetMode 设置样本内窗口的划分方式
+func (w *WalkForward) SetMode(mode WalkForwardMode) {
+	w.mode = mode
+}
+
+// SetRandomSearch 样本内改用随机搜索，每轮抽取 samples 组参数
+func (w *WalkForward) SetRandomSearch(samples int, seed int64) {
+	w.samples = samples
+	w.seed = seed
+}
+
+// Run 依次执行每一轮样本内优化和样本外回测
+func (w *WalkForward) Run(ctx context.Context, space ParamSpace) (WalkForwardReport, error) {
+	o := w.optimizer
+	windows, err := SplitWalkForward(o.startTime, o.endTime, w.inSample, w.outOfSample, w.mode)
+	if err != nil {
+		return WalkForwardReport{}, err
+	}
+
+	result := WalkForwardReport{Mode: w.mode}
+	balance := o.initialBalance
+	var equity []analytics.EquityPoint
+	var histories []exchange.PositionHistory
+	var isAnnualized, oosAnnualized decimal.Decimal
+
+	for i, window := range windows {
+		best, err := w.optimizeInSample(ctx, window, space)
+		if err != nil {
+			return WalkForwardReport{}, fmt.Errorf("walk forward window %d: %w", i+1, err)
+		}
+
+		oos := o.withRange(window.OutOfSampleStart, window.OutOfSampleEnd, balance)
+		// 样本外窗口结束时平仓，下一轮从已实现的资金开始，窗口末尾的持仓计入历史持仓
+		oos.flatten = true
+		report, oosHistories, err := oos.runBacktest(ctx, best.Params)
+		if err != nil {
+			return WalkForwardReport{}, fmt.Errorf("walk forward window %d out-of-sample: %w", i+1, err)
+		}
+
+		// 每轮的第一个点是初始资金，与上一轮的最后一个点重合
+		points := report.Equity
+		if len(equity) > 0 && len(points) > 0 {
+			points = points[1:]
+		}
+		equity = append(equity, points...)
+		histories = append(histories, oosHistories...)
+		balance = report.Account.FinalBalance
+
+		isReturn := annualizedReturn(best.Report)
+		oosReturn := annualizedReturn(report)
+		isAnnualized = isAnnualized.Add(isReturn)
+		oosAnnualized = oosAnnualized.Add(oosReturn)
+
+		report.Equity = nil
+		result.Windows = append(result.Windows, WalkForwardWindowResult{
+			Window:      window,
+			Params:      best.Params,
+			InSample:    best.Report,
+			OutOfSample: report,
+			Efficiency:  efficiency(oosReturn, isReturn),
+		})
+	}
+
+	// 窗口数量相同，均值之比等于总和之比
+	result.Efficiency = efficiency(oosAnnualized, isAnnualized)
+	result.Report = analytics.BuildReport(analytics.ReportInput{
+		StrategyName:   result.Windows[0].OutOfSample.StrategyName,
+		TradingPair:    result.Windows[0].OutOfSample.TradingPair,
+		InitialBalance: o.initialBalance,
+		StartTime:      windows[0].OutOfSampleStart,
+		EndTime:        windows[len(windows)-1].OutOfSampleEnd,
+		Equity:         equity,
+		Histories:      histories,
+	})
+	return result, nil
+}
+
+// optimizeInSample 在样本内窗口优化参数，返回排名第一的结果
+func (w *WalkForward) optimizeInSample(ctx context.Context, window WalkForwardWindow, space ParamSpace) (OptimizeResult, error) {
+	o := w.optimizer.withRange(window.InSampleStart, window.InSampleEnd, w.optimizer.initialBalance)
+
+	var results []OptimizeResult
+	var err error
+	if w.samples > 0 {
+		results, err = o.RandomSearch(ctx, space, w.samples, w.seed)
+	} else {
+		results, err = o.GridSearch(ctx, space)
+	}
+	if err != nil {
+		return OptimizeResult{}, err
+	}
+	if len(results) == 0 || results[0].Err != nil {
+		return OptimizeResult{}, fmt.Errorf("no valid params in-sample")
+	}
+	return results[0], nil
+}
+
+// annualizedReturn 按报告区间长度线性年化的收益率
+func annualizedReturn(report analytics.Report) decimal.Decimal {
+	if report.Duration <= 0 {
+		return decimal.Zero
+	}
+	years := decimal.NewFromInt(int64(report.Duration)).Div(decimal.NewFromInt(int64(walkForwardYear)))
+	return report.Account.TotalReturn.Div(years)
+}
+
+// efficiency 前进效率，样本内收益不为正时没有意义，返回 0
+func efficiency(oosReturn, isReturn decimal.Decimal) decimal.Decimal {
+	if !isReturn.IsPositive() {
+		return decimal.Zero
+	}
+	return oosReturn.Div(isReturn)
+}
+
+// WriteWalkForwardTable 以对齐的表格输出每一轮的参数和样本内外表现，最后一行为拼接后的样本外汇总
+func WriteWalkForwardTable(out io.Writer, report WalkForwardReport) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WINDOW\tIN_SAMPLE\tOUT_OF_SAMPLE\tPARAMS\tIS_RETURN\tOOS_RETURN\tOOS_MAX_DD\tOOS_TRADES\tWFE\t")
+	for i, r := range report.Windows {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t\n",
+			i+1,
+			formatRange(r.Window.InSampleStart, r.Window.InSampleEnd),
+			formatRange(r.Window.OutOfSampleStart, r.Window.OutOfSampleEnd),
+			r.Params,
+			percent(r.InSample.Account.TotalReturn),
+			percent(r.OutOfSample.Account.TotalReturn),
+			percent(r.OutOfSample.Risk.MaxDrawdownPercent),
+			r.OutOfSample.Trading.TotalTrades,
+			r.Efficiency.StringFixed(2),
+		)
+	}
+	fmt.Fprintf(tw, "total\t\t%s\t\t\t%s\t%s\t%d\t%s\t\n",
+		formatRange(report.Report.StartTime, report.Report.EndTime),
+		percent(report.Report.Account.TotalReturn),
+		percent(report.Report.Risk.MaxDrawdownPercent),
+		report.Report.Trading.TotalTrades,
+		report.Efficiency.StringFixed(2),
+	)
+	return tw.Flush()
+}
+
+func formatRange(start, end time.Time) string {
+	return start.Format("2006-01-02") + "~" + end.Format("2006-01-02")
+}
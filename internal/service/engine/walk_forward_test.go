@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/KNICEX/trading-agent/internal/service/exchange/backtest"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSplitWalkForward 测试滚动和锚定两种窗口划分
+func TestSplitWalkForward(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(10 * day)
+
+	rolling, err := SplitWalkForward(start, end, 4*day, 2*day, WalkForwardRolling)
+	require.NoError(t, err)
+	require.Len(t, rolling, 3)
+	for i, w := range rolling {
+		oosStart := start.Add(time.Duration(4+2*i) * day)
+		assert.Equal(t, oosStart.Add(-4*day), w.InSampleStart)
+		assert.Equal(t, oosStart, w.InSampleEnd)
+		assert.Equal(t, oosStart, w.OutOfSampleStart)
+		assert.Equal(t, oosStart.Add(2*day), w.OutOfSampleEnd)
+	}
+
+	// 锚定模式样本内起点不变；最后一个样本外窗口截断到结束时间
+	anchored, err := SplitWalkForward(start, end, 4*day, 4*day, WalkForwardAnchored)
+	require.NoError(t, err)
+	require.Len(t, anchored, 2)
+	assert.Equal(t, start, anchored[1].InSampleStart)
+	assert.Equal(t, start.Add(8*day), anchored[1].InSampleEnd)
+	assert.Equal(t, end, anchored[1].OutOfSampleEnd)
+
+	_, err = SplitWalkForward(start, end, 10*day, day, WalkForwardRolling)
+	assert.Error(t, err)
+	_, err = SplitWalkForward(start, end, 4*day, 0, WalkForwardRolling)
+	assert.Error(t, err)
+}
+
+// TestWalkForward_Run 测试每轮样本内优化后回测样本外，资金曲线首尾相接并汇总成完整报告
+func TestWalkForward_Run(t *testing.T) {
+	ctx := context.Background()
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	interval := exchange.Interval1h
+	dataStart := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	startTime := dataStart.Add(3 * 24 * time.Hour)
+	endTime := startTime.Add(12 * 24 * time.Hour)
+	provider := sineKlineProvider(pair, interval, dataStart, 15*24)
+
+	initialBalance := decimal.NewFromInt(10000)
+	optimizer := NewOptimizer(startTime, endTime, initialBalance, provider, testOptimizerRiskConfig, maStrategyFactory(pair))
+	optimizer.SetMetric(MetricTotalReturn)
+	optimizer.SetExchangeSetup(func(ctx context.Context, svc *backtest.ExchangeService) error {
+		return svc.SetLeverage(ctx, exchange.SetLeverageReq{TradingPair: pair, Leverage: 10})
+	})
+	space := ParamSpace{
+		IntRange("short", 3, 5, 2),
+		IntRange("long", 10, 20, 10),
+	}
+
+	wf := NewWalkForward(optimizer, 6*24*time.Hour, 3*24*time.Hour)
+	report, err := wf.Run(ctx, space)
+	require.NoError(t, err)
+	require.Len(t, report.Windows, 2)
+	assert.Equal(t, WalkForwardRolling, report.Mode)
+
+	balance := initialBalance
+	totalTrades := 0
+	for _, w := range report.Windows {
+		assert.NotEmpty(t, w.Params.String())
+		// 每轮以上一轮样本外的期末权益开始
+		assert.True(t, w.OutOfSample.Account.InitialBalance.Equal(balance), "%s != %s", w.OutOfSample.Account.InitialBalance, balance)
+		assert.True(t, w.InSample.Account.InitialBalance.Equal(initialBalance))
+		assert.Nil(t, w.OutOfSample.Equity)
+		balance = w.OutOfSample.Account.FinalBalance
+		totalTrades += w.OutOfSample.Trading.TotalTrades
+	}
+
+	full := report.Report
+	assert.Equal(t, startTime.Add(6*24*time.Hour), full.StartTime)
+	assert.Equal(t, endTime, full.EndTime)
+	assert.True(t, full.Account.InitialBalance.Equal(initialBalance))
+	assert.True(t, full.Account.FinalBalance.Equal(balance), "%s != %s", full.Account.FinalBalance, balance)
+	assert.Equal(t, totalTrades, full.Trading.TotalTrades)
+	for i := 1; i < len(full.Equity); i++ {
+		assert.True(t, full.Equity[i].Timestamp.After(full.Equity[i-1].Timestamp), "stitched equity should be strictly increasing in time")
+	}
+
+	// 锚定模式 + 随机搜索，相同种子结果一致
+	wf.SetMode(WalkForwardAnchored)
+	wf.SetRandomSearch(3, 7)
+	a, err := wf.Run(ctx, space)
+	require.NoError(t, err)
+	b, err := wf.Run(ctx, space)
+	require.NoError(t, err)
+	require.Len(t, a.Windows, 2)
+	assert.Equal(t, startTime, a.Windows[1].Window.InSampleStart)
+	for i := range a.Windows {
+		assert.Equal(t, a.Windows[i].Params, b.Windows[i].Params)
+	}
+	assert.True(t, a.Report.Account.FinalBalance.Equal(b.Report.Account.FinalBalance))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteWalkForwardTable(&buf, report))
+	assert.Contains(t, buf.String(), "WFE")
+	assert.Contains(t, buf.String(), "total")
+}
@@ -0,0 +1,180 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/entity"
+	"github.com/KNICEX/trading-agent/internal/repo"
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+)
+
+// cacheFetchBatch 每次向上游请求的K线数量，币安默认单次最多返回 500 根
+const cacheFetchBatch = 500
+
+// CachedKlineProvider 带本地缓存的K线提供者
+// 已缓存的时间范围直接从数据库读取，只向上游请求缺失的部分；范围全部命中时完全离线可用
+type CachedKlineProvider struct {
+	upstream KlineProvider
+	repo     repo.KlineRepo
+	now      func() time.Time
+}
+
+// NewCachedKlineProvider 创建缓存K线提供者，upstream 一般为 BinanceKlineProvider
+func NewCachedKlineProvider(upstream KlineProvider, klineRepo repo.KlineRepo) *CachedKlineProvider {
+	return &CachedKlineProvider{
+		upstream: upstream,
+		repo:     klineRepo,
+		now:      time.Now,
+	}
+}
+
+// GetKlines 获取 [StartTime, EndTime) 范围内的K线
+func (p *CachedKlineProvider) GetKlines(ctx context.Context, req exchange.GetKlinesReq) ([]exchange.Kline, error) {
+	if !req.StartTime.Before(req.EndTime) {
+		return []exchange.Kline{}, nil
+	}
+
+	// 只缓存已经收盘的K线，尚未收盘的部分每次都从上游获取
+	cacheEnd := req.EndTime
+	if limit := p.now().Add(-req.Interval.Duration()); cacheEnd.After(limit) {
+		cacheEnd = limit
+	}
+
+	var result []exchange.Kline
+	if req.StartTime.Before(cacheEnd) {
+		if err := p.fillGaps(ctx, req, cacheEnd); err != nil {
+			return nil, err
+		}
+		cached, err := p.repo.FindKlines(ctx, req.TradingPair.ToString(), req.Interval.ToString(), req.StartTime.UnixMilli(), cacheEnd.UnixMilli())
+		if err != nil {
+			return nil, fmt.Errorf("find cached klines: %w", err)
+		}
+		result = make([]exchange.Kline, 0, len(cached))
+		for _, k := range cached {
+			kline, err := fromKlineEntity(k)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, kline)
+		}
+	} else {
+		cacheEnd = req.StartTime
+	}
+
+	if cacheEnd.Before(req.EndTime) {
+		recent, err := p.fetch(ctx, req, cacheEnd, req.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, recent...)
+	}
+	return result, nil
+}
+
+// fillGaps 找出 [StartTime, cacheEnd) 中未缓存的范围，从上游获取并写入缓存
+func (p *CachedKlineProvider) fillGaps(ctx context.Context, req exchange.GetKlinesReq, cacheEnd time.Time) error {
+	symbol, interval := req.TradingPair.ToString(), req.Interval.ToString()
+	ranges, err := p.repo.FindRanges(ctx, symbol, interval, req.StartTime.UnixMilli(), cacheEnd.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("find cached ranges: %w", err)
+	}
+
+	cursor := req.StartTime
+	for _, r := range append(ranges, entity.KlineRange{StartTime: cacheEnd.UnixMilli(), EndTime: cacheEnd.UnixMilli()}) {
+		gapEnd := time.UnixMilli(r.StartTime)
+		if gapEnd.After(cacheEnd) {
+			gapEnd = cacheEnd
+		}
+
+		// 分批获取，每批单独落库，中断后已获取的部分不会丢失
+		batch := req.Interval.Duration() * cacheFetchBatch
+		for start := cursor; start.Before(gapEnd); start = start.Add(batch) {
+			end := start.Add(batch)
+			if end.After(gapEnd) {
+				end = gapEnd
+			}
+			klines, err := p.fetch(ctx, req, start, end)
+			if err != nil {
+				return err
+			}
+
+			entities := make([]entity.Kline, 0, len(klines))
+			for _, kline := range klines {
+				entities = append(entities, toKlineEntity(symbol, interval, kline))
+			}
+			if err := p.repo.SaveKlines(ctx, symbol, interval, start.UnixMilli(), end.UnixMilli(), entities); err != nil {
+				return fmt.Errorf("save klines to cache: %w", err)
+			}
+		}
+
+		if rangeEnd := time.UnixMilli(r.EndTime); rangeEnd.After(cursor) {
+			cursor = rangeEnd
+		}
+	}
+	return nil
+}
+
+// fetch 从上游获取 [start, end) 范围内的K线，过滤掉范围之外的数据（币安的 EndTime 是闭区间）
+func (p *CachedKlineProvider) fetch(ctx context.Context, req exchange.GetKlinesReq, start, end time.Time) ([]exchange.Kline, error) {
+	klines, err := p.upstream.GetKlines(ctx, exchange.GetKlinesReq{
+		TradingPair: req.TradingPair,
+		Interval:    req.Interval,
+		StartTime:   start,
+		EndTime:     end,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetch klines from upstream: %w", err)
+	}
+
+	result := make([]exchange.Kline, 0, len(klines))
+	for _, kline := range klines {
+		if !kline.OpenTime.Before(start) && kline.OpenTime.Before(end) {
+			result = append(result, kline)
+		}
+	}
+	return result, nil
+}
+
+func toKlineEntity(symbol, interval string, kline exchange.Kline) entity.Kline {
+	return entity.Kline{
+		Symbol:      symbol,
+		Interval:    interval,
+		OpenTime:    kline.OpenTime.UnixMilli(),
+		CloseTime:   kline.CloseTime.UnixMilli(),
+		Open:        kline.Open.String(),
+		High:        kline.High.String(),
+		Low:         kline.Low.String(),
+		Close:       kline.Close.String(),
+		Volume:      kline.Volume.String(),
+		QuoteVolume: kline.QuoteAssetVolume.String(),
+	}
+}
+
+func fromKlineEntity(k entity.Kline) (exchange.Kline, error) {
+	kline := exchange.Kline{
+		OpenTime:  time.UnixMilli(k.OpenTime),
+		CloseTime: time.UnixMilli(k.CloseTime),
+	}
+	values := []struct {
+		s      string
+		target *decimal.Decimal
+	}{
+		{k.Open, &kline.Open},
+		{k.High, &kline.High},
+		{k.Low, &kline.Low},
+		{k.Close, &kline.Close},
+		{k.Volume, &kline.Volume},
+		{k.QuoteVolume, &kline.QuoteAssetVolume},
+	}
+	for _, v := range values {
+		d, err := decimal.NewFromString(v.s)
+		if err != nil {
+			return exchange.Kline{}, fmt.Errorf("invalid cached kline %s %d: %w", k.Symbol, k.OpenTime, err)
+		}
+		*v.target = d
+	}
+	return kline, nil
+}
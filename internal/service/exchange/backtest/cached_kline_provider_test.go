@@ -0,0 +1,171 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/repo"
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// recordingKlineProvider 记录上游请求的K线提供者，offline 时返回错误
+type recordingKlineProvider struct {
+	*MockKlineProvider
+	requests []exchange.GetKlinesReq
+	offline  bool
+}
+
+func (p *recordingKlineProvider) GetKlines(ctx context.Context, req exchange.GetKlinesReq) ([]exchange.Kline, error) {
+	if p.offline {
+		return nil, errors.New("network unreachable")
+	}
+	p.requests = append(p.requests, req)
+	return p.MockKlineProvider.GetKlines(ctx, req)
+}
+
+func setupCachedProvider(t *testing.T, start time.Time, count int) (*CachedKlineProvider, *recordingKlineProvider, repo.KlineRepo) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "cache.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	require.NoError(t, repo.InitTables(db))
+
+	upstream := &recordingKlineProvider{MockKlineProvider: NewMockKlineProvider()}
+	upstream.GenerateKlines(filePair, exchange.Interval1h, start, 100, count, "up")
+
+	klineRepo := repo.NewKlineRepo(db)
+	return NewCachedKlineProvider(upstream, klineRepo), upstream, klineRepo
+}
+
+// TestCachedKlineProvider_CacheHit 测试第二次读取相同范围时不再请求上游，且可以离线使用
+func TestCachedKlineProvider_CacheHit(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	provider, upstream, _ := setupCachedProvider(t, start, 48)
+	ctx := context.Background()
+	req := exchange.GetKlinesReq{
+		TradingPair: filePair,
+		Interval:    exchange.Interval1h,
+		StartTime:   start,
+		EndTime:     start.Add(24 * time.Hour),
+	}
+
+	first, err := provider.GetKlines(ctx, req)
+	require.NoError(t, err)
+	require.Len(t, first, 24)
+	assert.Len(t, upstream.requests, 1)
+
+	upstream.offline = true
+	second, err := provider.GetKlines(ctx, req)
+	require.NoError(t, err)
+	require.Len(t, second, 24)
+	for i := range first {
+		assert.True(t, first[i].OpenTime.Equal(second[i].OpenTime))
+		assert.True(t, first[i].Close.Equal(second[i].Close))
+		assert.True(t, first[i].QuoteAssetVolume.Equal(second[i].QuoteAssetVolume))
+	}
+
+	// 未缓存的范围离线时返回错误
+	_, err = provider.GetKlines(ctx, exchange.GetKlinesReq{
+		TradingPair: filePair,
+		Interval:    exchange.Interval1h,
+		StartTime:   start.Add(24 * time.Hour),
+		EndTime:     start.Add(30 * time.Hour),
+	})
+	assert.Error(t, err)
+}
+
+// TestCachedKlineProvider_FetchOnlyGaps 测试只请求缺失的范围，并合并已缓存范围
+func TestCachedKlineProvider_FetchOnlyGaps(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	provider, upstream, klineRepo := setupCachedProvider(t, start, 48)
+	ctx := context.Background()
+	get := func(from, to int) []exchange.Kline {
+		klines, err := provider.GetKlines(ctx, exchange.GetKlinesReq{
+			TradingPair: filePair,
+			Interval:    exchange.Interval1h,
+			StartTime:   start.Add(time.Duration(from) * time.Hour),
+			EndTime:     start.Add(time.Duration(to) * time.Hour),
+		})
+		require.NoError(t, err)
+		return klines
+	}
+
+	get(0, 10)
+	get(20, 30)
+	upstream.requests = nil
+
+	klines := get(5, 40)
+	require.Len(t, klines, 35)
+	for i, kline := range klines {
+		assert.True(t, kline.OpenTime.Equal(start.Add(time.Duration(5+i)*time.Hour)))
+	}
+
+	// 只请求 [10, 20) 和 [30, 40)
+	require.Len(t, upstream.requests, 2)
+	assert.True(t, upstream.requests[0].StartTime.Equal(start.Add(10*time.Hour)))
+	assert.True(t, upstream.requests[0].EndTime.Equal(start.Add(20*time.Hour)))
+	assert.True(t, upstream.requests[1].StartTime.Equal(start.Add(30*time.Hour)))
+	assert.True(t, upstream.requests[1].EndTime.Equal(start.Add(40*time.Hour)))
+
+	// 相邻范围合并为一个
+	ranges, err := klineRepo.FindRanges(ctx, filePair.ToString(), "1h", 0, start.Add(100*time.Hour).UnixMilli())
+	require.NoError(t, err)
+	require.Len(t, ranges, 1)
+	assert.Equal(t, start.UnixMilli(), ranges[0].StartTime)
+	assert.Equal(t, start.Add(40*time.Hour).UnixMilli(), ranges[0].EndTime)
+}
+
+// TestCachedKlineProvider_EmptyRangeCached 测试上游没有数据的范围也会被缓存
+func TestCachedKlineProvider_EmptyRangeCached(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	provider, upstream, _ := setupCachedProvider(t, start, 10)
+	ctx := context.Background()
+	req := exchange.GetKlinesReq{
+		TradingPair: filePair,
+		Interval:    exchange.Interval1h,
+		StartTime:   start.Add(-24 * time.Hour),
+		EndTime:     start,
+	}
+
+	klines, err := provider.GetKlines(ctx, req)
+	require.NoError(t, err)
+	assert.Empty(t, klines)
+
+	upstream.offline = true
+	_, err = provider.GetKlines(ctx, req)
+	assert.NoError(t, err)
+}
+
+// TestCachedKlineProvider_UnclosedNotCached 测试未收盘的K线不写入缓存
+func TestCachedKlineProvider_UnclosedNotCached(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	provider, upstream, _ := setupCachedProvider(t, start, 10)
+	provider.now = func() time.Time { return start.Add(5*time.Hour + 30*time.Minute) }
+	ctx := context.Background()
+	req := exchange.GetKlinesReq{
+		TradingPair: filePair,
+		Interval:    exchange.Interval1h,
+		StartTime:   start,
+		EndTime:     start.Add(6 * time.Hour),
+	}
+
+	klines, err := provider.GetKlines(ctx, req)
+	require.NoError(t, err)
+	require.Len(t, klines, 6)
+
+	// 已收盘的部分走缓存，最后一根未收盘的K线重新请求
+	upstream.requests = nil
+	klines, err = provider.GetKlines(ctx, req)
+	require.NoError(t, err)
+	require.Len(t, klines, 6)
+	require.Len(t, upstream.requests, 1)
+	assert.True(t, upstream.requests[0].StartTime.Equal(start.Add(4*time.Hour+30*time.Minute)))
+}
@@ -0,0 +1,321 @@
+package backtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildOHLCKlines 按给定的 [open, high, low, close] 构造K线序列
+func buildOHLCKlines(startTime time.Time, interval exchange.Interval, ohlc [][4]float64) []exchange.Kline {
+	klines := make([]exchange.Kline, 0, len(ohlc))
+	for i, p := range ohlc {
+		openTime := startTime.Add(time.Duration(i) * interval.Duration())
+		klines = append(klines, exchange.Kline{
+			OpenTime:  openTime,
+			CloseTime: openTime.Add(interval.Duration() - time.Millisecond),
+			Open:      decimal.NewFromFloat(p[0]),
+			High:      decimal.NewFromFloat(p[1]),
+			Low:       decimal.NewFromFloat(p[2]),
+			Close:     decimal.NewFromFloat(p[3]),
+			Volume:    decimal.NewFromInt(100),
+		})
+	}
+	return klines
+}
+
+// setupConditionalTest 开一个 1 BTC 的多仓，返回K线通道（已消费到开仓成交的K线）
+func setupConditionalTest(t *testing.T, ohlc [][4]float64) (*ExchangeService, exchange.TradingPair, *klineSteps) {
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	interval := exchange.Interval5m
+	endTime := startTime.Add(time.Duration(len(ohlc)) * interval.Duration())
+
+	svc, provider := createTestExchange(t, 100000.0, startTime, endTime)
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	provider.AddKlines(pair, interval, buildOHLCKlines(startTime, interval, ohlc))
+
+	ctx := context.Background()
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
+
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Quantity:    decimal.NewFromInt(1),
+	})
+	require.NoError(t, err)
+	// 市价单在下一根K线开盘价成交
+	steps.next()
+
+	return svc, pair, steps
+}
+
+// TestConditionalOrder_StopLossTriggered 测试多仓止损：最低价下穿触发价时按触发价平仓
+func TestConditionalOrder_StopLossTriggered(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓成交
+		{100, 104, 96, 101}, // 未触发
+		{101, 102, 94, 95},  // 触发止损
+		{95, 96, 94, 95},
+	})
+	ctx := context.Background()
+
+	stopId, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair:  pair,
+		OrderType:    exchange.OrderTypeClose,
+		PositonSide:  exchange.PositionSideLong,
+		Conditional:  exchange.ConditionalTypeStopMarket,
+		TriggerPrice: decimal.NewFromInt(95),
+		Quantity:     decimal.NewFromInt(1),
+		ReduceOnly:   true,
+	})
+	require.NoError(t, err)
+
+	steps.next()
+	order, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: stopId})
+	require.NoError(t, err)
+	assert.Equal(t, exchange.OrderStatusPending, order.Status, "最低价 96 未触及触发价 95")
+
+	steps.next()
+	order, err = svc.GetOrder(ctx, exchange.GetOrderReq{Id: stopId})
+	require.NoError(t, err)
+	assert.Equal(t, exchange.OrderStatusFilled, order.Status)
+	assert.True(t, order.ExecutedQuantity.Equal(decimal.NewFromInt(1)))
+
+	positions, err := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
+	require.NoError(t, err)
+	assert.Empty(t, positions, "止损触发后仓位应该被平掉")
+
+	histories, err := svc.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{TradingPairs: []exchange.TradingPair{pair}})
+	require.NoError(t, err)
+	require.Len(t, histories, 1)
+	// 开仓价 100，止损价 95，亏损 5
+	assert.True(t, histories[0].RealizedPnl.Equal(decimal.NewFromInt(-5)), "realized pnl: %s", histories[0].RealizedPnl)
+}
+
+// TestConditionalOrder_TakeProfitClosePosition 测试全部平仓止盈：按触发时的持仓数量成交
+func TestConditionalOrder_TakeProfitClosePosition(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓成交
+		{100, 111, 99, 110}, // 触发止盈
+		{110, 111, 109, 110},
+	})
+	ctx := context.Background()
+
+	tpId, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair:   pair,
+		OrderType:     exchange.OrderTypeClose,
+		PositonSide:   exchange.PositionSideLong,
+		Conditional:   exchange.ConditionalTypeTakeProfitMarket,
+		TriggerPrice:  decimal.NewFromInt(110),
+		ClosePosition: true,
+	})
+	require.NoError(t, err)
+
+	steps.next()
+	order, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: tpId})
+	require.NoError(t, err)
+	assert.Equal(t, exchange.OrderStatusFilled, order.Status)
+	assert.True(t, order.ExecutedQuantity.Equal(decimal.NewFromInt(1)))
+
+	positions, err := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
+	require.NoError(t, err)
+	assert.Empty(t, positions)
+}
+
+// TestConditionalOrder_ExpireWithoutPosition 测试只减仓条件单触发时已无持仓则失效
+func TestConditionalOrder_ExpireWithoutPosition(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓成交
+		{100, 101, 99, 100}, // 市价平仓
+		{100, 101, 90, 92},  // 止损触发，但已无持仓
+		{92, 93, 91, 92},
+	})
+	ctx := context.Background()
+
+	stopId, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair:  pair,
+		OrderType:    exchange.OrderTypeClose,
+		PositonSide:  exchange.PositionSideLong,
+		Conditional:  exchange.ConditionalTypeStopMarket,
+		TriggerPrice: decimal.NewFromInt(95),
+		Quantity:     decimal.NewFromInt(1),
+		ReduceOnly:   true,
+	})
+	require.NoError(t, err)
+
+	_, err = svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeClose,
+		PositonSide: exchange.PositionSideLong,
+		Quantity:    decimal.NewFromInt(1),
+	})
+	require.NoError(t, err)
+
+	steps.next()
+	steps.next()
+
+	order, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: stopId})
+	require.NoError(t, err)
+	assert.Equal(t, exchange.OrderStatusExpired, order.Status)
+	assert.True(t, order.ExecutedQuantity.IsZero())
+}
+
+// TestConditionalOrder_Validation 测试条件单参数校验
+func TestConditionalOrder_Validation(t *testing.T) {
+	svc, pair, _ := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100},
+		{100, 101, 99, 100},
+	})
+	ctx := context.Background()
+
+	// 缺少触发价
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeClose,
+		PositonSide: exchange.PositionSideLong,
+		Conditional: exchange.ConditionalTypeStopMarket,
+		Quantity:    decimal.NewFromInt(1),
+	})
+	assert.Error(t, err)
+
+	// 全部平仓只能用于条件平仓单
+	_, err = svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair:   pair,
+		OrderType:     exchange.OrderTypeClose,
+		PositonSide:   exchange.PositionSideLong,
+		ClosePosition: true,
+	})
+	assert.Error(t, err)
+}
+
+// TestConditionalOrder_GapFillAtOpen 测试跳空越过触发价时按开盘价成交
+func TestConditionalOrder_GapFillAtOpen(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓成交
+		{90, 92, 88, 91},    // 跳空低开，止损按开盘价 90 成交
+		{91, 92, 90, 91},
+	})
+	ctx := context.Background()
+
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair:   pair,
+		OrderType:     exchange.OrderTypeClose,
+		PositonSide:   exchange.PositionSideLong,
+		Conditional:   exchange.ConditionalTypeStopMarket,
+		TriggerPrice:  decimal.NewFromInt(95),
+		ClosePosition: true,
+	})
+	require.NoError(t, err)
+
+	steps.next()
+
+	histories, err := svc.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{TradingPairs: []exchange.TradingPair{pair}})
+	require.NoError(t, err)
+	require.Len(t, histories, 1)
+	assert.True(t, histories[0].RealizedPnl.Equal(decimal.NewFromInt(-10)), "realized pnl: %s", histories[0].RealizedPnl)
+}
+
+// placeBracket 给多仓同时挂止损(95)和止盈(110)，返回 (止损ID, 止盈ID)
+func placeBracket(t *testing.T, svc *ExchangeService, pair exchange.TradingPair) (exchange.OrderId, exchange.OrderId) {
+	ctx := context.Background()
+	stopId, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair:   pair,
+		OrderType:     exchange.OrderTypeClose,
+		PositonSide:   exchange.PositionSideLong,
+		Conditional:   exchange.ConditionalTypeStopMarket,
+		TriggerPrice:  decimal.NewFromInt(95),
+		ClosePosition: true,
+	})
+	require.NoError(t, err)
+
+	tpId, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair:   pair,
+		OrderType:     exchange.OrderTypeClose,
+		PositonSide:   exchange.PositionSideLong,
+		Conditional:   exchange.ConditionalTypeTakeProfitMarket,
+		TriggerPrice:  decimal.NewFromInt(110),
+		ClosePosition: true,
+	})
+	require.NoError(t, err)
+	return stopId, tpId
+}
+
+// bracketKlines 第三根K线同时覆盖止损价和止盈价
+var bracketKlines = [][4]float64{
+	{100, 101, 99, 100},
+	{100, 102, 98, 100}, // 开仓成交
+	{100, 111, 94, 105}, // 止损和止盈同时落在K线内
+	{105, 106, 104, 105},
+}
+
+// TestConditionalOrder_IntrabarPolicy 测试止损止盈落在同一根K线内时的成交顺序策略
+func TestConditionalOrder_IntrabarPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     IntrabarPolicy
+		wantFilled string // "stop" 或 "tp"
+	}{
+		{name: "悲观策略止损优先", policy: IntrabarPolicyPessimistic, wantFilled: "stop"},
+		{name: "乐观策略止盈优先", policy: IntrabarPolicyOptimistic, wantFilled: "tp"},
+		// 没有小周期数据时退化为悲观策略
+		{name: "子周期数据缺失", policy: IntrabarPolicySubInterval, wantFilled: "stop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, pair, steps := setupConditionalTest(t, bracketKlines)
+			svc.SetIntrabarPolicy(tt.policy)
+			stopId, tpId := placeBracket(t, svc, pair)
+
+			steps.next()
+
+			filledId, expiredId := stopId, tpId
+			if tt.wantFilled == "tp" {
+				filledId, expiredId = tpId, stopId
+			}
+			assertOrderStatus(t, svc, filledId, exchange.OrderStatusFilled)
+			assertOrderStatus(t, svc, expiredId, exchange.OrderStatusExpired)
+		})
+	}
+}
+
+// TestConditionalOrder_SubIntervalReplay 测试子周期回放按实际触发顺序成交
+func TestConditionalOrder_SubIntervalReplay(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, bracketKlines)
+	svc.SetIntrabarPolicy(IntrabarPolicySubInterval)
+
+	// 第三根5m K线内，价格先涨到 111 再跌到 94
+	barStart := time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC)
+	provider := svc.klineProvider.(*MockKlineProvider)
+	provider.AddKlines(pair, exchange.Interval1m, buildOHLCKlines(barStart, exchange.Interval1m, [][4]float64{
+		{100, 103, 99, 102},
+		{102, 111, 101, 108}, // 先触发止盈
+		{108, 109, 100, 101},
+		{101, 102, 94, 96},
+		{96, 106, 95, 105},
+	}))
+	stopId, tpId := placeBracket(t, svc, pair)
+
+	steps.next()
+
+	assertOrderStatus(t, svc, tpId, exchange.OrderStatusFilled)
+	assertOrderStatus(t, svc, stopId, exchange.OrderStatusExpired)
+}
+
+func assertOrderStatus(t *testing.T, svc *ExchangeService, id exchange.OrderId, status exchange.OrderStatus) {
+	order, err := svc.GetOrder(context.Background(), exchange.GetOrderReq{Id: id})
+	require.NoError(t, err)
+	assert.Equal(t, status, order.Status, "order %s", id)
+}
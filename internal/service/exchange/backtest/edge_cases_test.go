@@ -27,8 +27,8 @@ func TestEdgeCase_InsufficientBalance(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 尝试开仓（数量过大）
 	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -59,8 +59,8 @@ func TestEdgeCase_InsufficientPosition(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 开仓0.1
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -71,8 +71,8 @@ func TestEdgeCase_InsufficientPosition(t *testing.T) {
 		Quantity:    decimal.NewFromFloat(0.1),
 		Timestamp:   time.Now(),
 	})
-	<-klineChan
-	<-klineChan // 等待订单成交
+	steps.next()
+	steps.next() // 等待订单成交
 
 	// 确认持仓存在
 	positions, _ := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
@@ -112,8 +112,8 @@ func TestEdgeCase_CloseNonExistentPosition(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 尝试平仓（没有持仓）
 	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -217,8 +217,8 @@ func TestEdgeCase_ZeroQuantity(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 尝试创建零数量订单
 	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -254,11 +254,11 @@ func TestEdgeCase_MultipleKlineProviders(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan1, _ := svc.SubscribeKline(ctx, pair1, interval)
-	klineChan2, _ := svc.SubscribeKline(ctx, pair2, interval)
+	steps1 := newKlineSteps(t, svc, pair1, interval)
+	steps2 := newKlineSteps(t, svc, pair2, interval)
 
-	<-klineChan1
-	<-klineChan2
+	steps1.next()
+	steps2.next()
 
 	// BTC开多仓（上涨趋势）
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -280,13 +280,13 @@ func TestEdgeCase_MultipleKlineProviders(t *testing.T) {
 		Timestamp:   time.Now(),
 	})
 
-	<-klineChan1
-	<-klineChan2
+	steps1.next()
+	steps2.next()
 
 	// 等待价格变化
 	for i := 0; i < 10; i++ {
-		<-klineChan1
-		<-klineChan2
+		steps1.next()
+		steps2.next()
 	}
 
 	// 检查两个持仓
@@ -332,8 +332,8 @@ func TestEdgeCase_StopOrderAfterPositionClosed(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 开仓并设置止盈
 	resp, _ := svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -344,8 +344,8 @@ func TestEdgeCase_StopOrderAfterPositionClosed(t *testing.T) {
 		Quantity:    decimal.NewFromFloat(0.1),
 		Timestamp:   time.Now(),
 	})
-	<-klineChan
-	<-klineChan // 等待开仓成交
+	steps.next()
+	steps.next() // 等待开仓成交
 
 	// 手动平仓
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -356,8 +356,8 @@ func TestEdgeCase_StopOrderAfterPositionClosed(t *testing.T) {
 		Quantity:    decimal.NewFromFloat(0.1),
 		Timestamp:   time.Now(),
 	})
-	<-klineChan
-	<-klineChan // 等待平仓成交
+	steps.next()
+	steps.next() // 等待平仓成交
 
 	// 持仓已关闭
 	positions, _ := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
@@ -365,7 +365,7 @@ func TestEdgeCase_StopOrderAfterPositionClosed(t *testing.T) {
 
 	// 继续推送K线，即使价格达到止盈价，也不应该再次触发
 	for i := 0; i < 10; i++ {
-		<-klineChan
+		steps.next()
 	}
 
 	// 持仓仍然为空
@@ -390,8 +390,8 @@ func TestEdgeCase_ConcurrentOrders(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 并发创建多个订单
 	orderCount := 10
@@ -462,8 +462,8 @@ func TestEdgeCase_VerySmallQuantity(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 创建极小数量的订单
 	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -478,8 +478,8 @@ func TestEdgeCase_VerySmallQuantity(t *testing.T) {
 	// 应该能成功创建
 	require.NoError(t, err)
 
-	<-klineChan
-	<-klineChan // 等待订单成交
+	steps.next()
+	steps.next() // 等待订单成交
 
 	// 检查持仓
 	positions, _ := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
@@ -502,8 +502,8 @@ func TestEdgeCase_AddPositionMultipleTimes(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 多次开仓（加仓）
 	quantities := []float64{0.01, 0.02, 0.03, 0.04}
@@ -518,8 +518,8 @@ func TestEdgeCase_AddPositionMultipleTimes(t *testing.T) {
 			Quantity:    decimal.NewFromFloat(qty),
 			Timestamp:   time.Now(),
 		})
-		<-klineChan // 等待订单进入pending
-		<-klineChan // 等待订单成交
+		steps.next() // 等待订单进入pending
+		steps.next() // 等待订单成交
 
 		totalQuantity = totalQuantity.Add(decimal.NewFromFloat(qty))
 
@@ -548,8 +548,8 @@ func TestEdgeCase_PartialCloseMultipleTimes(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 开仓1.0
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -560,8 +560,8 @@ func TestEdgeCase_PartialCloseMultipleTimes(t *testing.T) {
 		Quantity:    decimal.NewFromFloat(1.0),
 		Timestamp:   time.Now(),
 	})
-	<-klineChan
-	<-klineChan // 等待开仓成交
+	steps.next()
+	steps.next() // 等待开仓成交
 
 	// 多次部分平仓
 	closeQuantities := []float64{0.1, 0.2, 0.3, 0.4}
@@ -576,8 +576,8 @@ func TestEdgeCase_PartialCloseMultipleTimes(t *testing.T) {
 			Quantity:    decimal.NewFromFloat(qty),
 			Timestamp:   time.Now(),
 		})
-		<-klineChan // 等待订单进入pending
-		<-klineChan // 等待订单成交
+		steps.next() // 等待订单进入pending
+		steps.next() // 等待订单成交
 
 		remainingQuantity = remainingQuantity.Sub(decimal.NewFromFloat(qty))
 
@@ -611,8 +611,8 @@ func TestEdgeCase_NoPriceMovement(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 开仓
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -623,11 +623,11 @@ func TestEdgeCase_NoPriceMovement(t *testing.T) {
 		Quantity:    decimal.NewFromFloat(0.1),
 		Timestamp:   time.Now(),
 	})
-	<-klineChan
+	steps.next()
 
 	// 等待几根K线
 	for i := 0; i < 5; i++ {
-		<-klineChan
+		steps.next()
 	}
 
 	// 检查未实现盈亏（应该接近零）
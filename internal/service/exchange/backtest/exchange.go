@@ -3,6 +3,7 @@ package backtest
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -19,9 +20,11 @@ type ExchangeService struct {
 	startTime     time.Time
 	endTime       time.Time
 
-	// 每个交易对的当前时间（从K线更新）
-	timeMu       sync.RWMutex
-	currentTimes map[string]time.Time // key: tradingPair symbol
+	// 模拟时钟，所有交易对共用，由K线收盘时间推进
+	timeMu sync.RWMutex
+	clock  time.Time
+	// 使用真实时间代替模拟时钟（模拟盘），创建后不再修改
+	wallClock bool
 
 	// 模拟交易状态
 	orderMu       sync.RWMutex
@@ -48,9 +51,52 @@ type ExchangeService struct {
 	// 当前市场价格（从K线更新）
 	priceMu       sync.RWMutex
 	currentPrices map[string]decimal.Decimal // key: tradingPair symbol
+	lastKlines    map[string]exchange.Kline  // 最近处理的K线，Flatten 平仓时按它计算滑点
 
 	// 冻结资金（开仓挂单占用）
 	frozenFunds map[exchange.OrderId]decimal.Decimal // 每个开仓挂单冻结的资金
+
+	// K线内条件单成交顺序
+	intrabarMu     sync.RWMutex
+	intrabarPolicy IntrabarPolicy
+	subInterval    exchange.Interval // IntrabarPolicySubInterval 使用的回放周期
+
+	// 手续费
+	feeMu       sync.RWMutex
+	feeSchedule FeeSchedule
+	makerOrders map[exchange.OrderId]bool // 下单时判定为挂单的限价单，受 orderMu 保护
+
+	// 跟踪止损状态，受 orderMu 保护
+	trailingStops map[exchange.OrderId]*trailingState
+
+	// 滑点
+	slippageMu    sync.RWMutex
+	slippageModel SlippageModel
+
+	// 限价挂单成交模型
+	fillMu    sync.RWMutex
+	fillModel FillModel
+
+	// 保证金模式和维持保证金档位（强平计算）
+	marginMu           sync.RWMutex
+	marginTypes        map[string]exchange.MarginType     // key: tradingPair symbol，默认全仓
+	marginTiers        map[string][]MaintenanceMarginTier // key: tradingPair symbol
+	defaultMarginTiers []MaintenanceMarginTier
+
+	// 交易对规则，设置后下单、改单和调整杠杆时校验
+	rulesMu       sync.RWMutex
+	rulesProvider exchange.SymbolRulesProvider
+
+	// 账户事件订阅
+	userDataMu   sync.RWMutex
+	userDataSubs []*userDataSub
+	marginCalls  map[string]bool // 已经推送过追加保证金通知的持仓，受 positionMu 保护
+
+	// 资金费
+	fundingMu      sync.Mutex
+	fundingSource  FundingRateSource
+	fundingRates   map[string][]exchange.FundingRate // key: tradingPair symbol，懒加载
+	fundingCursors map[string]int                    // 下一个待结算的资金费率下标
 }
 
 // NewExchangeService 使用自定义K线提供者创建服务
@@ -59,6 +105,7 @@ func NewExchangeService(startTime, endTime time.Time, initialBalance decimal.Dec
 		klineProvider: provider,
 		startTime:     startTime,
 		endTime:       endTime,
+		clock:         startTime,
 
 		// 初始化模拟交易状态
 		orders:        make(map[exchange.OrderId]*exchange.OrderInfo),
@@ -72,33 +119,65 @@ func NewExchangeService(startTime, endTime time.Time, initialBalance decimal.Dec
 			UnrealizedPnl:    decimal.Zero,
 			UsedMargin:       decimal.Zero,
 		},
-		positionHistories: []exchange.PositionHistory{},
-		activeHistories:   make(map[string]*exchange.PositionHistory),
-		leverages:         make(map[string]int),
-		currentPrices:     make(map[string]decimal.Decimal),
-		currentTimes:      make(map[string]time.Time),
-		frozenFunds:       make(map[exchange.OrderId]decimal.Decimal),
+		positionHistories:  []exchange.PositionHistory{},
+		activeHistories:    make(map[string]*exchange.PositionHistory),
+		leverages:          make(map[string]int),
+		currentPrices:      make(map[string]decimal.Decimal),
+		lastKlines:         make(map[string]exchange.Kline),
+		frozenFunds:        make(map[exchange.OrderId]decimal.Decimal),
+		intrabarPolicy:     IntrabarPolicyPessimistic,
+		subInterval:        exchange.Interval1m,
+		makerOrders:        make(map[exchange.OrderId]bool),
+		trailingStops:      make(map[exchange.OrderId]*trailingState),
+		fundingRates:       make(map[string][]exchange.FundingRate),
+		fundingCursors:     make(map[string]int),
+		marginCalls:        make(map[string]bool),
+		marginTypes:        make(map[string]exchange.MarginType),
+		marginTiers:        make(map[string][]MaintenanceMarginTier),
+		defaultMarginTiers: DefaultMaintenanceMarginTiers(),
 	}
 
 	return svc
 }
 
-// now 返回指定交易对的当前时间（从K线更新）
-func (svc *ExchangeService) now(tradingPair exchange.TradingPair) time.Time {
+// now 返回模拟时钟的当前时间（最近处理的K线收盘时间），模拟盘返回真实时间
+func (svc *ExchangeService) now() time.Time {
+	if svc.wallClock {
+		return time.Now()
+	}
 	svc.timeMu.RLock()
 	defer svc.timeMu.RUnlock()
-
-	if t, exists := svc.currentTimes[tradingPair.ToString()]; exists {
-		return t
-	}
-	return svc.startTime
+	return svc.clock
 }
 
-// updateTime 更新交易对的当前时间
-func (svc *ExchangeService) updateTime(tradingPair exchange.TradingPair, t time.Time) {
+// advanceClock 推进模拟时钟，时钟只会向前走
+func (svc *ExchangeService) advanceClock(t time.Time) {
 	svc.timeMu.Lock()
 	defer svc.timeMu.Unlock()
-	svc.currentTimes[tradingPair.ToString()] = t
+	if t.After(svc.clock) {
+		svc.clock = t
+	}
+}
+
+// processKline 用一根K线驱动撮合：更新价格、时钟和持仓盈亏，结算资金费，扫描挂单和强平
+func (svc *ExchangeService) processKline(ctx context.Context, tradingPair exchange.TradingPair, kline exchange.Kline) {
+	// 更新当前价格为K线收盘价（用于市价单成交）
+	svc.updatePrice(tradingPair, kline.Close)
+	svc.priceMu.Lock()
+	svc.lastKlines[tradingPair.ToString()] = kline
+	svc.priceMu.Unlock()
+
+	svc.advanceClock(kline.CloseTime)
+
+	// 🔑 更新持仓的未实现盈亏和标记价格
+	svc.updatePositionsPnl(tradingPair, kline.Close)
+
+	// 结算K线开盘前到期的资金费
+	svc.settleFunding(ctx, tradingPair, kline.OpenTime, kline.Open)
+
+	// 🔑 第一次扫描：检查上一根K线后创建的订单
+	// 检查挂单是否成交，检查止盈止损是否触发
+	svc.scanOrders(ctx, tradingPair, kline)
 }
 
 func (svc *ExchangeService) Ticker(ctx context.Context, tradingPair exchange.TradingPair) (decimal.Decimal, error) {
@@ -120,93 +199,6 @@ func (svc *ExchangeService) updatePrice(tradingPair exchange.TradingPair, price
 	svc.currentPrices[tradingPair.ToString()] = price
 }
 
-func (svc *ExchangeService) SubscribeKline(ctx context.Context, tradingPair exchange.TradingPair, interval exchange.Interval) (chan exchange.Kline, error) {
-	ch := make(chan exchange.Kline)
-
-	// 🔑 优化：分批获取K线（每批200根），避免单次请求过大
-	go func() {
-		defer close(ch)
-
-		const batchSize = 200 // 每批获取200根K线
-		currentTime := svc.startTime
-		totalKlines := 0
-
-		for currentTime.Before(svc.endTime) {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-			}
-
-			// 计算当前批次的结束时间（最多200根K线）
-			batchEndTime := currentTime.Add(interval.Duration() * batchSize)
-			if batchEndTime.After(svc.endTime) {
-				batchEndTime = svc.endTime
-			}
-
-			// 获取一批K线数据（使用K线提供者）
-			klines, err := svc.klineProvider.GetKlines(ctx, exchange.GetKlinesReq{
-				TradingPair: tradingPair,
-				Interval:    interval,
-				StartTime:   currentTime,
-				EndTime:     batchEndTime,
-			})
-
-			if err != nil {
-				fmt.Printf("failed to get klines for %s: %v\n", tradingPair.ToString(), err)
-				return
-			}
-
-			if len(klines) == 0 {
-				// 当前批次没有数据，跳到下一批
-				currentTime = batchEndTime
-				continue
-			}
-
-			totalKlines += len(klines)
-
-			// 逐根推送K线
-			for _, kline := range klines {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-				}
-
-				time.Sleep(time.Millisecond * 10)
-				// 更新当前价格为K线收盘价（用于市价单成交）
-				svc.updatePrice(tradingPair, kline.Close)
-
-				// 更新该交易对的当前时间
-				svc.updateTime(tradingPair, kline.CloseTime)
-
-				// 🔑 更新持仓的未实现盈亏和标记价格
-				svc.updatePositionsPnl(tradingPair, kline.Close)
-
-				// 🔑 第一次扫描：检查上一根K线后创建的订单
-				// 检查挂单是否成交，检查止盈止损是否触发
-				svc.scanOrders(ctx, tradingPair, kline)
-
-				// 推送K线
-				select {
-				case ch <- kline:
-				case <-ctx.Done():
-					return
-				}
-
-			}
-
-			// 移动到下一批
-			currentTime = batchEndTime
-		}
-
-		fmt.Printf("loaded total %d klines for %s (%s)\n",
-			totalKlines, tradingPair.ToString(), interval.ToString())
-	}()
-
-	return ch, nil
-}
-
 func (svc *ExchangeService) GetKlines(ctx context.Context, req exchange.GetKlinesReq) ([]exchange.Kline, error) {
 	klines, err := svc.klineProvider.GetKlines(ctx, req)
 	if err != nil {
@@ -309,6 +301,9 @@ func (svc *ExchangeService) updatePositionsPnl(tradingPair exchange.TradingPair,
 func (svc *ExchangeService) scanOrders(ctx context.Context, tradingPair exchange.TradingPair, kline exchange.Kline) {
 	// 扫描待成交的挂单
 	svc.scanPendingOrders(ctx, tradingPair, kline)
+
+	// 🔑 检查强平
+	svc.checkLiquidations(ctx, tradingPair, kline)
 }
 
 // scanPendingOrders 扫描待成交订单，检查是否满足成交条件
@@ -324,13 +319,45 @@ func (svc *ExchangeService) scanPendingOrders(ctx context.Context, tradingPair e
 	}
 	svc.orderMu.RUnlock()
 
+	// 🔑 按下单顺序扫描，保证同一根K线内多个订单的成交顺序可复现
+	sort.Slice(pendingList, func(i, j int) bool {
+		return orderSeq(pendingList[i].Id) < orderSeq(pendingList[j].Id)
+	})
+
+	// GTD 订单到了失效时间后不再成交
+	pendingList = svc.expireGoodTillDate(pendingList, kline)
+
 	// 检查每个订单是否满足成交条件
+	triggered := make([]*exchange.OrderInfo, 0, len(pendingList))
 	for _, order := range pendingList {
 		if svc.checkOrderFilled(order, kline) {
-			// 订单满足成交条件，执行成交
-			svc.fillOrder(ctx, order, kline)
+			triggered = append(triggered, order)
+		}
+	}
+
+	// 🔑 同一根K线内多个订单触发时，按 IntrabarPolicy 决定成交顺序
+	// 先成交的平仓单平掉仓位后，后面的只减仓条件单会失效
+	for _, item := range svc.sequenceTriggered(ctx, tradingPair, kline, triggered) {
+		if !svc.isPending(item.order) {
+			continue
+		}
+		if !svc.canFillOrKill(item.order, item.bar) {
+			continue
+		}
+		if err := svc.fillOrder(ctx, item.order, item.bar); err != nil {
+			// 成交失败（例如没有冻结资金、持仓不足）的订单不再重试，标记为被拒绝
+			svc.rejectOrder(ctx, item.order, err)
 		}
 	}
+
+	// IOC / FOK 订单没有成交的部分失效
+	svc.expireImmediateOrders(pendingList)
+}
+
+// orderSeq 解析订单序号，订单ID由 generateOrderId 递增生成
+func orderSeq(id string) int64 {
+	seq, _ := strconv.ParseInt(id, 10, 64)
+	return seq
 }
 
 // checkOrderFilled 检查订单是否满足成交条件
@@ -339,17 +366,22 @@ func (svc *ExchangeService) scanPendingOrders(ctx context.Context, tradingPair e
 // - Open + Short (开空)：卖出，K线最高价 >= 限价时成交
 // - Close + Long (平多)：卖出，K线最高价 >= 限价时成交
 // - Close + Short (平空)：买入，K线最低价 <= 限价时成交
+// 条件单按触发价判断，见 checkTriggered
 func (svc *ExchangeService) checkOrderFilled(order *exchange.OrderInfo, kline exchange.Kline) bool {
+	if order.Conditional == exchange.ConditionalTypeTrailingStopMarket {
+		return svc.checkTrailingTriggered(order, kline)
+	}
+	if order.Conditional.IsConditional() {
+		return svc.checkTriggered(order, kline)
+	}
+
 	// 市价单，立即成交
 	if order.Price.IsZero() {
 		return true
 	}
 
 	// 限价单：判断K线价格区间是否触碰到限价
-	isBuyOrder := (order.OrderType == exchange.OrderTypeOpen && order.PositionSide == exchange.PositionSideLong) ||
-		(order.OrderType == exchange.OrderTypeClose && order.PositionSide == exchange.PositionSideShort)
-
-	if isBuyOrder {
+	if order.IsBuy() {
 		// 买入订单：K线最低价触及或低于限价时成交
 		return kline.Low.LessThanOrEqual(order.Price)
 	} else {
@@ -358,55 +390,165 @@ func (svc *ExchangeService) checkOrderFilled(order *exchange.OrderInfo, kline ex
 	}
 }
 
+// checkTriggered 检查条件单是否触发
+// - 止损 (STOP_MARKET)：买入时价格上穿触发价触发，卖出时价格下穿触发价触发
+// - 止盈 (TAKE_PROFIT_MARKET)：买入时价格下穿触发价触发，卖出时价格上穿触发价触发
+// 跟踪止损的触发价随K线移动，见 checkTrailingTriggered
+func (svc *ExchangeService) checkTriggered(order *exchange.OrderInfo, kline exchange.Kline) bool {
+	// 买入止损 / 卖出止盈：价格向上触及触发价
+	triggerOnRise := triggersOnRise(order)
+	if triggerOnRise {
+		return kline.High.GreaterThanOrEqual(order.TriggerPrice)
+	}
+	return kline.Low.LessThanOrEqual(order.TriggerPrice)
+}
+
 // fillOrder 执行订单成交
 func (svc *ExchangeService) fillOrder(ctx context.Context, order *exchange.OrderInfo, kline exchange.Kline) error {
 	// 确定成交价格
 	fillPrice := order.Price
-	if fillPrice.IsZero() {
+	if order.Conditional == exchange.ConditionalTypeTrailingStopMarket {
+		// 跟踪止损的成交价在推进止损价时已经确定
+		fillPrice = svc.trailingFillPrice(order)
+	} else if order.Conditional.IsConditional() {
+		// 条件单触发后以市价成交：按触发价成交，跳空越过触发价时按开盘价成交
+		fillPrice = triggerFillPrice(order, kline)
+	} else if fillPrice.IsZero() {
 		// 市价单使用当前K线开盘价
 		fillPrice = kline.Open
 	}
 	// 否则使用限价单的挂单价格成交
 
+	// 本根K线要成交的数量，设置了成交模型时挂单限价单可能只成交一部分
+	quantity := svc.fillQuantity(order, kline)
+	if !quantity.IsPositive() && !order.ClosePosition {
+		return nil
+	}
+
 	// 执行持仓变更
 	posKey := svc.getPositionKey(order.TradingPair, order.PositionSide)
 
-	var executedQuantity decimal.Decimal
+	var executedQuantity, realizedPnl decimal.Decimal
+	var exec execution
 	var err error
 
 	if order.OrderType == exchange.OrderTypeOpen {
-		// 开仓或加仓（可能部分成交）
-		executedQuantity, err = svc.openPosition(posKey, order, fillPrice)
+		// 开仓或加仓（可能因资金不足部分成交）
+		exec = svc.newExecution(order, kline, fillPrice, quantity)
+		executedQuantity, err = svc.openPosition(posKey, order, quantity, exec)
 		if err != nil {
 			return err
 		}
 	} else {
 		// 平仓或减仓
-		err = svc.closePosition(posKey, order, fillPrice)
+		closeQuantity, ok := svc.closeQuantity(posKey, order, quantity)
+		if !ok {
+			// 🔑 只减仓/全部平仓的条件单触发时已无持仓，订单直接失效
+			svc.expireOrder(order)
+			svc.cancelOrderGroup(ctx, order.GroupId)
+			return nil
+		}
+		exec = svc.newExecution(order, kline, fillPrice, closeQuantity)
+		realizedPnl, err = svc.closePosition(posKey, order, closeQuantity, exec)
 		if err != nil {
 			return err
 		}
-		executedQuantity = order.Quantity
+		executedQuantity = closeQuantity
 	}
 
 	// 更新订单状态
 	svc.orderMu.Lock()
 
-	// 从待成交列表移除
-	delete(svc.pendingOrders, exchange.OrderId(order.Id))
+	// 更新成交数量和成交均价
+	order.AvgPrice = averagePrice(order.AvgPrice, order.ExecutedQuantity, exec.price, executedQuantity)
+	order.ExecutedQuantity = order.ExecutedQuantity.Add(executedQuantity)
+	now := svc.now()
+	order.UpdatedAt = now
 
-	// 更新订单状态和成交数量
-	order.ExecutedQuantity = executedQuantity
-	if executedQuantity.Equal(order.Quantity) {
+	// 🔑 全部成交、资金不足或持仓不足（成交数量少于本次数量）时订单结束，否则继续挂单等待后续K线成交
+	done := order.ClosePosition || order.ExecutedQuantity.GreaterThanOrEqual(order.Quantity) || executedQuantity.LessThan(quantity)
+	if done {
+		// 从待成交列表移除
+		delete(svc.pendingOrders, exchange.OrderId(order.Id))
+		delete(svc.makerOrders, exchange.OrderId(order.Id))
+		delete(svc.trailingStops, exchange.OrderId(order.Id))
+		order.CompletedAt = now
+	}
+	if order.ClosePosition || order.ExecutedQuantity.GreaterThanOrEqual(order.Quantity) {
 		order.Status = exchange.OrderStatusFilled
 	} else {
 		order.Status = exchange.OrderStatusPartiallyFilled
 	}
-	now := svc.now(order.TradingPair)
+
+	svc.orderMu.Unlock()
+
+	if done {
+		svc.releaseFrozenFunds(exchange.OrderId(order.Id))
+	}
+	svc.publishFill(order, newTrade(order, exec, executedQuantity, realizedPnl, now), exchange.BalanceChangeReasonOrder)
+
+	// 🔑 订单组（OCO）：一个成交后撤销同组其余订单，仓位平掉后撤销该方向的所有订单组
+	svc.cancelOrderGroup(ctx, order.GroupId)
+	if order.OrderType == exchange.OrderTypeClose {
+		svc.cancelGroupsOnClose(ctx, order.TradingPair, order.PositionSide)
+	}
+
+	return nil
+}
+
+// closeQuantity 计算平仓订单的成交数量，quantity 为本次要成交的数量
+// - 全部平仓 (ClosePosition)：按当前持仓数量成交
+// - 只减仓 (ReduceOnly) 和条件平仓单：成交数量不超过当前持仓
+// - 普通平仓：按 quantity 成交
+// 只减仓/条件平仓单在没有持仓时返回 false
+func (svc *ExchangeService) closeQuantity(posKey string, order *exchange.OrderInfo, quantity decimal.Decimal) (decimal.Decimal, bool) {
+	if !order.ClosePosition && !order.ReduceOnly && !order.Conditional.IsConditional() {
+		return quantity, true
+	}
+
+	svc.positionMu.RLock()
+	position, exists := svc.positions[posKey]
+	svc.positionMu.RUnlock()
+
+	if !exists || !position.Quantity.IsPositive() {
+		return decimal.Zero, false
+	}
+	if order.ClosePosition {
+		return position.Quantity, true
+	}
+	return decimal.Min(quantity, position.Quantity), true
+}
+
+// rejectOrder 订单成交失败被拒绝，从待成交列表移除并返还冻结资金
+func (svc *ExchangeService) rejectOrder(ctx context.Context, order *exchange.OrderInfo, reason error) {
+	svc.orderMu.Lock()
+	delete(svc.pendingOrders, exchange.OrderId(order.Id))
+	delete(svc.makerOrders, exchange.OrderId(order.Id))
+	delete(svc.trailingStops, exchange.OrderId(order.Id))
+	order.Status = exchange.OrderStatusRejected
+	order.RejectReason = reason.Error()
+	now := svc.now()
 	order.UpdatedAt = now
 	order.CompletedAt = now
+	svc.orderMu.Unlock()
+
+	svc.releaseFrozenFunds(exchange.OrderId(order.Id))
+	svc.publishOrderUpdate(order)
+	svc.cancelOrderGroup(ctx, order.GroupId)
+}
 
+// expireOrder 订单失效，从待成交列表移除并返还剩余的冻结资金
+func (svc *ExchangeService) expireOrder(order *exchange.OrderInfo) {
+	svc.orderMu.Lock()
+	delete(svc.pendingOrders, exchange.OrderId(order.Id))
+	delete(svc.makerOrders, exchange.OrderId(order.Id))
+	delete(svc.trailingStops, exchange.OrderId(order.Id))
+	order.Status = exchange.OrderStatusExpired
+	now := svc.now()
+	order.UpdatedAt = now
+	order.CompletedAt = now
 	svc.orderMu.Unlock()
 
-	return nil
+	svc.releaseFrozenFunds(exchange.OrderId(order.Id))
+	svc.publishOrderUpdate(order)
 }
@@ -25,6 +25,37 @@ func createTestExchange(t *testing.T, initialBalance float64, startTime, endTime
 	return svc, provider
 }
 
+// klineSteps 在测试中逐根K线同步驱动回测交易所，撮合顺序与 Replay 一致：
+// next 先用下一根K线撮合，再返回该K线，之后创建的订单从再下一根K线开始撮合
+type klineSteps struct {
+	svc    *ExchangeService
+	pair   exchange.TradingPair
+	klines []exchange.Kline
+}
+
+// newKlineSteps 读取回测区间内交易对的全部K线
+func newKlineSteps(t *testing.T, svc *ExchangeService, pair exchange.TradingPair, interval exchange.Interval) *klineSteps {
+	klines, err := svc.klineProvider.GetKlines(context.Background(), exchange.GetKlinesReq{
+		TradingPair: pair,
+		Interval:    interval,
+		StartTime:   svc.startTime,
+		EndTime:     svc.endTime,
+	})
+	require.NoError(t, err)
+	return &klineSteps{svc: svc, pair: pair, klines: klines}
+}
+
+// next 用下一根K线撮合并返回该K线，K线用完后返回零值
+func (s *klineSteps) next() exchange.Kline {
+	if len(s.klines) == 0 {
+		return exchange.Kline{}
+	}
+	kline := s.klines[0]
+	s.klines = s.klines[1:]
+	s.svc.processKline(context.Background(), s.pair, kline)
+	return kline
+}
+
 // KlineTrendType K线趋势类型
 type KlineTrendType string
 
@@ -155,11 +186,10 @@ func TestExchangeService_MarketOrder_Buy(t *testing.T) {
 	ctx := context.Background()
 
 	// 订阅K线
-	klineChan, err := svc.SubscribeKline(ctx, pair, interval)
-	require.NoError(t, err)
+	steps := newKlineSteps(t, svc, pair, interval)
 
 	// 等待第一根K线
-	kline1 := <-klineChan
+	kline1 := steps.next()
 	require.NotNil(t, kline1)
 
 	// 创建市价开多单
@@ -175,11 +205,11 @@ func TestExchangeService_MarketOrder_Buy(t *testing.T) {
 	assert.NotEmpty(t, orderId)
 
 	// 市价单需要等待下一根K线才会成交
-	kline2 := <-klineChan
+	kline2 := steps.next()
 	require.NotNil(t, kline2)
 
 	// 再等待一根K线确保订单已成交
-	<-klineChan
+	steps.next()
 
 	// 检查订单状态
 	orderInfo, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: orderId})
@@ -223,11 +253,10 @@ func TestExchangeService_LimitOrder_Buy(t *testing.T) {
 	ctx := context.Background()
 
 	// 订阅K线
-	klineChan, err := svc.SubscribeKline(ctx, pair, interval)
-	require.NoError(t, err)
+	steps := newKlineSteps(t, svc, pair, interval)
 
 	// 等待第一根K线
-	kline1 := <-klineChan
+	kline1 := steps.next()
 	require.NotNil(t, kline1)
 	t.Logf("第一根K线: Low=%s, High=%s, Close=%s", kline1.Low, kline1.High, kline1.Close)
 
@@ -251,12 +280,12 @@ func TestExchangeService_LimitOrder_Buy(t *testing.T) {
 	assert.Equal(t, exchange.OrderStatusPending, orders[0].Status)
 
 	// 等待下一根K线，此时价格上涨，K线的Low应该能触及我们的限价
-	kline2 := <-klineChan
+	kline2 := steps.next()
 	require.NotNil(t, kline2)
 	t.Logf("第二根K线: Low=%s, High=%s, Close=%s, 限价=%s", kline2.Low, kline2.High, kline2.Close, limitPrice)
 
 	// 再等待一根K线确保订单已处理
-	<-klineChan
+	steps.next()
 
 	// 检查订单是否成交
 	orderInfo, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: orderId})
@@ -287,11 +316,10 @@ func TestExchangeService_LimitOrder_Sell(t *testing.T) {
 	ctx := context.Background()
 
 	// 订阅K线
-	klineChan, err := svc.SubscribeKline(ctx, pair, interval)
-	require.NoError(t, err)
+	steps := newKlineSteps(t, svc, pair, interval)
 
 	// 等待第一根K线
-	kline1 := <-klineChan
+	kline1 := steps.next()
 	require.NotNil(t, kline1)
 
 	// 创建限价开空单（价格设置在当前价格上方）
@@ -308,7 +336,7 @@ func TestExchangeService_LimitOrder_Sell(t *testing.T) {
 
 	// 等待K线触发订单成交（K线最高价会高于限价）
 	for i := 0; i < 5; i++ {
-		kline := <-klineChan
+		kline := steps.next()
 		require.NotNil(t, kline)
 	}
 
@@ -341,11 +369,10 @@ func TestExchangeService_ClosePosition(t *testing.T) {
 	ctx := context.Background()
 
 	// 订阅K线
-	klineChan, err := svc.SubscribeKline(ctx, pair, interval)
-	require.NoError(t, err)
+	steps := newKlineSteps(t, svc, pair, interval)
 
 	// 等待第一根K线
-	kline1 := <-klineChan
+	kline1 := steps.next()
 	require.NotNil(t, kline1)
 
 	// 开多仓
@@ -360,7 +387,7 @@ func TestExchangeService_ClosePosition(t *testing.T) {
 	require.NoError(t, err)
 
 	// 等待开仓成交
-	kline2 := <-klineChan
+	kline2 := steps.next()
 	require.NotNil(t, kline2)
 
 	// 确认持仓
@@ -376,7 +403,7 @@ func TestExchangeService_ClosePosition(t *testing.T) {
 
 	// 等待几根K线让价格上涨
 	for i := 0; i < 5; i++ {
-		<-klineChan
+		steps.next()
 	}
 
 	// 平仓
@@ -391,7 +418,7 @@ func TestExchangeService_ClosePosition(t *testing.T) {
 	require.NoError(t, err)
 
 	// 等待平仓成交
-	kline3 := <-klineChan
+	kline3 := steps.next()
 	require.NotNil(t, kline3)
 
 	// 检查订单状态
@@ -456,11 +483,10 @@ func TestExchangeService_Leverage(t *testing.T) {
 	require.NoError(t, err)
 
 	// 订阅K线
-	klineChan, err := svc.SubscribeKline(ctx, pair, interval)
-	require.NoError(t, err)
+	steps := newKlineSteps(t, svc, pair, interval)
 
 	// 等待第一根K线
-	<-klineChan
+	steps.next()
 
 	// 记录开仓前的可用余额
 	accountBefore, err := svc.GetAccountInfo(ctx)
@@ -480,7 +506,7 @@ func TestExchangeService_Leverage(t *testing.T) {
 	require.NoError(t, err)
 
 	// 等待成交
-	<-klineChan
+	steps.next()
 
 	// 检查持仓
 	positions, err := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
@@ -554,14 +580,13 @@ func TestExchangeService_StopLoss(t *testing.T) {
 	ctx := context.Background()
 
 	// 订阅K线
-	klineChan, err := svc.SubscribeKline(ctx, pair, interval)
-	require.NoError(t, err)
+	steps := newKlineSteps(t, svc, pair, interval)
 
 	// 等待第一根K线
-	<-klineChan
+	steps.next()
 
 	// 开多仓
-	_, err = svc.CreateOrder(ctx, exchange.CreateOrderReq{
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
 		TradingPair: pair,
 		OrderType:   exchange.OrderTypeOpen,
 		PositonSide: exchange.PositionSideLong,
@@ -572,7 +597,7 @@ func TestExchangeService_StopLoss(t *testing.T) {
 	require.NoError(t, err)
 
 	// 等待开仓成交
-	<-klineChan
+	steps.next()
 
 	// 检查持仓
 	positions, err := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
@@ -600,7 +625,7 @@ func TestExchangeService_StopLoss(t *testing.T) {
 	// 等待K线直到止损触发
 	triggered := false
 	for i := 0; i < 15; i++ {
-		<-klineChan
+		steps.next()
 
 		// 检查持仓是否已关闭
 		positions, err = svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
@@ -650,14 +675,13 @@ func TestExchangeService_TakeProfit(t *testing.T) {
 	ctx := context.Background()
 
 	// 订阅K线
-	klineChan, err := svc.SubscribeKline(ctx, pair, interval)
-	require.NoError(t, err)
+	steps := newKlineSteps(t, svc, pair, interval)
 
 	// 等待第一根K线
-	<-klineChan
+	steps.next()
 
 	// 开多仓
-	_, err = svc.CreateOrder(ctx, exchange.CreateOrderReq{
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
 		TradingPair: pair,
 		OrderType:   exchange.OrderTypeOpen,
 		PositonSide: exchange.PositionSideLong,
@@ -668,7 +692,7 @@ func TestExchangeService_TakeProfit(t *testing.T) {
 	require.NoError(t, err)
 
 	// 等待开仓成交
-	<-klineChan
+	steps.next()
 
 	// 检查持仓
 	positions, err := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
@@ -696,7 +720,7 @@ func TestExchangeService_TakeProfit(t *testing.T) {
 	// 等待K线直到止盈触发
 	triggered := false
 	for i := 0; i < 15; i++ {
-		<-klineChan
+		steps.next()
 
 		// 检查持仓是否已关闭
 		positions, err = svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
@@ -740,11 +764,10 @@ func TestExchangeService_CancelOrder(t *testing.T) {
 	ctx := context.Background()
 
 	// 订阅K线
-	klineChan, err := svc.SubscribeKline(ctx, pair, interval)
-	require.NoError(t, err)
+	steps := newKlineSteps(t, svc, pair, interval)
 
 	// 等待第一根K线
-	<-klineChan
+	steps.next()
 
 	// 记录创建订单前的余额
 	accountBefore, err := svc.GetAccountInfo(ctx)
@@ -813,14 +836,13 @@ func TestExchangeService_InsufficientBalance(t *testing.T) {
 	ctx := context.Background()
 
 	// 订阅K线
-	klineChan, err := svc.SubscribeKline(ctx, pair, interval)
-	require.NoError(t, err)
+	steps := newKlineSteps(t, svc, pair, interval)
 
 	// 等待第一根K线
-	<-klineChan
+	steps.next()
 
 	// 尝试开仓（数量过大，余额不足）
-	_, err = svc.CreateOrder(ctx, exchange.CreateOrderReq{
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
 		TradingPair: pair,
 		OrderType:   exchange.OrderTypeOpen,
 		PositonSide: exchange.PositionSideLong,
@@ -851,14 +873,13 @@ func TestExchangeService_UnrealizedPnL(t *testing.T) {
 	ctx := context.Background()
 
 	// 订阅K线
-	klineChan, err := svc.SubscribeKline(ctx, pair, interval)
-	require.NoError(t, err)
+	steps := newKlineSteps(t, svc, pair, interval)
 
 	// 等待第一根K线
-	<-klineChan
+	steps.next()
 
 	// 开多仓
-	_, err = svc.CreateOrder(ctx, exchange.CreateOrderReq{
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
 		TradingPair: pair,
 		OrderType:   exchange.OrderTypeOpen,
 		PositonSide: exchange.PositionSideLong,
@@ -869,7 +890,7 @@ func TestExchangeService_UnrealizedPnL(t *testing.T) {
 	require.NoError(t, err)
 
 	// 等待开仓成交
-	<-klineChan
+	steps.next()
 
 	// 检查初始持仓
 	positions, err := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
@@ -880,7 +901,7 @@ func TestExchangeService_UnrealizedPnL(t *testing.T) {
 
 	// 等待几根K线，价格上涨
 	for i := 0; i < 5; i++ {
-		<-klineChan
+		steps.next()
 	}
 
 	// 检查未实现盈亏
@@ -927,19 +948,17 @@ func TestExchangeService_MultiplePositions(t *testing.T) {
 	ctx := context.Background()
 
 	// 订阅BTC K线
-	klineChan1, err := svc.SubscribeKline(ctx, pair1, interval)
-	require.NoError(t, err)
+	steps1 := newKlineSteps(t, svc, pair1, interval)
 
 	// 订阅ETH K线
-	klineChan2, err := svc.SubscribeKline(ctx, pair2, interval)
-	require.NoError(t, err)
+	steps2 := newKlineSteps(t, svc, pair2, interval)
 
 	// 等待第一根K线
-	<-klineChan1
-	<-klineChan2
+	steps1.next()
+	steps2.next()
 
 	// 开BTC多仓
-	_, err = svc.CreateOrder(ctx, exchange.CreateOrderReq{
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
 		TradingPair: pair1,
 		OrderType:   exchange.OrderTypeOpen,
 		PositonSide: exchange.PositionSideLong,
@@ -961,8 +980,8 @@ func TestExchangeService_MultiplePositions(t *testing.T) {
 	require.NoError(t, err)
 
 	// 等待成交
-	<-klineChan1
-	<-klineChan2
+	steps1.next()
+	steps2.next()
 
 	// 检查持仓
 	allPositions, err := svc.GetActivePositions(ctx, []exchange.TradingPair{})
@@ -0,0 +1,82 @@
+package backtest
+
+import (
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+)
+
+// FeeRate 手续费率
+type FeeRate struct {
+	Maker decimal.Decimal // 挂单（限价单在盘口等待成交）
+	Taker decimal.Decimal // 吃单（市价单、条件单、下单即成交的限价单）
+}
+
+// FeeSchedule 手续费配置，可以按交易对单独配置
+type FeeSchedule struct {
+	Default FeeRate
+	Pairs   map[string]FeeRate // key: tradingPair symbol
+}
+
+// DefaultFeeSchedule 币安U本位合约普通用户费率：挂单 0.02%，吃单 0.05%
+func DefaultFeeSchedule() FeeSchedule {
+	return FeeSchedule{
+		Default: FeeRate{
+			Maker: decimal.NewFromFloat(0.0002),
+			Taker: decimal.NewFromFloat(0.0005),
+		},
+	}
+}
+
+// Rate 获取交易对的手续费率
+func (s FeeSchedule) Rate(tradingPair exchange.TradingPair) FeeRate {
+	if rate, ok := s.Pairs[tradingPair.ToString()]; ok {
+		return rate
+	}
+	return s.Default
+}
+
+// SetFeeSchedule 设置手续费配置，默认不收手续费
+func (svc *ExchangeService) SetFeeSchedule(schedule FeeSchedule) {
+	svc.feeMu.Lock()
+	defer svc.feeMu.Unlock()
+	svc.feeSchedule = schedule
+}
+
+// feeRate 获取订单成交适用的手续费率
+func (svc *ExchangeService) feeRate(order *exchange.OrderInfo) decimal.Decimal {
+	svc.feeMu.RLock()
+	rate := svc.feeSchedule.Rate(order.TradingPair)
+	svc.feeMu.RUnlock()
+
+	if svc.isMaker(order) {
+		return rate.Maker
+	}
+	return rate.Taker
+}
+
+// isMaker 订单下单时是否被判定为挂单
+func (svc *ExchangeService) isMaker(order *exchange.OrderInfo) bool {
+	svc.orderMu.RLock()
+	defer svc.orderMu.RUnlock()
+	return svc.makerOrders[exchange.OrderId(order.Id)]
+}
+
+// isMakerOrder 判断订单是否作为挂单成交
+// 只有下单时不会立即成交的限价单才是挂单：买单限价低于当前价，卖单限价高于当前价
+func (svc *ExchangeService) isMakerOrder(req exchange.CreateOrderReq) bool {
+	if req.Conditional.IsConditional() || req.Price.IsZero() {
+		return false
+	}
+
+	svc.priceMu.RLock()
+	currentPrice, ok := svc.currentPrices[req.TradingPair.ToString()]
+	svc.priceMu.RUnlock()
+	if !ok {
+		return true
+	}
+
+	if exchange.IsBuySide(req.OrderType, req.PositonSide) {
+		return req.Price.LessThan(currentPrice)
+	}
+	return req.Price.GreaterThan(currentPrice)
+}
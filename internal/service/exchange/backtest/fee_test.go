@@ -0,0 +1,135 @@
+package backtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFee_MakerLimitOrder 测试挂单成交的限价单按挂单费率收取手续费
+func TestFee_MakerLimitOrder(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 市价开仓
+		{100, 106, 99, 105}, // 限价 105 平仓
+		{105, 106, 104, 105},
+	})
+	// 开仓在设置费率之前完成，这里只校验平仓手续费
+	svc.SetFeeSchedule(FeeSchedule{
+		Default: FeeRate{Maker: decimal.NewFromFloat(0.0005), Taker: decimal.NewFromFloat(0.001)},
+	})
+	ctx := context.Background()
+
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeClose,
+		PositonSide: exchange.PositionSideLong,
+		Price:       decimal.NewFromInt(105), // 高于当前价的卖单，挂单成交
+		Quantity:    decimal.NewFromInt(1),
+	})
+	require.NoError(t, err)
+	steps.next()
+
+	histories, err := svc.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{})
+	require.NoError(t, err)
+	require.Len(t, histories, 1)
+
+	// 平仓手续费 = 105 × 1 × 0.05%
+	expectedFee := decimal.NewFromFloat(0.0525)
+	assert.True(t, histories[0].Fee.Equal(expectedFee), "fee: %s", histories[0].Fee)
+	assert.True(t, histories[0].Events[len(histories[0].Events)-1].Fee.Equal(expectedFee))
+	assert.True(t, histories[0].NetPnl().Equal(decimal.NewFromInt(5).Sub(expectedFee)))
+
+	account, err := svc.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.True(t, account.TotalBalance.Equal(decimal.NewFromInt(100005).Sub(expectedFee)), "balance: %s", account.TotalBalance)
+}
+
+// TestFee_MarketOrderTaker 测试开仓市价单按吃单费率扣费
+func TestFee_MarketOrderTaker(t *testing.T) {
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	interval := exchange.Interval5m
+	svc, provider := createTestExchange(t, 10000.0, startTime, startTime.Add(3*interval.Duration()))
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	provider.AddKlines(pair, interval, buildOHLCKlines(startTime, interval, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 101, 99, 100},
+		{100, 101, 99, 100},
+	}))
+	svc.SetFeeSchedule(DefaultFeeSchedule())
+
+	ctx := context.Background()
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
+
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Quantity:    decimal.NewFromInt(10),
+	})
+	require.NoError(t, err)
+	steps.next()
+
+	// 开仓手续费 = 100 × 10 × 0.05%
+	account, err := svc.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.True(t, account.TotalBalance.Equal(decimal.NewFromFloat(9999.5)), "balance: %s", account.TotalBalance)
+}
+
+// TestFunding_ConstantRate 测试持仓跨过资金费结算时间时收取资金费
+func TestFunding_ConstantRate(t *testing.T) {
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	interval := exchange.Interval1h
+	ohlc := make([][4]float64, 10)
+	for i := range ohlc {
+		ohlc[i] = [4]float64{100, 101, 99, 100}
+	}
+	svc, provider := createTestExchange(t, 10000.0, startTime, startTime.Add(10*interval.Duration()))
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	provider.AddKlines(pair, interval, buildOHLCKlines(startTime, interval, ohlc))
+	// 费率 0.01%，每 8 小时结算一次
+	svc.SetFundingRateSource(NewConstantFundingRateSource(decimal.NewFromFloat(0.0001), 8*time.Hour))
+
+	ctx := context.Background()
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next() // 00:00，此时无持仓，不收资金费
+
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Quantity:    decimal.NewFromInt(10),
+	})
+	require.NoError(t, err)
+
+	// 01:00 开仓成交，一直持有到 08:00 的K线
+	for i := 1; i <= 8; i++ {
+		steps.next()
+	}
+
+	// 多头支付 100 × 10 × 0.01% = 0.1
+	account, err := svc.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.True(t, account.TotalBalance.Equal(decimal.NewFromFloat(9999.9)), "balance: %s", account.TotalBalance)
+
+	_, err = svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeClose,
+		PositonSide: exchange.PositionSideLong,
+		Quantity:    decimal.NewFromInt(10),
+	})
+	require.NoError(t, err)
+	steps.next()
+
+	histories, err := svc.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{})
+	require.NoError(t, err)
+	require.Len(t, histories, 1)
+	assert.True(t, histories[0].Funding.Equal(decimal.NewFromFloat(-0.1)), "funding: %s", histories[0].Funding)
+	assert.True(t, histories[0].NetPnl().Equal(decimal.NewFromFloat(-0.1)))
+}
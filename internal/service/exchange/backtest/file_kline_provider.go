@@ -0,0 +1,297 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+)
+
+var (
+	// ErrKlineNotMonotonic K线开盘时间没有严格递增（乱序或重复）
+	ErrKlineNotMonotonic = errors.New("kline open time is not strictly increasing")
+	// ErrKlineGap 相邻K线之间缺失数据
+	ErrKlineGap = errors.New("kline gap detected")
+)
+
+// FileKlineProvider 从本地文件加载K线数据，用于离线、可复现的回测
+//
+// 目录结构按交易对和周期划分：
+//
+//	<root>/<SYMBOL>/<interval>/*.csv
+//	<root>/<SYMBOL>/<interval>/*.parquet
+//
+// 例如 data/BTCUSDT/1h/BTCUSDT-1h-2024-01.csv。同一目录下的文件按文件名中的日期排序后依次读取，
+// 月度数据包已经覆盖的每日数据包会被忽略，币安公开数据（data.binance.vision）解压后可以直接放入对应目录。
+//
+// 文件逐行流式读取，不会整体载入内存；读取时校验开盘时间严格递增且没有缺口。
+type FileKlineProvider struct {
+	root      string
+	allowGaps bool
+
+	mu      sync.Mutex
+	cursors map[string]fileCursor // 顺序读取的断点，分批读取时不必每次从头扫描
+}
+
+// fileCursor 上次读取停止的位置
+type fileCursor struct {
+	path string    // 下一行所在的文件，为空表示全部读完
+	pos  filePos   // 下一行在文件中的位置
+	next time.Time // 下一行的开盘时间，之前的行开盘时间都小于它
+	prev time.Time // 上一行的开盘时间，用于跨批次校验缺口
+}
+
+// NewFileKlineProvider 创建文件K线提供者，root 为数据根目录
+func NewFileKlineProvider(root string) *FileKlineProvider {
+	return &FileKlineProvider{
+		root:    root,
+		cursors: make(map[string]fileCursor),
+	}
+}
+
+// SetAllowGaps 设置是否允许K线缺口（默认不允许）
+// 交易所维护期间可能确实没有K线，允许缺口后只校验时间递增
+func (p *FileKlineProvider) SetAllowGaps(allow bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.allowGaps = allow
+}
+
+// GetKlines 获取 [StartTime, EndTime) 范围内的K线
+func (p *FileKlineProvider) GetKlines(ctx context.Context, req exchange.GetKlinesReq) ([]exchange.Kline, error) {
+	var klines []exchange.Kline
+	err := p.StreamKlines(ctx, req, func(kline exchange.Kline) error {
+		klines = append(klines, kline)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return klines, nil
+}
+
+// StreamKlines 按时间顺序逐根回调 [StartTime, EndTime) 范围内的K线，fn 返回错误时停止读取
+func (p *FileKlineProvider) StreamKlines(ctx context.Context, req exchange.GetKlinesReq, fn func(exchange.Kline) error) error {
+	dir := filepath.Join(p.root, req.TradingPair.ToString(), req.Interval.ToString())
+	files, err := listKlineFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	key := req.TradingPair.ToString() + "_" + req.Interval.ToString()
+	p.mu.Lock()
+	cursor, hasCursor := p.cursors[key]
+	allowGaps := p.allowGaps
+	p.mu.Unlock()
+
+	// 请求从断点之后开始时，断点之前的行都不在范围内，直接从断点继续
+	startIdx := 0
+	var startPos filePos
+	var prev time.Time
+	if hasCursor && !req.StartTime.Before(cursor.next) {
+		if cursor.path == "" {
+			return nil
+		}
+		for idx, path := range files {
+			if path == cursor.path {
+				startIdx, startPos, prev = idx, cursor.pos, cursor.prev
+				break
+			}
+		}
+	}
+
+	for i := startIdx; i < len(files); i++ {
+		path := files[i]
+		from, to, ok := fileTimeRange(path)
+		if ok && !from.Before(req.EndTime) {
+			// 文件按时间排序，之后的文件都在范围之外，下次从这个文件开始读
+			p.saveCursor(key, fileCursor{path: path, next: from, prev: prev})
+			return nil
+		}
+		if ok && !to.After(req.StartTime) {
+			// 整个文件都在范围之前，跳过后无法校验与下一个文件之间的缺口
+			prev = time.Time{}
+			continue
+		}
+
+		pos := filePos{}
+		if i == startIdx {
+			pos = startPos
+		}
+		stopped, err := p.streamFile(ctx, key, path, pos, req, allowGaps, &prev, fn)
+		if err != nil {
+			return err
+		}
+		if stopped {
+			return nil
+		}
+	}
+
+	// 全部文件读完
+	if !prev.IsZero() {
+		p.saveCursor(key, fileCursor{next: prev.Add(time.Nanosecond), prev: prev})
+	}
+	return nil
+}
+
+// streamFile 从 pos 开始读取单个文件，遇到 EndTime 之后的K线时保存断点并返回 stopped
+func (p *FileKlineProvider) streamFile(
+	ctx context.Context,
+	key string,
+	path string,
+	pos filePos,
+	req exchange.GetKlinesReq,
+	allowGaps bool,
+	prev *time.Time,
+	fn func(exchange.Kline) error,
+) (stopped bool, err error) {
+	reader, err := openKlineFile(path, req.Interval, pos)
+	if err != nil {
+		return false, fmt.Errorf("open kline file %s: %w", path, err)
+	}
+	defer reader.Close()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		rowPos := reader.Pos()
+		kline, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("read kline file %s: %w", path, err)
+		}
+
+		if !prev.IsZero() {
+			if !kline.OpenTime.After(*prev) {
+				return false, fmt.Errorf("%s at %s: %w (previous %s)", path, kline.OpenTime.Format(time.RFC3339), ErrKlineNotMonotonic, prev.Format(time.RFC3339))
+			}
+			if !allowGaps && kline.OpenTime.Sub(*prev) != req.Interval.Duration() {
+				return false, fmt.Errorf("%s: %w between %s and %s", path, ErrKlineGap, prev.Format(time.RFC3339), kline.OpenTime.Format(time.RFC3339))
+			}
+		}
+
+		if !kline.OpenTime.Before(req.EndTime) {
+			p.saveCursor(key, fileCursor{path: path, pos: rowPos, next: kline.OpenTime, prev: *prev})
+			return true, nil
+		}
+		*prev = kline.OpenTime
+
+		if kline.OpenTime.Before(req.StartTime) {
+			continue
+		}
+		if err := fn(kline); err != nil {
+			return false, err
+		}
+	}
+}
+
+func (p *FileKlineProvider) saveCursor(key string, cursor fileCursor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cursors[key] = cursor
+}
+
+// listKlineFiles 列出目录下的K线文件，按时间顺序排列
+func listKlineFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read kline directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".csv", ".parquet":
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return orderKlineFiles(files), nil
+}
+
+// orderKlineFiles 按文件名中的日期排序，去掉被月度数据包覆盖的每日数据包和同一时段的重复文件
+// 只按文件名排序时每日数据包会排在同月的月度数据包之前；无法推断时间范围的文件排在最前，按文件名排序
+func orderKlineFiles(files []string) []string {
+	type klineFile struct {
+		path     string
+		from, to time.Time
+		ranged   bool
+	}
+	items := make([]klineFile, 0, len(files))
+	for _, path := range files {
+		from, to, ok := fileTimeRange(path)
+		items = append(items, klineFile{path: path, from: from, to: to, ranged: ok})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.ranged != b.ranged {
+			return !a.ranged
+		}
+		if !a.from.Equal(b.from) {
+			return a.from.Before(b.from)
+		}
+		// 同一起点时范围大的（月度）在前，后面被覆盖的文件会被去掉
+		if !a.to.Equal(b.to) {
+			return a.to.After(b.to)
+		}
+		return a.path < b.path
+	})
+
+	ordered := make([]string, 0, len(items))
+	var covered time.Time
+	for _, item := range items {
+		if item.ranged {
+			if !item.to.After(covered) {
+				continue
+			}
+			covered = item.to
+		}
+		ordered = append(ordered, item.path)
+	}
+	return ordered
+}
+
+// binanceFileDate 币安数据包的文件名：BTCUSDT-1h-2024-01（月度）或 BTCUSDT-1h-2024-01-15（每日）
+var binanceFileDate = regexp.MustCompile(`-(\d{4})-(\d{2})(?:-(\d{2}))?$`)
+
+// fileTimeRange 从文件名推断文件覆盖的时间范围 [from, to)，无法推断时 ok 为 false
+func fileTimeRange(path string) (from, to time.Time, ok bool) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	match := binanceFileDate.FindStringSubmatch(name)
+	if match == nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	year, _ := strconv.Atoi(match[1])
+	month, _ := strconv.Atoi(match[2])
+	if month < 1 || month > 12 {
+		return time.Time{}, time.Time{}, false
+	}
+	if match[3] == "" {
+		from = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 1, 0), true
+	}
+
+	day, _ := strconv.Atoi(match[3])
+	from = time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if from.Day() != day {
+		return time.Time{}, time.Time{}, false
+	}
+	return from, from.AddDate(0, 0, 1), true
+}
@@ -0,0 +1,299 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/KNICEX/trading-agent/pkg/parquetx"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var filePair = exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+
+// writeKlineFile 在 <root>/BTCUSDT/<interval>/ 下写入文件
+func writeKlineFile(t *testing.T, root string, interval exchange.Interval, name, content string) {
+	dir := filepath.Join(root, filePair.ToString(), interval.ToString())
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+// binanceRows 生成币安数据包格式的行，scale 为时间戳相对毫秒的倍数（1000 表示微秒）
+func binanceRows(start time.Time, interval exchange.Interval, count int, basePrice float64, scale int64) string {
+	var sb strings.Builder
+	for i := 0; i < count; i++ {
+		openTime := start.Add(time.Duration(i) * interval.Duration())
+		closeTime := openTime.Add(interval.Duration() - time.Millisecond)
+		price := basePrice + float64(i)
+		fmt.Fprintf(&sb, "%d,%.2f,%.2f,%.2f,%.2f,10.5,%d,1050.25,42,5.1,510.3,0\n",
+			openTime.UnixMilli()*scale, price, price+2, price-2, price+1, closeTime.UnixMilli()*scale)
+	}
+	return sb.String()
+}
+
+// TestFileKlineProvider_BinanceDump 测试币安数据包格式：跨月度文件读取、微秒时间戳、时间范围过滤
+func TestFileKlineProvider_BinanceDump(t *testing.T) {
+	root := t.TempDir()
+	interval := exchange.Interval1h
+	jan := time.Date(2024, 1, 31, 20, 0, 0, 0, time.UTC)
+	feb := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	// 一月的文件带表头，二月的文件无表头且时间戳为微秒
+	header := "open_time,open,high,low,close,volume,close_time,quote_volume,count,taker_buy_volume,taker_buy_quote_volume,ignore\n"
+	writeKlineFile(t, root, interval, "BTCUSDT-1h-2024-01.csv", header+binanceRows(jan, interval, 4, 100, 1))
+	writeKlineFile(t, root, interval, "BTCUSDT-1h-2024-02.csv", binanceRows(feb, interval, 4, 200, 1000))
+
+	provider := NewFileKlineProvider(root)
+	klines, err := provider.GetKlines(context.Background(), exchange.GetKlinesReq{
+		TradingPair: filePair,
+		Interval:    interval,
+		StartTime:   jan.Add(2 * time.Hour),
+		EndTime:     feb.Add(3 * time.Hour),
+	})
+	require.NoError(t, err)
+	require.Len(t, klines, 5)
+
+	assert.Equal(t, jan.Add(2*time.Hour), klines[0].OpenTime)
+	assert.Equal(t, feb, klines[2].OpenTime)
+	assert.Equal(t, feb.Add(time.Hour-time.Millisecond), klines[2].CloseTime)
+	assert.True(t, klines[2].Open.Equal(decimal.NewFromInt(200)))
+	assert.True(t, klines[2].High.Equal(decimal.NewFromInt(202)))
+	assert.True(t, klines[2].Low.Equal(decimal.NewFromInt(198)))
+	assert.True(t, klines[2].Close.Equal(decimal.NewFromInt(201)))
+	assert.True(t, klines[2].Volume.Equal(decimal.NewFromFloat(10.5)))
+	assert.True(t, klines[2].QuoteAssetVolume.Equal(decimal.NewFromFloat(1050.25)))
+	assert.Equal(t, feb.Add(2*time.Hour), klines[4].OpenTime)
+}
+
+// TestFileKlineProvider_DailyAndMonthly 测试月度和每日数据包混放：按日期排序，月度已覆盖的每日数据包被忽略
+func TestFileKlineProvider_DailyAndMonthly(t *testing.T) {
+	root := t.TempDir()
+	interval := exchange.Interval1h
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	// 按文件名排序时每日数据包 2024-01-15 排在月度数据包 2024-01 之前
+	writeKlineFile(t, root, interval, "BTCUSDT-1h-2024-01.csv", binanceRows(jan, interval, 31*24, 100, 1))
+	writeKlineFile(t, root, interval, "BTCUSDT-1h-2024-01-15.csv", binanceRows(jan.AddDate(0, 0, 14), interval, 24, 5000, 1))
+	writeKlineFile(t, root, interval, "BTCUSDT-1h-2024-02-01.csv", binanceRows(feb, interval, 24, 2000, 1))
+
+	files, err := listKlineFiles(filepath.Join(root, filePair.ToString(), interval.ToString()))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "BTCUSDT-1h-2024-01.csv", filepath.Base(files[0]))
+	assert.Equal(t, "BTCUSDT-1h-2024-02-01.csv", filepath.Base(files[1]))
+
+	provider := NewFileKlineProvider(root)
+	klines, err := provider.GetKlines(context.Background(), exchange.GetKlinesReq{
+		TradingPair: filePair,
+		Interval:    interval,
+		StartTime:   jan,
+		EndTime:     feb.Add(24 * time.Hour),
+	})
+	require.NoError(t, err)
+	require.Len(t, klines, 32*24)
+
+	// 1 月 15 日的数据来自月度数据包
+	assert.True(t, klines[14*24].Open.Equal(decimal.NewFromInt(100+14*24)))
+	assert.Equal(t, feb, klines[31*24].OpenTime)
+	assert.True(t, klines[31*24].Open.Equal(decimal.NewFromInt(2000)))
+}
+
+// TestFileKlineProvider_HeaderCSV 测试按表头匹配列、日期字符串时间和缺省收盘时间
+func TestFileKlineProvider_HeaderCSV(t *testing.T) {
+	root := t.TempDir()
+	interval := exchange.Interval15m
+	writeKlineFile(t, root, interval, "klines.csv", strings.Join([]string{
+		"Timestamp,Close,Open,Low,High",
+		"2024-03-01T00:00:00Z,101,100,99,102",
+		"2024-03-01T00:15:00Z,103,101,100,104",
+		"2024-03-01 00:30:00,102,103,101,104",
+	}, "\n"))
+
+	provider := NewFileKlineProvider(root)
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	klines, err := provider.GetKlines(context.Background(), exchange.GetKlinesReq{
+		TradingPair: filePair,
+		Interval:    interval,
+		StartTime:   start,
+		EndTime:     start.Add(24 * time.Hour),
+	})
+	require.NoError(t, err)
+	require.Len(t, klines, 3)
+	assert.True(t, klines[1].Open.Equal(decimal.NewFromInt(101)))
+	assert.True(t, klines[1].Close.Equal(decimal.NewFromInt(103)))
+	assert.True(t, klines[1].Volume.IsZero())
+	assert.Equal(t, start.Add(30*time.Minute), klines[2].OpenTime)
+	assert.Equal(t, start.Add(30*time.Minute-time.Millisecond), klines[1].CloseTime)
+}
+
+// TestFileKlineProvider_Validation 测试缺口和乱序检测
+func TestFileKlineProvider_Validation(t *testing.T) {
+	interval := exchange.Interval1h
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	req := exchange.GetKlinesReq{
+		TradingPair: filePair,
+		Interval:    interval,
+		StartTime:   start,
+		EndTime:     start.Add(24 * time.Hour),
+	}
+
+	t.Run("gap", func(t *testing.T) {
+		root := t.TempDir()
+		rows := binanceRows(start, interval, 2, 100, 1) + binanceRows(start.Add(3*time.Hour), interval, 2, 100, 1)
+		writeKlineFile(t, root, interval, "data.csv", rows)
+
+		provider := NewFileKlineProvider(root)
+		_, err := provider.GetKlines(context.Background(), req)
+		assert.ErrorIs(t, err, ErrKlineGap)
+
+		// 允许缺口后正常读取
+		provider = NewFileKlineProvider(root)
+		provider.SetAllowGaps(true)
+		klines, err := provider.GetKlines(context.Background(), req)
+		require.NoError(t, err)
+		assert.Len(t, klines, 4)
+	})
+
+	t.Run("not monotonic", func(t *testing.T) {
+		root := t.TempDir()
+		rows := binanceRows(start, interval, 3, 100, 1) + binanceRows(start.Add(time.Hour), interval, 1, 100, 1)
+		writeKlineFile(t, root, interval, "data.csv", rows)
+
+		provider := NewFileKlineProvider(root)
+		provider.SetAllowGaps(true)
+		_, err := provider.GetKlines(context.Background(), req)
+		assert.ErrorIs(t, err, ErrKlineNotMonotonic)
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		provider := NewFileKlineProvider(t.TempDir())
+		_, err := provider.GetKlines(context.Background(), req)
+		assert.Error(t, err)
+	})
+}
+
+// TestFileKlineProvider_Parquet 测试读取多个行组的 Parquet 文件
+func TestFileKlineProvider_Parquet(t *testing.T) {
+	root := t.TempDir()
+	interval := exchange.Interval5m
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	dir := filepath.Join(root, filePair.ToString(), interval.ToString())
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	f, err := os.Create(filepath.Join(dir, "BTCUSDT-5m-2024-01.parquet"))
+	require.NoError(t, err)
+
+	w, err := parquetx.NewWriter(f, []parquetx.Field{
+		{Name: "open_time", Type: parquetx.TypeInt64, Unit: parquetx.TimeUnitMillis},
+		{Name: "open", Type: parquetx.TypeDouble},
+		{Name: "high", Type: parquetx.TypeDouble},
+		{Name: "low", Type: parquetx.TypeDouble},
+		{Name: "close", Type: parquetx.TypeDouble},
+		{Name: "volume", Type: parquetx.TypeByteArray},
+	})
+	require.NoError(t, err)
+	// 两个行组，每组 3 根K线
+	for g := 0; g < 2; g++ {
+		columns := []*parquetx.ColumnData{
+			{Type: parquetx.TypeInt64}, {Type: parquetx.TypeDouble}, {Type: parquetx.TypeDouble},
+			{Type: parquetx.TypeDouble}, {Type: parquetx.TypeDouble}, {Type: parquetx.TypeByteArray},
+		}
+		for i := 0; i < 3; i++ {
+			n := g*3 + i
+			price := 100 + float64(n)
+			columns[0].Ints = append(columns[0].Ints, start.Add(time.Duration(n)*interval.Duration()).UnixMilli())
+			columns[1].Floats = append(columns[1].Floats, price)
+			columns[2].Floats = append(columns[2].Floats, price+1)
+			columns[3].Floats = append(columns[3].Floats, price-1)
+			columns[4].Floats = append(columns[4].Floats, price+0.5)
+			columns[5].Bytes = append(columns[5].Bytes, []byte("12.345"))
+		}
+		require.NoError(t, w.WriteRowGroup(columns))
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	provider := NewFileKlineProvider(root)
+	klines, err := provider.GetKlines(context.Background(), exchange.GetKlinesReq{
+		TradingPair: filePair,
+		Interval:    interval,
+		StartTime:   start.Add(2 * interval.Duration()),
+		EndTime:     start.Add(5 * interval.Duration()),
+	})
+	require.NoError(t, err)
+	require.Len(t, klines, 3)
+	assert.Equal(t, start.Add(2*interval.Duration()), klines[0].OpenTime)
+	assert.True(t, klines[1].Open.Equal(decimal.NewFromInt(103)), "跨行组读取")
+	assert.True(t, klines[1].Close.Equal(decimal.NewFromFloat(103.5)))
+	assert.True(t, klines[1].Volume.Equal(decimal.NewFromFloat(12.345)))
+	assert.Equal(t, klines[1].OpenTime.Add(interval.Duration()-time.Millisecond), klines[1].CloseTime)
+}
+
+// TestFileKlineProvider_SequentialBatches 测试分批读取（从断点继续）与一次性读取结果一致
+func TestFileKlineProvider_SequentialBatches(t *testing.T) {
+	root := t.TempDir()
+	interval := exchange.Interval1h
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeKlineFile(t, root, interval, "a.csv", binanceRows(start, interval, 10, 100, 1))
+	writeKlineFile(t, root, interval, "b.csv", binanceRows(start.Add(10*time.Hour), interval, 10, 110, 1))
+
+	ctx := context.Background()
+	provider := NewFileKlineProvider(root)
+	var batched []exchange.Kline
+	for batchStart := start; batchStart.Before(start.Add(24 * time.Hour)); batchStart = batchStart.Add(3 * time.Hour) {
+		klines, err := provider.GetKlines(ctx, exchange.GetKlinesReq{
+			TradingPair: filePair,
+			Interval:    interval,
+			StartTime:   batchStart,
+			EndTime:     batchStart.Add(3 * time.Hour),
+		})
+		require.NoError(t, err)
+		batched = append(batched, klines...)
+	}
+	require.Len(t, batched, 20)
+	for i, kline := range batched {
+		assert.Equal(t, start.Add(time.Duration(i)*time.Hour), kline.OpenTime)
+	}
+
+	// 断点之前的范围仍然可以读取
+	klines, err := provider.GetKlines(ctx, exchange.GetKlinesReq{
+		TradingPair: filePair,
+		Interval:    interval,
+		StartTime:   start.Add(4 * time.Hour),
+		EndTime:     start.Add(6 * time.Hour),
+	})
+	require.NoError(t, err)
+	require.Len(t, klines, 2)
+	assert.True(t, klines[0].Open.Equal(decimal.NewFromInt(104)))
+}
+
+// TestFileKlineProvider_WithExchange 测试回测交易所使用文件数据回放K线
+func TestFileKlineProvider_WithExchange(t *testing.T) {
+	root := t.TempDir()
+	interval := exchange.Interval1h
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeKlineFile(t, root, interval, "BTCUSDT-1h-2024-01.csv", binanceRows(start, interval, 300, 100, 1))
+
+	svc := NewExchangeService(start, start.Add(250*time.Hour), decimal.NewFromInt(10000), NewFileKlineProvider(root))
+
+	count := 0
+	var last exchange.Kline
+	recorder := &replayRecorder{onKline: func(sub KlineSubscription, kline exchange.Kline) error {
+		if count > 0 {
+			assert.Equal(t, last.OpenTime.Add(time.Hour), kline.OpenTime)
+		}
+		last = kline
+		count++
+		return nil
+	}}
+	require.NoError(t, svc.Replay(context.Background(), []KlineSubscription{{TradingPair: filePair, Interval: interval}}, recorder))
+	assert.Equal(t, 250, count)
+}
@@ -0,0 +1,105 @@
+package backtest
+
+import (
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+)
+
+// FillModel 限价挂单成交模型
+// 只作用于下单时没有立即成交、在盘口排队的限价单（挂单），市价单、条件单和下单即成交的限价单一次全部成交
+// 没有设置时K线触及挂单价即全部成交（默认）
+type FillModel interface {
+	// FillQuantity 返回本根K线可以成交的数量，返回 0 表示本根K线不成交
+	// 返回值超过 Remaining 时按 Remaining 成交
+	FillQuantity(req FillReq) decimal.Decimal
+}
+
+// FillReq 计算挂单成交数量所需的信息
+type FillReq struct {
+	Order     *exchange.OrderInfo
+	Remaining decimal.Decimal // 剩余未成交数量
+	Kline     exchange.Kline  // 触及挂单价的K线
+	// TradedThrough 价格是否穿过挂单价（买单最低价低于挂单价，卖单最高价高于挂单价）
+	// 只是触及挂单价时，同价位排在前面的订单还没有全部成交
+	TradedThrough bool
+}
+
+// VolumeParticipationFill 按K线成交量占比成交
+// 每根K线最多成交 Rate × K线成交量；价格只触及挂单价时，先扣除排在前面的 QueueAhead × K线成交量
+type VolumeParticipationFill struct {
+	Rate       decimal.Decimal // 成交量占比，例如 0.1 表示每根K线最多成交该K线成交量的 10%
+	QueueAhead decimal.Decimal // 挂单前方排队量占K线成交量的比例，为 0 表示不考虑排队
+}
+
+func (m VolumeParticipationFill) FillQuantity(req FillReq) decimal.Decimal {
+	quantity := req.Kline.Volume.Mul(m.Rate)
+	if !req.TradedThrough {
+		quantity = quantity.Sub(req.Kline.Volume.Mul(m.QueueAhead))
+	}
+	return quantity
+}
+
+// SetFillModel 设置限价挂单成交模型，nil 表示触及挂单价即全部成交（默认）
+func (svc *ExchangeService) SetFillModel(model FillModel) {
+	svc.fillMu.Lock()
+	defer svc.fillMu.Unlock()
+	svc.fillModel = model
+}
+
+// fillQuantity 计算订单在本根K线上要成交的数量
+// 挂单限价单按成交模型计算，其余订单成交全部剩余数量
+func (svc *ExchangeService) fillQuantity(order *exchange.OrderInfo, kline exchange.Kline) decimal.Decimal {
+	remaining := order.Quantity.Sub(order.ExecutedQuantity)
+	if order.Conditional.IsConditional() || order.Price.IsZero() {
+		return remaining
+	}
+
+	svc.fillMu.RLock()
+	model := svc.fillModel
+	svc.fillMu.RUnlock()
+	if model == nil {
+		return remaining
+	}
+
+	svc.orderMu.RLock()
+	maker := svc.makerOrders[exchange.OrderId(order.Id)]
+	svc.orderMu.RUnlock()
+	if !maker {
+		return remaining
+	}
+
+	tradedThrough := kline.High.GreaterThan(order.Price)
+	if order.IsBuy() {
+		tradedThrough = kline.Low.LessThan(order.Price)
+	}
+	quantity := model.FillQuantity(FillReq{
+		Order:         order,
+		Remaining:     remaining,
+		Kline:         kline,
+		TradedThrough: tradedThrough,
+	})
+	if !quantity.IsPositive() {
+		return decimal.Zero
+	}
+	return decimal.Min(quantity, remaining)
+}
+
+// releaseFrozenFunds 订单结束时返还剩余的冻结资金
+func (svc *ExchangeService) releaseFrozenFunds(orderId exchange.OrderId) {
+	svc.accountMu.Lock()
+	defer svc.accountMu.Unlock()
+
+	if frozenAmount, ok := svc.frozenFunds[orderId]; ok {
+		delete(svc.frozenFunds, orderId)
+		svc.account.AvailableBalance = svc.account.AvailableBalance.Add(frozenAmount)
+	}
+}
+
+// averagePrice 累计成交后的成交均价
+func averagePrice(avgPrice, executed, price, quantity decimal.Decimal) decimal.Decimal {
+	total := executed.Add(quantity)
+	if total.IsZero() {
+		return decimal.Zero
+	}
+	return avgPrice.Mul(executed).Add(price.Mul(quantity)).Div(total)
+}
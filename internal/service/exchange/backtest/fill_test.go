@@ -0,0 +1,117 @@
+package backtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createRestingBuy 在当前价 100 下方挂 95 的限价买单（挂单）
+func createRestingBuy(t *testing.T, svc *ExchangeService, pair exchange.TradingPair, quantity int64) exchange.OrderId {
+	id, err := svc.CreateOrder(context.Background(), exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Price:       decimal.NewFromInt(95),
+		Quantity:    decimal.NewFromInt(quantity),
+	})
+	require.NoError(t, err)
+	return id
+}
+
+// TestFillModel_VolumeParticipation 测试挂单按K线成交量占比分多根K线成交
+func TestFillModel_VolumeParticipation(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓 1 BTC
+		{100, 101, 94, 96},  // 成交 3
+		{96, 97, 94, 95},    // 成交 3
+		{95, 96, 94, 95},    // 成交 3
+		{95, 96, 94, 95},    // 成交剩余的 1
+		{95, 96, 94, 95},
+	})
+	ctx := context.Background()
+	// K线成交量 100，每根K线最多成交 3
+	svc.SetFillModel(VolumeParticipationFill{Rate: decimal.NewFromFloat(0.03)})
+	id := createRestingBuy(t, svc, pair, 10)
+
+	for i, executed := range []int64{3, 6, 9} {
+		steps.next()
+		order, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: id})
+		require.NoError(t, err)
+		assert.Equal(t, exchange.OrderStatusPartiallyFilled, order.Status, "kline %d", i)
+		assert.True(t, order.ExecutedQuantity.Equal(decimal.NewFromInt(executed)), "kline %d executed: %s", i, order.ExecutedQuantity)
+		assert.True(t, order.AvgPrice.Equal(decimal.NewFromInt(95)), "kline %d avg price: %s", i, order.AvgPrice)
+
+		// 部分成交的订单仍然在未成交列表里
+		orders, err := svc.GetOrders(ctx, exchange.GetOrdersReq{TradingPair: pair})
+		require.NoError(t, err)
+		assert.Len(t, orders, 1)
+	}
+
+	steps.next()
+	order, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: id})
+	require.NoError(t, err)
+	assert.Equal(t, exchange.OrderStatusFilled, order.Status)
+	assert.True(t, order.ExecutedQuantity.Equal(decimal.NewFromInt(10)))
+
+	positions, err := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	assert.True(t, positions[0].Quantity.Equal(decimal.NewFromInt(11)), "quantity: %s", positions[0].Quantity)
+}
+
+// TestFillModel_QueueAhead 测试只触及挂单价时先扣除前方排队量，价格穿过挂单价时不扣除
+func TestFillModel_QueueAhead(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓 1 BTC
+		{100, 101, 96, 97},  // 未触及
+		{97, 98, 95, 96},    // 只触及 95：3 - 1 = 2
+		{96, 97, 94, 95},    // 穿过 95：3
+		{95, 96, 94, 95},
+	})
+	ctx := context.Background()
+	svc.SetFillModel(VolumeParticipationFill{
+		Rate:       decimal.NewFromFloat(0.03),
+		QueueAhead: decimal.NewFromFloat(0.01),
+	})
+	id := createRestingBuy(t, svc, pair, 10)
+
+	for i, executed := range []int64{0, 2, 5} {
+		steps.next()
+		order, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: id})
+		require.NoError(t, err)
+		assert.True(t, order.ExecutedQuantity.Equal(decimal.NewFromInt(executed)), "kline %d executed: %s", i, order.ExecutedQuantity)
+	}
+}
+
+// TestFillModel_CancelPartiallyFilled 测试撤销部分成交的挂单，返还剩余的冻结资金
+func TestFillModel_CancelPartiallyFilled(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓 1 BTC，占用保证金 100
+		{100, 101, 94, 96},  // 成交 3，占用保证金 285
+		{96, 97, 94, 95},
+	})
+	ctx := context.Background()
+	svc.SetFillModel(VolumeParticipationFill{Rate: decimal.NewFromFloat(0.03)})
+	id := createRestingBuy(t, svc, pair, 10)
+
+	steps.next()
+	require.NoError(t, svc.CancelOrder(ctx, exchange.CancelOrderReq{Id: id, TradingPair: pair}))
+
+	order, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: id})
+	require.NoError(t, err)
+	assert.Equal(t, exchange.OrderStatusCancelled, order.Status)
+	assert.True(t, order.ExecutedQuantity.Equal(decimal.NewFromInt(3)))
+
+	account, err := svc.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.True(t, account.AvailableBalance.Equal(decimal.NewFromInt(100000-100-285)), "available balance: %s", account.AvailableBalance)
+	assert.True(t, account.UsedMargin.Equal(decimal.NewFromInt(385)), "used margin: %s", account.UsedMargin)
+}
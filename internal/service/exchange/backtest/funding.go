@@ -0,0 +1,127 @@
+package backtest
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+)
+
+// FundingRateSource 资金费率数据源
+// binance.MarketService 直接实现了该接口，可用真实历史资金费率回测
+type FundingRateSource interface {
+	// GetFundingRates 获取 [startTime, endTime) 内的资金费率，按时间升序
+	GetFundingRates(ctx context.Context, tradingPair exchange.TradingPair, startTime, endTime time.Time) ([]exchange.FundingRate, error)
+}
+
+// ConstantFundingRateSource 固定资金费率，按固定周期结算（币安默认每 8 小时，UTC 0/8/16 点）
+type ConstantFundingRateSource struct {
+	rate     decimal.Decimal
+	interval time.Duration
+}
+
+// NewConstantFundingRateSource 创建固定资金费率数据源
+func NewConstantFundingRateSource(rate decimal.Decimal, interval time.Duration) *ConstantFundingRateSource {
+	return &ConstantFundingRateSource{rate: rate, interval: interval}
+}
+
+func (s *ConstantFundingRateSource) GetFundingRates(ctx context.Context, tradingPair exchange.TradingPair, startTime, endTime time.Time) ([]exchange.FundingRate, error) {
+	if s.interval <= 0 {
+		return nil, nil
+	}
+
+	var rates []exchange.FundingRate
+	// 结算时间按 UTC 对齐到周期整点
+	for t := startTime.UTC().Truncate(s.interval); t.Before(endTime); t = t.Add(s.interval) {
+		if t.Before(startTime) {
+			continue
+		}
+		rates = append(rates, exchange.FundingRate{
+			TradingPair: tradingPair,
+			Rate:        s.rate,
+			FundingTime: t,
+		})
+	}
+	return rates, nil
+}
+
+// SetFundingRateSource 设置资金费率数据源，不设置则不结算资金费
+func (svc *ExchangeService) SetFundingRateSource(source FundingRateSource) {
+	svc.fundingMu.Lock()
+	defer svc.fundingMu.Unlock()
+	svc.fundingSource = source
+	svc.fundingRates = make(map[string][]exchange.FundingRate)
+	svc.fundingCursors = make(map[string]int)
+}
+
+// settleFunding 结算截止到 until（含）的资金费
+// 在每根K线开盘时调用，使用开盘价作为标记价格，结算的是上一根K线结束时的持仓
+func (svc *ExchangeService) settleFunding(ctx context.Context, tradingPair exchange.TradingPair, until time.Time, markPrice decimal.Decimal) {
+	svc.fundingMu.Lock()
+	defer svc.fundingMu.Unlock()
+
+	if svc.fundingSource == nil {
+		return
+	}
+
+	symbol := tradingPair.ToString()
+	rates, loaded := svc.fundingRates[symbol]
+	if !loaded {
+		var err error
+		rates, err = svc.fundingSource.GetFundingRates(ctx, tradingPair, svc.startTime, svc.endTime)
+		if err != nil {
+			log.Printf("[backtest] load funding rates for %s failed, funding disabled: %v", symbol, err)
+		}
+		sort.SliceStable(rates, func(i, j int) bool {
+			return rates[i].FundingTime.Before(rates[j].FundingTime)
+		})
+		svc.fundingRates[symbol] = rates
+	}
+
+	cursor := svc.fundingCursors[symbol]
+	for cursor < len(rates) && !rates[cursor].FundingTime.After(until) {
+		if funding := svc.applyFunding(tradingPair, rates[cursor].Rate, markPrice); !funding.IsZero() {
+			svc.publishBalanceUpdate(tradingPair.Quote, funding, exchange.BalanceChangeReasonFundingFee)
+		}
+		cursor++
+	}
+	svc.fundingCursors[symbol] = cursor
+}
+
+// applyFunding 对交易对的所有持仓收取/支付一次资金费，返回资金费合计（正数表示收入）
+func (svc *ExchangeService) applyFunding(tradingPair exchange.TradingPair, rate, markPrice decimal.Decimal) decimal.Decimal {
+	svc.positionMu.RLock()
+	defer svc.positionMu.RUnlock()
+
+	total := decimal.Zero
+	for _, side := range []exchange.PositionSide{exchange.PositionSideLong, exchange.PositionSideShort} {
+		posKey := svc.getPositionKey(tradingPair, side)
+		position, exists := svc.positions[posKey]
+		if !exists {
+			continue
+		}
+
+		// 资金费 = 持仓名义价值 × 费率，费率为正时多头支付
+		payment := position.Quantity.Mul(markPrice).Mul(rate)
+		funding := payment.Neg()
+		if side == exchange.PositionSideShort {
+			funding = payment
+		}
+
+		svc.accountMu.Lock()
+		svc.account.TotalBalance = svc.account.TotalBalance.Add(funding)
+		svc.account.AvailableBalance = svc.account.AvailableBalance.Add(funding)
+		svc.accountMu.Unlock()
+
+		svc.historyMu.Lock()
+		if history, ok := svc.activeHistories[posKey]; ok {
+			history.Funding = history.Funding.Add(funding)
+		}
+		svc.historyMu.Unlock()
+		total = total.Add(funding)
+	}
+	return total
+}
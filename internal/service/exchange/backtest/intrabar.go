@@ -0,0 +1,153 @@
+package backtest
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+)
+
+// IntrabarPolicy 同一根K线内多个条件单同时触发时的处理策略
+// 只有 OHLC 无法知道K线内价格先到高点还是先到低点，止损和止盈同时落在一根K线内时需要约定先后
+type IntrabarPolicy string
+
+const (
+	// IntrabarPolicyPessimistic 悲观：止损优先于止盈成交（默认）
+	IntrabarPolicyPessimistic IntrabarPolicy = "pessimistic"
+	// IntrabarPolicyOptimistic 乐观：止盈优先于止损成交
+	IntrabarPolicyOptimistic IntrabarPolicy = "optimistic"
+	// IntrabarPolicySubInterval 用更小周期的K线回放，按实际触发顺序成交
+	// 小周期数据缺失时退化为悲观策略
+	IntrabarPolicySubInterval IntrabarPolicy = "sub_interval"
+)
+
+// SetIntrabarPolicy 设置K线内条件单的成交顺序策略
+func (svc *ExchangeService) SetIntrabarPolicy(policy IntrabarPolicy) {
+	svc.intrabarMu.Lock()
+	defer svc.intrabarMu.Unlock()
+	svc.intrabarPolicy = policy
+}
+
+// SetSubInterval 设置 IntrabarPolicySubInterval 回放使用的K线周期，默认 1m
+func (svc *ExchangeService) SetSubInterval(interval exchange.Interval) {
+	svc.intrabarMu.Lock()
+	defer svc.intrabarMu.Unlock()
+	svc.subInterval = interval
+}
+
+func (svc *ExchangeService) getIntrabarPolicy() (IntrabarPolicy, exchange.Interval) {
+	svc.intrabarMu.RLock()
+	defer svc.intrabarMu.RUnlock()
+	return svc.intrabarPolicy, svc.subInterval
+}
+
+// triggeredOrder K线内触发的订单
+type triggeredOrder struct {
+	order *exchange.OrderInfo
+	// bar 决定成交价的K线：普通订单为当前K线，子周期回放时为条件单实际触发的小周期K线
+	bar exchange.Kline
+	// step 触发所在的子周期序号，未回放时为 0
+	step int
+}
+
+// sequenceTriggered 确定同一根K线内触发订单的成交顺序
+// 普通订单（市价/限价）按下单顺序排在前面，条件单按策略排序
+func (svc *ExchangeService) sequenceTriggered(ctx context.Context, tradingPair exchange.TradingPair, kline exchange.Kline, orders []*exchange.OrderInfo) []triggeredOrder {
+	policy, subInterval := svc.getIntrabarPolicy()
+
+	var subKlines []exchange.Kline
+	if policy == IntrabarPolicySubInterval && hasConditional(orders) {
+		subKlines = svc.loadSubKlines(ctx, tradingPair, kline, subInterval)
+	}
+
+	result := make([]triggeredOrder, 0, len(orders))
+	for _, order := range orders {
+		item := triggeredOrder{order: order, bar: kline}
+		// 跟踪止损的止损价随K线推进，已经在主周期K线上确定了触发价和成交价
+		if order.Conditional.IsConditional() && order.Conditional != exchange.ConditionalTypeTrailingStopMarket && len(subKlines) > 0 {
+			// 找到第一根触发的小周期K线，用它决定顺序和成交价
+			for i, sub := range subKlines {
+				if svc.checkTriggered(order, sub) {
+					item.bar = sub
+					item.step = i
+					break
+				}
+			}
+		}
+		result = append(result, item)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.order.Conditional.IsConditional() != b.order.Conditional.IsConditional() {
+			return !a.order.Conditional.IsConditional()
+		}
+		if a.step != b.step {
+			return a.step < b.step
+		}
+		return conditionalRank(a.order, policy) < conditionalRank(b.order, policy)
+	})
+	return result
+}
+
+// loadSubKlines 加载当前K线时间范围内的小周期K线
+func (svc *ExchangeService) loadSubKlines(ctx context.Context, tradingPair exchange.TradingPair, kline exchange.Kline, subInterval exchange.Interval) []exchange.Kline {
+	subKlines, err := svc.klineProvider.GetKlines(ctx, exchange.GetKlinesReq{
+		TradingPair: tradingPair,
+		Interval:    subInterval,
+		StartTime:   kline.OpenTime,
+		EndTime:     kline.CloseTime,
+	})
+	if err != nil {
+		log.Printf("[backtest] load %s sub klines for %s failed, fallback to pessimistic: %v",
+			subInterval.ToString(), tradingPair.ToString(), err)
+		return nil
+	}
+	return subKlines
+}
+
+// conditionalRank 条件单在同一时刻触发时的优先级，越小越先成交
+func conditionalRank(order *exchange.OrderInfo, policy IntrabarPolicy) int {
+	if !order.Conditional.IsConditional() {
+		return 0
+	}
+	isStop := order.Conditional != exchange.ConditionalTypeTakeProfitMarket
+	if policy == IntrabarPolicyOptimistic {
+		isStop = !isStop
+	}
+	if isStop {
+		return 0
+	}
+	return 1
+}
+
+// triggerFillPrice 条件单触发后的成交价
+// 开盘即越过触发价（跳空）时按开盘价成交，否则按触发价成交
+func triggerFillPrice(order *exchange.OrderInfo, bar exchange.Kline) decimal.Decimal {
+	triggerOnRise := triggersOnRise(order)
+	if triggerOnRise && bar.Open.GreaterThan(order.TriggerPrice) {
+		return bar.Open
+	}
+	if !triggerOnRise && bar.Open.LessThan(order.TriggerPrice) {
+		return bar.Open
+	}
+	return order.TriggerPrice
+}
+
+// triggersOnRise 条件单是否在价格上涨时触发：买入止损 / 卖出止盈
+// 跟踪止损与止损方向相同
+func triggersOnRise(order *exchange.OrderInfo) bool {
+	isStop := order.Conditional != exchange.ConditionalTypeTakeProfitMarket
+	return isStop == order.IsBuy()
+}
+
+func hasConditional(orders []*exchange.OrderInfo) bool {
+	for _, order := range orders {
+		if order.Conditional.IsConditional() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,453 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/KNICEX/trading-agent/pkg/parquetx"
+	"github.com/shopspring/decimal"
+)
+
+// filePos K线文件中一行的位置
+type filePos struct {
+	offset   int64 // CSV：行首的字节偏移
+	rowGroup int   // Parquet：行组下标
+	row      int   // Parquet：行组内的行号
+}
+
+// klineFileReader 逐行读取K线文件
+type klineFileReader interface {
+	// Next 读取下一根K线，读完时返回 io.EOF
+	Next() (exchange.Kline, error)
+	// Pos 下一行的位置
+	Pos() filePos
+	Close() error
+}
+
+// openKlineFile 按扩展名打开K线文件，并定位到 pos
+func openKlineFile(path string, interval exchange.Interval, pos filePos) (klineFileReader, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return newCSVKlineReader(path, interval, pos)
+	case ".parquet":
+		return newParquetKlineReader(path, interval, pos)
+	default:
+		return nil, fmt.Errorf("unsupported kline file: %s", path)
+	}
+}
+
+// klineColumns 各字段所在的列，-1 表示不存在
+type klineColumns struct {
+	openTime, open, high, low, close, volume, closeTime, quoteVolume int
+}
+
+// binanceColumns 币安数据包（无表头或有表头）的列顺序：
+// open_time, open, high, low, close, volume, close_time, quote_volume, count, taker_buy_volume, taker_buy_quote_volume, ignore
+var binanceColumns = klineColumns{
+	openTime: 0, open: 1, high: 2, low: 3, close: 4, volume: 5, closeTime: 6, quoteVolume: 7,
+}
+
+// resolveKlineColumns 按列名匹配字段，列名不区分大小写并忽略空格和下划线
+func resolveKlineColumns(names []string) (klineColumns, error) {
+	columns := klineColumns{-1, -1, -1, -1, -1, -1, -1, -1}
+	for i, name := range names {
+		name = strings.TrimPrefix(name, "\ufeff")
+		name = strings.NewReplacer("_", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+
+		var target *int
+		switch name {
+		case "opentime", "timestamp", "time", "date", "datetime":
+			target = &columns.openTime
+		case "open":
+			target = &columns.open
+		case "high":
+			target = &columns.high
+		case "low":
+			target = &columns.low
+		case "close":
+			target = &columns.close
+		case "volume", "vol":
+			target = &columns.volume
+		case "closetime":
+			target = &columns.closeTime
+		case "quotevolume", "quoteassetvolume":
+			target = &columns.quoteVolume
+		}
+		if target != nil && *target < 0 {
+			*target = i
+		}
+	}
+
+	required := []struct {
+		name string
+		idx  int
+	}{
+		{"open_time", columns.openTime}, {"open", columns.open}, {"high", columns.high}, {"low", columns.low}, {"close", columns.close},
+	}
+	for _, r := range required {
+		if r.idx < 0 {
+			return columns, fmt.Errorf("missing column %s", r.name)
+		}
+	}
+	return columns, nil
+}
+
+// csvKlineReader 流式读取 CSV K线文件
+type csvKlineReader struct {
+	file     *os.File
+	reader   *csv.Reader
+	base     int64 // reader 起始位置在文件中的偏移
+	columns  klineColumns
+	interval exchange.Interval
+
+	pending    []string // 无表头文件的第一行在识别格式时已被读出
+	pendingPos int64
+}
+
+func newCSVKlineReader(path string, interval exchange.Interval, pos filePos) (*csvKlineReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &csvKlineReader{file: file, interval: interval}
+	r.reader = newCSVReader(file)
+
+	// 第一行为数字时是无表头的币安数据包格式，否则按表头匹配列
+	first, err := r.reader.Read()
+	if errors.Is(err, io.EOF) {
+		r.columns = binanceColumns
+		return r, nil
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(first[0]), "\ufeff"), 10, 64); err == nil {
+		r.columns = binanceColumns
+		r.pending = append([]string(nil), first...)
+	} else if r.columns, err = resolveKlineColumns(first); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if pos.offset > 0 {
+		if _, err := file.Seek(pos.offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		r.reader = newCSVReader(file)
+		r.base = pos.offset
+		r.pending = nil
+	}
+	return r, nil
+}
+
+func newCSVReader(file *os.File) *csv.Reader {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	reader.TrimLeadingSpace = true
+	return reader
+}
+
+func (r *csvKlineReader) Pos() filePos {
+	if r.pending != nil {
+		return filePos{offset: r.pendingPos}
+	}
+	return filePos{offset: r.base + r.reader.InputOffset()}
+}
+
+func (r *csvKlineReader) Next() (exchange.Kline, error) {
+	record := r.pending
+	r.pending = nil
+	if record == nil {
+		var err error
+		if record, err = r.reader.Read(); err != nil {
+			return exchange.Kline{}, err
+		}
+	}
+
+	line, _ := r.reader.FieldPos(0)
+	kline, err := r.parse(record)
+	if err != nil {
+		return exchange.Kline{}, fmt.Errorf("line %d: %w", line, err)
+	}
+	return kline, nil
+}
+
+func (r *csvKlineReader) parse(record []string) (exchange.Kline, error) {
+	field := func(idx int) string {
+		if idx < 0 || idx >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[idx])
+	}
+
+	var kline exchange.Kline
+	var err error
+	if kline.OpenTime, err = parseKlineTime(field(r.columns.openTime)); err != nil {
+		return kline, fmt.Errorf("open time: %w", err)
+	}
+	prices := []struct {
+		idx    int
+		target *decimal.Decimal
+	}{
+		{r.columns.open, &kline.Open},
+		{r.columns.high, &kline.High},
+		{r.columns.low, &kline.Low},
+		{r.columns.close, &kline.Close},
+	}
+	for _, p := range prices {
+		if *p.target, err = decimal.NewFromString(field(p.idx)); err != nil {
+			return kline, fmt.Errorf("price: %w", err)
+		}
+	}
+	if kline.Volume, err = optionalDecimal(field(r.columns.volume)); err != nil {
+		return kline, fmt.Errorf("volume: %w", err)
+	}
+	if kline.QuoteAssetVolume, err = optionalDecimal(field(r.columns.quoteVolume)); err != nil {
+		return kline, fmt.Errorf("quote volume: %w", err)
+	}
+
+	kline.CloseTime = defaultCloseTime(kline.OpenTime, r.interval)
+	if s := field(r.columns.closeTime); s != "" {
+		if kline.CloseTime, err = parseKlineTime(s); err != nil {
+			return kline, fmt.Errorf("close time: %w", err)
+		}
+	}
+	return kline, nil
+}
+
+func (r *csvKlineReader) Close() error {
+	return r.file.Close()
+}
+
+// parquetKlineReader 按行组读取 Parquet K线文件，同一时刻只有一个行组在内存中
+type parquetKlineReader struct {
+	file     *os.File
+	pf       *parquetx.File
+	names    []string // 各字段的列名，顺序与 klineColumns 一致
+	interval exchange.Interval
+
+	rowGroup int
+	row      int
+	group    map[string]*parquetx.ColumnData
+}
+
+func newParquetKlineReader(path string, interval exchange.Interval, pos filePos) (*parquetKlineReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	pf, err := parquetx.Open(file, stat.Size())
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	fieldNames := make([]string, 0, len(pf.Fields()))
+	for _, field := range pf.Fields() {
+		fieldNames = append(fieldNames, field.Name)
+	}
+	columns, err := resolveKlineColumns(fieldNames)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	name := func(idx int) string {
+		if idx < 0 {
+			return ""
+		}
+		return fieldNames[idx]
+	}
+	return &parquetKlineReader{
+		file: file,
+		pf:   pf,
+		names: []string{
+			name(columns.openTime), name(columns.open), name(columns.high), name(columns.low),
+			name(columns.close), name(columns.volume), name(columns.closeTime), name(columns.quoteVolume),
+		},
+		interval: interval,
+		rowGroup: pos.rowGroup,
+		row:      pos.row,
+	}, nil
+}
+
+func (r *parquetKlineReader) Pos() filePos {
+	return filePos{rowGroup: r.rowGroup, row: r.row}
+}
+
+func (r *parquetKlineReader) Next() (exchange.Kline, error) {
+	for r.rowGroup < r.pf.NumRowGroups() {
+		if int64(r.row) >= r.pf.RowGroupRows(r.rowGroup) {
+			r.rowGroup++
+			r.row = 0
+			r.group = nil
+			continue
+		}
+
+		if r.group == nil {
+			var wanted []string
+			for _, name := range r.names {
+				if name != "" {
+					wanted = append(wanted, name)
+				}
+			}
+			group, err := r.pf.ReadRowGroup(r.rowGroup, wanted...)
+			if err != nil {
+				return exchange.Kline{}, err
+			}
+			r.group = group
+		}
+
+		kline, err := r.parse(r.row)
+		if err != nil {
+			return exchange.Kline{}, fmt.Errorf("row group %d row %d: %w", r.rowGroup, r.row, err)
+		}
+		r.row++
+		return kline, nil
+	}
+	return exchange.Kline{}, io.EOF
+}
+
+func (r *parquetKlineReader) parse(row int) (exchange.Kline, error) {
+	var kline exchange.Kline
+	var err error
+	if kline.OpenTime, err = r.timeAt(r.names[0], row); err != nil {
+		return kline, fmt.Errorf("open time: %w", err)
+	}
+
+	values := []struct {
+		name   string
+		target *decimal.Decimal
+	}{
+		{r.names[1], &kline.Open},
+		{r.names[2], &kline.High},
+		{r.names[3], &kline.Low},
+		{r.names[4], &kline.Close},
+		{r.names[5], &kline.Volume},
+		{r.names[7], &kline.QuoteAssetVolume},
+	}
+	for _, v := range values {
+		if v.name == "" {
+			continue
+		}
+		if *v.target, err = r.decimalAt(v.name, row); err != nil {
+			return kline, fmt.Errorf("%s: %w", v.name, err)
+		}
+	}
+
+	kline.CloseTime = defaultCloseTime(kline.OpenTime, r.interval)
+	if name := r.names[6]; name != "" && !r.group[name].IsNull(row) {
+		if kline.CloseTime, err = r.timeAt(name, row); err != nil {
+			return kline, fmt.Errorf("close time: %w", err)
+		}
+	}
+	return kline, nil
+}
+
+func (r *parquetKlineReader) decimalAt(name string, row int) (decimal.Decimal, error) {
+	column := r.group[name]
+	if column.IsNull(row) {
+		return decimal.Zero, nil
+	}
+	switch column.Type {
+	case parquetx.TypeFloat, parquetx.TypeDouble:
+		return decimal.NewFromFloat(column.Floats[row]), nil
+	case parquetx.TypeInt32, parquetx.TypeInt64:
+		return decimal.NewFromInt(column.Ints[row]), nil
+	case parquetx.TypeByteArray:
+		return decimal.NewFromString(string(column.Bytes[row]))
+	default:
+		return decimal.Zero, fmt.Errorf("unsupported column type %s", column.Type)
+	}
+}
+
+func (r *parquetKlineReader) timeAt(name string, row int) (time.Time, error) {
+	column := r.group[name]
+	if column.IsNull(row) {
+		return time.Time{}, errors.New("null timestamp")
+	}
+	switch column.Type {
+	case parquetx.TypeInt32, parquetx.TypeInt64:
+		field, _ := r.pf.Field(name)
+		v := column.Ints[row]
+		switch field.Unit {
+		case parquetx.TimeUnitMillis:
+			return time.UnixMilli(v).UTC(), nil
+		case parquetx.TimeUnitMicros:
+			return time.UnixMicro(v).UTC(), nil
+		case parquetx.TimeUnitNanos:
+			return time.Unix(0, v).UTC(), nil
+		default:
+			return unixTimestamp(v), nil
+		}
+	case parquetx.TypeByteArray:
+		return parseKlineTime(string(column.Bytes[row]))
+	default:
+		return time.Time{}, fmt.Errorf("unsupported column type %s", column.Type)
+	}
+}
+
+func (r *parquetKlineReader) Close() error {
+	return r.file.Close()
+}
+
+// parseKlineTime 解析时间：整数按数量级识别秒/毫秒/微秒/纳秒，否则按常见日期格式解析（UTC）
+func parseKlineTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return unixTimestamp(v), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// unixTimestamp 按数量级识别时间戳单位
+// 币安数据包的时间戳以毫秒为主，2025 年起现货数据改为微秒
+func unixTimestamp(v int64) time.Time {
+	abs := v
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs < 1e11:
+		return time.Unix(v, 0).UTC()
+	case abs < 1e14:
+		return time.UnixMilli(v).UTC()
+	case abs < 1e17:
+		return time.UnixMicro(v).UTC()
+	default:
+		return time.Unix(0, v).UTC()
+	}
+}
+
+// defaultCloseTime 缺少收盘时间列时按币安的约定计算：开盘时间 + 周期 - 1ms
+func defaultCloseTime(openTime time.Time, interval exchange.Interval) time.Time {
+	return openTime.Add(interval.Duration() - time.Millisecond)
+}
+
+func optionalDecimal(s string) (decimal.Decimal, error) {
+	if s == "" {
+		return decimal.Zero, nil
+	}
+	return decimal.NewFromString(s)
+}
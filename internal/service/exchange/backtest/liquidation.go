@@ -0,0 +1,293 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+)
+
+// MaintenanceMarginTier 维持保证金档位
+// 维持保证金 = 名义价值 × Rate - Amount（速算数），按名义价值所在档位计算
+type MaintenanceMarginTier struct {
+	NotionalFloor decimal.Decimal // 档位下限（含）
+	Rate          decimal.Decimal // 维持保证金率
+	Amount        decimal.Decimal // 维持保证金速算数
+}
+
+// NewMaintenanceMarginTiers 按档位下限和维持保证金率生成档位，自动计算速算数
+// floors 必须从 0 开始递增，与 rates 一一对应
+func NewMaintenanceMarginTiers(floors, rates []decimal.Decimal) []MaintenanceMarginTier {
+	tiers := make([]MaintenanceMarginTier, 0, len(floors))
+	amount := decimal.Zero
+	for i := range floors {
+		if i > 0 {
+			// 速算数保证维持保证金在档位边界处连续
+			amount = amount.Add(floors[i].Mul(rates[i].Sub(rates[i-1])))
+		}
+		tiers = append(tiers, MaintenanceMarginTier{
+			NotionalFloor: floors[i],
+			Rate:          rates[i],
+			Amount:        amount,
+		})
+	}
+	return tiers
+}
+
+// DefaultMaintenanceMarginTiers 币安 BTCUSDT 永续合约的维持保证金档位
+func DefaultMaintenanceMarginTiers() []MaintenanceMarginTier {
+	floors := []float64{0, 50_000, 500_000, 8_000_000, 50_000_000, 80_000_000, 100_000_000, 200_000_000, 300_000_000}
+	rates := []float64{0.004, 0.005, 0.01, 0.025, 0.05, 0.1, 0.125, 0.15, 0.25}
+
+	floorDecimals := make([]decimal.Decimal, len(floors))
+	rateDecimals := make([]decimal.Decimal, len(rates))
+	for i := range floors {
+		floorDecimals[i] = decimal.NewFromFloat(floors[i])
+		rateDecimals[i] = decimal.NewFromFloat(rates[i])
+	}
+	return NewMaintenanceMarginTiers(floorDecimals, rateDecimals)
+}
+
+// tierFor 获取名义价值所在的档位
+func tierFor(tiers []MaintenanceMarginTier, notional decimal.Decimal) MaintenanceMarginTier {
+	tier := tiers[0]
+	for _, t := range tiers {
+		if notional.GreaterThanOrEqual(t.NotionalFloor) {
+			tier = t
+		}
+	}
+	return tier
+}
+
+// SetMaintenanceMarginTiers 设置交易对的维持保证金档位，未设置时使用 DefaultMaintenanceMarginTiers
+func (svc *ExchangeService) SetMaintenanceMarginTiers(tradingPair exchange.TradingPair, tiers []MaintenanceMarginTier) {
+	svc.marginMu.Lock()
+	defer svc.marginMu.Unlock()
+	svc.marginTiers[tradingPair.ToString()] = tiers
+}
+
+// SetMarginType 设置交易对的保证金模式（回测专用，默认全仓）
+// 与币安一致，有持仓时不允许切换
+func (svc *ExchangeService) SetMarginType(tradingPair exchange.TradingPair, marginType exchange.MarginType) error {
+	if marginType != exchange.MarginTypeCross && marginType != exchange.MarginTypeIsolated {
+		return fmt.Errorf("invalid margin type: %s", marginType)
+	}
+
+	svc.positionMu.RLock()
+	for _, position := range svc.positions {
+		if position.TradingPair == tradingPair {
+			svc.positionMu.RUnlock()
+			return fmt.Errorf("cannot change margin type of %s with open position", tradingPair.ToString())
+		}
+	}
+	svc.positionMu.RUnlock()
+
+	svc.marginMu.Lock()
+	defer svc.marginMu.Unlock()
+	svc.marginTypes[tradingPair.ToString()] = marginType
+	return nil
+}
+
+func (svc *ExchangeService) getMarginType(tradingPair exchange.TradingPair) exchange.MarginType {
+	svc.marginMu.RLock()
+	defer svc.marginMu.RUnlock()
+	if marginType, ok := svc.marginTypes[tradingPair.ToString()]; ok {
+		return marginType
+	}
+	return exchange.MarginTypeCross
+}
+
+func (svc *ExchangeService) getMarginTiers(tradingPair exchange.TradingPair) []MaintenanceMarginTier {
+	svc.marginMu.RLock()
+	defer svc.marginMu.RUnlock()
+	if tiers, ok := svc.marginTiers[tradingPair.ToString()]; ok && len(tiers) > 0 {
+		return tiers
+	}
+	return svc.defaultMarginTiers
+}
+
+// maintenanceMargin 计算持仓按标记价格的维持保证金
+func (svc *ExchangeService) maintenanceMargin(position *exchange.Position) decimal.Decimal {
+	notional := position.Quantity.Mul(position.MarkPrice)
+	tier := tierFor(svc.getMarginTiers(position.TradingPair), notional)
+	return notional.Mul(tier.Rate).Sub(tier.Amount)
+}
+
+// liquidationPrice 计算持仓的强平价格（币安公式）
+//
+//	LP = (WB - TMM + UPNL + cum - side × Q × EP) / (Q × MMR - side × Q)
+//
+// side 多头为 1、空头为 -1。
+// 逐仓：WB 为该仓位的保证金，TMM、UPNL 为 0；
+// 全仓：WB 为钱包余额，TMM、UPNL 为其他持仓的维持保证金和未实现盈亏。
+// 需要持有 positionMu 和 accountMu 读锁
+func (svc *ExchangeService) liquidationPrice(posKey string, position *exchange.Position) decimal.Decimal {
+	if !position.Quantity.IsPositive() {
+		return decimal.Zero
+	}
+
+	walletBalance := position.MarginAmount
+	if position.MarginType != exchange.MarginTypeIsolated {
+		walletBalance = svc.account.TotalBalance
+		for key, other := range svc.positions {
+			if key == posKey || other.MarginType == exchange.MarginTypeIsolated {
+				continue
+			}
+			walletBalance = walletBalance.Sub(svc.maintenanceMargin(other)).Add(other.UnrealizedPnl)
+		}
+	}
+
+	side := decimal.NewFromInt(1)
+	if position.PositionSide == exchange.PositionSideShort {
+		side = decimal.NewFromInt(-1)
+	}
+
+	tier := tierFor(svc.getMarginTiers(position.TradingPair), position.Quantity.Mul(position.MarkPrice))
+	qty := position.Quantity
+	numerator := walletBalance.Add(tier.Amount).Sub(side.Mul(qty).Mul(position.EntryPrice))
+	denominator := qty.Mul(tier.Rate).Sub(side.Mul(qty))
+	if denominator.IsZero() {
+		return decimal.Zero
+	}
+
+	price := numerator.Div(denominator)
+	if !price.IsPositive() {
+		// 保证金足以覆盖价格归零（如 1 倍杠杆多头），不会被强平
+		return decimal.Zero
+	}
+	return price
+}
+
+// marginRatio 保证金率 = 维持保证金 / 保证金余额，达到 1 时强平
+// 逐仓按该仓位的保证金计算，全仓按钱包余额和所有全仓持仓计算
+// 需要持有 positionMu 和 accountMu 读锁
+func (svc *ExchangeService) marginRatio(position *exchange.Position) decimal.Decimal {
+	maintenance := svc.maintenanceMargin(position)
+	equity := position.MarginAmount.Add(position.UnrealizedPnl)
+	if position.MarginType != exchange.MarginTypeIsolated {
+		equity = svc.account.TotalBalance
+		maintenance = decimal.Zero
+		for _, other := range svc.positions {
+			if other.MarginType == exchange.MarginTypeIsolated {
+				continue
+			}
+			maintenance = maintenance.Add(svc.maintenanceMargin(other))
+			equity = equity.Add(other.UnrealizedPnl)
+		}
+	}
+
+	if !equity.IsPositive() {
+		return decimal.NewFromInt(1)
+	}
+	return maintenance.Div(equity)
+}
+
+// checkLiquidations 更新交易对持仓的强平价格，并检查K线是否触及强平价
+// 在挂单扫描之后调用：止损价一般在强平价之前，先触发止损
+func (svc *ExchangeService) checkLiquidations(ctx context.Context, tradingPair exchange.TradingPair, kline exchange.Kline) {
+	type liquidation struct {
+		posKey string
+		side   exchange.PositionSide
+		price  decimal.Decimal
+	}
+
+	var liquidations []liquidation
+	var marginCalls []exchange.Position
+	svc.positionMu.Lock()
+	svc.accountMu.RLock()
+	for _, side := range []exchange.PositionSide{exchange.PositionSideLong, exchange.PositionSideShort} {
+		posKey := svc.getPositionKey(tradingPair, side)
+		position, exists := svc.positions[posKey]
+		if !exists {
+			delete(svc.marginCalls, posKey)
+			continue
+		}
+
+		// 保证金率越过阈值时推送一次追加保证金通知，回落后重新计算
+		if svc.marginRatio(position).GreaterThanOrEqual(marginCallRatio) {
+			if !svc.marginCalls[posKey] {
+				svc.marginCalls[posKey] = true
+				marginCalls = append(marginCalls, *position)
+			}
+		} else {
+			delete(svc.marginCalls, posKey)
+		}
+
+		lp := svc.liquidationPrice(posKey, position)
+		position.LiquidationPrice = lp
+		if lp.IsZero() {
+			continue
+		}
+
+		// 开盘即越过强平价时按开盘价强平
+		if side == exchange.PositionSideLong && kline.Low.LessThanOrEqual(lp) {
+			liquidations = append(liquidations, liquidation{posKey: posKey, side: side, price: decimal.Min(lp, kline.Open)})
+		} else if side == exchange.PositionSideShort && kline.High.GreaterThanOrEqual(lp) {
+			liquidations = append(liquidations, liquidation{posKey: posKey, side: side, price: decimal.Max(lp, kline.Open)})
+		}
+	}
+	svc.accountMu.RUnlock()
+	svc.positionMu.Unlock()
+
+	svc.publishMarginCall(marginCalls)
+	for _, l := range liquidations {
+		svc.liquidate(tradingPair, l.posKey, l.side, l.price)
+		svc.cancelGroupsOnClose(ctx, tradingPair, l.side)
+	}
+}
+
+// liquidate 按强平价强制平仓，剩余的维持保证金作为强平清算费扣除
+func (svc *ExchangeService) liquidate(tradingPair exchange.TradingPair, posKey string, side exchange.PositionSide, price decimal.Decimal) {
+	svc.positionMu.RLock()
+	position, exists := svc.positions[posKey]
+	if !exists {
+		svc.positionMu.RUnlock()
+		return
+	}
+	quantity := position.Quantity
+	snapshot := *position
+	snapshot.MarkPrice = price
+	svc.positionMu.RUnlock()
+
+	notional := quantity.Mul(price)
+	feeRate := decimal.Zero
+	if notional.IsPositive() {
+		feeRate = svc.maintenanceMargin(&snapshot).Div(notional)
+	}
+
+	// 强平单：以系统订单的形式记录
+	orderId := svc.generateOrderId()
+	now := svc.now()
+	order := &exchange.OrderInfo{
+		Id:               orderId.ToString(),
+		TradingPair:      tradingPair,
+		OrderType:        exchange.OrderTypeClose,
+		PositionSide:     side,
+		Quantity:         quantity,
+		ExecutedQuantity: quantity,
+		AvgPrice:         price,
+		Status:           exchange.OrderStatusFilled,
+		ReduceOnly:       true,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		CompletedAt:      now,
+	}
+	svc.orderMu.Lock()
+	svc.orders[orderId] = order
+	svc.orderMu.Unlock()
+
+	exec := execution{
+		price:       price,
+		feeRate:     feeRate,
+		slippage:    decimal.Zero,
+		liquidation: true,
+	}
+	realizedPnl, err := svc.closePosition(posKey, order, quantity, exec)
+	if err != nil {
+		log.Printf("[backtest] liquidate position %s failed: %v", posKey, err)
+		return
+	}
+	svc.publishFill(order, newTrade(order, exec, quantity, realizedPnl, now), exchange.BalanceChangeReasonLiquidation)
+}
@@ -0,0 +1,125 @@
+package backtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupLeveragedLong 以 10 倍杠杆在 100 开 1 BTC 多仓
+func setupLeveragedLong(t *testing.T, balance float64, marginType exchange.MarginType, ohlc [][4]float64) (*ExchangeService, exchange.TradingPair, *klineSteps) {
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	interval := exchange.Interval5m
+	svc, provider := createTestExchange(t, balance, startTime, startTime.Add(time.Duration(len(ohlc))*interval.Duration()))
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	provider.AddKlines(pair, interval, buildOHLCKlines(startTime, interval, ohlc))
+
+	ctx := context.Background()
+	require.NoError(t, svc.SetLeverage(ctx, exchange.SetLeverageReq{TradingPair: pair, Leverage: 10}))
+	require.NoError(t, svc.SetMarginType(pair, marginType))
+
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
+
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Quantity:    decimal.NewFromInt(1),
+	})
+	require.NoError(t, err)
+	steps.next()
+
+	return svc, pair, steps
+}
+
+// TestLiquidation_Isolated 测试逐仓仓位跌破强平价时被强平，损失全部保证金
+func TestLiquidation_Isolated(t *testing.T) {
+	svc, pair, steps := setupLeveragedLong(t, 1000, exchange.MarginTypeIsolated, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 101, 99, 100}, // 开仓
+		{100, 101, 95, 96},
+		{96, 97, 89, 90}, // 跌破强平价
+		{90, 91, 89, 90},
+	})
+	ctx := context.Background()
+
+	steps.next()
+	positions, err := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	// LP = (10 - 100) / (0.004 - 1) ≈ 90.36
+	assert.InDelta(t, 90.3614, positions[0].LiquidationPrice.InexactFloat64(), 1e-3)
+	assert.Equal(t, exchange.MarginTypeIsolated, positions[0].MarginType)
+
+	steps.next()
+	positions, err = svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
+	require.NoError(t, err)
+	assert.Empty(t, positions, "跌破强平价后仓位应该被强平")
+
+	histories, err := svc.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{})
+	require.NoError(t, err)
+	require.Len(t, histories, 1)
+	lastEvent := histories[0].Events[len(histories[0].Events)-1]
+	assert.Equal(t, exchange.PositionEventTypeLiquidation, lastEvent.EventType)
+	// 强平亏损 + 清算费 = 全部保证金
+	assert.InDelta(t, -10, histories[0].NetPnl().InexactFloat64(), 1e-6)
+
+	account, err := svc.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.InDelta(t, 990, account.TotalBalance.InexactFloat64(), 1e-6)
+}
+
+// TestLiquidation_CrossUsesWalletBalance 测试全仓模式用钱包余额承担亏损，强平价更低
+func TestLiquidation_CrossUsesWalletBalance(t *testing.T) {
+	svc, pair, steps := setupLeveragedLong(t, 20, exchange.MarginTypeCross, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 101, 99, 100}, // 开仓
+		{100, 101, 85, 86},  // 逐仓会被强平，全仓不会
+		{86, 87, 79, 80},    // 跌破全仓强平价
+		{80, 81, 79, 80},
+	})
+	ctx := context.Background()
+
+	steps.next()
+	positions, err := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	// LP = (20 - 100) / (0.004 - 1) ≈ 80.32
+	assert.InDelta(t, 80.3213, positions[0].LiquidationPrice.InexactFloat64(), 1e-3)
+
+	steps.next()
+	positions, err = svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
+	require.NoError(t, err)
+	assert.Empty(t, positions)
+}
+
+// TestLiquidation_SetMarginTypeWithPosition 测试有持仓时不允许切换保证金模式
+func TestLiquidation_SetMarginTypeWithPosition(t *testing.T) {
+	svc, pair, _ := setupLeveragedLong(t, 1000, exchange.MarginTypeCross, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 101, 99, 100},
+		{100, 101, 99, 100},
+	})
+	assert.Error(t, svc.SetMarginType(pair, exchange.MarginTypeIsolated))
+}
+
+// TestMaintenanceMarginTiers 测试速算数在档位边界处连续
+func TestMaintenanceMarginTiers(t *testing.T) {
+	tiers := DefaultMaintenanceMarginTiers()
+	assert.True(t, tiers[1].Amount.Equal(decimal.NewFromInt(50)))
+	assert.True(t, tiers[2].Amount.Equal(decimal.NewFromInt(2550)))
+	assert.True(t, tiers[3].Amount.Equal(decimal.NewFromInt(122550)))
+
+	for i := 1; i < len(tiers); i++ {
+		floor := tiers[i].NotionalFloor
+		below := floor.Mul(tiers[i-1].Rate).Sub(tiers[i-1].Amount)
+		above := floor.Mul(tiers[i].Rate).Sub(tiers[i].Amount)
+		assert.True(t, below.Equal(above), "tier %d: %s != %s", i, below, above)
+	}
+}
@@ -0,0 +1,123 @@
+package backtest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+)
+
+// MemoryKlineProvider 在内存中缓存上游K线，供多个回测并发共享（例如参数优化）
+//
+// 每个交易对和周期缓存一段连续的时间范围，请求超出范围时只向上游请求缺失的部分并合并，
+// 之后相同范围的请求直接从内存返回。上游需要能一次返回整个请求范围（CachedKlineProvider、
+// FileKlineProvider、MockKlineProvider），返回的K线切片是共享的，调用方不能修改。
+type MemoryKlineProvider struct {
+	upstream KlineProvider
+
+	mu     sync.Mutex
+	series map[string]*memoryKlineSeries // key: tradingPair_interval
+}
+
+// memoryKlineSeries 已缓存的 [from, to) 范围内的K线，按开盘时间升序
+type memoryKlineSeries struct {
+	from, to time.Time
+	klines   []exchange.Kline
+}
+
+// NewMemoryKlineProvider 创建内存缓存K线提供者
+func NewMemoryKlineProvider(upstream KlineProvider) *MemoryKlineProvider {
+	return &MemoryKlineProvider{
+		upstream: upstream,
+		series:   make(map[string]*memoryKlineSeries),
+	}
+}
+
+// GetKlines 获取 [StartTime, EndTime) 范围内的K线
+func (p *MemoryKlineProvider) GetKlines(ctx context.Context, req exchange.GetKlinesReq) ([]exchange.Kline, error) {
+	if !req.StartTime.Before(req.EndTime) {
+		return []exchange.Kline{}, nil
+	}
+
+	// 同一把锁内向上游补齐，并发的相同请求只会请求一次上游
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := req.TradingPair.ToString() + "_" + req.Interval.ToString()
+	s, ok := p.series[key]
+	if !ok {
+		klines, err := p.upstream.GetKlines(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		s = &memoryKlineSeries{from: req.StartTime, to: req.EndTime}
+		s.merge(klines)
+		p.series[key] = s
+	}
+
+	// 向前、向后扩展缓存范围，保持范围连续
+	if req.StartTime.Before(s.from) {
+		klines, err := p.upstream.GetKlines(ctx, exchange.GetKlinesReq{
+			TradingPair: req.TradingPair,
+			Interval:    req.Interval,
+			StartTime:   req.StartTime,
+			EndTime:     s.from,
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.merge(klines)
+		s.from = req.StartTime
+	}
+	if req.EndTime.After(s.to) {
+		klines, err := p.upstream.GetKlines(ctx, exchange.GetKlinesReq{
+			TradingPair: req.TradingPair,
+			Interval:    req.Interval,
+			StartTime:   s.to,
+			EndTime:     req.EndTime,
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.merge(klines)
+		s.to = req.EndTime
+	}
+
+	return s.slice(req.StartTime, req.EndTime), nil
+}
+
+// merge 合并新K线，按开盘时间去重排序
+func (s *memoryKlineSeries) merge(klines []exchange.Kline) {
+	if len(klines) == 0 {
+		return
+	}
+	merged := make([]exchange.Kline, 0, len(s.klines)+len(klines))
+	merged = append(merged, s.klines...)
+	merged = append(merged, klines...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].OpenTime.Before(merged[j].OpenTime)
+	})
+
+	deduped := merged[:0]
+	for _, kline := range merged {
+		if n := len(deduped); n > 0 && deduped[n-1].OpenTime.Equal(kline.OpenTime) {
+			continue
+		}
+		deduped = append(deduped, kline)
+	}
+	s.klines = deduped
+}
+
+// slice 返回开盘时间在 [start, end) 内的K线
+func (s *memoryKlineSeries) slice(start, end time.Time) []exchange.Kline {
+	i := sort.Search(len(s.klines), func(i int) bool {
+		return !s.klines[i].OpenTime.Before(start)
+	})
+	j := sort.Search(len(s.klines), func(j int) bool {
+		return !s.klines[j].OpenTime.Before(end)
+	})
+	// 限制容量，调用方 append 时不会覆盖缓存
+	return s.klines[i:j:j]
+}
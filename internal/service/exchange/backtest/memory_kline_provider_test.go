@@ -0,0 +1,51 @@
+package backtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMemoryKlineProvider_Extend 测试已缓存的范围直接从内存返回，超出范围时只请求缺失的部分
+func TestMemoryKlineProvider_Extend(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	upstream := &recordingKlineProvider{MockKlineProvider: NewMockKlineProvider()}
+	upstream.GenerateKlines(filePair, exchange.Interval1h, start, 100, 72, "up")
+	provider := NewMemoryKlineProvider(upstream)
+	ctx := context.Background()
+
+	get := func(from, to int) []exchange.Kline {
+		klines, err := provider.GetKlines(ctx, exchange.GetKlinesReq{
+			TradingPair: filePair,
+			Interval:    exchange.Interval1h,
+			StartTime:   start.Add(time.Duration(from) * time.Hour),
+			EndTime:     start.Add(time.Duration(to) * time.Hour),
+		})
+		require.NoError(t, err)
+		return klines
+	}
+
+	assert.Len(t, get(24, 48), 24)
+	assert.Len(t, get(30, 40), 10)
+	assert.Len(t, upstream.requests, 1, "range already cached")
+
+	// 向前和向后扩展，只请求缺失的部分
+	klines := get(12, 60)
+	require.Len(t, klines, 48)
+	require.Len(t, upstream.requests, 3)
+	assert.Equal(t, start.Add(12*time.Hour), upstream.requests[1].StartTime)
+	assert.Equal(t, start.Add(24*time.Hour), upstream.requests[1].EndTime)
+	assert.Equal(t, start.Add(48*time.Hour), upstream.requests[2].StartTime)
+	assert.Equal(t, start.Add(60*time.Hour), upstream.requests[2].EndTime)
+	for i, kline := range klines {
+		assert.Equal(t, start.Add(time.Duration(12+i)*time.Hour), kline.OpenTime)
+	}
+
+	// 在返回的切片后追加不会覆盖缓存中的下一根K线
+	_ = append(get(12, 13), exchange.Kline{})
+	assert.Equal(t, start.Add(13*time.Hour), get(13, 14)[0].OpenTime)
+}
@@ -104,24 +104,3 @@ func (p *MockKlineProvider) GetKlines(ctx context.Context, req exchange.GetKline
 
 	return result, nil
 }
-
-// FileKlineProvider 从文件加载K线数据的提供者
-// TODO: 实现从CSV/JSON文件加载K线数据
-type FileKlineProvider struct {
-	// 可以添加文件路径等配置
-}
-
-// NewFileKlineProvider 创建文件K线提供者
-func NewFileKlineProvider() *FileKlineProvider {
-	return &FileKlineProvider{}
-}
-
-// GetKlines 从文件获取K线数据
-func (p *FileKlineProvider) GetKlines(ctx context.Context, req exchange.GetKlinesReq) ([]exchange.Kline, error) {
-	// TODO: 实现从文件读取K线数据
-	// 1. 根据tradingPair和interval确定文件路径
-	// 2. 读取CSV/JSON文件
-	// 3. 解析并过滤时间范围
-	// 4. 返回K线数据
-	return []exchange.Kline{}, nil
-}
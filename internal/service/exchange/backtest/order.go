@@ -3,20 +3,35 @@ package backtest
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"github.com/KNICEX/trading-agent/internal/service/exchange"
 	"github.com/shopspring/decimal"
 )
 
 // CreateOrder 创建订单（回测模式：创建挂单，等待K线触发成交）
+// 参数不合法、余额或持仓不足时返回 *exchange.OrderRejectedError
 func (svc *ExchangeService) CreateOrder(ctx context.Context, req exchange.CreateOrderReq) (exchange.OrderId, error) {
+	if err := svc.validateConditional(req); err != nil {
+		return "", &exchange.OrderRejectedError{Reason: err.Error()}
+	}
+	if err := svc.checkTimeInForce(req); err != nil {
+		return "", err
+	}
+	if err := svc.checkSymbolRules(ctx, req); err != nil {
+		return "", err
+	}
+
 	orderId := svc.generateOrderId()
-	now := svc.now(req.TradingPair)
+	now := svc.now()
 
 	if req.OrderType == exchange.OrderTypeOpen {
 		// 🔑 开仓订单：冻结资金（应用杠杆）
-		// 获取订单价格（限价单用限价，市价单用当前价）
+		// 获取订单价格（限价单用限价，条件单用触发价，市价单用当前价）
 		price := req.Price
+		if req.Conditional.IsConditional() {
+			price = req.TriggerPrice
+		}
 		if price.IsZero() {
 			// 市价单，使用当前市价估算
 			currentPrice, err := svc.Ticker(ctx, req.TradingPair)
@@ -38,7 +53,7 @@ func (svc *ExchangeService) CreateOrder(ctx context.Context, req exchange.Create
 		svc.accountMu.RUnlock()
 
 		if availableBalance.LessThan(frozenAmount) {
-			return "", fmt.Errorf("insufficient balance: available=%s, required=%s (leverage: %dx)",
+			return "", rejectf("insufficient balance: available=%s, required=%s (leverage: %dx)",
 				availableBalance, frozenAmount, leverage)
 		}
 
@@ -47,23 +62,24 @@ func (svc *ExchangeService) CreateOrder(ctx context.Context, req exchange.Create
 		svc.account.AvailableBalance = svc.account.AvailableBalance.Sub(frozenAmount)
 		svc.frozenFunds[orderId] = frozenAmount
 		svc.accountMu.Unlock()
-	} else {
-		// 🔑 平仓订单：检查持仓数量是否足够
-		// posKey := svc.getPositionKey(req.TradingPair, req.PositonSide)
+	} else if !req.Conditional.IsConditional() {
+		// 🔑 普通平仓订单：检查持仓数量是否足够（双向持仓模式下平仓单本身就是只减仓）
+		// 条件平仓单（止盈止损）可以在开仓成交前挂出，触发时再按持仓数量成交
+		posKey := svc.getPositionKey(req.TradingPair, req.PositonSide)
 
-		// svc.positionMu.RLock()
-		// position, exists := svc.positions[posKey]
-		// svc.positionMu.RUnlock()
+		svc.positionMu.RLock()
+		position, exists := svc.positions[posKey]
+		svc.positionMu.RUnlock()
 
-		// if !exists {
-		// 	return "", fmt.Errorf("position not found: %s", posKey)
-		// }
+		if !exists {
+			return "", rejectf("position not found: %s", posKey)
+		}
 
-		// // 检查持仓数量是否足够
-		// if position.Quantity.LessThan(req.Quantity) {
-		// 	return "", fmt.Errorf("insufficient position quantity: have=%s, required=%s",
-		// 		position.Quantity, req.Quantity)
-		// }
+		// 检查持仓数量是否足够
+		if position.Quantity.LessThan(req.Quantity) {
+			return "", rejectf("insufficient position quantity: have=%s, required=%s",
+				position.Quantity, req.Quantity)
+		}
 	}
 
 	// 创建订单记录（扩展版本）
@@ -76,20 +92,91 @@ func (svc *ExchangeService) CreateOrder(ctx context.Context, req exchange.Create
 		Quantity:         req.Quantity,
 		ExecutedQuantity: decimal.Zero,                // 初始未成交
 		Status:           exchange.OrderStatusPending, // 挂单状态
+		Conditional:      req.Conditional,
+		TriggerPrice:     req.TriggerPrice,
+		ReduceOnly:       req.ReduceOnly,
+		ClosePosition:    req.ClosePosition,
+		CallbackRate:     req.CallbackRate,
+		CallbackDistance: req.CallbackDistance,
+		ActivationPrice:  req.ActivationPrice,
+		GroupId:          req.GroupId,
+		TimeInForce:      req.TimeInForce,
+		GoodTillDate:     req.GoodTillDate,
 		CreatedAt:        now,
 		UpdatedAt:        now,
 	}
 
+	// 下单时就确定是挂单还是吃单，成交时按对应费率收取手续费
+	maker := svc.isMakerOrder(req)
+
 	// 保存订单
 	svc.orderMu.Lock()
 	svc.orders[orderId] = order
 	// 添加到待成交订单列表
 	svc.pendingOrders[orderId] = order
+	if maker {
+		svc.makerOrders[orderId] = true
+	}
 	svc.orderMu.Unlock()
 
+	if req.Conditional == exchange.ConditionalTypeTrailingStopMarket {
+		currentPrice, _ := svc.Ticker(ctx, req.TradingPair)
+		svc.initTrailingStop(order, currentPrice)
+	}
+	svc.publishOrderUpdate(order)
+
 	return orderId, nil
 }
 
+// rejectf 交易所拒绝下单
+func rejectf(format string, args ...any) error {
+	return &exchange.OrderRejectedError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// validateConditional 校验条件单参数
+func (svc *ExchangeService) validateConditional(req exchange.CreateOrderReq) error {
+	if req.Conditional.IsConditional() {
+		switch req.Conditional {
+		case exchange.ConditionalTypeStopMarket, exchange.ConditionalTypeTakeProfitMarket:
+			if !req.TriggerPrice.IsPositive() {
+				return fmt.Errorf("trigger price is required for %s order", req.Conditional)
+			}
+		case exchange.ConditionalTypeTrailingStopMarket:
+			if err := validateTrailing(req); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported conditional type: %s", req.Conditional)
+		}
+	}
+
+	if req.ClosePosition && (!req.Conditional.IsConditional() || req.OrderType != exchange.OrderTypeClose) {
+		return fmt.Errorf("close position is only supported by conditional close orders")
+	}
+	if req.ReduceOnly && req.OrderType != exchange.OrderTypeClose {
+		return fmt.Errorf("reduce only is only supported by close orders")
+	}
+	return nil
+}
+
+// validateTrailing 校验跟踪止损参数：回调比例和回调距离二选一
+func validateTrailing(req exchange.CreateOrderReq) error {
+	hasRate, hasDistance := !req.CallbackRate.IsZero(), !req.CallbackDistance.IsZero()
+	if hasRate == hasDistance {
+		return fmt.Errorf("exactly one of callback rate and callback distance is required for %s order", req.Conditional)
+	}
+	if hasRate && (!req.CallbackRate.IsPositive() || req.CallbackRate.GreaterThanOrEqual(decimal.NewFromInt(100))) {
+		return fmt.Errorf("callback rate must be in (0, 100): %s", req.CallbackRate)
+	}
+	if hasDistance && !req.CallbackDistance.IsPositive() {
+		return fmt.Errorf("callback distance must be positive: %s", req.CallbackDistance)
+	}
+	if req.ActivationPrice.IsNegative() {
+		return fmt.Errorf("activation price must not be negative: %s", req.ActivationPrice)
+	}
+	return nil
+}
+
 // CreateOrders 批量创建订单
 func (svc *ExchangeService) CreateOrders(ctx context.Context, reqs []exchange.CreateOrderReq) ([]exchange.OrderId, error) {
 	ids := make([]exchange.OrderId, len(reqs))
@@ -103,14 +190,119 @@ func (svc *ExchangeService) CreateOrders(ctx context.Context, reqs []exchange.Cr
 	return ids, nil
 }
 
-// ModifyOrder 修改订单（回测模式：不支持）
+// ModifyOrder 修改挂单的价格和数量
+// 与币安一致，只能修改未完全成交的限价单；条件单需要撤单后重新创建
+// Price / Quantity 为空时保持原值，新数量必须大于已成交数量
+// 开仓订单按新的价格和剩余数量重新计算冻结资金
 func (svc *ExchangeService) ModifyOrder(ctx context.Context, req exchange.ModifyOrderReq) error {
-	return fmt.Errorf("modify order not supported in backtest mode")
+	order, err := svc.modifyOrder(req)
+	if err != nil {
+		return err
+	}
+	svc.publishOrderUpdate(order)
+	return nil
 }
 
-// ModifyOrders 批量修改订单（回测模式：不支持）
-func (svc *ExchangeService) ModifyOrders(ctx context.Context, req []exchange.ModifyOrderReq) error {
-	return fmt.Errorf("modify orders not supported in backtest mode")
+// modifyOrder 修改挂单，返回修改后的订单
+func (svc *ExchangeService) modifyOrder(req exchange.ModifyOrderReq) (*exchange.OrderInfo, error) {
+	svc.orderMu.Lock()
+	defer svc.orderMu.Unlock()
+
+	order, exists := svc.pendingOrders[req.Id]
+	if !exists {
+		return nil, fmt.Errorf("order not found or already filled: %s", req.Id)
+	}
+	if !req.TradingPair.IsZero() && order.TradingPair != req.TradingPair {
+		return nil, fmt.Errorf("order %s does not belong to trading pair %s", req.Id, req.TradingPair.ToString())
+	}
+	if order.Conditional.IsConditional() || order.Price.IsZero() {
+		return nil, fmt.Errorf("only limit orders can be modified: %s", req.Id)
+	}
+
+	price, quantity := order.Price, order.Quantity
+	if !req.Price.IsZero() {
+		price = req.Price
+	}
+	if !req.Quantity.IsZero() {
+		quantity = req.Quantity
+	}
+	if !price.IsPositive() {
+		return nil, fmt.Errorf("invalid price: %s", price)
+	}
+	if quantity.LessThanOrEqual(order.ExecutedQuantity) {
+		return nil, fmt.Errorf("quantity %s must be greater than executed quantity %s", quantity, order.ExecutedQuantity)
+	}
+	remaining := quantity.Sub(order.ExecutedQuantity)
+
+	if rules, ok := svc.symbolRules(order.TradingPair); ok {
+		if err := rules.Validate(exchange.CreateOrderReq{
+			TradingPair: order.TradingPair,
+			OrderType:   order.OrderType,
+			PositonSide: order.PositionSide,
+			Price:       price,
+			Quantity:    quantity,
+			ReduceOnly:  order.ReduceOnly,
+		}, price); err != nil {
+			return nil, err
+		}
+	}
+
+	// 改价后可能变成可以立即成交的价格，重新判定挂单/吃单，只做挂单的订单此时拒绝修改
+	maker := svc.isMakerOrder(exchange.CreateOrderReq{
+		TradingPair: order.TradingPair,
+		OrderType:   order.OrderType,
+		PositonSide: order.PositionSide,
+		Price:       price,
+	})
+	if order.TimeInForce == exchange.TimeInForceGTX && !maker {
+		return nil, fmt.Errorf("post only order would immediately match: price=%s", price)
+	}
+
+	if order.OrderType == exchange.OrderTypeOpen {
+		// 🔑 开仓订单：按新的价格和剩余数量重新冻结资金
+		leverage := svc.getLeverage(order.TradingPair)
+		required := price.Mul(remaining).Div(decimal.NewFromInt(int64(leverage)))
+
+		svc.accountMu.Lock()
+		diff := required.Sub(svc.frozenFunds[req.Id])
+		if diff.GreaterThan(svc.account.AvailableBalance) {
+			available := svc.account.AvailableBalance
+			svc.accountMu.Unlock()
+			return nil, fmt.Errorf("insufficient balance: available=%s, required=%s (leverage: %dx)", available, diff, leverage)
+		}
+		svc.account.AvailableBalance = svc.account.AvailableBalance.Sub(diff)
+		svc.frozenFunds[req.Id] = required
+		svc.accountMu.Unlock()
+	} else {
+		// 平仓订单：剩余数量不能超过持仓
+		svc.positionMu.RLock()
+		position, exists := svc.positions[svc.getPositionKey(order.TradingPair, order.PositionSide)]
+		svc.positionMu.RUnlock()
+		if !exists || position.Quantity.LessThan(remaining) {
+			return nil, fmt.Errorf("insufficient position quantity for order %s: required=%s", req.Id, remaining)
+		}
+	}
+
+	order.Price = price
+	order.Quantity = quantity
+	order.UpdatedAt = svc.now()
+
+	if maker {
+		svc.makerOrders[req.Id] = true
+	} else {
+		delete(svc.makerOrders, req.Id)
+	}
+	return order, nil
+}
+
+// ModifyOrders 批量修改订单，逐个修改，遇到错误时返回（之前的修改已经生效）
+func (svc *ExchangeService) ModifyOrders(ctx context.Context, reqs []exchange.ModifyOrderReq) error {
+	for _, req := range reqs {
+		if err := svc.ModifyOrder(ctx, req); err != nil {
+			return fmt.Errorf("modify order %s failed: %w", req.Id, err)
+		}
+	}
+	return nil
 }
 
 // GetOrder 获取订单信息
@@ -126,18 +318,31 @@ func (svc *ExchangeService) GetOrder(ctx context.Context, req exchange.GetOrderR
 	return *order, nil
 }
 
-// GetOrders 获取待成交订单列表
+// GetOrders 获取订单列表，按下单顺序返回
+// 默认只返回待成交订单，设置了历史查询条件时从全部订单中过滤
 func (svc *ExchangeService) GetOrders(ctx context.Context, req exchange.GetOrdersReq) ([]exchange.OrderInfo, error) {
 	svc.orderMu.RLock()
 	defer svc.orderMu.RUnlock()
 
+	source := svc.pendingOrders
+	if req.IsHistoryQuery() {
+		source = svc.orders
+	}
+
 	var orders []exchange.OrderInfo
-	for _, order := range svc.pendingOrders {
-		if req.TradingPair.IsZero() || order.TradingPair == req.TradingPair {
+	for _, order := range source {
+		if req.Match(*order) {
 			orders = append(orders, *order)
 		}
 	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orderSeq(orders[i].Id) < orderSeq(orders[j].Id)
+	})
 
+	// 只保留最近的 Limit 条
+	if req.Limit > 0 && len(orders) > req.Limit {
+		orders = orders[len(orders)-req.Limit:]
+	}
 	return orders, nil
 }
 
@@ -166,10 +371,14 @@ func (svc *ExchangeService) CancelOrder(ctx context.Context, req exchange.Cancel
 
 	// 从待成交列表移除
 	delete(svc.pendingOrders, req.Id)
+	delete(svc.makerOrders, req.Id)
+	delete(svc.trailingStops, req.Id)
 
 	// 更新订单状态为已取消
-	order.Status = exchange.OrderStatus("cancelled")
-	order.UpdatedAt = svc.now(order.TradingPair)
+	now := svc.now()
+	order.Status = exchange.OrderStatusCancelled
+	order.UpdatedAt = now
+	order.CompletedAt = now
 
 	// 🔑 释放冻结的资金（仅开仓订单）
 	if order.OrderType == exchange.OrderTypeOpen {
@@ -191,6 +400,11 @@ func (svc *ExchangeService) CancelOrder(ctx context.Context, req exchange.Cancel
 		svc.orderMu.Unlock()
 	}
 
+	svc.publishOrderUpdate(order)
+
+	// 订单组（OCO）：撤销一个订单时同组的其余订单一起撤销
+	svc.cancelOrderGroup(ctx, order.GroupId)
+
 	return nil
 }
 
@@ -251,9 +465,11 @@ func (svc *ExchangeService) CancelOrders(ctx context.Context, req exchange.Cance
 	return nil
 }
 
-// openPosition 开仓或加仓
+// openPosition 开仓或加仓，quantity 为本次要成交的数量
 // 返回实际成交的数量（可能因资金不足而部分成交）
-func (svc *ExchangeService) openPosition(posKey string, order *exchange.OrderInfo, price decimal.Decimal) (decimal.Decimal, error) {
+// 手续费按 exec.feeRate 从钱包余额中扣除
+func (svc *ExchangeService) openPosition(posKey string, order *exchange.OrderInfo, quantity decimal.Decimal, exec execution) (decimal.Decimal, error) {
+	price := exec.price
 	svc.positionMu.Lock()
 	defer svc.positionMu.Unlock()
 
@@ -261,7 +477,7 @@ func (svc *ExchangeService) openPosition(posKey string, order *exchange.OrderInf
 	leverage := svc.getLeverage(order.TradingPair)
 
 	// 计算实际所需保证金（价格 × 数量 ÷ 杠杆）
-	actualCost := price.Mul(order.Quantity).Div(decimal.NewFromInt(int64(leverage)))
+	actualCost := price.Mul(quantity).Div(decimal.NewFromInt(int64(leverage)))
 
 	// 🔑 从冻结资金转为已用保证金
 	orderId := exchange.OrderId(order.Id)
@@ -275,14 +491,21 @@ func (svc *ExchangeService) openPosition(posKey string, order *exchange.OrderInf
 	}
 
 	// ✅ 挂单已冻结资金，现在转为保证金
-	delete(svc.frozenFunds, orderId)
+	// 挂单只成交一部分时按比例使用冻结资金，剩余的继续冻结
+	if remaining := order.Quantity.Sub(order.ExecutedQuantity); quantity.LessThan(remaining) {
+		portion := frozenAmount.Mul(quantity).Div(remaining)
+		svc.frozenFunds[orderId] = frozenAmount.Sub(portion)
+		frozenAmount = portion
+	} else {
+		delete(svc.frozenFunds, orderId)
+	}
 
 	// 计算冻结金额与实际成交金额的差额
 	// 对于市价单，冻结时使用估算价格，成交时使用实际价格
 	diff := frozenAmount.Sub(actualCost)
 
-	// 实际成交的数量（默认为订单数量）
-	executedQuantity := order.Quantity
+	// 实际成交的数量（默认为本次数量）
+	executedQuantity := quantity
 	actualMargin := actualCost
 
 	if diff.IsPositive() {
@@ -301,7 +524,7 @@ func (svc *ExchangeService) openPosition(posKey string, order *exchange.OrderInf
 			// 能够开仓的最大数量 = 可用总资金 × 杠杆 ÷ 成交价格
 			maxQuantity := totalAvailable.Mul(decimal.NewFromInt(int64(leverage))).Div(price)
 
-			if maxQuantity.LessThan(order.Quantity) {
+			if maxQuantity.LessThan(quantity) {
 				// 部分成交：使用全部可用资金
 				executedQuantity = maxQuantity
 				actualMargin = totalAvailable
@@ -321,10 +544,16 @@ func (svc *ExchangeService) openPosition(posKey string, order *exchange.OrderInf
 		// 正好相等
 		svc.account.UsedMargin = svc.account.UsedMargin.Add(actualCost)
 	}
+
+	// 💰 扣除开仓手续费
+	fee := price.Mul(executedQuantity).Mul(exec.feeRate)
+	slippage := exec.slippage.Mul(executedQuantity)
+	svc.account.TotalBalance = svc.account.TotalBalance.Sub(fee)
+	svc.account.AvailableBalance = svc.account.AvailableBalance.Sub(fee)
 	svc.accountMu.Unlock()
 
 	position, exists := svc.positions[posKey]
-	now := svc.now(order.TradingPair)
+	now := svc.now()
 
 	// 📝 持仓历史记录
 	svc.historyMu.Lock()
@@ -337,7 +566,7 @@ func (svc *ExchangeService) openPosition(posKey string, order *exchange.OrderInf
 			PositionSide:     order.PositionSide,
 			EntryPrice:       price,
 			BreakEvenPrice:   price,
-			MarginType:       exchange.MarginTypeCross,
+			MarginType:       svc.getMarginType(order.TradingPair),
 			Leverage:         leverage, // 使用实际杠杆
 			LiquidationPrice: decimal.Zero,
 			MarkPrice:        price,
@@ -371,11 +600,13 @@ func (svc *ExchangeService) openPosition(posKey string, order *exchange.OrderInf
 			AfterQuantity:  executedQuantity,
 			Price:          price,
 			RealizedPnl:    decimal.Zero,
-			Fee:            decimal.Zero,
+			Fee:            fee,
+			Slippage:       slippage,
 			CreatedAt:      order.CreatedAt,
 			UpdatedAt:      order.UpdatedAt,
 			CompletedAt:    now,
 		})
+		history.Fee = history.Fee.Add(fee)
 	} else {
 		// 加仓：计算新的平均入场价
 		oldQuantity := position.Quantity
@@ -402,11 +633,13 @@ func (svc *ExchangeService) openPosition(posKey string, order *exchange.OrderInf
 				AfterQuantity:  totalQuantity,
 				Price:          price,
 				RealizedPnl:    decimal.Zero,
-				Fee:            decimal.Zero,
+				Fee:            fee,
+				Slippage:       slippage,
 				CreatedAt:      order.CreatedAt,
 				UpdatedAt:      order.UpdatedAt,
 				CompletedAt:    now,
 			})
+			history.Fee = history.Fee.Add(fee)
 		}
 	}
 	svc.historyMu.Unlock()
@@ -415,51 +648,60 @@ func (svc *ExchangeService) openPosition(posKey string, order *exchange.OrderInf
 	return executedQuantity, nil
 }
 
-// closePosition 平仓或减仓
-func (svc *ExchangeService) closePosition(posKey string, order *exchange.OrderInfo, price decimal.Decimal) error {
+// closePosition 平仓或减仓，返回已实现盈亏（不含手续费）
+// quantity 为本次成交数量（只减仓/全部平仓的条件单触发时会按持仓数量调整）
+// 手续费按 exec.feeRate 从钱包余额中扣除
+func (svc *ExchangeService) closePosition(posKey string, order *exchange.OrderInfo, quantity decimal.Decimal, exec execution) (decimal.Decimal, error) {
+	price := exec.price
 	svc.positionMu.Lock()
 	defer svc.positionMu.Unlock()
 
 	position, exists := svc.positions[posKey]
 	if !exists {
-		return fmt.Errorf("position not found: %s", posKey)
+		return decimal.Zero, fmt.Errorf("position not found: %s", posKey)
 	}
 
-	if position.Quantity.LessThan(order.Quantity) {
-		return fmt.Errorf("insufficient position quantity: have=%s, want=%s",
-			position.Quantity, order.Quantity)
+	if position.Quantity.LessThan(quantity) {
+		return decimal.Zero, fmt.Errorf("insufficient position quantity: have=%s, want=%s",
+			position.Quantity, quantity)
 	}
 
 	// 计算盈亏
 	var pnl decimal.Decimal
 	if order.PositionSide == exchange.PositionSideLong {
 		// 多头：(卖出价 - 买入价) * 数量
-		pnl = price.Sub(position.EntryPrice).Mul(order.Quantity)
+		pnl = price.Sub(position.EntryPrice).Mul(quantity)
 	} else {
 		// 空头：(买入价 - 卖出价) * 数量
-		pnl = position.EntryPrice.Sub(price).Mul(order.Quantity)
+		pnl = position.EntryPrice.Sub(price).Mul(quantity)
 	}
 
 	// 释放保证金
-	releasedMargin := position.MarginAmount.Mul(order.Quantity).Div(position.Quantity)
+	releasedMargin := position.MarginAmount.Mul(quantity).Div(position.Quantity)
 
-	// ✅ 更新账户：保证金 + 盈亏 → 可用余额
+	// 平仓手续费
+	fee := price.Mul(quantity).Mul(exec.feeRate)
+	slippage := exec.slippage.Mul(quantity)
+
+	// ✅ 更新账户：保证金 + 盈亏 - 手续费 → 可用余额
 	svc.accountMu.Lock()
-	svc.account.AvailableBalance = svc.account.AvailableBalance.Add(releasedMargin).Add(pnl)
+	svc.account.AvailableBalance = svc.account.AvailableBalance.Add(releasedMargin).Add(pnl).Sub(fee)
 	svc.account.UsedMargin = svc.account.UsedMargin.Sub(releasedMargin)
-	svc.account.TotalBalance = svc.account.TotalBalance.Add(pnl)
+	svc.account.TotalBalance = svc.account.TotalBalance.Add(pnl).Sub(fee)
 	svc.accountMu.Unlock()
 
 	// 更新或关闭仓位
 	oldQuantity := position.Quantity
-	if order.Quantity.GreaterThan(position.Quantity) {
-		order.Quantity = position.Quantity
-	}
-	position.Quantity = position.Quantity.Sub(order.Quantity)
+	position.Quantity = position.Quantity.Sub(quantity)
 	position.MarginAmount = position.MarginAmount.Sub(releasedMargin)
-	now := svc.now(order.TradingPair)
+	now := svc.now()
 	position.UpdatedAt = now
 
+	closeEventType := exchange.PositionEventTypeClose
+	if exec.liquidation {
+		closeEventType = exchange.PositionEventTypeLiquidation
+	}
+
 	// 📝 持仓历史记录
 	svc.historyMu.Lock()
 	history, historyExists := svc.activeHistories[posKey]
@@ -476,18 +718,20 @@ func (svc *ExchangeService) closePosition(posKey string, order *exchange.OrderIn
 			// 记录平仓事件
 			history.Events = append(history.Events, exchange.PositionEvent{
 				OrderId:        exchange.OrderId(order.Id),
-				EventType:      exchange.PositionEventTypeClose,
-				Quantity:       order.Quantity,
+				EventType:      closeEventType,
+				Quantity:       quantity,
 				BeforeQuantity: oldQuantity,
 				AfterQuantity:  decimal.Zero,
 				Price:          price,
 				RealizedPnl:    pnl,
-				Fee:            decimal.Zero,
+				Fee:            fee,
+				Slippage:       slippage,
 				CreatedAt:      order.CreatedAt,
 				UpdatedAt:      order.UpdatedAt,
 				CompletedAt:    now,
 			})
 
+			history.Fee = history.Fee.Add(fee)
 			for _, event := range history.Events {
 				history.RealizedPnl = history.RealizedPnl.Add(event.RealizedPnl)
 			}
@@ -502,19 +746,21 @@ func (svc *ExchangeService) closePosition(posKey string, order *exchange.OrderIn
 			history.Events = append(history.Events, exchange.PositionEvent{
 				OrderId:        exchange.OrderId(order.Id),
 				EventType:      exchange.PositionEventTypeDecrease,
-				Quantity:       order.Quantity,
+				Quantity:       quantity,
 				BeforeQuantity: oldQuantity,
 				AfterQuantity:  position.Quantity,
 				Price:          price,
 				RealizedPnl:    pnl,
-				Fee:            decimal.Zero,
+				Fee:            fee,
+				Slippage:       slippage,
 				CreatedAt:      order.CreatedAt,
 				UpdatedAt:      order.UpdatedAt,
 				CompletedAt:    now,
 			})
+			history.Fee = history.Fee.Add(fee)
 		}
 	}
 	svc.historyMu.Unlock()
 
-	return nil
+	return pnl, nil
 }
@@ -0,0 +1,60 @@
+package backtest
+
+import (
+	"context"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+)
+
+// cancelOrderGroup 撤销订单组内其余未成交的订单
+func (svc *ExchangeService) cancelOrderGroup(ctx context.Context, groupId string) {
+	if groupId == "" {
+		return
+	}
+
+	svc.orderMu.RLock()
+	var ids []exchange.OrderId
+	for id, order := range svc.pendingOrders {
+		if order.GroupId == groupId {
+			ids = append(ids, id)
+		}
+	}
+	svc.orderMu.RUnlock()
+
+	for _, id := range ids {
+		// 撤单会级联撤销同组订单，已经被撤掉的订单忽略错误
+		_ = svc.CancelOrder(ctx, exchange.CancelOrderReq{Id: id})
+	}
+}
+
+// cancelGroupsOnClose 仓位被平掉后（平仓单、强平等）撤销该方向所有订单组内的订单
+func (svc *ExchangeService) cancelGroupsOnClose(ctx context.Context, tradingPair exchange.TradingPair, side exchange.PositionSide) {
+	svc.positionMu.RLock()
+	_, exists := svc.positions[svc.getPositionKey(tradingPair, side)]
+	svc.positionMu.RUnlock()
+	if exists {
+		return
+	}
+
+	svc.orderMu.RLock()
+	groups := make(map[string]bool)
+	for _, order := range svc.pendingOrders {
+		if order.GroupId != "" && order.TradingPair == tradingPair && order.PositionSide == side {
+			groups[order.GroupId] = true
+		}
+	}
+	svc.orderMu.RUnlock()
+
+	for groupId := range groups {
+		svc.cancelOrderGroup(ctx, groupId)
+	}
+}
+
+// isPending 订单是否还在待成交列表里
+// 同一根K线内先成交的订单可能撤掉了同组的其他已触发订单
+func (svc *ExchangeService) isPending(order *exchange.OrderInfo) bool {
+	svc.orderMu.RLock()
+	defer svc.orderMu.RUnlock()
+	_, ok := svc.pendingOrders[exchange.OrderId(order.Id)]
+	return ok
+}
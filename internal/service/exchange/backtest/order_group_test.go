@@ -0,0 +1,104 @@
+package backtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOrderGroup_SiblingCancelledOnFill 测试止盈成交后同组止损被撤销，不会再触发
+func TestOrderGroup_SiblingCancelledOnFill(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓成交
+		{100, 111, 99, 108}, // 止盈 110 成交
+		{108, 109, 90, 92},  // 止损价 95 被击穿，但止损单已撤销
+		{92, 93, 91, 92},
+	})
+	ctx := context.Background()
+
+	// 止盈数量小于持仓，止盈成交后仍有持仓，止损只会因为订单组被撤销
+	tradingSvc := exchange.NewTradingService(svc, &PercisionProvider{})
+	resp, err := tradingSvc.SetStopOrders(ctx, exchange.SetStopOrdersReq{
+		TradingPair:  pair,
+		PositionSide: exchange.PositionSideLong,
+		TakeProfit:   exchange.StopOrder{Price: decimal.NewFromInt(110)},
+		StopLoss:     exchange.StopOrder{Price: decimal.NewFromInt(95)},
+		Quantity:     decimal.NewFromFloat(0.5),
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.GroupId)
+
+	steps.next()
+	assertOrderStatus(t, svc, resp.TakeProfitId, exchange.OrderStatusFilled)
+	assertOrderStatus(t, svc, resp.StopLossId, exchange.OrderStatusCancelled)
+	stopLoss, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: resp.StopLossId})
+	require.NoError(t, err)
+	assert.False(t, stopLoss.CompletedAt.IsZero(), "同组撤单同样记录完成时间")
+
+	steps.next()
+	positions, err := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	assert.True(t, positions[0].Quantity.Equal(decimal.NewFromFloat(0.5)), "quantity: %s", positions[0].Quantity)
+}
+
+// TestOrderGroup_SameKlineTriggered 测试同一根K线内止损止盈都触发时只成交一个
+func TestOrderGroup_SameKlineTriggered(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, bracketKlines)
+	ctx := context.Background()
+
+	tradingSvc := exchange.NewTradingService(svc, &PercisionProvider{})
+	resp, err := tradingSvc.SetStopOrders(ctx, exchange.SetStopOrdersReq{
+		TradingPair:  pair,
+		PositionSide: exchange.PositionSideLong,
+		TakeProfit:   exchange.StopOrder{Price: decimal.NewFromInt(110)},
+		StopLoss:     exchange.StopOrder{Price: decimal.NewFromInt(95)},
+		Quantity:     decimal.NewFromFloat(0.5),
+	})
+	require.NoError(t, err)
+
+	steps.next()
+	// 默认悲观策略止损优先
+	assertOrderStatus(t, svc, resp.StopLossId, exchange.OrderStatusFilled)
+	assertOrderStatus(t, svc, resp.TakeProfitId, exchange.OrderStatusCancelled)
+}
+
+// TestOrderGroup_CancelledOnPositionClosed 测试仓位被普通平仓单平掉后撤销订单组
+func TestOrderGroup_CancelledOnPositionClosed(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓成交
+		{100, 101, 99, 100}, // 市价平仓
+		{100, 101, 99, 100},
+	})
+	ctx := context.Background()
+
+	tradingSvc := exchange.NewTradingService(svc, &PercisionProvider{})
+	resp, err := tradingSvc.SetStopOrders(ctx, exchange.SetStopOrdersReq{
+		TradingPair:  pair,
+		PositionSide: exchange.PositionSideLong,
+		TakeProfit:   exchange.StopOrder{Price: decimal.NewFromInt(110)},
+		StopLoss:     exchange.StopOrder{Price: decimal.NewFromInt(95)},
+	})
+	require.NoError(t, err)
+
+	_, err = tradingSvc.ClosePosition(ctx, exchange.ClosePositionReq{
+		TradingPair:  pair,
+		PositionSide: exchange.PositionSideLong,
+		CloseAll:     true,
+	})
+	require.NoError(t, err)
+
+	steps.next()
+	assertOrderStatus(t, svc, resp.TakeProfitId, exchange.OrderStatusCancelled)
+	assertOrderStatus(t, svc, resp.StopLossId, exchange.OrderStatusCancelled)
+
+	orders, err := svc.GetOrders(ctx, exchange.GetOrdersReq{TradingPair: pair})
+	require.NoError(t, err)
+	assert.Empty(t, orders)
+}
@@ -0,0 +1,105 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOrderHistory_GetOrders 测试查询历史订单：默认只返回挂单，可以按状态、时间和条数过滤
+func TestOrderHistory_GetOrders(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓 1 BTC
+		{100, 101, 94, 96},  // 95 的买单成交
+		{96, 97, 94, 95},
+	})
+	ctx := context.Background()
+
+	filledId := createRestingBuy(t, svc, pair, 1)
+	cancelledId, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Price:       decimal.NewFromInt(90),
+		Quantity:    decimal.NewFromInt(1),
+	})
+	require.NoError(t, err)
+	require.NoError(t, svc.CancelOrder(ctx, exchange.CancelOrderReq{Id: cancelledId, TradingPair: pair}))
+	steps.next()
+
+	orders, err := svc.GetOrders(ctx, exchange.GetOrdersReq{TradingPair: pair})
+	require.NoError(t, err)
+	assert.Empty(t, orders, "已结束的订单不在挂单列表里")
+
+	// 按下单顺序返回全部订单
+	history, err := svc.GetOrders(ctx, exchange.GetOrdersReq{TradingPair: pair, IncludeClosed: true})
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, string(filledId), history[1].Id)
+	assert.Equal(t, string(cancelledId), history[2].Id)
+	assert.Equal(t, exchange.OrderStatusFilled, history[1].Status)
+	assert.Equal(t, exchange.OrderStatusCancelled, history[2].Status)
+	assert.False(t, history[2].IsActive())
+	assert.False(t, history[2].CompletedAt.IsZero(), "撤单时间记为完成时间")
+
+	cancelled, err := svc.GetOrders(ctx, exchange.GetOrdersReq{
+		TradingPair: pair,
+		Statuses:    []exchange.OrderStatus{exchange.OrderStatusCancelled},
+	})
+	require.NoError(t, err)
+	require.Len(t, cancelled, 1)
+	assert.Equal(t, string(cancelledId), cancelled[0].Id)
+
+	// 只取最近的 2 条
+	latest, err := svc.GetOrders(ctx, exchange.GetOrdersReq{TradingPair: pair, IncludeClosed: true, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, latest, 2)
+	assert.Equal(t, string(filledId), latest[0].Id)
+
+	// 开仓单之后创建的订单
+	afterOpen, err := svc.GetOrders(ctx, exchange.GetOrdersReq{
+		TradingPair:   pair,
+		IncludeClosed: true,
+		StartTime:     history[0].CreatedAt.Add(1),
+	})
+	require.NoError(t, err)
+	assert.Len(t, afterOpen, 2)
+}
+
+// TestOrderHistory_Rejected 测试下单被拒绝时返回拒绝原因
+func TestOrderHistory_Rejected(t *testing.T) {
+	svc, pair, _ := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100},
+		{100, 101, 99, 100},
+	})
+	ctx := context.Background()
+
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Quantity:    decimal.NewFromInt(10000),
+	})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, exchange.ErrOrderRejected))
+
+	var rejected *exchange.OrderRejectedError
+	require.True(t, errors.As(err, &rejected))
+	assert.Contains(t, rejected.Reason, "insufficient balance")
+
+	_, err = svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeClose,
+		PositonSide: exchange.PositionSideShort,
+		Quantity:    decimal.NewFromInt(1),
+	})
+	assert.ErrorIs(t, err, exchange.ErrOrderRejected)
+	assert.Contains(t, err.Error(), "position not found")
+}
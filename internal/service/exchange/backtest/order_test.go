@@ -26,8 +26,8 @@ func TestOrderService_CreateMarketOrder(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 创建市价单
 	orderId, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -42,7 +42,7 @@ func TestOrderService_CreateMarketOrder(t *testing.T) {
 	assert.NotEmpty(t, orderId)
 
 	// 市价单应该在下一根K线立即成交
-	<-klineChan
+	steps.next()
 
 	orderInfo, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: orderId})
 	require.NoError(t, err)
@@ -66,8 +66,8 @@ func TestOrderService_CreateLimitOrder(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 创建限价买单（价格低于市价）
 	limitPrice := decimal.NewFromFloat(49980.0)
@@ -88,7 +88,7 @@ func TestOrderService_CreateLimitOrder(t *testing.T) {
 
 	// 等待K线触发成交
 	for i := 0; i < 5; i++ {
-		<-klineChan
+		steps.next()
 	}
 
 	// 检查订单是否成交
@@ -114,10 +114,10 @@ func TestOrderService_GetOrders(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan1, _ := svc.SubscribeKline(ctx, pair1, interval)
-	klineChan2, _ := svc.SubscribeKline(ctx, pair2, interval)
-	<-klineChan1
-	<-klineChan2
+	steps1 := newKlineSteps(t, svc, pair1, interval)
+	steps2 := newKlineSteps(t, svc, pair2, interval)
+	steps1.next()
+	steps2.next()
 
 	// 创建多个限价单（不会立即成交）
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -177,8 +177,8 @@ func TestOrderService_CancelOrder(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 创建限价单
 	orderId, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -222,8 +222,8 @@ func TestOrderService_CancelOrders(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 创建多个限价单
 	for i := 0; i < 3; i++ {
@@ -268,8 +268,8 @@ func TestOrderService_OrderFillPrice(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 创建限价买单
 	limitPrice := decimal.NewFromFloat(49990.0)
@@ -285,7 +285,7 @@ func TestOrderService_OrderFillPrice(t *testing.T) {
 
 	// 等待成交
 	for i := 0; i < 5; i++ {
-		<-klineChan
+		steps.next()
 	}
 
 	// 检查持仓入场价
@@ -345,8 +345,8 @@ func TestOrderService_OrderScanMechanism(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan // 第一根K线
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next() // 第一根K线
 
 	// 创建买单（限价49950），应该在第二根K线成交（最低价49950）
 	buyOrderId, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -374,7 +374,7 @@ func TestOrderService_OrderScanMechanism(t *testing.T) {
 	orders, _ := svc.GetOrders(ctx, exchange.GetOrdersReq{TradingPair: pair})
 	assert.Len(t, orders, 2)
 
-	<-klineChan // 第二根K线，两个订单都应该成交
+	steps.next() // 第二根K线，两个订单都应该成交
 
 	// 检查订单状态
 	buyOrder, _ := svc.GetOrder(ctx, exchange.GetOrderReq{Id: buyOrderId})
@@ -406,8 +406,8 @@ func TestOrderService_FrozenFunds(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 记录初始余额
 	accountBefore, _ := svc.GetAccountInfo(ctx)
@@ -436,7 +436,7 @@ func TestOrderService_FrozenFunds(t *testing.T) {
 		"冻结金额应该约等于订单价值")
 
 	// 等待成交
-	<-klineChan
+	steps.next()
 
 	// 成交后，冻结资金应该转为保证金
 	accountAfterFill, _ := svc.GetAccountInfo(ctx)
@@ -467,8 +467,8 @@ func TestOrderService_MultiplePendingCloseOrders(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 开仓
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -479,7 +479,7 @@ func TestOrderService_MultiplePendingCloseOrders(t *testing.T) {
 		Quantity:    decimal.NewFromFloat(0.2),
 		Timestamp:   time.Now(),
 	})
-	<-klineChan
+	steps.next()
 
 	// 创建第一个平仓限价单（不会立即成交）
 	closeOrderId1, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -566,8 +566,8 @@ func TestOrderService_PartialFill(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan // 第一根K线
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next() // 第一根K线
 
 	// 创建市价单：买入0.2个BTC
 	// 冻结金额 = 50000 × 0.2 = 10000 USDT（刚好用完全部余额）
@@ -586,7 +586,7 @@ func TestOrderService_PartialFill(t *testing.T) {
 	assert.True(t, accountAfterCreate.AvailableBalance.IsZero(),
 		"创建订单后可用余额应该为0（全部冻结）")
 
-	<-klineChan // 第二根K线，价格上涨到52000，订单成交
+	steps.next() // 第二根K线，价格上涨到52000，订单成交
 
 	// 检查订单状态：应该部分成交
 	order, _ := svc.GetOrder(ctx, exchange.GetOrderReq{Id: orderId})
@@ -639,10 +639,10 @@ func TestOrderService_CancelOrderLogic(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan1, _ := svc.SubscribeKline(ctx, pair1, interval)
-	klineChan2, _ := svc.SubscribeKline(ctx, pair2, interval)
-	<-klineChan1
-	<-klineChan2
+	steps1 := newKlineSteps(t, svc, pair1, interval)
+	steps2 := newKlineSteps(t, svc, pair2, interval)
+	steps1.next()
+	steps2.next()
 
 	// 创建多个订单
 	order1, _ := svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -685,7 +685,7 @@ func TestOrderService_CancelOrderLogic(t *testing.T) {
 
 		// 检查订单状态
 		canceledOrder, _ := svc.GetOrder(ctx, exchange.GetOrderReq{Id: order1})
-		assert.Equal(t, exchange.OrderStatus("cancelled"), canceledOrder.Status)
+		assert.Equal(t, exchange.OrderStatusCancelled, canceledOrder.Status)
 
 		// 检查挂单列表
 		orders, _ := svc.GetOrders(ctx, exchange.GetOrdersReq{})
@@ -748,3 +748,121 @@ func TestOrderService_CancelOrderLogic(t *testing.T) {
 		assert.Len(t, orders, 0, "所有订单应该被取消")
 	})
 }
+
+// TestOrderService_ModifyOrder 测试修改限价挂单的价格和数量，冻结资金按新值重新计算
+func TestOrderService_ModifyOrder(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓 1 BTC，可用余额 99900
+		{100, 101, 94, 96},  // 触及改价后的 95
+		{96, 97, 95, 96},
+	})
+	ctx := context.Background()
+
+	orderId, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Price:       decimal.NewFromInt(90),
+		Quantity:    decimal.NewFromInt(10),
+	})
+	require.NoError(t, err)
+
+	account, err := svc.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.True(t, account.AvailableBalance.Equal(decimal.NewFromInt(99000)), "available balance: %s", account.AvailableBalance)
+
+	// 改价到 95，数量改为 20：冻结资金从 900 变为 1900
+	err = svc.ModifyOrder(ctx, exchange.ModifyOrderReq{
+		Id:          orderId,
+		TradingPair: pair,
+		Price:       decimal.NewFromInt(95),
+		Quantity:    decimal.NewFromInt(20),
+	})
+	require.NoError(t, err)
+
+	account, err = svc.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.True(t, account.AvailableBalance.Equal(decimal.NewFromInt(98000)), "available balance: %s", account.AvailableBalance)
+
+	order, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: orderId})
+	require.NoError(t, err)
+	assert.True(t, order.Price.Equal(decimal.NewFromInt(95)))
+	assert.True(t, order.Quantity.Equal(decimal.NewFromInt(20)))
+
+	// 按修改后的价格成交
+	steps.next()
+	order, err = svc.GetOrder(ctx, exchange.GetOrderReq{Id: orderId})
+	require.NoError(t, err)
+	assert.Equal(t, exchange.OrderStatusFilled, order.Status)
+	assert.True(t, order.AvgPrice.Equal(decimal.NewFromInt(95)), "avg price: %s", order.AvgPrice)
+
+	account, err = svc.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.True(t, account.AvailableBalance.Equal(decimal.NewFromInt(98000)), "available balance: %s", account.AvailableBalance)
+	assert.True(t, account.UsedMargin.Equal(decimal.NewFromInt(2000)), "used margin: %s", account.UsedMargin)
+}
+
+// TestOrderService_ModifyOrderValidation 测试修改订单的校验
+func TestOrderService_ModifyOrderValidation(t *testing.T) {
+	svc, pair, _ := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100},
+		{100, 101, 99, 100},
+	})
+	ctx := context.Background()
+
+	openId, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Price:       decimal.NewFromInt(90),
+		Quantity:    decimal.NewFromInt(10),
+	})
+	require.NoError(t, err)
+
+	closeId, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeClose,
+		PositonSide: exchange.PositionSideLong,
+		Price:       decimal.NewFromInt(120),
+		Quantity:    decimal.NewFromInt(1),
+	})
+	require.NoError(t, err)
+
+	stopId, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair:  pair,
+		OrderType:    exchange.OrderTypeClose,
+		PositonSide:  exchange.PositionSideLong,
+		Conditional:  exchange.ConditionalTypeStopMarket,
+		TriggerPrice: decimal.NewFromInt(95),
+		Quantity:     decimal.NewFromInt(1),
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		req  exchange.ModifyOrderReq
+	}{
+		{name: "订单不存在", req: exchange.ModifyOrderReq{Id: "999", Price: decimal.NewFromInt(95)}},
+		{name: "条件单不能修改", req: exchange.ModifyOrderReq{Id: stopId, Quantity: decimal.NewFromInt(2)}},
+		{name: "余额不足", req: exchange.ModifyOrderReq{Id: openId, Quantity: decimal.NewFromInt(10000)}},
+		{name: "平仓数量超过持仓", req: exchange.ModifyOrderReq{Id: closeId, Quantity: decimal.NewFromInt(2)}},
+		{name: "价格为负", req: exchange.ModifyOrderReq{Id: openId, Price: decimal.NewFromInt(-1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, svc.ModifyOrder(ctx, tt.req))
+		})
+	}
+
+	// 校验失败不改变订单和冻结资金
+	order, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: openId})
+	require.NoError(t, err)
+	assert.True(t, order.Price.Equal(decimal.NewFromInt(90)))
+	assert.True(t, order.Quantity.Equal(decimal.NewFromInt(10)))
+
+	account, err := svc.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.True(t, account.AvailableBalance.Equal(decimal.NewFromInt(99000)), "available balance: %s", account.AvailableBalance)
+}
@@ -0,0 +1,465 @@
+package backtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+)
+
+// 编译时检查接口实现
+var _ exchange.LiveService = (*PaperExchangeService)(nil)
+
+// defaultPaperDriveInterval 模拟盘撮合使用的K线周期，周期越小挂单和条件单的成交越及时
+var defaultPaperDriveInterval = exchange.Interval1m
+
+const (
+	// defaultPaperSaveInterval 模拟盘状态有变化时写入磁盘的间隔
+	defaultPaperSaveInterval = 10 * time.Second
+	// paperResubscribeDelay 撮合K线订阅失败后重新订阅的间隔
+	paperResubscribeDelay = 10 * time.Second
+)
+
+// PaperExchangeService 模拟盘：行情来自实盘 MarketService，订单按回测的撮合逻辑成交
+//
+// 时钟使用真实时间。Run 为每个有订单、持仓或行情订阅的交易对订阅实时K线（默认 1m），
+// 每根收盘的K线驱动一次撮合，与回测一样处理挂单、条件单、保证金和强平。
+// 市价单按下单时的实盘最新价立即成交（同样计算手续费和滑点）。
+// 账户状态定期写入磁盘，重启后用 Load 恢复，停机期间的K线在重新订阅时补齐撮合。
+// 资金费不结算。
+type PaperExchangeService struct {
+	*ExchangeService
+	market exchange.LiveMarketService
+
+	driveInterval exchange.Interval
+	statePath     string
+	saveInterval  time.Duration
+
+	// mu 串行化撮合和修改账户状态的操作，保证写入磁盘的状态一致
+	mu         sync.Mutex
+	dirty      bool
+	lastKlines map[string]time.Time // 每个交易对最后撮合的K线开盘时间，key: tradingPair symbol
+
+	pairsMu sync.Mutex
+	pairs   map[string]exchange.TradingPair // 需要撮合的交易对
+	watchC  chan struct{}
+}
+
+// paperState 模拟盘磁盘状态格式
+type paperState struct {
+	SavedAt    time.Time              `json:"savedAt"`
+	Exchange   State                  `json:"exchange"`
+	Pairs      []exchange.TradingPair `json:"pairs"`
+	LastKlines map[string]time.Time   `json:"lastKlines"`
+}
+
+// NewPaperExchangeService 创建模拟盘，market 一般为 binance.MarketService
+// initialBalance 只在没有可恢复的状态时使用
+func NewPaperExchangeService(market exchange.LiveMarketService, initialBalance decimal.Decimal) *PaperExchangeService {
+	// 模拟盘没有回放区间，K线都从 market 实时获取
+	svc := NewExchangeService(time.Now(), time.Time{}, initialBalance, NewBinanceKlineProvider(market))
+	svc.wallClock = true
+
+	return &PaperExchangeService{
+		ExchangeService: svc,
+		market:          market,
+		driveInterval:   defaultPaperDriveInterval,
+		saveInterval:    defaultPaperSaveInterval,
+		lastKlines:      make(map[string]time.Time),
+		pairs:           make(map[string]exchange.TradingPair),
+		watchC:          make(chan struct{}, 1),
+	}
+}
+
+// SetStatePath 设置状态文件路径，不设置则不持久化
+func (p *PaperExchangeService) SetStatePath(path string) {
+	p.statePath = path
+}
+
+// SetDriveInterval 设置撮合使用的K线周期，需要在 Run 之前调用
+func (p *PaperExchangeService) SetDriveInterval(interval exchange.Interval) {
+	p.driveInterval = interval
+}
+
+// SetSaveInterval 设置状态写入磁盘的间隔
+func (p *PaperExchangeService) SetSaveInterval(interval time.Duration) {
+	p.saveInterval = interval
+}
+
+// Load 从状态文件恢复账户，文件不存在时使用初始余额重新开始
+func (p *PaperExchangeService) Load() error {
+	if p.statePath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(p.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read paper trading state failed: %w", err)
+	}
+	var state paperState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("decode paper trading state failed: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.ExchangeService.RestoreState(state.Exchange); err != nil {
+		return fmt.Errorf("restore paper trading state failed: %w", err)
+	}
+	p.lastKlines = make(map[string]time.Time, len(state.LastKlines))
+	for symbol, openTime := range state.LastKlines {
+		p.lastKlines[symbol] = openTime
+	}
+	for _, pair := range state.Pairs {
+		p.watch(pair)
+	}
+	log.Printf("[paper] restored state saved at %s: %d orders, %d positions",
+		state.SavedAt.Format(time.RFC3339), len(state.Exchange.Orders), len(state.Exchange.Positions))
+	return nil
+}
+
+// Save 将当前状态写入状态文件，先写临时文件再重命名，避免进程中断留下不完整的状态
+func (p *PaperExchangeService) Save() error {
+	if p.statePath == "" {
+		return nil
+	}
+
+	p.mu.Lock()
+	state := paperState{
+		SavedAt:    time.Now(),
+		Exchange:   p.ExchangeService.State(),
+		Pairs:      p.watchedPairs(),
+		LastKlines: make(map[string]time.Time, len(p.lastKlines)),
+	}
+	for symbol, openTime := range p.lastKlines {
+		state.LastKlines[symbol] = openTime
+	}
+	p.dirty = false
+	p.mu.Unlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encode paper trading state failed: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p.statePath), 0o755); err != nil {
+		return fmt.Errorf("write paper trading state failed: %w", err)
+	}
+	tmp := p.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write paper trading state failed: %w", err)
+	}
+	if err := os.Rename(tmp, p.statePath); err != nil {
+		return fmt.Errorf("write paper trading state failed: %w", err)
+	}
+	return nil
+}
+
+// Run 订阅撮合K线并定期保存状态，阻塞到 ctx 取消，退出前保存一次状态
+func (p *PaperExchangeService) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.saveInterval)
+	defer ticker.Stop()
+
+	var wg sync.WaitGroup
+	driving := make(map[string]bool)
+	startDrivers := func() {
+		for _, pair := range p.watchedPairs() {
+			symbol := pair.ToString()
+			if driving[symbol] {
+				continue
+			}
+			driving[symbol] = true
+			wg.Add(1)
+			go func(pair exchange.TradingPair) {
+				defer wg.Done()
+				p.drive(ctx, pair)
+			}(pair)
+		}
+	}
+
+	startDrivers()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return p.Save()
+		case <-p.watchC:
+			startDrivers()
+		case <-ticker.C:
+			startDrivers()
+			if p.isDirty() {
+				if err := p.Save(); err != nil {
+					log.Printf("[paper] save state failed: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// drive 订阅交易对的撮合K线，补齐上次撮合之后的K线后逐根撮合，订阅断开时重新订阅
+func (p *PaperExchangeService) drive(ctx context.Context, pair exchange.TradingPair) {
+	for {
+		klineChan, err := p.market.SubscribeKline(ctx, pair, p.driveInterval)
+		if err != nil {
+			log.Printf("[paper] subscribe kline %s %s failed: %v", pair.ToString(), p.driveInterval.ToString(), err)
+		} else {
+			if err := p.backfill(ctx, pair); err != nil {
+				log.Printf("[paper] backfill kline %s failed: %v", pair.ToString(), err)
+			}
+			for kline := range klineChan {
+				p.processKlines(ctx, pair, []exchange.Kline{kline})
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(paperResubscribeDelay):
+		}
+	}
+}
+
+// backfill 撮合上次撮合之后（例如停机期间）已经收盘的K线，首次撮合的交易对不需要补齐
+func (p *PaperExchangeService) backfill(ctx context.Context, pair exchange.TradingPair) error {
+	for {
+		p.mu.Lock()
+		last := p.lastKlines[pair.ToString()]
+		p.mu.Unlock()
+		if last.IsZero() {
+			return nil
+		}
+
+		now := time.Now()
+		klines, err := p.market.GetKlines(ctx, exchange.GetKlinesReq{
+			TradingPair: pair,
+			Interval:    p.driveInterval,
+			StartTime:   last.Add(p.driveInterval.Duration()),
+			EndTime:     now,
+		})
+		if err != nil {
+			return err
+		}
+
+		// 还没收盘的K线等推送
+		closed := make([]exchange.Kline, 0, len(klines))
+		for _, kline := range klines {
+			if kline.CloseTime.Before(now) {
+				closed = append(closed, kline)
+			}
+		}
+		// 单次请求有条数上限，没有新K线说明已经补齐
+		if p.processKlines(ctx, pair, closed) == 0 {
+			return nil
+		}
+	}
+}
+
+// processKlines 按开盘时间去重后逐根撮合，返回撮合的K线数量
+// 一批K线在同一次加锁内撮合，期间不会插入新订单
+func (p *PaperExchangeService) processKlines(ctx context.Context, pair exchange.TradingPair, klines []exchange.Kline) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	symbol := pair.ToString()
+	count := 0
+	for _, kline := range klines {
+		if !kline.OpenTime.After(p.lastKlines[symbol]) {
+			continue
+		}
+		p.ExchangeService.processKline(ctx, pair, kline)
+		p.lastKlines[symbol] = kline.OpenTime
+		p.dirty = true
+		count++
+	}
+	return count
+}
+
+// watch 把交易对加入撮合，Run 已经启动时立即订阅
+func (p *PaperExchangeService) watch(pair exchange.TradingPair) {
+	p.pairsMu.Lock()
+	_, exists := p.pairs[pair.ToString()]
+	if !exists {
+		p.pairs[pair.ToString()] = pair
+	}
+	p.pairsMu.Unlock()
+
+	if !exists {
+		select {
+		case p.watchC <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (p *PaperExchangeService) watchedPairs() []exchange.TradingPair {
+	p.pairsMu.Lock()
+	defer p.pairsMu.Unlock()
+	pairs := make([]exchange.TradingPair, 0, len(p.pairs))
+	for _, pair := range p.pairs {
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+func (p *PaperExchangeService) isDirty() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dirty
+}
+
+// locked 在 mu 内执行修改账户状态的操作
+func (p *PaperExchangeService) locked(fn func() error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dirty = true
+	return fn()
+}
+
+// ============ Service 接口实现 ============
+
+func (p *PaperExchangeService) MarketService() exchange.MarketService {
+	return p
+}
+
+func (p *PaperExchangeService) KlineStreamService() exchange.KlineStreamService {
+	return p
+}
+
+func (p *PaperExchangeService) PositionService() exchange.PositionService {
+	return p
+}
+
+func (p *PaperExchangeService) AccountService() exchange.AccountService {
+	return p
+}
+
+func (p *PaperExchangeService) OrderService() exchange.OrderService {
+	return p
+}
+
+// ============ MarketService 实现：行情直接来自实盘 ============
+
+func (p *PaperExchangeService) Ticker(ctx context.Context, tradingPair exchange.TradingPair) (decimal.Decimal, error) {
+	return p.market.Ticker(ctx, tradingPair)
+}
+
+func (p *PaperExchangeService) GetKlines(ctx context.Context, req exchange.GetKlinesReq) ([]exchange.Kline, error) {
+	return p.market.GetKlines(ctx, req)
+}
+
+// SubscribeKline 订阅实时K线，同时开始撮合该交易对
+func (p *PaperExchangeService) SubscribeKline(ctx context.Context, tradingPair exchange.TradingPair, interval exchange.Interval) (chan exchange.Kline, error) {
+	p.watch(tradingPair)
+	return p.market.SubscribeKline(ctx, tradingPair, interval)
+}
+
+// ============ OrderService / PositionService 实现：撮合逻辑与回测一致 ============
+
+// CreateOrder 下单，市价单按实盘最新价立即成交，其余订单等撮合K线成交
+func (p *PaperExchangeService) CreateOrder(ctx context.Context, req exchange.CreateOrderReq) (exchange.OrderId, error) {
+	p.watch(req.TradingPair)
+
+	// 交易对还没有撮合过时也需要最新价估算开仓保证金
+	isMarket := req.Price.IsZero() && !req.Conditional.IsConditional()
+	price, err := p.ExchangeService.Ticker(ctx, req.TradingPair)
+	if isMarket || err != nil {
+		price, err = p.market.Ticker(ctx, req.TradingPair)
+		if err != nil {
+			return "", fmt.Errorf("failed to get current price for %s: %w", req.TradingPair.ToString(), err)
+		}
+	}
+
+	var id exchange.OrderId
+	err = p.locked(func() error {
+		p.ExchangeService.updatePrice(req.TradingPair, price)
+		var err error
+		id, err = p.ExchangeService.CreateOrder(ctx, req)
+		if err != nil {
+			return err
+		}
+		if isMarket {
+			p.fillMarketOrder(ctx, id, price)
+		}
+		return nil
+	})
+	return id, err
+}
+
+// fillMarketOrder 用最新价构造一根瞬时K线撮合市价单，调用时持有 mu
+func (p *PaperExchangeService) fillMarketOrder(ctx context.Context, id exchange.OrderId, price decimal.Decimal) {
+	p.ExchangeService.orderMu.RLock()
+	order, pending := p.ExchangeService.pendingOrders[id]
+	p.ExchangeService.orderMu.RUnlock()
+	if !pending {
+		return
+	}
+
+	now := time.Now()
+	tick := exchange.Kline{OpenTime: now, CloseTime: now, Open: price, High: price, Low: price, Close: price}
+	p.ExchangeService.updatePositionsPnl(order.TradingPair, price)
+	if err := p.ExchangeService.fillOrder(ctx, order, tick); err != nil {
+		p.ExchangeService.rejectOrder(ctx, order, err)
+	}
+}
+
+// CreateOrders 逐个下单，与币安批量下单一样，单个订单被拒绝不影响其它订单，
+// 返回已成功的订单和被拒绝的原因
+func (p *PaperExchangeService) CreateOrders(ctx context.Context, reqs []exchange.CreateOrderReq) ([]exchange.OrderId, error) {
+	var ids []exchange.OrderId
+	var errs []error
+	for i, req := range reqs {
+		id, err := p.CreateOrder(ctx, req)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("create order %d failed: %w", i, err))
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, errors.Join(errs...)
+}
+
+func (p *PaperExchangeService) ModifyOrder(ctx context.Context, req exchange.ModifyOrderReq) error {
+	return p.locked(func() error {
+		return p.ExchangeService.ModifyOrder(ctx, req)
+	})
+}
+
+func (p *PaperExchangeService) ModifyOrders(ctx context.Context, reqs []exchange.ModifyOrderReq) error {
+	return p.locked(func() error {
+		return p.ExchangeService.ModifyOrders(ctx, reqs)
+	})
+}
+
+func (p *PaperExchangeService) CancelOrder(ctx context.Context, req exchange.CancelOrderReq) error {
+	return p.locked(func() error {
+		return p.ExchangeService.CancelOrder(ctx, req)
+	})
+}
+
+func (p *PaperExchangeService) CancelOrders(ctx context.Context, req exchange.CancelOrdersReq) error {
+	return p.locked(func() error {
+		return p.ExchangeService.CancelOrders(ctx, req)
+	})
+}
+
+func (p *PaperExchangeService) SetLeverage(ctx context.Context, req exchange.SetLeverageReq) error {
+	return p.locked(func() error {
+		return p.ExchangeService.SetLeverage(ctx, req)
+	})
+}
+
+// SetMarginType 设置交易对的保证金模式
+func (p *PaperExchangeService) SetMarginType(tradingPair exchange.TradingPair, marginType exchange.MarginType) error {
+	return p.locked(func() error {
+		return p.ExchangeService.SetMarginType(tradingPair, marginType)
+	})
+}
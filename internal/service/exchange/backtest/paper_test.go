@@ -0,0 +1,257 @@
+package backtest
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLiveMarket 模拟实盘行情：固定的最新价、历史K线，以及由测试推送的实时K线
+type fakeLiveMarket struct {
+	mu     sync.Mutex
+	price  decimal.Decimal
+	klines []exchange.Kline
+	subs   chan chan exchange.Kline
+}
+
+func newFakeLiveMarket(price float64) *fakeLiveMarket {
+	return &fakeLiveMarket{price: decimal.NewFromFloat(price), subs: make(chan chan exchange.Kline, 10)}
+}
+
+func (m *fakeLiveMarket) Ticker(ctx context.Context, tradingPair exchange.TradingPair) (decimal.Decimal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.price, nil
+}
+
+func (m *fakeLiveMarket) GetKlines(ctx context.Context, req exchange.GetKlinesReq) ([]exchange.Kline, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []exchange.Kline
+	for _, kline := range m.klines {
+		if !kline.OpenTime.Before(req.StartTime) && kline.OpenTime.Before(req.EndTime) {
+			result = append(result, kline)
+		}
+	}
+	return result, nil
+}
+
+func (m *fakeLiveMarket) SubscribeKline(ctx context.Context, tradingPair exchange.TradingPair, interval exchange.Interval) (chan exchange.Kline, error) {
+	ch := make(chan exchange.Kline)
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	m.subs <- ch
+	return ch, nil
+}
+
+func paperKline(openTime time.Time, open, high, low, close float64) exchange.Kline {
+	return exchange.Kline{
+		OpenTime:  openTime,
+		CloseTime: openTime.Add(exchange.Interval1m.Duration() - time.Millisecond),
+		Open:      decimal.NewFromFloat(open),
+		High:      decimal.NewFromFloat(high),
+		Low:       decimal.NewFromFloat(low),
+		Close:     decimal.NewFromFloat(close),
+		Volume:    decimal.NewFromInt(100),
+	}
+}
+
+// TestPaperExchange_CreateOrdersPartial 测试批量下单时单个订单被拒绝，仍然返回其它已创建的订单
+func TestPaperExchange_CreateOrdersPartial(t *testing.T) {
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	paper := NewPaperExchangeService(newFakeLiveMarket(100), decimal.NewFromInt(10000))
+	ctx := context.Background()
+
+	limitOpen := func(price int64) exchange.CreateOrderReq {
+		return exchange.CreateOrderReq{
+			TradingPair: pair,
+			OrderType:   exchange.OrderTypeOpen,
+			PositonSide: exchange.PositionSideLong,
+			Price:       decimal.NewFromInt(price),
+			Quantity:    decimal.NewFromInt(1),
+		}
+	}
+	ids, err := paper.CreateOrders(ctx, []exchange.CreateOrderReq{
+		limitOpen(95),
+		// 没有持仓，平仓单被拒绝
+		{TradingPair: pair, OrderType: exchange.OrderTypeClose, PositonSide: exchange.PositionSideLong, Quantity: decimal.NewFromInt(1)},
+		limitOpen(90),
+	})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, exchange.ErrOrderRejected)
+	assert.Contains(t, err.Error(), "create order 1 failed")
+	require.Len(t, ids, 2)
+
+	orders, err := paper.GetOrders(ctx, exchange.GetOrdersReq{TradingPair: pair})
+	require.NoError(t, err)
+	assert.Len(t, orders, 2, "已创建的订单仍然挂在交易所，调用方需要拿到它们的ID")
+	for _, id := range ids {
+		assertOrderStatus(t, paper.ExchangeService, id, exchange.OrderStatusPending)
+	}
+}
+
+// TestPaperExchange_FillAndRestore 测试模拟盘：市价单按最新价立即成交，挂单由实时K线撮合，
+// 重启后恢复账户状态，并补齐停机期间的K线撮合
+func TestPaperExchange_FillAndRestore(t *testing.T) {
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	statePath := filepath.Join(t.TempDir(), "paper.json")
+	base := time.Now().Add(-time.Hour).Truncate(time.Minute)
+
+	market := newFakeLiveMarket(100)
+	paper := NewPaperExchangeService(market, decimal.NewFromInt(10000))
+	paper.SetStatePath(statePath)
+	require.NoError(t, paper.Load())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runDone := make(chan error, 1)
+	go func() { runDone <- paper.Run(ctx) }()
+
+	// 市价单不等K线，按最新价成交
+	_, err := paper.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Quantity:    decimal.NewFromInt(1),
+	})
+	require.NoError(t, err)
+	positions, err := paper.GetActivePositions(ctx, []exchange.TradingPair{pair})
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	assert.True(t, positions[0].EntryPrice.Equal(decimal.NewFromInt(100)), "entry price: %s", positions[0].EntryPrice)
+
+	limit95, err := paper.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Price:       decimal.NewFromInt(95),
+		Quantity:    decimal.NewFromInt(2),
+	})
+	require.NoError(t, err)
+	limit90, err := paper.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Price:       decimal.NewFromInt(90),
+		Quantity:    decimal.NewFromInt(1),
+	})
+	require.NoError(t, err)
+
+	// 实时K线触及 95，撮合第一个挂单
+	stream := <-market.subs
+	stream <- paperKline(base, 100, 101, 94, 96)
+	require.Eventually(t, func() bool {
+		order, err := paper.GetOrder(ctx, exchange.GetOrderReq{Id: limit95})
+		return err == nil && order.Status == exchange.OrderStatusFilled
+	}, time.Second, 10*time.Millisecond)
+
+	// 停止时写入状态
+	cancel()
+	require.NoError(t, <-runDone)
+	account, err := paper.GetAccountInfo(context.Background())
+	require.NoError(t, err)
+
+	// 重启：恢复账户，停机期间的K线触及 90，撮合第二个挂单
+	market = newFakeLiveMarket(96)
+	market.klines = []exchange.Kline{
+		paperKline(base, 100, 101, 94, 96), // 已经撮合过
+		paperKline(base.Add(time.Minute), 96, 97, 89, 92),
+	}
+	restored := NewPaperExchangeService(market, decimal.NewFromInt(10000))
+	restored.SetStatePath(statePath)
+	require.NoError(t, restored.Load())
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	restoredAccount, err := restored.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.True(t, restoredAccount.TotalBalance.Equal(account.TotalBalance))
+	assert.True(t, restoredAccount.AvailableBalance.Equal(account.AvailableBalance))
+
+	go func() { runDone <- restored.Run(ctx) }()
+	<-market.subs
+	require.Eventually(t, func() bool {
+		order, err := restored.GetOrder(ctx, exchange.GetOrderReq{Id: limit90})
+		return err == nil && order.Status == exchange.OrderStatusFilled
+	}, time.Second, 10*time.Millisecond)
+
+	positions, err = restored.GetActivePositions(ctx, []exchange.TradingPair{pair})
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	assert.True(t, positions[0].Quantity.Equal(decimal.NewFromInt(4)), "quantity: %s", positions[0].Quantity)
+
+	// 订单ID接着重启前的编号
+	id, err := restored.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeClose,
+		PositonSide: exchange.PositionSideLong,
+		Quantity:    decimal.NewFromInt(4),
+		ReduceOnly:  true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, exchange.OrderId("4"), id)
+
+	positions, err = restored.GetActivePositions(ctx, []exchange.TradingPair{pair})
+	require.NoError(t, err)
+	assert.Empty(t, positions)
+
+	cancel()
+	require.NoError(t, <-runDone)
+}
+
+// TestPaperExchange_HistoryPositionsConcurrent 测试模拟盘成交追加历史持仓时可以同时读取，返回的是副本
+func TestPaperExchange_HistoryPositionsConcurrent(t *testing.T) {
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	paper := NewPaperExchangeService(newFakeLiveMarket(100), decimal.NewFromInt(10000))
+	ctx := context.Background()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				histories, err := paper.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{})
+				if err == nil && len(histories) > 0 {
+					histories[0].Events = nil
+				}
+			}
+		}
+	}()
+
+	const rounds = 20
+	for i := 0; i < rounds; i++ {
+		for _, orderType := range []exchange.OrderType{exchange.OrderTypeOpen, exchange.OrderTypeClose} {
+			_, err := paper.CreateOrder(ctx, exchange.CreateOrderReq{
+				TradingPair: pair,
+				OrderType:   orderType,
+				PositonSide: exchange.PositionSideLong,
+				Quantity:    decimal.NewFromInt(1),
+			})
+			require.NoError(t, err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	histories, err := paper.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{})
+	require.NoError(t, err)
+	require.Len(t, histories, rounds)
+	// 调用方修改返回值不影响交易所内部的历史
+	for _, history := range histories {
+		assert.NotEmpty(t, history.Events)
+	}
+}
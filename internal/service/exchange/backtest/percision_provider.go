@@ -1,14 +1,38 @@
 package backtest
 
 import (
+	"sync"
+
 	"github.com/KNICEX/trading-agent/internal/service/exchange"
 )
 
-var _ exchange.QuantityPrecisionProvider = (*PercisionProvider)(nil)
+var _ exchange.SymbolRulesProvider = (*PercisionProvider)(nil)
 
+// PercisionProvider 回测交易对规则，默认数量精度为3位小数，可以按交易对设置完整规则
 type PercisionProvider struct {
+	mu    sync.RWMutex
+	rules map[string]exchange.SymbolRules // key: tradingPair symbol
+}
+
+// SetSymbolRules 设置交易对的交易规则，例如从币安 exchangeInfo 缓存中加载的规则
+func (p *PercisionProvider) SetSymbolRules(rules exchange.SymbolRules) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.rules == nil {
+		p.rules = make(map[string]exchange.SymbolRules)
+	}
+	p.rules[rules.TradingPair.ToString()] = rules
+}
+
+func (p *PercisionProvider) GetSymbolRules(pair exchange.TradingPair) exchange.SymbolRules {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if rules, ok := p.rules[pair.ToString()]; ok {
+		return rules
+	}
+	return exchange.DefaultSymbolRules(pair, 3)
 }
 
 func (p *PercisionProvider) GetQuantityPrecision(pair exchange.TradingPair) int32 {
-	return 3
+	return p.GetSymbolRules(pair).QuantityPrecision
 }
@@ -3,6 +3,7 @@ package backtest
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"github.com/KNICEX/trading-agent/internal/service/exchange"
 )
@@ -37,8 +38,12 @@ func (svc *ExchangeService) GetActivePositions(ctx context.Context, pairs []exch
 
 // GetHistoryPositions 获取历史持仓
 func (svc *ExchangeService) GetHistoryPositions(ctx context.Context, req exchange.GetHistoryPositionsReq) ([]exchange.PositionHistory, error) {
-	// 回测模式：返回所有历史持仓
-	return svc.positionHistories, nil
+	// 回测模式：返回所有历史持仓的副本，模拟盘下成交可能同时追加历史
+	svc.historyMu.RLock()
+	defer svc.historyMu.RUnlock()
+	histories := make([]exchange.PositionHistory, len(svc.positionHistories))
+	copy(histories, svc.positionHistories)
+	return histories, nil
 }
 
 // SetLeverage 设置杠杆
@@ -46,6 +51,11 @@ func (svc *ExchangeService) SetLeverage(ctx context.Context, req exchange.SetLev
 	if req.Leverage < 1 || req.Leverage > 125 {
 		return fmt.Errorf("invalid leverage: %d, must be between 1 and 125", req.Leverage)
 	}
+	if rules, ok := svc.symbolRules(req.TradingPair); ok {
+		if err := rules.ValidateLeverage(req.Leverage); err != nil {
+			return err
+		}
+	}
 
 	svc.leverageMu.Lock()
 	svc.leverages[req.TradingPair.ToString()] = req.Leverage
@@ -63,3 +73,68 @@ func (svc *ExchangeService) SetLeverage(ctx context.Context, req exchange.SetLev
 
 	return nil
 }
+
+// Flatten 撤销所有挂单，并按最新价格市价平掉全部持仓
+// 平仓与普通市价单一样收取手续费、计算滑点并记录历史持仓，回测区间结束时调用可以得到已实现的期末资金
+func (svc *ExchangeService) Flatten(ctx context.Context) error {
+	if err := svc.cancelOrdersByTradingPair(ctx, exchange.TradingPair{}); err != nil {
+		return fmt.Errorf("cancel pending orders failed: %w", err)
+	}
+
+	positions, err := svc.GetActivePositions(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// map 遍历顺序不固定，按持仓 key 排序保证结果可复现
+	sort.Slice(positions, func(i, j int) bool {
+		return svc.getPositionKey(positions[i].TradingPair, positions[i].PositionSide) <
+			svc.getPositionKey(positions[j].TradingPair, positions[j].PositionSide)
+	})
+
+	for _, position := range positions {
+		if position.Quantity.IsZero() {
+			continue
+		}
+		bar, err := svc.closingBar(position.TradingPair)
+		if err != nil {
+			return err
+		}
+		orderId, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+			TradingPair: position.TradingPair,
+			OrderType:   exchange.OrderTypeClose,
+			PositonSide: position.PositionSide,
+			Quantity:    position.Quantity.Abs(),
+		})
+		if err != nil {
+			return fmt.Errorf("create close order for %s %s failed: %w", position.TradingPair.ToString(), position.PositionSide, err)
+		}
+
+		svc.orderMu.RLock()
+		order := svc.orders[orderId]
+		svc.orderMu.RUnlock()
+		if err := svc.fillOrder(ctx, order, bar); err != nil {
+			svc.rejectOrder(ctx, order, err)
+			return fmt.Errorf("close position %s %s failed: %w", position.TradingPair.ToString(), position.PositionSide, err)
+		}
+	}
+	return nil
+}
+
+// closingBar Flatten 平仓使用的K线：最近一根K线，开盘价换成最新价格（市价单按开盘价成交）
+// 没有处理过K线时（例如从状态恢复）用最新价格构造
+func (svc *ExchangeService) closingBar(tradingPair exchange.TradingPair) (exchange.Kline, error) {
+	now := svc.now()
+
+	svc.priceMu.RLock()
+	defer svc.priceMu.RUnlock()
+	price, ok := svc.currentPrices[tradingPair.ToString()]
+	if !ok {
+		return exchange.Kline{}, fmt.Errorf("no price data for %s", tradingPair.ToString())
+	}
+	bar, ok := svc.lastKlines[tradingPair.ToString()]
+	if !ok {
+		bar = exchange.Kline{OpenTime: now, CloseTime: now, High: price, Low: price, Close: price}
+	}
+	bar.Open = price
+	return bar, nil
+}
@@ -29,11 +29,11 @@ func TestPositionService_GetActivePositions(t *testing.T) {
 	ctx := context.Background()
 
 	// 订阅K线
-	klineChan1, _ := svc.SubscribeKline(ctx, pair1, interval)
-	klineChan2, _ := svc.SubscribeKline(ctx, pair2, interval)
+	steps1 := newKlineSteps(t, svc, pair1, interval)
+	steps2 := newKlineSteps(t, svc, pair2, interval)
 
-	<-klineChan1
-	<-klineChan2
+	steps1.next()
+	steps2.next()
 
 	// 开两个仓位
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -54,8 +54,8 @@ func TestPositionService_GetActivePositions(t *testing.T) {
 		Timestamp:   time.Now(),
 	})
 
-	<-klineChan1
-	<-klineChan2
+	steps1.next()
+	steps2.next()
 
 	// 测试获取所有持仓
 	allPositions, err := svc.GetActivePositions(ctx, []exchange.TradingPair{})
@@ -94,8 +94,8 @@ func TestPositionService_GetHistoryPositions(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 开仓
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -107,7 +107,7 @@ func TestPositionService_GetHistoryPositions(t *testing.T) {
 		Timestamp:   time.Now(),
 	})
 
-	<-klineChan
+	steps.next()
 
 	// 平仓
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -119,8 +119,8 @@ func TestPositionService_GetHistoryPositions(t *testing.T) {
 		Timestamp:   time.Now(),
 	})
 
-	<-klineChan
-	<-klineChan
+	steps.next()
+	steps.next()
 
 	// 获取历史持仓
 	histories, err := svc.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{})
@@ -168,8 +168,8 @@ func TestPositionService_PositionEvents(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 开仓 0.1
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -180,10 +180,10 @@ func TestPositionService_PositionEvents(t *testing.T) {
 		Quantity:    decimal.NewFromFloat(0.1),
 		Timestamp:   time.Now(),
 	})
-	<-klineChan
+	steps.next()
 
 	// 加仓 0.05
-	<-klineChan
+	steps.next()
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
 		TradingPair: pair,
 		OrderType:   exchange.OrderTypeOpen,
@@ -192,10 +192,10 @@ func TestPositionService_PositionEvents(t *testing.T) {
 		Quantity:    decimal.NewFromFloat(0.05),
 		Timestamp:   time.Now(),
 	})
-	<-klineChan
+	steps.next()
 
 	// 减仓 0.03
-	<-klineChan
+	steps.next()
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
 		TradingPair: pair,
 		OrderType:   exchange.OrderTypeClose,
@@ -204,10 +204,10 @@ func TestPositionService_PositionEvents(t *testing.T) {
 		Quantity:    decimal.NewFromFloat(0.03),
 		Timestamp:   time.Now(),
 	})
-	<-klineChan
+	steps.next()
 
 	// 全平
-	<-klineChan
+	steps.next()
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
 		TradingPair: pair,
 		OrderType:   exchange.OrderTypeClose,
@@ -216,8 +216,8 @@ func TestPositionService_PositionEvents(t *testing.T) {
 		Quantity:    decimal.NewFromFloat(0.12),
 		Timestamp:   time.Now(),
 	})
-	<-klineChan
-	<-klineChan
+	steps.next()
+	steps.next()
 
 	// 获取历史持仓
 	histories, err := svc.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{})
@@ -316,8 +316,8 @@ func TestPositionService_LeverageAfterPositionOpen(t *testing.T) {
 		Leverage:    5,
 	})
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 开仓
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -328,8 +328,8 @@ func TestPositionService_LeverageAfterPositionOpen(t *testing.T) {
 		Quantity:    decimal.NewFromFloat(0.1),
 		Timestamp:   time.Now(),
 	})
-	<-klineChan
-	<-klineChan
+	steps.next()
+	steps.next()
 
 	// 检查持仓杠杆
 	positions, _ := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
@@ -396,8 +396,8 @@ func TestPositionService_UnrealizedPnLUpdate(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 开多仓
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -408,8 +408,8 @@ func TestPositionService_UnrealizedPnLUpdate(t *testing.T) {
 		Quantity:    decimal.NewFromFloat(0.1),
 		Timestamp:   time.Now(),
 	})
-	<-klineChan
-	<-klineChan
+	steps.next()
+	steps.next()
 
 	positions, _ := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
 	require.Len(t, positions, 1)
@@ -419,7 +419,7 @@ func TestPositionService_UnrealizedPnLUpdate(t *testing.T) {
 	var pnlHistory []decimal.Decimal
 
 	for i := 0; i < 15; i++ {
-		<-klineChan
+		steps.next()
 
 		positions, _ = svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
 		if len(positions) > 0 {
@@ -469,8 +469,8 @@ func TestPositionService_LongAndShortUnrealizedPnL(t *testing.T) {
 
 	ctx := context.Background()
 
-	klineChan, _ := svc.SubscribeKline(ctx, pair, interval)
-	<-klineChan
+	steps := newKlineSteps(t, svc, pair, interval)
+	steps.next()
 
 	// 同时开多仓和空仓（同一交易对的不同方向）
 	svc.CreateOrder(ctx, exchange.CreateOrderReq{
@@ -491,8 +491,8 @@ func TestPositionService_LongAndShortUnrealizedPnL(t *testing.T) {
 		Timestamp:   time.Now(),
 	})
 
-	<-klineChan
-	<-klineChan
+	steps.next()
+	steps.next()
 
 	// 获取两个持仓
 	positions, _ := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
@@ -512,7 +512,7 @@ func TestPositionService_LongAndShortUnrealizedPnL(t *testing.T) {
 
 	// 等待价格上涨
 	for i := 0; i < 5; i++ {
-		<-klineChan
+		steps.next()
 	}
 
 	// 再次获取持仓
@@ -541,3 +541,84 @@ func TestPositionService_LongAndShortUnrealizedPnL(t *testing.T) {
 	t.Logf("空头盈亏: %s", shortPosition.UnrealizedPnl)
 	t.Logf("总盈亏: %s", longPosition.UnrealizedPnl.Add(shortPosition.UnrealizedPnl))
 }
+
+// TestExchangeService_Flatten 测试撤销挂单并按最新价市价平掉全部持仓，平仓计入手续费和历史持仓
+func TestExchangeService_Flatten(t *testing.T) {
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	endTime := startTime.Add(24 * time.Hour)
+	svc, provider := createTestExchange(t, 50000.0, startTime, endTime)
+	svc.SetFeeSchedule(DefaultFeeSchedule())
+
+	btc := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	eth := exchange.TradingPair{Base: "ETH", Quote: "USDT"}
+	interval := exchange.Interval5m
+	provider.GenerateKlines(btc, interval, startTime, 50000.0, 5, "up")
+	provider.GenerateKlines(eth, interval, startTime, 3000.0, 5, "up")
+
+	ctx := context.Background()
+	btcSteps := newKlineSteps(t, svc, btc, interval)
+	ethSteps := newKlineSteps(t, svc, eth, interval)
+	btcSteps.next()
+	ethSteps.next()
+
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: btc,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Quantity:    decimal.NewFromFloat(0.1),
+	})
+	require.NoError(t, err)
+	_, err = svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: eth,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideShort,
+		Quantity:    decimal.NewFromFloat(1.0),
+	})
+	require.NoError(t, err)
+	btcSteps.next()
+	ethSteps.next()
+
+	// 远离市价的止损单，平仓时一起撤销
+	_, err = svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair:  btc,
+		OrderType:    exchange.OrderTypeClose,
+		PositonSide:  exchange.PositionSideLong,
+		Quantity:     decimal.NewFromFloat(0.1),
+		Conditional:  exchange.ConditionalTypeStopMarket,
+		TriggerPrice: decimal.NewFromInt(10000),
+	})
+	require.NoError(t, err)
+	// 再走一根K线，未实现盈亏按最新收盘价计算
+	btcSteps.next()
+	ethSteps.next()
+
+	before, err := svc.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	opened, err := svc.GetActivePositions(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, opened, 2)
+	closingFee := decimal.Zero
+	for _, position := range opened {
+		closingFee = closingFee.Add(position.MarkPrice.Mul(position.Quantity.Abs()).Mul(DefaultFeeSchedule().Default.Taker))
+	}
+	require.NoError(t, svc.Flatten(ctx))
+
+	positions, err := svc.GetActivePositions(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, positions)
+	orders, err := svc.GetOrders(ctx, exchange.GetOrdersReq{})
+	require.NoError(t, err)
+	assert.Empty(t, orders)
+
+	histories, err := svc.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{})
+	require.NoError(t, err)
+	assert.Len(t, histories, 2)
+
+	// 按最新收盘价平仓，没有未实现盈亏，期末资金等于平仓前的权益减去平仓手续费
+	after, err := svc.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.True(t, after.UnrealizedPnl.IsZero())
+	assert.True(t, after.UsedMargin.IsZero())
+	expected := before.TotalBalance.Add(before.UnrealizedPnl).Sub(closingFee)
+	assert.True(t, after.TotalBalance.Equal(expected), "%s != %s", after.TotalBalance, expected)
+}
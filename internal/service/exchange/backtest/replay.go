@@ -0,0 +1,173 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+)
+
+// replayBatch Replay 每次从 KlineProvider 读取的K线数量
+const replayBatch = 1000
+
+// KlineSubscription 回放订阅的K线流
+type KlineSubscription struct {
+	TradingPair exchange.TradingPair
+	Interval    exchange.Interval
+}
+
+// ReplayHandler 回放回调，在同一线程中同步调用，返回之后模拟时钟才会继续推进
+type ReplayHandler interface {
+	// OnKline 订阅的K线收盘时调用，此时该时刻的撮合已经完成
+	OnKline(ctx context.Context, sub KlineSubscription, kline exchange.Kline) error
+	// OnTick 同一时刻收盘的K线全部回调完成后调用
+	OnTick(ctx context.Context, t time.Time) error
+}
+
+// Replay 以事件驱动的方式回放 [startTime, endTime) 内所有订阅的K线
+//
+// 所有K线流按收盘时间归并成一条时间线，不需要等待，也不依赖 goroutine 调度，结果可复现。
+// 对于每个收盘时刻：
+//  1. 先用该时刻收盘的K线撮合订单（每个交易对只用周期最小的K线流撮合，避免同一段行情重复撮合）
+//  2. 再按 交易对、周期 的顺序回调 OnKline，回调中创建的订单从下一根K线开始撮合
+//  3. 最后回调 OnTick
+//
+// handler 返回错误时停止回放并返回该错误。
+func (svc *ExchangeService) Replay(ctx context.Context, subs []KlineSubscription, handler ReplayHandler) error {
+	streams := svc.newReplayStreams(subs)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// 找出最早的收盘时刻
+		var tick time.Time
+		found := false
+		for _, s := range streams {
+			kline, ok, err := s.peek(ctx)
+			if err != nil {
+				return err
+			}
+			if ok && (!found || kline.CloseTime.Before(tick)) {
+				tick = kline.CloseTime
+				found = true
+			}
+		}
+		if !found {
+			return nil
+		}
+
+		// 取出该时刻收盘的所有K线
+		type event struct {
+			stream *replayStream
+			kline  exchange.Kline
+		}
+		var events []event
+		for _, s := range streams {
+			kline, ok, _ := s.peek(ctx)
+			if ok && kline.CloseTime.Equal(tick) {
+				events = append(events, event{stream: s, kline: kline})
+				s.pop()
+			}
+		}
+
+		for _, e := range events {
+			if e.stream.driver {
+				svc.processKline(ctx, e.stream.sub.TradingPair, e.kline)
+			}
+		}
+		svc.advanceClock(tick)
+
+		for _, e := range events {
+			if err := handler.OnKline(ctx, e.stream.sub, e.kline); err != nil {
+				return err
+			}
+		}
+		if err := handler.OnTick(ctx, tick); err != nil {
+			return err
+		}
+	}
+}
+
+// newReplayStreams 去重并排序订阅，为每个交易对选出周期最小的K线流驱动撮合
+func (svc *ExchangeService) newReplayStreams(subs []KlineSubscription) []*replayStream {
+	seen := make(map[string]bool)
+	var streams []*replayStream
+	for _, sub := range subs {
+		key := sub.TradingPair.ToString() + "_" + sub.Interval.ToString()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		streams = append(streams, &replayStream{svc: svc, sub: sub, next: svc.startTime})
+	}
+
+	sort.Slice(streams, func(i, j int) bool {
+		pi, pj := streams[i].sub.TradingPair.ToString(), streams[j].sub.TradingPair.ToString()
+		if pi != pj {
+			return pi < pj
+		}
+		return streams[i].sub.Interval.Duration() < streams[j].sub.Interval.Duration()
+	})
+
+	// 排序后每个交易对的第一个流周期最小
+	for i, s := range streams {
+		s.driver = i == 0 || streams[i-1].sub.TradingPair != s.sub.TradingPair
+	}
+	return streams
+}
+
+// replayStream 分批从 KlineProvider 读取的K线流
+type replayStream struct {
+	svc    *ExchangeService
+	sub    KlineSubscription
+	driver bool // 是否驱动该交易对的撮合
+
+	buf  []exchange.Kline
+	pos  int
+	next time.Time // 下一批的开始时间
+}
+
+// peek 返回下一根K线，流结束时 ok 为 false
+func (s *replayStream) peek(ctx context.Context) (exchange.Kline, bool, error) {
+	for s.pos >= len(s.buf) {
+		if !s.next.Before(s.svc.endTime) {
+			return exchange.Kline{}, false, nil
+		}
+
+		end := s.next.Add(s.sub.Interval.Duration() * replayBatch)
+		if end.After(s.svc.endTime) {
+			end = s.svc.endTime
+		}
+		klines, err := s.svc.klineProvider.GetKlines(ctx, exchange.GetKlinesReq{
+			TradingPair: s.sub.TradingPair,
+			Interval:    s.sub.Interval,
+			StartTime:   s.next,
+			EndTime:     end,
+		})
+		if err != nil {
+			return exchange.Kline{}, false, fmt.Errorf("failed to get klines for %s: %w", s.sub.TradingPair.ToString(), err)
+		}
+
+		// 只保留本批范围内的K线，保证批次之间不重叠
+		s.buf = s.buf[:0]
+		for _, kline := range klines {
+			if !kline.OpenTime.Before(s.next) && kline.OpenTime.Before(end) {
+				s.buf = append(s.buf, kline)
+			}
+		}
+		sort.SliceStable(s.buf, func(i, j int) bool {
+			return s.buf[i].OpenTime.Before(s.buf[j].OpenTime)
+		})
+		s.pos = 0
+		s.next = end
+	}
+	return s.buf[s.pos], true, nil
+}
+
+func (s *replayStream) pop() {
+	s.pos++
+}
@@ -0,0 +1,202 @@
+package backtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replayRecorder 记录回放顺序，onKline 可以在回调中下单
+type replayRecorder struct {
+	events  []string
+	ticks   []time.Time
+	onKline func(sub KlineSubscription, kline exchange.Kline) error
+}
+
+func (r *replayRecorder) OnKline(ctx context.Context, sub KlineSubscription, kline exchange.Kline) error {
+	r.events = append(r.events, sub.TradingPair.ToString()+"_"+sub.Interval.ToString()+"@"+kline.CloseTime.Format("15:04"))
+	if r.onKline != nil {
+		return r.onKline(sub, kline)
+	}
+	return nil
+}
+
+func (r *replayRecorder) OnTick(ctx context.Context, t time.Time) error {
+	r.ticks = append(r.ticks, t)
+	return nil
+}
+
+// TestReplay_MergesStreamsInTimeOrder 测试多个交易对、多个周期按收盘时间归并，同一时刻按 交易对、周期 排序
+func TestReplay_MergesStreamsInTimeOrder(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	btc := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	eth := exchange.TradingPair{Base: "ETH", Quote: "USDT"}
+
+	provider := NewMockKlineProvider()
+	provider.GenerateKlines(btc, exchange.Interval5m, start, 100, 6, "up")
+	provider.GenerateKlines(btc, exchange.Interval15m, start, 100, 2, "up")
+	provider.GenerateKlines(eth, exchange.Interval5m, start, 10, 6, "up")
+	svc := NewExchangeService(start, start.Add(30*time.Minute), decimal.NewFromInt(10000), provider)
+
+	recorder := &replayRecorder{}
+	err := svc.Replay(context.Background(), []KlineSubscription{
+		{TradingPair: eth, Interval: exchange.Interval5m},
+		{TradingPair: btc, Interval: exchange.Interval15m},
+		{TradingPair: btc, Interval: exchange.Interval5m},
+		{TradingPair: btc, Interval: exchange.Interval5m}, // 重复订阅只回放一次
+	}, recorder)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"BTCUSDT_5m@00:05", "ETHUSDT_5m@00:05",
+		"BTCUSDT_5m@00:10", "ETHUSDT_5m@00:10",
+		"BTCUSDT_5m@00:15", "BTCUSDT_15m@00:15", "ETHUSDT_5m@00:15",
+		"BTCUSDT_5m@00:20", "ETHUSDT_5m@00:20",
+		"BTCUSDT_5m@00:25", "ETHUSDT_5m@00:25",
+		"BTCUSDT_5m@00:30", "BTCUSDT_15m@00:30", "ETHUSDT_5m@00:30",
+	}, recorder.events)
+	require.Len(t, recorder.ticks, 6)
+	assert.Equal(t, start.Add(30*time.Minute), recorder.ticks[5])
+	assert.Equal(t, start.Add(30*time.Minute), svc.now())
+}
+
+// TestReplay_OrdersFillFromNextKline 测试回调中创建的订单不会用同一时刻收盘的K线撮合
+func TestReplay_OrdersFillFromNextKline(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	interval := exchange.Interval5m
+	btc := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	eth := exchange.TradingPair{Base: "ETH", Quote: "USDT"}
+
+	provider := NewMockKlineProvider()
+	provider.AddKlines(btc, interval, buildOHLCKlines(start, interval, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 101, 99, 100},
+		{100, 101, 99, 100},
+	}))
+	// ETH 第一根K线最低 90，第二根最低 95
+	provider.AddKlines(eth, interval, buildOHLCKlines(start, interval, [][4]float64{
+		{100, 101, 90, 100},
+		{100, 101, 95, 100},
+		{100, 101, 99, 100},
+	}))
+	svc := NewExchangeService(start, start.Add(3*interval.Duration()), decimal.NewFromInt(10000), provider)
+
+	ctx := context.Background()
+	var orderId exchange.OrderId
+	var statuses []exchange.OrderStatus
+	recorder := &replayRecorder{onKline: func(sub KlineSubscription, kline exchange.Kline) error {
+		if sub.TradingPair == btc && orderId == "" {
+			// BTC 策略在第一根K线收盘时给 ETH 挂 92 的买单
+			resp, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+				TradingPair: eth,
+				OrderType:   exchange.OrderTypeOpen,
+				PositonSide: exchange.PositionSideLong,
+				Price:       decimal.NewFromInt(92),
+				Quantity:    decimal.NewFromInt(1),
+			})
+			orderId = resp
+			return err
+		}
+		if sub.TradingPair == eth && orderId != "" {
+			order, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: orderId, TradingPair: eth})
+			if err != nil {
+				return err
+			}
+			statuses = append(statuses, order.Status)
+		}
+		return nil
+	}}
+
+	require.NoError(t, svc.Replay(ctx, []KlineSubscription{
+		{TradingPair: btc, Interval: interval},
+		{TradingPair: eth, Interval: interval},
+	}, recorder))
+
+	// 同一时刻 ETH 的K线（最低 90）已经撮合过，订单保持挂单；之后的K线最低价都高于 92
+	require.NotEmpty(t, statuses)
+	for _, status := range statuses {
+		assert.Equal(t, exchange.OrderStatusPending, status)
+	}
+}
+
+// TestReplay_Deterministic 测试多次回放得到完全相同的结果
+func TestReplay_Deterministic(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pairs := []exchange.TradingPair{{Base: "BTC", Quote: "USDT"}, {Base: "ETH", Quote: "USDT"}, {Base: "SOL", Quote: "USDT"}}
+
+	run := func() []string {
+		provider := NewMockKlineProvider()
+		subs := make([]KlineSubscription, 0, len(pairs))
+		for _, pair := range pairs {
+			provider.GenerateKlines(pair, exchange.Interval5m, start, 100, 300, "volatile")
+			subs = append(subs, KlineSubscription{TradingPair: pair, Interval: exchange.Interval5m})
+		}
+		svc := NewExchangeService(start, start.Add(300*exchange.Interval5m.Duration()), decimal.NewFromInt(100000), provider)
+
+		ctx := context.Background()
+		recorder := &replayRecorder{}
+		recorder.onKline = func(sub KlineSubscription, kline exchange.Kline) error {
+			// 每根K线轮流开平仓
+			side := exchange.OrderTypeOpen
+			if len(recorder.events)%2 == 0 {
+				side = exchange.OrderTypeClose
+			}
+			_, _ = svc.CreateOrder(ctx, exchange.CreateOrderReq{
+				TradingPair: sub.TradingPair,
+				OrderType:   side,
+				PositonSide: exchange.PositionSideLong,
+				Quantity:    decimal.NewFromInt(1),
+			})
+			return nil
+		}
+		require.NoError(t, svc.Replay(ctx, subs, recorder))
+
+		account, err := svc.GetAccountInfo(ctx)
+		require.NoError(t, err)
+		return append(recorder.events, account.TotalBalance.String())
+	}
+
+	first := run()
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, first, run())
+	}
+}
+
+// TestExchangeService_NoKlineStream 测试回测交易所不提供实时K线订阅，只能通过 Replay 驱动撮合
+func TestExchangeService_NoKlineStream(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	svc := NewExchangeService(start, start.Add(time.Hour), decimal.NewFromInt(10000), NewMockKlineProvider())
+
+	var svcAny any = svc
+	_, ok := svcAny.(exchange.KlineStreamService)
+	assert.False(t, ok)
+	_, ok = svcAny.(exchange.LiveService)
+	assert.False(t, ok)
+}
+
+// TestReplay_YearOf5m 测试一年的 5m 数据可以在数秒内回放完成（没有逐根等待）
+func TestReplay_YearOf5m(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip long replay in short mode")
+	}
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	count := 365 * 288
+	btc := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	provider := NewMockKlineProvider()
+	provider.GenerateKlines(btc, exchange.Interval5m, start, 20000, count, "volatile")
+	svc := NewExchangeService(start, start.Add(time.Duration(count)*exchange.Interval5m.Duration()), decimal.NewFromInt(10000), provider)
+
+	recorder := &replayRecorder{}
+	begin := time.Now()
+	require.NoError(t, svc.Replay(context.Background(), []KlineSubscription{{TradingPair: btc, Interval: exchange.Interval5m}}, recorder))
+	elapsed := time.Since(begin)
+
+	assert.Len(t, recorder.ticks, count)
+	assert.Less(t, elapsed, 30*time.Second)
+	t.Logf("replayed %d klines in %s", count, elapsed)
+}
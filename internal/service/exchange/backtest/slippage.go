@@ -0,0 +1,125 @@
+package backtest
+
+import (
+	"math"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+)
+
+// SlippageModel 滑点模型
+// 只作用于以市价成交的订单（市价单、触发后的条件单），限价单按挂单价成交不产生滑点
+type SlippageModel interface {
+	// Slippage 返回每单位数量的不利价格偏移（非负）
+	// 买入时成交价上移，卖出时成交价下移
+	Slippage(req SlippageReq) decimal.Decimal
+}
+
+// SlippageReq 计算滑点所需的成交信息
+type SlippageReq struct {
+	Order    *exchange.OrderInfo
+	Price    decimal.Decimal // 理论成交价
+	Quantity decimal.Decimal // 成交数量
+	Kline    exchange.Kline  // 成交所在的K线
+}
+
+// FixedBpsSlippage 固定基点滑点，1 bps = 0.01%
+type FixedBpsSlippage struct {
+	Bps decimal.Decimal
+}
+
+func (m FixedBpsSlippage) Slippage(req SlippageReq) decimal.Decimal {
+	return req.Price.Mul(m.Bps).Div(decimal.NewFromInt(10000))
+}
+
+// VolatilitySlippage 按K线振幅缩放的滑点：滑点 = 系数 × (最高价 - 最低价)
+// 波动越大，市价单越难按理想价格成交
+type VolatilitySlippage struct {
+	Factor decimal.Decimal
+}
+
+func (m VolatilitySlippage) Slippage(req SlippageReq) decimal.Decimal {
+	return req.Kline.High.Sub(req.Kline.Low).Abs().Mul(m.Factor)
+}
+
+// VolumeParticipationSlippage 按成交量占比计算的冲击成本（平方根模型）
+// 滑点比例 = 系数 × sqrt(成交数量 / K线成交量)，不超过 MaxRatio
+type VolumeParticipationSlippage struct {
+	Coefficient decimal.Decimal
+	MaxRatio    decimal.Decimal // 滑点比例上限，K线成交量为 0 时直接使用上限；为 0 表示不限制
+}
+
+func (m VolumeParticipationSlippage) Slippage(req SlippageReq) decimal.Decimal {
+	var ratio decimal.Decimal
+	if req.Kline.Volume.IsPositive() {
+		participation := req.Quantity.Div(req.Kline.Volume).InexactFloat64()
+		ratio = m.Coefficient.Mul(decimal.NewFromFloat(math.Sqrt(participation)))
+	} else {
+		ratio = m.MaxRatio
+	}
+	if m.MaxRatio.IsPositive() && ratio.GreaterThan(m.MaxRatio) {
+		ratio = m.MaxRatio
+	}
+	return req.Price.Mul(ratio)
+}
+
+// SetSlippageModel 设置滑点模型，nil 表示不模拟滑点（默认）
+func (svc *ExchangeService) SetSlippageModel(model SlippageModel) {
+	svc.slippageMu.Lock()
+	defer svc.slippageMu.Unlock()
+	svc.slippageModel = model
+}
+
+// execution 一次成交的价格和成本参数
+type execution struct {
+	price    decimal.Decimal // 实际成交价（已计入滑点）
+	feeRate  decimal.Decimal // 手续费率
+	slippage decimal.Decimal // 每单位滑点
+	maker    bool            // 挂单成交
+
+	liquidation bool // 强制平仓
+}
+
+// newExecution 计算订单成交的实际价格、手续费率和滑点
+func (svc *ExchangeService) newExecution(order *exchange.OrderInfo, kline exchange.Kline, price, quantity decimal.Decimal) execution {
+	exec := execution{
+		price:    price,
+		feeRate:  svc.feeRate(order),
+		slippage: decimal.Zero,
+		maker:    svc.isMaker(order),
+	}
+
+	// 限价单按挂单价成交
+	if !order.Conditional.IsConditional() && !order.Price.IsZero() {
+		return exec
+	}
+
+	svc.slippageMu.RLock()
+	model := svc.slippageModel
+	svc.slippageMu.RUnlock()
+	if model == nil {
+		return exec
+	}
+
+	slippage := model.Slippage(SlippageReq{
+		Order:    order,
+		Price:    price,
+		Quantity: quantity,
+		Kline:    kline,
+	})
+	if !slippage.IsPositive() {
+		return exec
+	}
+	// 卖出时成交价最多滑到 0
+	if !order.IsBuy() && slippage.GreaterThan(price) {
+		slippage = price
+	}
+
+	exec.slippage = slippage
+	if order.IsBuy() {
+		exec.price = price.Add(slippage)
+	} else {
+		exec.price = price.Sub(slippage)
+	}
+	return exec
+}
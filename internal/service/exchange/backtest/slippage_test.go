@@ -0,0 +1,121 @@
+package backtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSlippageModels 测试各滑点模型的计算
+func TestSlippageModels(t *testing.T) {
+	kline := exchange.Kline{
+		Open:   decimal.NewFromInt(100),
+		High:   decimal.NewFromInt(104),
+		Low:    decimal.NewFromInt(98),
+		Close:  decimal.NewFromInt(102),
+		Volume: decimal.NewFromInt(400),
+	}
+	req := SlippageReq{Price: decimal.NewFromInt(100), Quantity: decimal.NewFromInt(4), Kline: kline}
+
+	tests := []struct {
+		name  string
+		model SlippageModel
+		want  decimal.Decimal
+	}{
+		{
+			name:  "固定 5 bps",
+			model: FixedBpsSlippage{Bps: decimal.NewFromInt(5)},
+			want:  decimal.NewFromFloat(0.05),
+		},
+		{
+			name:  "振幅的 10%",
+			model: VolatilitySlippage{Factor: decimal.NewFromFloat(0.1)},
+			want:  decimal.NewFromFloat(0.6),
+		},
+		{
+			// 成交量占比 1%，sqrt(0.01) = 0.1，滑点比例 = 0.01 × 0.1
+			name:  "成交量占比",
+			model: VolumeParticipationSlippage{Coefficient: decimal.NewFromFloat(0.01)},
+			want:  decimal.NewFromFloat(0.1),
+		},
+		{
+			name:  "成交量占比触及上限",
+			model: VolumeParticipationSlippage{Coefficient: decimal.NewFromFloat(0.01), MaxRatio: decimal.NewFromFloat(0.0005)},
+			want:  decimal.NewFromFloat(0.05),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.model.Slippage(req)
+			assert.InDelta(t, tt.want.InexactFloat64(), got.InexactFloat64(), 1e-9, "got %s", got)
+		})
+	}
+}
+
+// TestSlippage_AppliedToMarketAndStopFills 测试滑点作用于市价单和触发后的止损单，并记录在仓位事件上
+func TestSlippage_AppliedToMarketAndStopFills(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓（无滑点）
+		{100, 101, 94, 95},  // 触发止损 95
+		{95, 96, 94, 95},
+	})
+	// 10 bps 固定滑点
+	svc.SetSlippageModel(FixedBpsSlippage{Bps: decimal.NewFromInt(10)})
+	ctx := context.Background()
+
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair:   pair,
+		OrderType:     exchange.OrderTypeClose,
+		PositonSide:   exchange.PositionSideLong,
+		Conditional:   exchange.ConditionalTypeStopMarket,
+		TriggerPrice:  decimal.NewFromInt(95),
+		ClosePosition: true,
+	})
+	require.NoError(t, err)
+	steps.next()
+
+	histories, err := svc.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{})
+	require.NoError(t, err)
+	require.Len(t, histories, 1)
+
+	// 卖出止损：95 × (1 - 0.1%) = 94.905
+	closeEvent := histories[0].Events[len(histories[0].Events)-1]
+	assert.True(t, closeEvent.Price.Equal(decimal.NewFromFloat(94.905)), "close price: %s", closeEvent.Price)
+	assert.True(t, closeEvent.Slippage.Equal(decimal.NewFromFloat(0.095)), "slippage: %s", closeEvent.Slippage)
+	assert.True(t, histories[0].RealizedPnl.Equal(decimal.NewFromFloat(-5.095)), "pnl: %s", histories[0].RealizedPnl)
+}
+
+// TestSlippage_LimitOrderUnaffected 测试限价单不受滑点影响
+func TestSlippage_LimitOrderUnaffected(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100},
+		{100, 106, 99, 105}, // 限价 105 平仓
+		{105, 106, 104, 105},
+	})
+	svc.SetSlippageModel(FixedBpsSlippage{Bps: decimal.NewFromInt(10)})
+	ctx := context.Background()
+
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeClose,
+		PositonSide: exchange.PositionSideLong,
+		Price:       decimal.NewFromInt(105),
+		Quantity:    decimal.NewFromInt(1),
+	})
+	require.NoError(t, err)
+	steps.next()
+
+	histories, err := svc.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{})
+	require.NoError(t, err)
+	require.Len(t, histories, 1)
+	closeEvent := histories[0].Events[len(histories[0].Events)-1]
+	assert.True(t, closeEvent.Price.Equal(decimal.NewFromInt(105)))
+	assert.True(t, closeEvent.Slippage.IsZero())
+}
@@ -0,0 +1,218 @@
+package backtest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+)
+
+// State 模拟交易所的账户状态：订单、持仓、余额、持仓历史和交易对配置
+// 可以序列化成 JSON 持久化，用 RestoreState 恢复
+// 不包含手续费、滑点、成交模型等配置，恢复后需要重新设置
+type State struct {
+	Clock       time.Time `json:"clock"`
+	NextOrderId int64     `json:"nextOrderId"`
+
+	Orders        []exchange.OrderInfo                 `json:"orders"`
+	PendingOrders []exchange.OrderId                   `json:"pendingOrders"`
+	FrozenFunds   map[exchange.OrderId]decimal.Decimal `json:"frozenFunds"`
+	MakerOrders   []exchange.OrderId                   `json:"makerOrders"`
+	TrailingStops map[exchange.OrderId]TrailingState   `json:"trailingStops"`
+
+	Account           exchange.AccountInfo                `json:"account"`
+	Positions         map[string]exchange.Position        `json:"positions"`
+	PositionHistories []exchange.PositionHistory          `json:"positionHistories"`
+	ActiveHistories   map[string]exchange.PositionHistory `json:"activeHistories"`
+	MarginCalls       []string                            `json:"marginCalls"`
+
+	Leverages   map[string]int                 `json:"leverages"`
+	MarginTypes map[string]exchange.MarginType `json:"marginTypes"`
+	Prices      map[string]decimal.Decimal     `json:"prices"`
+}
+
+// TrailingState 跟踪止损的运行状态
+type TrailingState struct {
+	Activated bool            `json:"activated"`
+	Extreme   decimal.Decimal `json:"extreme"`
+	FillPrice decimal.Decimal `json:"fillPrice"`
+}
+
+// State 导出当前状态，各部分分别加锁读取，需要一致的快照时调用方要保证没有并发撮合和下单
+func (svc *ExchangeService) State() State {
+	state := State{
+		Clock:           svc.now(),
+		FrozenFunds:     make(map[exchange.OrderId]decimal.Decimal),
+		TrailingStops:   make(map[exchange.OrderId]TrailingState),
+		Positions:       make(map[string]exchange.Position),
+		ActiveHistories: make(map[string]exchange.PositionHistory),
+		Leverages:       make(map[string]int),
+		MarginTypes:     make(map[string]exchange.MarginType),
+		Prices:          make(map[string]decimal.Decimal),
+	}
+
+	svc.orderMu.RLock()
+	state.NextOrderId = svc.nextOrderId
+	for _, order := range svc.orders {
+		state.Orders = append(state.Orders, *order)
+	}
+	for id := range svc.pendingOrders {
+		state.PendingOrders = append(state.PendingOrders, id)
+	}
+	for id := range svc.makerOrders {
+		state.MakerOrders = append(state.MakerOrders, id)
+	}
+	for id, ts := range svc.trailingStops {
+		state.TrailingStops[id] = TrailingState{Activated: ts.activated, Extreme: ts.extreme, FillPrice: ts.fillPrice}
+	}
+	svc.orderMu.RUnlock()
+
+	// 按下单顺序输出，保证同样的状态序列化结果一致
+	sort.Slice(state.Orders, func(i, j int) bool {
+		return orderSeq(state.Orders[i].Id) < orderSeq(state.Orders[j].Id)
+	})
+	sortOrderIds(state.PendingOrders)
+	sortOrderIds(state.MakerOrders)
+
+	svc.accountMu.RLock()
+	state.Account = *svc.account
+	for id, amount := range svc.frozenFunds {
+		state.FrozenFunds[id] = amount
+	}
+	svc.accountMu.RUnlock()
+
+	svc.positionMu.RLock()
+	for key, position := range svc.positions {
+		state.Positions[key] = *position
+	}
+	for key := range svc.marginCalls {
+		state.MarginCalls = append(state.MarginCalls, key)
+	}
+	svc.positionMu.RUnlock()
+	sort.Strings(state.MarginCalls)
+
+	svc.historyMu.RLock()
+	state.PositionHistories = append([]exchange.PositionHistory(nil), svc.positionHistories...)
+	for key, history := range svc.activeHistories {
+		state.ActiveHistories[key] = *history
+	}
+	svc.historyMu.RUnlock()
+
+	svc.leverageMu.RLock()
+	for symbol, leverage := range svc.leverages {
+		state.Leverages[symbol] = leverage
+	}
+	svc.leverageMu.RUnlock()
+
+	svc.marginMu.RLock()
+	for symbol, marginType := range svc.marginTypes {
+		state.MarginTypes[symbol] = marginType
+	}
+	svc.marginMu.RUnlock()
+
+	svc.priceMu.RLock()
+	for symbol, price := range svc.currentPrices {
+		state.Prices[symbol] = price
+	}
+	svc.priceMu.RUnlock()
+
+	return state
+}
+
+// RestoreState 用 State 导出的状态覆盖当前状态，需要在撮合和下单开始之前调用
+func (svc *ExchangeService) RestoreState(state State) error {
+	orders := make(map[exchange.OrderId]*exchange.OrderInfo, len(state.Orders))
+	for i := range state.Orders {
+		order := state.Orders[i]
+		orders[exchange.OrderId(order.Id)] = &order
+	}
+	pendingOrders := make(map[exchange.OrderId]*exchange.OrderInfo, len(state.PendingOrders))
+	for _, id := range state.PendingOrders {
+		order, ok := orders[id]
+		if !ok {
+			return fmt.Errorf("pending order %s not found in orders", id)
+		}
+		pendingOrders[id] = order
+	}
+	makerOrders := make(map[exchange.OrderId]bool, len(state.MakerOrders))
+	for _, id := range state.MakerOrders {
+		makerOrders[id] = true
+	}
+	trailingStops := make(map[exchange.OrderId]*trailingState, len(state.TrailingStops))
+	for id, ts := range state.TrailingStops {
+		trailingStops[id] = &trailingState{activated: ts.Activated, extreme: ts.Extreme, fillPrice: ts.FillPrice}
+	}
+
+	svc.timeMu.Lock()
+	svc.clock = state.Clock
+	svc.timeMu.Unlock()
+
+	svc.orderMu.Lock()
+	svc.nextOrderId = state.NextOrderId
+	svc.orders = orders
+	svc.pendingOrders = pendingOrders
+	svc.makerOrders = makerOrders
+	svc.trailingStops = trailingStops
+	svc.orderMu.Unlock()
+
+	svc.accountMu.Lock()
+	account := state.Account
+	svc.account = &account
+	svc.frozenFunds = make(map[exchange.OrderId]decimal.Decimal, len(state.FrozenFunds))
+	for id, amount := range state.FrozenFunds {
+		svc.frozenFunds[id] = amount
+	}
+	svc.accountMu.Unlock()
+
+	svc.positionMu.Lock()
+	svc.positions = make(map[string]*exchange.Position, len(state.Positions))
+	for key, position := range state.Positions {
+		position := position
+		svc.positions[key] = &position
+	}
+	svc.marginCalls = make(map[string]bool, len(state.MarginCalls))
+	for _, key := range state.MarginCalls {
+		svc.marginCalls[key] = true
+	}
+	svc.positionMu.Unlock()
+
+	svc.historyMu.Lock()
+	svc.positionHistories = append([]exchange.PositionHistory{}, state.PositionHistories...)
+	svc.activeHistories = make(map[string]*exchange.PositionHistory, len(state.ActiveHistories))
+	for key, history := range state.ActiveHistories {
+		history := history
+		svc.activeHistories[key] = &history
+	}
+	svc.historyMu.Unlock()
+
+	svc.leverageMu.Lock()
+	svc.leverages = make(map[string]int, len(state.Leverages))
+	for symbol, leverage := range state.Leverages {
+		svc.leverages[symbol] = leverage
+	}
+	svc.leverageMu.Unlock()
+
+	svc.marginMu.Lock()
+	svc.marginTypes = make(map[string]exchange.MarginType, len(state.MarginTypes))
+	for symbol, marginType := range state.MarginTypes {
+		svc.marginTypes[symbol] = marginType
+	}
+	svc.marginMu.Unlock()
+
+	svc.priceMu.Lock()
+	svc.currentPrices = make(map[string]decimal.Decimal, len(state.Prices))
+	for symbol, price := range state.Prices {
+		svc.currentPrices[symbol] = price
+	}
+	svc.priceMu.Unlock()
+
+	return nil
+}
+
+func sortOrderIds(ids []exchange.OrderId) {
+	sort.Slice(ids, func(i, j int) bool {
+		return orderSeq(string(ids[i])) < orderSeq(string(ids[j]))
+	})
+}
@@ -0,0 +1,60 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+)
+
+// SetSymbolRulesProvider 设置交易对规则，下单和改单时按价格步长、数量步长和上下限、最小名义价值校验，
+// 调整杠杆时校验最大杠杆，与实盘交易所的过滤器一致。默认不校验
+func (svc *ExchangeService) SetSymbolRulesProvider(provider exchange.SymbolRulesProvider) {
+	svc.rulesMu.Lock()
+	defer svc.rulesMu.Unlock()
+	svc.rulesProvider = provider
+}
+
+// SymbolRulesProvider 返回 SetSymbolRulesProvider 设置的规则提供器，没有设置时返回 nil
+func (svc *ExchangeService) SymbolRulesProvider() exchange.SymbolRulesProvider {
+	svc.rulesMu.RLock()
+	defer svc.rulesMu.RUnlock()
+	return svc.rulesProvider
+}
+
+// symbolRules 获取交易对规则，没有设置规则提供器时返回 false
+func (svc *ExchangeService) symbolRules(tradingPair exchange.TradingPair) (exchange.SymbolRules, bool) {
+	svc.rulesMu.RLock()
+	provider := svc.rulesProvider
+	svc.rulesMu.RUnlock()
+
+	if provider == nil {
+		return exchange.SymbolRules{}, false
+	}
+	return provider.GetSymbolRules(tradingPair), true
+}
+
+// checkSymbolRules 按交易对规则校验新订单，市价单用当前价估算名义价值
+func (svc *ExchangeService) checkSymbolRules(ctx context.Context, req exchange.CreateOrderReq) error {
+	rules, ok := svc.symbolRules(req.TradingPair)
+	if !ok {
+		return nil
+	}
+
+	refPrice := req.Price
+	if refPrice.IsZero() && req.Conditional.IsConditional() {
+		refPrice = req.TriggerPrice
+	}
+	if refPrice.IsZero() {
+		price, err := svc.Ticker(ctx, req.TradingPair)
+		if err != nil {
+			return fmt.Errorf("failed to get current price for symbol rules: %w", err)
+		}
+		refPrice = price
+	}
+
+	if err := rules.Validate(req, refPrice); err != nil {
+		return rejectf("%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSymbolRules 价格步长 0.5，数量步长 0.01，最小名义价值 5，最大杠杆 50
+func testSymbolRules(pair exchange.TradingPair) *PercisionProvider {
+	provider := &PercisionProvider{}
+	provider.SetSymbolRules(exchange.SymbolRules{
+		TradingPair:       pair,
+		QuantityPrecision: 2,
+		TickSize:          decimal.NewFromFloat(0.5),
+		StepSize:          decimal.NewFromFloat(0.01),
+		MinQuantity:       decimal.NewFromFloat(0.01),
+		MaxQuantity:       decimal.NewFromInt(100),
+		MinNotional:       decimal.NewFromInt(5),
+		LeverageBrackets: []exchange.LeverageBracket{
+			{NotionalCap: decimal.NewFromInt(1000000), MaxLeverage: 50},
+		},
+	})
+	return provider
+}
+
+// TestSymbolRules_BacktestRejects 测试回测交易所按交易对规则拒绝订单
+func TestSymbolRules_BacktestRejects(t *testing.T) {
+	svc, pair, _ := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100},
+		{100, 101, 96, 97},
+	})
+	ctx := context.Background()
+	svc.SetSymbolRulesProvider(testSymbolRules(pair))
+
+	limit := func(price, quantity float64) error {
+		_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+			TradingPair: pair,
+			OrderType:   exchange.OrderTypeOpen,
+			PositonSide: exchange.PositionSideLong,
+			Price:       decimal.NewFromFloat(price),
+			Quantity:    decimal.NewFromFloat(quantity),
+		})
+		return err
+	}
+
+	assert.NoError(t, limit(95.5, 0.1))
+	for name, err := range map[string]error{
+		"价格不符合步长": limit(95.3, 0.1),
+		"数量不符合步长": limit(95, 0.105),
+		"名义价值不足":  limit(95, 0.05),
+		"数量超过上限":  limit(95, 101),
+	} {
+		require.Error(t, err, name)
+		assert.True(t, errors.Is(err, exchange.ErrOrderRejected), name)
+	}
+
+	// 市价单按当前价估算名义价值：0.04 * 100 < 5
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Quantity:    decimal.NewFromFloat(0.04),
+	})
+	assert.ErrorIs(t, err, exchange.ErrOrderRejected)
+
+	// 改单同样校验
+	id := createRestingBuy(t, svc, pair, 1)
+	assert.Error(t, svc.ModifyOrder(ctx, exchange.ModifyOrderReq{Id: id, TradingPair: pair, Price: decimal.NewFromFloat(94.2)}))
+	assert.NoError(t, svc.ModifyOrder(ctx, exchange.ModifyOrderReq{Id: id, TradingPair: pair, Price: decimal.NewFromFloat(94.5)}))
+
+	// 杠杆不能超过最大杠杆
+	assert.Error(t, svc.SetLeverage(ctx, exchange.SetLeverageReq{TradingPair: pair, Leverage: 75}))
+	assert.NoError(t, svc.SetLeverage(ctx, exchange.SetLeverageReq{TradingPair: pair, Leverage: 50}))
+}
+
+// TestSymbolRules_TradingServiceRounds 测试交易服务按相同规则取整价格和数量后下单
+func TestSymbolRules_TradingServiceRounds(t *testing.T) {
+	svc, pair, _ := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100},
+		{100, 101, 96, 97},
+	})
+	ctx := context.Background()
+	provider := testSymbolRules(pair)
+	svc.SetSymbolRulesProvider(provider)
+	tradingSvc := exchange.NewTradingService(svc, provider)
+
+	resp, err := tradingSvc.OpenPosition(ctx, exchange.OpenPositionReq{
+		TradingPair:  pair,
+		PositionSide: exchange.PositionSideLong,
+		Price:        decimal.NewFromFloat(95.2),
+		Quantity:     decimal.NewFromFloat(0.1299),
+		StopLoss:     exchange.StopOrder{Price: decimal.NewFromFloat(90.3)},
+	})
+	require.NoError(t, err)
+
+	order, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: resp.OrderId})
+	require.NoError(t, err)
+	assert.True(t, order.Price.Equal(decimal.NewFromFloat(95)), "price: %s", order.Price)
+	assert.True(t, order.Quantity.Equal(decimal.NewFromFloat(0.12)), "quantity: %s", order.Quantity)
+
+	stop, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: resp.StopLossId})
+	require.NoError(t, err)
+	assert.True(t, stop.TriggerPrice.Equal(decimal.NewFromFloat(90.5)), "trigger price: %s", stop.TriggerPrice)
+
+	// 取整后名义价值不足，不发送到交易所
+	_, err = tradingSvc.OpenPosition(ctx, exchange.OpenPositionReq{
+		TradingPair:  pair,
+		PositionSide: exchange.PositionSideLong,
+		Price:        decimal.NewFromInt(95),
+		Quantity:     decimal.NewFromFloat(0.0499),
+	})
+	assert.ErrorIs(t, err, exchange.ErrOrderRejected)
+}
@@ -0,0 +1,56 @@
+package backtest
+
+import (
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+)
+
+// checkTimeInForce 下单时校验有效方式
+// - GTX（只做挂单）：下单价格会立即成交时拒绝
+// - GTD：失效时间必须晚于当前时间
+func (svc *ExchangeService) checkTimeInForce(req exchange.CreateOrderReq) error {
+	if err := req.ValidateTimeInForce(); err != nil {
+		return &exchange.OrderRejectedError{Reason: err.Error()}
+	}
+
+	switch req.TimeInForce {
+	case exchange.TimeInForceGTX:
+		if !svc.isMakerOrder(req) {
+			return rejectf("post only order would immediately match: price=%s", req.Price)
+		}
+	case exchange.TimeInForceGTD:
+		if !req.GoodTillDate.After(svc.now()) {
+			return rejectf("good till date %s is not after current time %s", req.GoodTillDate, svc.now())
+		}
+	}
+	return nil
+}
+
+// expireGoodTillDate 到了失效时间的 GTD 订单不再参与撮合，返回仍然有效的订单
+func (svc *ExchangeService) expireGoodTillDate(orders []*exchange.OrderInfo, kline exchange.Kline) []*exchange.OrderInfo {
+	active := orders[:0]
+	for _, order := range orders {
+		if order.TimeInForce == exchange.TimeInForceGTD && !kline.OpenTime.Before(order.GoodTillDate) {
+			svc.expireOrder(order)
+			continue
+		}
+		active = append(active, order)
+	}
+	return active
+}
+
+// canFillOrKill FOK 订单在本根K线上能否全部成交，其余订单总是返回 true
+func (svc *ExchangeService) canFillOrKill(order *exchange.OrderInfo, kline exchange.Kline) bool {
+	if order.TimeInForce != exchange.TimeInForceFOK {
+		return true
+	}
+	return svc.fillQuantity(order, kline).GreaterThanOrEqual(order.Quantity.Sub(order.ExecutedQuantity))
+}
+
+// expireImmediateOrders IOC / FOK 订单只参与下单后第一根K线的撮合，没有成交的部分失效
+func (svc *ExchangeService) expireImmediateOrders(orders []*exchange.OrderInfo) {
+	for _, order := range orders {
+		if order.TimeInForce.IsImmediate() && svc.isPending(order) {
+			svc.expireOrder(order)
+		}
+	}
+}
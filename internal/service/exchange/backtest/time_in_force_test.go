@@ -0,0 +1,187 @@
+package backtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTimeInForceBuy 以指定有效方式挂限价买单
+func createTimeInForceBuy(t *testing.T, svc *ExchangeService, pair exchange.TradingPair, price, quantity int64, tif exchange.TimeInForce) exchange.OrderId {
+	id, err := svc.CreateOrder(context.Background(), exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Price:       decimal.NewFromInt(price),
+		Quantity:    decimal.NewFromInt(quantity),
+		TimeInForce: tif,
+	})
+	require.NoError(t, err)
+	return id
+}
+
+// TestTimeInForce_IOC 测试 IOC 订单只在下一根K线撮合，未成交的部分失效并返还冻结资金
+func TestTimeInForce_IOC(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓 1 BTC，占用保证金 100
+		{100, 101, 94, 96},  // 95 的 IOC 买单成交 3，其余失效；90 的 IOC 买单没有触及，全部失效
+		{96, 97, 89, 90},
+	})
+	ctx := context.Background()
+	svc.SetFillModel(VolumeParticipationFill{Rate: decimal.NewFromFloat(0.03)})
+	partialId := createTimeInForceBuy(t, svc, pair, 95, 10, exchange.TimeInForceIOC)
+	missedId := createTimeInForceBuy(t, svc, pair, 90, 1, exchange.TimeInForceIOC)
+
+	steps.next()
+	order, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: partialId})
+	require.NoError(t, err)
+	assert.Equal(t, exchange.OrderStatusExpired, order.Status)
+	assert.True(t, order.ExecutedQuantity.Equal(decimal.NewFromInt(3)), "executed: %s", order.ExecutedQuantity)
+	assert.Equal(t, exchange.TimeInForceIOC, order.TimeInForce)
+
+	missed, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: missedId})
+	require.NoError(t, err)
+	assert.Equal(t, exchange.OrderStatusExpired, missed.Status)
+	assert.True(t, missed.ExecutedQuantity.IsZero())
+
+	// 下一根K线触及 90 也不会再成交
+	steps.next()
+	account, err := svc.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.True(t, account.AvailableBalance.Equal(decimal.NewFromInt(100000-100-285)), "available balance: %s", account.AvailableBalance)
+}
+
+// TestTimeInForce_FOK 测试 FOK 订单不能全部成交时整单失效，能全部成交时正常成交
+func TestTimeInForce_FOK(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓 1 BTC
+		{100, 101, 94, 96},  // 每根K线最多成交 3
+		{96, 97, 94, 95},
+	})
+	ctx := context.Background()
+	svc.SetFillModel(VolumeParticipationFill{Rate: decimal.NewFromFloat(0.03)})
+	killedId := createTimeInForceBuy(t, svc, pair, 95, 10, exchange.TimeInForceFOK)
+	filledId := createTimeInForceBuy(t, svc, pair, 95, 2, exchange.TimeInForceFOK)
+
+	steps.next()
+	killed, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: killedId})
+	require.NoError(t, err)
+	assert.Equal(t, exchange.OrderStatusExpired, killed.Status)
+	assert.True(t, killed.ExecutedQuantity.IsZero())
+	assertOrderStatus(t, svc, filledId, exchange.OrderStatusFilled)
+
+	positions, err := svc.GetActivePositions(ctx, []exchange.TradingPair{pair})
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	assert.True(t, positions[0].Quantity.Equal(decimal.NewFromInt(3)), "quantity: %s", positions[0].Quantity)
+}
+
+// TestTimeInForce_PostOnly 测试只做挂单的订单会立即成交时被拒绝
+func TestTimeInForce_PostOnly(t *testing.T) {
+	svc, pair, _ := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 当前价 100
+		{100, 101, 99, 100},
+	})
+	ctx := context.Background()
+
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Price:       decimal.NewFromInt(101),
+		Quantity:    decimal.NewFromInt(1),
+		TimeInForce: exchange.TimeInForceGTX,
+	})
+	assert.ErrorIs(t, err, exchange.ErrOrderRejected)
+	assert.Contains(t, err.Error(), "post only")
+
+	id := createTimeInForceBuy(t, svc, pair, 99, 1, exchange.TimeInForceGTX)
+	svc.orderMu.RLock()
+	assert.True(t, svc.makerOrders[id])
+	svc.orderMu.RUnlock()
+
+	// 改价后会立即成交，拒绝修改
+	err = svc.ModifyOrder(ctx, exchange.ModifyOrderReq{Id: id, TradingPair: pair, Price: decimal.NewFromInt(101)})
+	assert.Error(t, err)
+	assertOrderStatus(t, svc, id, exchange.OrderStatusPending)
+}
+
+// TestTimeInForce_GTD 测试 GTD 订单到失效时间后不再成交
+func TestTimeInForce_GTD(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 00:05 开仓
+		{100, 101, 97, 98},  // 00:10 未触及 95
+		{98, 99, 94, 95},    // 00:15 已失效，触及 95 也不成交
+		{95, 96, 94, 95},
+	})
+	ctx := context.Background()
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Price:       decimal.NewFromInt(95),
+		Quantity:    decimal.NewFromInt(1),
+		TimeInForce: exchange.TimeInForceGTD,
+	})
+	assert.ErrorIs(t, err, exchange.ErrOrderRejected, "GTD 订单必须设置失效时间")
+
+	id, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair:  pair,
+		OrderType:    exchange.OrderTypeOpen,
+		PositonSide:  exchange.PositionSideLong,
+		Price:        decimal.NewFromInt(95),
+		Quantity:     decimal.NewFromInt(1),
+		TimeInForce:  exchange.TimeInForceGTD,
+		GoodTillDate: startTime.Add(15 * time.Minute),
+	})
+	require.NoError(t, err)
+
+	steps.next()
+	assertOrderStatus(t, svc, id, exchange.OrderStatusPending)
+	steps.next()
+	assertOrderStatus(t, svc, id, exchange.OrderStatusExpired)
+
+	account, err := svc.GetAccountInfo(ctx)
+	require.NoError(t, err)
+	assert.True(t, account.AvailableBalance.Equal(decimal.NewFromInt(100000-100)), "available balance: %s", account.AvailableBalance)
+}
+
+// TestTimeInForce_Validation 测试有效方式只对限价单有效
+func TestTimeInForce_Validation(t *testing.T) {
+	svc, pair, _ := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100},
+		{100, 101, 99, 100},
+	})
+	ctx := context.Background()
+
+	_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Quantity:    decimal.NewFromInt(1),
+		TimeInForce: exchange.TimeInForceIOC,
+	})
+	assert.ErrorIs(t, err, exchange.ErrOrderRejected)
+
+	_, err = svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair: pair,
+		OrderType:   exchange.OrderTypeOpen,
+		PositonSide: exchange.PositionSideLong,
+		Price:       decimal.NewFromInt(95),
+		Quantity:    decimal.NewFromInt(1),
+		TimeInForce: exchange.TimeInForce("DAY"),
+	})
+	assert.ErrorIs(t, err, exchange.ErrOrderRejected)
+}
@@ -0,0 +1,108 @@
+package backtest
+
+import (
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+)
+
+// trailingState 跟踪止损的运行状态，受 orderMu 保护
+type trailingState struct {
+	activated bool
+	// extreme 激活以来的最有利价格：卖单（平多）为最高价，买单（平空）为最低价
+	extreme decimal.Decimal
+	// fillPrice 触发时的成交价
+	fillPrice decimal.Decimal
+}
+
+// initTrailingStop 没有激活价的跟踪止损下单时立即激活，以当前价作为初始极值
+// 还没有行情时在第一根K线上激活
+func (svc *ExchangeService) initTrailingStop(order *exchange.OrderInfo, price decimal.Decimal) {
+	svc.orderMu.Lock()
+	defer svc.orderMu.Unlock()
+
+	state := &trailingState{}
+	if order.ActivationPrice.IsZero() && price.IsPositive() {
+		state.activated = true
+		state.extreme = price
+		order.TriggerPrice = trailingStopPrice(order, price)
+	}
+	svc.trailingStops[exchange.OrderId(order.Id)] = state
+}
+
+// checkTrailingTriggered 用一根K线推进跟踪止损，返回是否触发
+// 只有 OHLC 时按保守的顺序处理：
+//  1. 先用K线开始前的止损价检查不利方向的极值（卖单看最低价，买单看最高价），开盘即越过时按开盘价成交
+//  2. 未触发则用有利方向的极值激活或更新止损价；价格随后从极值走到收盘价，收盘价越过新的止损价时按新止损价成交
+func (svc *ExchangeService) checkTrailingTriggered(order *exchange.OrderInfo, kline exchange.Kline) bool {
+	svc.orderMu.Lock()
+	defer svc.orderMu.Unlock()
+
+	id := exchange.OrderId(order.Id)
+	state, ok := svc.trailingStops[id]
+	if !ok {
+		state = &trailingState{}
+		svc.trailingStops[id] = state
+	}
+
+	sell := !order.IsBuy()
+	adverse, favorable := kline.Low, kline.High
+	if !sell {
+		adverse, favorable = kline.High, kline.Low
+	}
+
+	if state.activated && trailingCrossed(sell, adverse, order.TriggerPrice) {
+		state.fillPrice = order.TriggerPrice
+		if trailingCrossed(sell, kline.Open, order.TriggerPrice) {
+			state.fillPrice = kline.Open
+		}
+		return true
+	}
+
+	if !state.activated {
+		if !order.ActivationPrice.IsZero() && !trailingCrossed(!sell, favorable, order.ActivationPrice) {
+			return false
+		}
+		state.activated = true
+		state.extreme = favorable
+	} else if trailingCrossed(!sell, favorable, state.extreme) {
+		state.extreme = favorable
+	}
+	order.TriggerPrice = trailingStopPrice(order, state.extreme)
+
+	if trailingCrossed(sell, kline.Close, order.TriggerPrice) {
+		state.fillPrice = order.TriggerPrice
+		return true
+	}
+	return false
+}
+
+// trailingFillPrice 跟踪止损触发时记录的成交价
+func (svc *ExchangeService) trailingFillPrice(order *exchange.OrderInfo) decimal.Decimal {
+	svc.orderMu.RLock()
+	defer svc.orderMu.RUnlock()
+
+	if state, ok := svc.trailingStops[exchange.OrderId(order.Id)]; ok && state.fillPrice.IsPositive() {
+		return state.fillPrice
+	}
+	return order.TriggerPrice
+}
+
+// trailingStopPrice 根据极值计算止损价：卖单在极值下方，买单在极值上方
+func trailingStopPrice(order *exchange.OrderInfo, extreme decimal.Decimal) decimal.Decimal {
+	offset := order.CallbackDistance
+	if !order.CallbackRate.IsZero() {
+		offset = extreme.Mul(order.CallbackRate).Div(decimal.NewFromInt(100))
+	}
+	if order.IsBuy() {
+		return extreme.Add(offset)
+	}
+	return extreme.Sub(offset)
+}
+
+// trailingCrossed 价格是否越过目标价：down 为 true 时判断 price <= target，否则判断 price >= target
+func trailingCrossed(down bool, price, target decimal.Decimal) bool {
+	if down {
+		return price.LessThanOrEqual(target)
+	}
+	return price.GreaterThanOrEqual(target)
+}
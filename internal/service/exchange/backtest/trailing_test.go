@@ -0,0 +1,136 @@
+package backtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTrailingStop_CallbackRate 测试按回调比例跟踪：止损价随最高价上移，收盘回落越过止损价时触发
+func TestTrailingStop_CallbackRate(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100},  // 开仓成交，当前价 100，止损价 95
+		{100, 110, 99, 108},  // 最高 110，止损价上移到 104.5
+		{108, 112, 105, 106}, // 最高 112，止损价 106.4，收盘 106 越过止损价
+		{106, 107, 105, 106},
+	})
+	ctx := context.Background()
+
+	tradingSvc := exchange.NewTradingService(svc, &PercisionProvider{})
+	resp, err := tradingSvc.SetStopOrders(ctx, exchange.SetStopOrdersReq{
+		TradingPair:  pair,
+		PositionSide: exchange.PositionSideLong,
+		TrailingStop: exchange.TrailingStop{CallbackRate: decimal.NewFromInt(5)},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.TrailingStopId.IsZero())
+
+	order, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: resp.TrailingStopId})
+	require.NoError(t, err)
+	assert.True(t, order.TriggerPrice.Equal(decimal.NewFromInt(95)), "trigger price: %s", order.TriggerPrice)
+
+	steps.next()
+	order, err = svc.GetOrder(ctx, exchange.GetOrderReq{Id: resp.TrailingStopId})
+	require.NoError(t, err)
+	assert.Equal(t, exchange.OrderStatusPending, order.Status)
+	assert.True(t, order.TriggerPrice.Equal(decimal.NewFromFloat(104.5)), "trigger price: %s", order.TriggerPrice)
+
+	steps.next()
+	order, err = svc.GetOrder(ctx, exchange.GetOrderReq{Id: resp.TrailingStopId})
+	require.NoError(t, err)
+	assert.Equal(t, exchange.OrderStatusFilled, order.Status)
+
+	histories, err := svc.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{TradingPairs: []exchange.TradingPair{pair}})
+	require.NoError(t, err)
+	require.Len(t, histories, 1)
+	// 开仓价 100，按止损价 106.4 成交
+	assert.True(t, histories[0].RealizedPnl.Equal(decimal.NewFromFloat(6.4)), "realized pnl: %s", histories[0].RealizedPnl)
+}
+
+// TestTrailingStop_ActivationAndDistance 测试激活价和回调距离：激活前不跟踪，跳空越过止损价时按开盘价成交
+func TestTrailingStop_ActivationAndDistance(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100},  // 开仓成交
+		{100, 105, 96, 104},  // 未到激活价 110
+		{104, 111, 103, 110}, // 激活，最高 111，止损价 108
+		{110, 115, 109, 114}, // 最高 115，止损价 112
+		{111, 112, 100, 101}, // 低开 111 越过止损价，按开盘价成交
+		{101, 102, 100, 101},
+	})
+	ctx := context.Background()
+
+	id, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+		TradingPair:      pair,
+		OrderType:        exchange.OrderTypeClose,
+		PositonSide:      exchange.PositionSideLong,
+		Quantity:         decimal.NewFromInt(1),
+		Conditional:      exchange.ConditionalTypeTrailingStopMarket,
+		CallbackDistance: decimal.NewFromInt(3),
+		ActivationPrice:  decimal.NewFromInt(110),
+		ReduceOnly:       true,
+	})
+	require.NoError(t, err)
+
+	expected := []struct {
+		status  exchange.OrderStatus
+		trigger float64
+	}{
+		{exchange.OrderStatusPending, 0},
+		{exchange.OrderStatusPending, 108},
+		{exchange.OrderStatusPending, 112},
+		{exchange.OrderStatusFilled, 112},
+	}
+	for i, want := range expected {
+		steps.next()
+		order, err := svc.GetOrder(ctx, exchange.GetOrderReq{Id: id})
+		require.NoError(t, err)
+		assert.Equal(t, want.status, order.Status, "kline %d", i)
+		assert.True(t, order.TriggerPrice.Equal(decimal.NewFromFloat(want.trigger)), "kline %d trigger price: %s", i, order.TriggerPrice)
+	}
+
+	histories, err := svc.GetHistoryPositions(ctx, exchange.GetHistoryPositionsReq{TradingPairs: []exchange.TradingPair{pair}})
+	require.NoError(t, err)
+	require.Len(t, histories, 1)
+	assert.True(t, histories[0].RealizedPnl.Equal(decimal.NewFromInt(11)), "realized pnl: %s", histories[0].RealizedPnl)
+}
+
+// TestTrailingStop_Validation 测试跟踪止损参数校验
+func TestTrailingStop_Validation(t *testing.T) {
+	svc, pair, _ := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100},
+		{100, 101, 99, 100},
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		rate     decimal.Decimal
+		distance decimal.Decimal
+	}{
+		{name: "缺少回调参数"},
+		{name: "比例和距离同时设置", rate: decimal.NewFromInt(1), distance: decimal.NewFromInt(1)},
+		{name: "比例超出范围", rate: decimal.NewFromInt(150)},
+		{name: "距离为负", distance: decimal.NewFromInt(-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.CreateOrder(ctx, exchange.CreateOrderReq{
+				TradingPair:      pair,
+				OrderType:        exchange.OrderTypeClose,
+				PositonSide:      exchange.PositionSideLong,
+				Quantity:         decimal.NewFromInt(1),
+				Conditional:      exchange.ConditionalTypeTrailingStopMarket,
+				CallbackRate:     tt.rate,
+				CallbackDistance: tt.distance,
+			})
+			assert.Error(t, err)
+		})
+	}
+}
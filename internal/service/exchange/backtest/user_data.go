@@ -0,0 +1,191 @@
+package backtest
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+)
+
+// userDataBufferSize 账户事件通道的缓冲大小
+// 事件在撮合时同步推送，缓冲满时丢弃新事件，不会阻塞撮合；订阅后需要持续消费
+const userDataBufferSize = 1024
+
+// marginCallRatio 保证金率（维持保证金 / 保证金余额）达到该值时推送追加保证金通知
+var marginCallRatio = decimal.NewFromFloat(0.8)
+
+func (svc *ExchangeService) UserDataService() exchange.UserDataService {
+	return svc
+}
+
+// SubscribeUserData 订阅账户事件，与币安 user data stream 的推送一致：
+// 订单状态变化、成交（含手续费和已实现盈亏）、持仓和余额变化、追加保证金通知
+// ctx 取消后关闭通道
+func (svc *ExchangeService) SubscribeUserData(ctx context.Context) (chan exchange.UserDataEvent, error) {
+	sub := &userDataSub{ctx: ctx, ch: make(chan exchange.UserDataEvent, userDataBufferSize)}
+
+	svc.userDataMu.Lock()
+	svc.userDataSubs = append(svc.userDataSubs, sub)
+	svc.userDataMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		svc.userDataMu.Lock()
+		defer svc.userDataMu.Unlock()
+		for i, s := range svc.userDataSubs {
+			if s == sub {
+				svc.userDataSubs = append(svc.userDataSubs[:i], svc.userDataSubs[i+1:]...)
+				break
+			}
+		}
+		close(sub.ch)
+	}()
+
+	return sub.ch, nil
+}
+
+type userDataSub struct {
+	ctx     context.Context
+	ch      chan exchange.UserDataEvent
+	dropped atomic.Int64 // 缓冲满时丢弃的事件数
+}
+
+// hasUserDataSubs 是否有订阅者，没有订阅者时不需要构造事件
+func (svc *ExchangeService) hasUserDataSubs() bool {
+	svc.userDataMu.RLock()
+	defer svc.userDataMu.RUnlock()
+	return len(svc.userDataSubs) > 0
+}
+
+// publishUserData 推送账户事件，调用时不能持有订单、持仓和账户的锁
+// 模拟盘撮合时持有 PaperExchangeService 的锁，所以不等待消费者：缓冲满时丢弃事件并打印日志
+func (svc *ExchangeService) publishUserData(events ...exchange.UserDataEvent) {
+	svc.userDataMu.RLock()
+	defer svc.userDataMu.RUnlock()
+
+	for _, sub := range svc.userDataSubs {
+		for _, event := range events {
+			select {
+			case sub.ch <- event:
+			default:
+				if sub.dropped.Add(1) == 1 {
+					log.Printf("[user data] subscriber is not consuming, buffer of %d is full, dropping events", userDataBufferSize)
+				}
+			}
+		}
+	}
+}
+
+// publishOrderUpdate 推送订单状态变化
+func (svc *ExchangeService) publishOrderUpdate(order *exchange.OrderInfo) {
+	if !svc.hasUserDataSubs() {
+		return
+	}
+	snapshot := svc.orderSnapshot(order)
+	svc.publishUserData(exchange.UserDataEvent{
+		Type:  exchange.UserDataEventTypeOrder,
+		Time:  svc.now(),
+		Order: &snapshot,
+	})
+}
+
+// publishFill 推送一次成交：订单更新、成交明细，以及随之变化的余额和持仓
+func (svc *ExchangeService) publishFill(order *exchange.OrderInfo, trade exchange.Trade, reason exchange.BalanceChangeReason) {
+	if !svc.hasUserDataSubs() {
+		return
+	}
+	now := svc.now()
+	snapshot := svc.orderSnapshot(order)
+	svc.publishUserData(
+		exchange.UserDataEvent{Type: exchange.UserDataEventTypeOrder, Time: now, Order: &snapshot},
+		exchange.UserDataEvent{Type: exchange.UserDataEventTypeTrade, Time: now, Order: &snapshot, Trade: &trade},
+		// 钱包余额变化 = 已实现盈亏 - 手续费，与持仓变更时记账一致
+		svc.balanceEvent(order.TradingPair.Quote, trade.RealizedPnl.Sub(trade.Fee), reason),
+		exchange.UserDataEvent{
+			Type:      exchange.UserDataEventTypePosition,
+			Time:      now,
+			Positions: []exchange.Position{svc.positionSnapshot(order.TradingPair, order.PositionSide)},
+			Reason:    reason,
+		},
+	)
+}
+
+// publishBalanceUpdate 推送余额变化（资金费等不经过订单的变化）
+func (svc *ExchangeService) publishBalanceUpdate(asset string, change decimal.Decimal, reason exchange.BalanceChangeReason) {
+	if !svc.hasUserDataSubs() {
+		return
+	}
+	svc.publishUserData(svc.balanceEvent(asset, change, reason))
+}
+
+// publishMarginCall 推送追加保证金通知
+func (svc *ExchangeService) publishMarginCall(positions []exchange.Position) {
+	if len(positions) == 0 || !svc.hasUserDataSubs() {
+		return
+	}
+	svc.publishUserData(exchange.UserDataEvent{
+		Type:      exchange.UserDataEventTypeMarginCall,
+		Time:      svc.now(),
+		Positions: positions,
+	})
+}
+
+func (svc *ExchangeService) orderSnapshot(order *exchange.OrderInfo) exchange.OrderInfo {
+	svc.orderMu.RLock()
+	defer svc.orderMu.RUnlock()
+	return *order
+}
+
+// positionSnapshot 持仓快照，仓位已经平掉时返回数量为 0 的持仓
+func (svc *ExchangeService) positionSnapshot(tradingPair exchange.TradingPair, side exchange.PositionSide) exchange.Position {
+	svc.positionMu.RLock()
+	defer svc.positionMu.RUnlock()
+	if position, ok := svc.positions[svc.getPositionKey(tradingPair, side)]; ok {
+		return *position
+	}
+	return exchange.Position{
+		TradingPair:  tradingPair,
+		PositionSide: side,
+		MarginType:   svc.getMarginType(tradingPair),
+		Quantity:     decimal.Zero,
+		UpdatedAt:    svc.now(),
+	}
+}
+
+// balanceEvent 余额变化事件，回测账户只有一种保证金资产
+func (svc *ExchangeService) balanceEvent(asset string, change decimal.Decimal, reason exchange.BalanceChangeReason) exchange.UserDataEvent {
+	svc.accountMu.RLock()
+	walletBalance := svc.account.TotalBalance
+	svc.accountMu.RUnlock()
+
+	return exchange.UserDataEvent{
+		Type: exchange.UserDataEventTypeBalance,
+		Time: svc.now(),
+		Balances: []exchange.BalanceChange{{
+			Asset:         asset,
+			WalletBalance: walletBalance,
+			Change:        change,
+		}},
+		Reason: reason,
+	}
+}
+
+// newTrade 根据成交构造成交明细，手续费与持仓变更时扣除的一致
+func newTrade(order *exchange.OrderInfo, exec execution, quantity, realizedPnl decimal.Decimal, now time.Time) exchange.Trade {
+	return exchange.Trade{
+		OrderId:      exchange.OrderId(order.Id),
+		TradingPair:  order.TradingPair,
+		OrderType:    order.OrderType,
+		PositionSide: order.PositionSide,
+		Price:        exec.price,
+		Quantity:     quantity,
+		Fee:          exec.price.Mul(quantity).Mul(exec.feeRate),
+		FeeAsset:     order.TradingPair.Quote,
+		RealizedPnl:  realizedPnl,
+		Maker:        exec.maker,
+		Time:         now,
+	}
+}
@@ -0,0 +1,137 @@
+package backtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nextUserData 读取下一条账户事件，超时视为失败
+func nextUserData(t *testing.T, ch chan exchange.UserDataEvent) exchange.UserDataEvent {
+	t.Helper()
+	select {
+	case event, ok := <-ch:
+		require.True(t, ok, "user data channel closed")
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for user data event")
+		return exchange.UserDataEvent{}
+	}
+}
+
+// TestUserData_Fill 测试挂单成交时依次推送订单、成交、余额和持仓事件
+func TestUserData_Fill(t *testing.T) {
+	svc, pair, steps := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100}, // 开仓 1 BTC
+		{100, 101, 94, 96},  // 挂单成交
+		{96, 97, 94, 95},
+	})
+	svc.SetFeeSchedule(DefaultFeeSchedule())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userData, err := svc.UserDataService().SubscribeUserData(ctx)
+	require.NoError(t, err)
+
+	id := createRestingBuy(t, svc, pair, 2)
+	event := nextUserData(t, userData)
+	assert.Equal(t, exchange.UserDataEventTypeOrder, event.Type)
+	assert.Equal(t, string(id), event.Order.Id)
+	assert.Equal(t, exchange.OrderStatusPending, event.Order.Status)
+
+	steps.next()
+	event = nextUserData(t, userData)
+	assert.Equal(t, exchange.UserDataEventTypeOrder, event.Type)
+	assert.Equal(t, exchange.OrderStatusFilled, event.Order.Status)
+
+	event = nextUserData(t, userData)
+	require.Equal(t, exchange.UserDataEventTypeTrade, event.Type)
+	trade := event.Trade
+	assert.Equal(t, id, trade.OrderId)
+	assert.True(t, trade.Price.Equal(decimal.NewFromInt(95)), "price: %s", trade.Price)
+	assert.True(t, trade.Quantity.Equal(decimal.NewFromInt(2)), "quantity: %s", trade.Quantity)
+	// 挂单费率 0.02%：95 * 2 * 0.0002
+	assert.True(t, trade.Fee.Equal(decimal.NewFromFloat(0.038)), "fee: %s", trade.Fee)
+	assert.Equal(t, "USDT", trade.FeeAsset)
+	assert.True(t, trade.Maker, "挂单成交是 maker")
+
+	event = nextUserData(t, userData)
+	require.Equal(t, exchange.UserDataEventTypeBalance, event.Type)
+	assert.Equal(t, exchange.BalanceChangeReasonOrder, event.Reason)
+	require.Len(t, event.Balances, 1)
+	account, err := svc.GetAccountInfo(context.Background())
+	require.NoError(t, err)
+	assert.True(t, event.Balances[0].WalletBalance.Equal(account.TotalBalance))
+	// 开仓没有已实现盈亏，余额变化就是扣掉的手续费
+	assert.True(t, event.Balances[0].Change.Equal(trade.Fee.Neg()), "change: %s", event.Balances[0].Change)
+
+	event = nextUserData(t, userData)
+	require.Equal(t, exchange.UserDataEventTypePosition, event.Type)
+	require.Len(t, event.Positions, 1)
+	assert.True(t, event.Positions[0].Quantity.Equal(decimal.NewFromInt(3)), "quantity: %s", event.Positions[0].Quantity)
+
+	// 取消订阅后通道关闭
+	cancel()
+	select {
+	case _, ok := <-userData:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("user data channel not closed")
+	}
+}
+
+// TestUserData_Cancel 测试撤单推送订单状态变化
+func TestUserData_Cancel(t *testing.T) {
+	svc, pair, _ := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100},
+		{100, 101, 96, 97},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userData, err := svc.UserDataService().SubscribeUserData(ctx)
+	require.NoError(t, err)
+
+	id := createRestingBuy(t, svc, pair, 1)
+	assert.Equal(t, exchange.OrderStatusPending, nextUserData(t, userData).Order.Status)
+
+	require.NoError(t, svc.CancelOrder(ctx, exchange.CancelOrderReq{Id: id, TradingPair: pair}))
+	event := nextUserData(t, userData)
+	assert.Equal(t, exchange.UserDataEventTypeOrder, event.Type)
+	assert.Equal(t, exchange.OrderStatusCancelled, event.Order.Status)
+}
+
+// TestUserData_BufferFull 测试订阅者不消费时撮合不会阻塞，缓冲满后丢弃新事件
+func TestUserData_BufferFull(t *testing.T) {
+	svc, pair, _ := setupConditionalTest(t, [][4]float64{
+		{100, 101, 99, 100},
+		{100, 102, 98, 100},
+		{100, 101, 96, 97},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	userData, err := svc.UserDataService().SubscribeUserData(ctx)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < userDataBufferSize+10; i++ {
+			svc.publishBalanceUpdate(pair.Quote, decimal.NewFromInt(1), exchange.BalanceChangeReasonFundingFee)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked on a full buffer")
+	}
+	assert.Len(t, userData, userDataBufferSize)
+}
@@ -59,12 +59,10 @@ func (s *BaseSuite) SetupSuite() {
 	s.accountSvc = binance.NewAccountService(s.client)
 	s.marketSvc = binance.NewMarketService(s.client)
 
-	// 使用通用的 TradingService
-	precisionProvider := binance.NewPrecisionProvider()
-	s.tradingSvc = exchange.NewTradingService(
-		binance.NewService(s.client),
-		precisionProvider,
-	)
+	// 使用通用的 TradingService，NewService 会加载交易对规则
+	exchangeSvc, err := binance.NewService(context.Background(), s.client)
+	s.Require().NoError(err, "加载交易对规则失败")
+	s.tradingSvc = exchangeSvc.TradingService()
 
 	// 设置测试交易对和上下文
 	s.testPair = exchange.TradingPair{Base: "XRP", Quote: "USDT"}
@@ -0,0 +1,259 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/shopspring/decimal"
+)
+
+// SubscribeKline 订阅已收盘的K线
+// 连接断开后按退避时间自动重连，重连后通过 REST 补齐断线期间缺失的K线，按开盘时间去重
+// 连接状态和错误通过 StreamStatus 通知，ctx 取消后关闭通道
+func (m *MarketService) SubscribeKline(ctx context.Context, tradingPair exchange.TradingPair, interval exchange.Interval) (chan exchange.Kline, error) {
+	stream := &klineStream{
+		m:           m,
+		tradingPair: tradingPair,
+		interval:    interval,
+		ch:          make(chan exchange.Kline, 10),
+	}
+
+	// 首次连接失败直接返回错误，之后的断线由 run 重连
+	conn, err := stream.connect(ctx)
+	if err != nil {
+		close(stream.ch)
+		return nil, err
+	}
+	stream.report(exchange.StreamStateConnected, nil, 0)
+
+	go stream.run(ctx, conn)
+	return stream.ch, nil
+}
+
+// klineStream 单个交易对和周期的K线订阅，只有 run 协程向 ch 发送
+type klineStream struct {
+	m           *MarketService
+	tradingPair exchange.TradingPair
+	interval    exchange.Interval
+	ch          chan exchange.Kline
+
+	lastOpenTime time.Time // 最后推送的K线开盘时间，用于去重和补齐
+}
+
+// klineConn 一次 websocket 连接，推送回调把K线写入 klines，由 run 协程统一处理
+type klineConn struct {
+	klines chan exchange.Kline
+	doneC  chan struct{}
+	stopC  chan struct{}
+}
+
+func (s *klineStream) connect(ctx context.Context) (*klineConn, error) {
+	conn := &klineConn{klines: make(chan exchange.Kline, 100)}
+
+	doneC, stopC, err := s.m.wsKlineServe(
+		s.tradingPair.ToString(),
+		s.interval.ToString(),
+		func(event *futures.WsKlineEvent) {
+			// 只处理已关闭的K线
+			if !event.Kline.IsFinal {
+				return
+			}
+			kline, err := convertWsKline(event.Kline)
+			if err != nil {
+				s.report(exchange.StreamStateError, err, 0)
+				return
+			}
+			select {
+			case conn.klines <- kline:
+			case <-ctx.Done():
+			}
+		},
+		func(err error) {
+			s.report(exchange.StreamStateError, err, 0)
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("subscribe kline %s %s failed: %w", s.tradingPair.ToString(), s.interval.ToString(), err)
+	}
+	conn.doneC = doneC
+	conn.stopC = stopC
+	return conn, nil
+}
+
+// run 消费推送直到 ctx 取消，断线后重连并补齐K线
+func (s *klineStream) run(ctx context.Context, conn *klineConn) {
+	defer close(s.ch)
+
+	for {
+		if !s.consume(ctx, conn) {
+			return
+		}
+		s.report(exchange.StreamStateDisconnected, nil, 0)
+
+		conn = s.reconnect(ctx)
+		if conn == nil {
+			return
+		}
+		backfilled, err := s.backfill(ctx)
+		if err != nil {
+			s.report(exchange.StreamStateError, err, backfilled)
+		}
+		s.report(exchange.StreamStateReconnected, nil, backfilled)
+	}
+}
+
+// consume 推送K线直到连接断开（返回 true）或 ctx 取消（返回 false）
+func (s *klineStream) consume(ctx context.Context, conn *klineConn) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			close(conn.stopC)
+			<-conn.doneC
+			return false
+		case kline := <-conn.klines:
+			if !s.emit(ctx, kline) {
+				return false
+			}
+		case <-conn.doneC:
+			// 连接断开前收到的K线仍然推送
+			for {
+				select {
+				case kline := <-conn.klines:
+					if !s.emit(ctx, kline) {
+						return false
+					}
+				default:
+					return true
+				}
+			}
+		}
+	}
+}
+
+// reconnect 按退避时间重连，ctx 取消时返回 nil
+func (s *klineStream) reconnect(ctx context.Context) *klineConn {
+	backoff := s.m.reconnectMin
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+
+		conn, err := s.connect(ctx)
+		if err == nil {
+			return conn
+		}
+		s.report(exchange.StreamStateError, err, 0)
+
+		backoff *= 2
+		if backoff > s.m.reconnectMax {
+			backoff = s.m.reconnectMax
+		}
+	}
+}
+
+// backfill 通过 REST 补齐最后推送的K线之后、已经收盘的K线
+// 新连接的推送在 consume 中处理，补齐期间先缓存在连接的通道里
+func (s *klineStream) backfill(ctx context.Context) (int, error) {
+	if s.lastOpenTime.IsZero() {
+		return 0, nil
+	}
+
+	count := 0
+	for {
+		now := time.Now()
+		klines, err := s.m.GetKlines(ctx, exchange.GetKlinesReq{
+			TradingPair: s.tradingPair,
+			Interval:    s.interval,
+			StartTime:   s.lastOpenTime.Add(s.interval.Duration()),
+			EndTime:     now,
+		})
+		if err != nil {
+			return count, fmt.Errorf("backfill kline %s %s failed: %w", s.tradingPair.ToString(), s.interval.ToString(), err)
+		}
+
+		emitted := 0
+		for _, kline := range klines {
+			// 还没收盘的K线等推送
+			if !kline.CloseTime.Before(now) {
+				break
+			}
+			if !kline.OpenTime.After(s.lastOpenTime) {
+				continue
+			}
+			if !s.emit(ctx, kline) {
+				return count, ctx.Err()
+			}
+			emitted++
+		}
+		count += emitted
+		// 单次请求有条数上限，没有新K线说明已经补齐
+		if emitted == 0 {
+			return count, nil
+		}
+	}
+}
+
+// emit 按开盘时间去重后推送，ctx 取消时返回 false
+func (s *klineStream) emit(ctx context.Context, kline exchange.Kline) bool {
+	if !kline.OpenTime.After(s.lastOpenTime) {
+		return true
+	}
+	select {
+	case s.ch <- kline:
+		s.lastOpenTime = kline.OpenTime
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// report 发送连接状态，状态通道满时丢弃
+func (s *klineStream) report(state exchange.StreamState, err error, backfilled int) {
+	status := exchange.StreamStatus{
+		TradingPair: s.tradingPair,
+		Interval:    s.interval,
+		State:       state,
+		Err:         err,
+		Backfilled:  backfilled,
+		Time:        time.Now(),
+	}
+	if err != nil {
+		log.Printf("[kline stream] %s %s %s: %v", s.tradingPair.ToString(), s.interval.ToString(), state, err)
+	} else {
+		log.Printf("[kline stream] %s %s %s", s.tradingPair.ToString(), s.interval.ToString(), state)
+	}
+
+	select {
+	case s.m.status <- status:
+	default:
+	}
+}
+
+// convertWsKline 转换推送中的K线
+func convertWsKline(k futures.WsKline) (exchange.Kline, error) {
+	fields := []string{k.Open, k.Close, k.High, k.Low, k.Volume, k.QuoteVolume}
+	values := make([]decimal.Decimal, len(fields))
+	for i, f := range fields {
+		v, err := decimal.NewFromString(f)
+		if err != nil {
+			return exchange.Kline{}, fmt.Errorf("parse kline field %q failed: %w", f, err)
+		}
+		values[i] = v
+	}
+	return exchange.Kline{
+		OpenTime:         time.UnixMilli(k.StartTime),
+		CloseTime:        time.UnixMilli(k.EndTime),
+		Open:             values[0],
+		Close:            values[1],
+		High:             values[2],
+		Low:              values[3],
+		Volume:           values[4],
+		QuoteAssetVolume: values[5],
+	}, nil
+}
@@ -0,0 +1,165 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKlineConn 本地模拟的一次 websocket 连接
+type fakeKlineConn struct {
+	handler    futures.WsKlineHandler
+	errHandler futures.ErrHandler
+	doneC      chan struct{}
+	once       sync.Once
+}
+
+func (c *fakeKlineConn) push(openTime time.Time, final bool) {
+	c.handler(&futures.WsKlineEvent{Kline: futures.WsKline{
+		StartTime:   openTime.UnixMilli(),
+		EndTime:     openTime.Add(time.Minute).UnixMilli() - 1,
+		Open:        "100",
+		Close:       "100",
+		High:        "100",
+		Low:         "100",
+		Volume:      "1",
+		QuoteVolume: "100",
+		IsFinal:     final,
+	}})
+}
+
+// disconnect 模拟服务端断开连接
+func (c *fakeKlineConn) disconnect() {
+	c.once.Do(func() { close(c.doneC) })
+}
+
+// fakeKlineServe 每次连接都通过 conns 交给测试控制
+func fakeKlineServe(conns chan *fakeKlineConn) wsKlineServeFunc {
+	return func(symbol, interval string, handler futures.WsKlineHandler, errHandler futures.ErrHandler) (chan struct{}, chan struct{}, error) {
+		conn := &fakeKlineConn{handler: handler, errHandler: errHandler, doneC: make(chan struct{})}
+		stopC := make(chan struct{})
+		go func() {
+			<-stopC
+			conn.disconnect()
+		}()
+		conns <- conn
+		return conn.doneC, stopC, nil
+	}
+}
+
+// restKline 币安 REST K线格式
+func restKline(openTime time.Time) []any {
+	return []any{
+		openTime.UnixMilli(), "100", "100", "100", "100", "1",
+		openTime.Add(time.Minute).UnixMilli() - 1, "100", 1, "0", "0", "0",
+	}
+}
+
+func nextKline(t *testing.T, ch chan exchange.Kline) exchange.Kline {
+	t.Helper()
+	select {
+	case kline, ok := <-ch:
+		require.True(t, ok, "kline channel closed")
+		return kline
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for kline")
+		return exchange.Kline{}
+	}
+}
+
+func nextStatus(t *testing.T, m *MarketService) exchange.StreamStatus {
+	t.Helper()
+	select {
+	case status := <-m.StreamStatus():
+		return status
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for stream status")
+		return exchange.StreamStatus{}
+	}
+}
+
+// TestKlineStream_ReconnectAndBackfill 测试断线重连后补齐缺失的K线并去重
+func TestKlineStream_ReconnectAndBackfill(t *testing.T) {
+	t0 := time.Now().Truncate(time.Minute).Add(-10 * time.Minute)
+
+	// REST 返回重复的 t0、缺失的 t0+1 ~ t0+3，以及还没收盘的当前K线
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		klines := [][]any{restKline(t0)}
+		for i := 1; i <= 3; i++ {
+			klines = append(klines, restKline(t0.Add(time.Duration(i)*time.Minute)))
+		}
+		klines = append(klines, restKline(time.Now().Truncate(time.Minute)))
+		_ = json.NewEncoder(w).Encode(klines)
+	}))
+	defer server.Close()
+
+	cli := futures.NewClient("", "")
+	cli.BaseURL = server.URL
+	m := NewMarketService(cli)
+	conns := make(chan *fakeKlineConn, 2)
+	m.wsKlineServe = fakeKlineServe(conns)
+	m.SetReconnectBackoff(10*time.Millisecond, 50*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pair := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	ch, err := m.SubscribeKline(ctx, pair, exchange.Interval1m)
+	require.NoError(t, err)
+	assert.Equal(t, exchange.StreamStateConnected, nextStatus(t, m).State)
+
+	conn := <-conns
+	conn.push(t0, false) // 未收盘的K线不推送
+	conn.push(t0, true)
+	assert.Equal(t, t0, nextKline(t, ch).OpenTime)
+
+	// 连接错误只通知，不退出
+	conn.errHandler(errors.New("read timeout"))
+	status := nextStatus(t, m)
+	assert.Equal(t, exchange.StreamStateError, status.State)
+	assert.Error(t, status.Err)
+
+	conn.disconnect()
+	assert.Equal(t, exchange.StreamStateDisconnected, nextStatus(t, m).State)
+
+	conn = <-conns
+	for i := 1; i <= 3; i++ {
+		assert.Equal(t, t0.Add(time.Duration(i)*time.Minute), nextKline(t, ch).OpenTime, "backfill %d", i)
+	}
+	status = nextStatus(t, m)
+	assert.Equal(t, exchange.StreamStateReconnected, status.State)
+	assert.Equal(t, 3, status.Backfilled)
+
+	// 新连接推送的重复K线被丢弃
+	conn.push(t0.Add(3*time.Minute), true)
+	conn.push(t0.Add(4*time.Minute), true)
+	assert.Equal(t, t0.Add(4*time.Minute), nextKline(t, ch).OpenTime)
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("kline channel not closed")
+	}
+}
+
+// TestKlineStream_ConnectFailed 测试首次连接失败直接返回错误
+func TestKlineStream_ConnectFailed(t *testing.T) {
+	m := NewMarketService(futures.NewClient("", ""))
+	m.wsKlineServe = func(symbol, interval string, handler futures.WsKlineHandler, errHandler futures.ErrHandler) (chan struct{}, chan struct{}, error) {
+		return nil, nil, errors.New("dial failed")
+	}
+
+	_, err := m.SubscribeKline(context.Background(), exchange.TradingPair{Base: "BTC", Quote: "USDT"}, exchange.Interval1m)
+	assert.Error(t, err)
+}
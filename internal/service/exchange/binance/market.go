@@ -2,7 +2,7 @@ package binance
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"time"
 
 	"github.com/KNICEX/trading-agent/internal/service/exchange"
@@ -10,15 +10,43 @@ import (
 	"github.com/shopspring/decimal"
 )
 
-var _ exchange.MarketService = (*MarketService)(nil)
+var (
+	_ exchange.MarketService        = (*MarketService)(nil)
+	_ exchange.StreamStatusReporter = (*MarketService)(nil)
+)
+
+// wsKlineServeFunc 与 futures.WsKlineServe 签名一致，测试时替换为本地推送
+type wsKlineServeFunc func(symbol, interval string, handler futures.WsKlineHandler, errHandler futures.ErrHandler) (doneC, stopC chan struct{}, err error)
 
 type MarketService struct {
 	cli *futures.Client
+
+	wsKlineServe wsKlineServeFunc
+	reconnectMin time.Duration // 重连等待时间，每次失败翻倍
+	reconnectMax time.Duration
+	status       chan exchange.StreamStatus
 }
 
 // NewMarketService 创建市场数据服务
 func NewMarketService(cli *futures.Client) *MarketService {
-	return &MarketService{cli: cli}
+	return &MarketService{
+		cli:          cli,
+		wsKlineServe: futures.WsKlineServe,
+		reconnectMin: time.Second,
+		reconnectMax: time.Minute,
+		status:       make(chan exchange.StreamStatus, 100),
+	}
+}
+
+// SetReconnectBackoff 设置K线推送断线重连的等待时间，从 min 开始每次失败翻倍，最长 max
+func (m *MarketService) SetReconnectBackoff(min, max time.Duration) {
+	m.reconnectMin = min
+	m.reconnectMax = max
+}
+
+// StreamStatus 所有K线订阅的连接状态，没有消费时丢弃最新的状态
+func (m *MarketService) StreamStatus() <-chan exchange.StreamStatus {
+	return m.status
 }
 
 func (m *MarketService) convertKlines(klines []*futures.Kline) []exchange.Kline {
@@ -79,93 +107,47 @@ func (m *MarketService) GetKlines(ctx context.Context, req exchange.GetKlinesReq
 	return m.convertKlines(res), nil
 }
 
-func (m *MarketService) SubscribeKline(ctx context.Context, tradingPair exchange.TradingPair, interval exchange.Interval) (chan exchange.Kline, error) {
-	ch := make(chan exchange.Kline, 10)
-
-	// 启动WebSocket订阅
-	doneC, stopC, err := futures.WsKlineServe(
-		tradingPair.ToString(),
-		interval.ToString(),
-		func(event *futures.WsKlineEvent) {
-			// 只处理已关闭的K线
-			if !event.Kline.IsFinal {
-				return
-			}
-
-			// 转换K线数据
-			klineOpen, err := decimal.NewFromString(event.Kline.Open)
-			if err != nil {
-				return
-			}
-			klineClose, err := decimal.NewFromString(event.Kline.Close)
-			if err != nil {
-				return
-			}
-			klineHigh, err := decimal.NewFromString(event.Kline.High)
-			if err != nil {
-				return
-			}
-			klineLow, err := decimal.NewFromString(event.Kline.Low)
-			if err != nil {
-				return
-			}
-			klineVolume, err := decimal.NewFromString(event.Kline.Volume)
-			if err != nil {
-				return
-			}
-			klineQuoteAssetVolume, err := decimal.NewFromString(event.Kline.QuoteVolume)
-			if err != nil {
-				return
-			}
-
-			kline := exchange.Kline{
-				OpenTime:         time.UnixMilli(event.Kline.StartTime),
-				CloseTime:        time.UnixMilli(event.Kline.EndTime),
-				Open:             klineOpen,
-				Close:            klineClose,
-				High:             klineHigh,
-				Low:              klineLow,
-				Volume:           klineVolume,
-				QuoteAssetVolume: klineQuoteAssetVolume,
-			}
-
-			// 发送K线数据到channel
-			select {
-			case ch <- kline:
-			case <-ctx.Done():
-				return
-			}
-		},
-		func(err error) {
-			log.Fatalf("ws kline error: %v", err)
-		},
-	)
-
+func (m *MarketService) Ticker(ctx context.Context, tradingPair exchange.TradingPair) (decimal.Decimal, error) {
+	prices, err := m.cli.NewListPricesService().Symbol(tradingPair.ToString()).Do(ctx)
 	if err != nil {
-		close(ch)
-		return nil, err
+		return decimal.Zero, err
 	}
+	return decimal.NewFromString(prices[0].Price)
+}
+
+// GetFundingRates 获取历史资金费率，按时间分页拉取 [startTime, endTime) 内的全部记录
+func (m *MarketService) GetFundingRates(ctx context.Context, tradingPair exchange.TradingPair, startTime, endTime time.Time) ([]exchange.FundingRate, error) {
+	const limit = 1000 // 币安单次最多返回 1000 条
 
-	// 启动协程处理context取消和清理
-	go func() {
-		select {
-		case <-ctx.Done():
-			// context被取消，关闭WebSocket
-			close(stopC)
-			close(ch)
-		case <-doneC:
-			// WebSocket连接断开
-			close(ch)
+	var rates []exchange.FundingRate
+	cursor := startTime
+	for cursor.Before(endTime) {
+		res, err := m.cli.NewFundingRateService().
+			Symbol(tradingPair.ToString()).
+			StartTime(cursor.UnixMilli()).
+			EndTime(endTime.UnixMilli() - 1).
+			Limit(limit).
+			Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get funding rates for %s failed: %w", tradingPair.ToString(), err)
 		}
-	}()
 
-	return ch, nil
-}
+		for _, r := range res {
+			rate, err := decimal.NewFromString(r.FundingRate)
+			if err != nil {
+				return nil, fmt.Errorf("parse funding rate %q failed: %w", r.FundingRate, err)
+			}
+			rates = append(rates, exchange.FundingRate{
+				TradingPair: tradingPair,
+				Rate:        rate,
+				FundingTime: time.UnixMilli(r.FundingTime),
+			})
+		}
 
-func (m *MarketService) Ticker(ctx context.Context, tradingPair exchange.TradingPair) (decimal.Decimal, error) {
-	prices, err := m.cli.NewListPricesService().Symbol(tradingPair.ToString()).Do(ctx)
-	if err != nil {
-		return decimal.Zero, err
+		if len(res) < limit {
+			break
+		}
+		cursor = time.UnixMilli(res[len(res)-1].FundingTime + 1)
 	}
-	return decimal.NewFromString(prices[0].Price)
+	return rates, nil
 }
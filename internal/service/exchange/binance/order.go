@@ -2,11 +2,15 @@ package binance
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/adshao/go-binance/v2/common"
 	"github.com/adshao/go-binance/v2/futures"
 	"github.com/samber/lo"
 	"github.com/shopspring/decimal"
@@ -14,6 +18,12 @@ import (
 
 var _ exchange.OrderService = (*OrderService)(nil)
 
+// orderGroupClientIdPrefix 订单组（OCO）订单的客户端订单号前缀
+// 币安合约不支持 OCO，订单组 ID 编码在客户端订单号里：oco_<groupId>_<seq>，重启后仍然可以从订单还原分组
+const orderGroupClientIdPrefix = "oco_"
+
+var clientOrderSeq atomic.Int64
+
 type OrderService struct {
 	cli *futures.Client
 }
@@ -24,8 +34,51 @@ func NewOrderService(cli *futures.Client) *OrderService {
 }
 
 func (o *OrderService) CreateOrder(ctx context.Context, req exchange.CreateOrderReq) (exchange.OrderId, error) {
+	service, err := o.buildCreateOrderService(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	order, err := service.Do(ctx, createOrderOptions(req)...)
+	if err != nil {
+		return "", fmt.Errorf("create order failed: %w", rejectedError(err))
+	}
+
+	return exchange.OrderId(strconv.FormatInt(order.OrderID, 10)), nil
+}
+
+// timeInForce 将接口层的有效方式转换为币安的有效方式，为空时为 GTC
+func timeInForce(tif exchange.TimeInForce) futures.TimeInForceType {
+	if tif == "" {
+		return futures.TimeInForceTypeGTC
+	}
+	return futures.TimeInForceType(tif)
+}
+
+// createOrderOptions 下单请求的额外参数
+// go-binance 的下单服务没有 goodTillDate，GTD 订单通过额外的表单参数传递
+func createOrderOptions(req exchange.CreateOrderReq) []futures.RequestOption {
+	if req.TimeInForce != exchange.TimeInForceGTD {
+		return nil
+	}
+	return []futures.RequestOption{
+		futures.WithExtraForm(map[string]any{"goodTillDate": req.GoodTillDate.UnixMilli()}),
+	}
+}
+
+// rejectedError 将币安 API 错误转换为 *exchange.OrderRejectedError，其余错误原样返回
+func rejectedError(err error) error {
+	var apiErr *common.APIError
+	if errors.As(err, &apiErr) && apiErr.IsValid() {
+		return &exchange.OrderRejectedError{Code: apiErr.Code, Reason: apiErr.Message}
+	}
+	return err
+}
+
+// buildCreateOrderService 将接口层的下单请求转换为币安下单请求
+func (o *OrderService) buildCreateOrderService(ctx context.Context, req exchange.CreateOrderReq) (*futures.CreateOrderService, error) {
 	// 将接口层的 OrderType 转换为币安的 OrderType
-	binanceType := o.binanceOrderType(req.OrderType, req.Price)
+	binanceType := o.binanceOrderType(req.OrderType, req.Price, req.Conditional)
 
 	// 根据 OrderType 和 PositionSide 自动计算 Side
 	side := o.calculateOrderSide(req.OrderType, req.PositonSide)
@@ -34,21 +87,99 @@ func (o *OrderService) CreateOrder(ctx context.Context, req exchange.CreateOrder
 		Symbol(req.TradingPair.ToString()).
 		Side(side).                                             // 自动计算的 BUY / SELL
 		Type(binanceType).                                      // 币安的订单类型
-		Quantity(req.Quantity.String()).                        // 下单数量
 		PositionSide(futures.PositionSideType(req.PositonSide)) // LONG / SHORT
 
 	// 限价单需要设置价格和有效期
+	if err := req.ValidateTimeInForce(); err != nil {
+		return nil, err
+	}
 	if binanceType == futures.OrderTypeLimit {
 		service = service.Price(req.Price.String())
-		service = service.TimeInForce(futures.TimeInForceTypeGTC)
+		service = service.TimeInForce(timeInForce(req.TimeInForce))
 	}
 
-	order, err := service.Do(ctx)
-	if err != nil {
-		return "", fmt.Errorf("create order failed: %w", err)
+	if req.Conditional == exchange.ConditionalTypeTrailingStopMarket {
+		callbackRate, err := o.callbackRate(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		service = service.CallbackRate(callbackRate.String())
+		if !req.ActivationPrice.IsZero() {
+			service = service.ActivationPrice(req.ActivationPrice.String())
+		}
+	} else if req.Conditional.IsConditional() {
+		if req.TriggerPrice.IsZero() {
+			return nil, fmt.Errorf("trigger price is required for %s order", req.Conditional)
+		}
+		service = service.StopPrice(req.TriggerPrice.String())
 	}
 
-	return exchange.OrderId(strconv.FormatInt(order.OrderID, 10)), nil
+	if req.GroupId != "" {
+		service = service.NewClientOrderID(groupClientOrderId(req.GroupId))
+	}
+
+	// 双向持仓模式下，平仓单本身就是只减仓，币安不允许再传 reduceOnly，所以 ReduceOnly 不需要映射
+	if req.ClosePosition {
+		if !req.Conditional.IsConditional() || req.OrderType != exchange.OrderTypeClose {
+			return nil, fmt.Errorf("close position is only supported by conditional close orders")
+		}
+		// closePosition=true 时不能传数量，触发后平掉该方向全部仓位
+		service = service.ClosePosition(true)
+	} else {
+		service = service.Quantity(req.Quantity.String()) // 下单数量
+	}
+
+	return service, nil
+}
+
+// callbackRate 跟踪止损的回调比例
+// 币安只支持回调比例（最小 0.1，步长 0.1），回调距离按激活价（未设置时按当前价）换算
+func (o *OrderService) callbackRate(ctx context.Context, req exchange.CreateOrderReq) (decimal.Decimal, error) {
+	if !req.CallbackRate.IsZero() {
+		return req.CallbackRate, nil
+	}
+	if !req.CallbackDistance.IsPositive() {
+		return decimal.Zero, fmt.Errorf("callback rate or callback distance is required for %s order", req.Conditional)
+	}
+
+	refPrice := req.ActivationPrice
+	if refPrice.IsZero() {
+		prices, err := o.cli.NewListPricesService().Symbol(req.TradingPair.ToString()).Do(ctx)
+		if err != nil {
+			return decimal.Zero, fmt.Errorf("get price for callback distance failed: %w", err)
+		}
+		if len(prices) == 0 {
+			return decimal.Zero, fmt.Errorf("no price for %s", req.TradingPair.ToString())
+		}
+		refPrice, err = decimal.NewFromString(prices[0].Price)
+		if err != nil {
+			return decimal.Zero, fmt.Errorf("invalid price %q: %w", prices[0].Price, err)
+		}
+	}
+
+	rate := req.CallbackDistance.Div(refPrice).Mul(decimal.NewFromInt(100)).Round(1)
+	if minRate := decimal.NewFromFloat(0.1); rate.LessThan(minRate) {
+		rate = minRate
+	}
+	return rate, nil
+}
+
+// groupClientOrderId 生成订单组订单的客户端订单号，同组订单的客户端订单号也必须唯一
+func groupClientOrderId(groupId string) string {
+	return orderGroupClientIdPrefix + groupId + "_" + strconv.FormatInt(clientOrderSeq.Add(1), 36)
+}
+
+// orderGroupId 从客户端订单号解析订单组 ID，不是订单组订单时返回空
+func orderGroupId(clientOrderId string) string {
+	rest, ok := strings.CutPrefix(clientOrderId, orderGroupClientIdPrefix)
+	if !ok {
+		return ""
+	}
+	idx := strings.LastIndex(rest, "_")
+	if idx <= 0 {
+		return ""
+	}
+	return rest[:idx]
 }
 
 // calculateOrderSide 根据 OrderType 和 PositionSide 自动计算 Side
@@ -74,8 +205,18 @@ func (o *OrderService) calculateOrderSide(orderType exchange.OrderType, position
 }
 
 // binanceOrderType 将接口层的 OrderType 转换为币安的 OrderType
-// 根据 orderType（开仓/平仓）和 price（是否为0）判断具体的币安订单类型
-func (o *OrderService) binanceOrderType(orderType exchange.OrderType, price decimal.Decimal) futures.OrderType {
+// 条件单直接映射为 STOP_MARKET / TAKE_PROFIT_MARKET / TRAILING_STOP_MARKET
+// 普通订单根据 price（是否为0）判断市价还是限价
+func (o *OrderService) binanceOrderType(orderType exchange.OrderType, price decimal.Decimal, conditional exchange.ConditionalType) futures.OrderType {
+	switch conditional {
+	case exchange.ConditionalTypeStopMarket:
+		return futures.OrderTypeStopMarket
+	case exchange.ConditionalTypeTakeProfitMarket:
+		return futures.OrderTypeTakeProfitMarket
+	case exchange.ConditionalTypeTrailingStopMarket:
+		return futures.OrderTypeTrailingStopMarket
+	}
+
 	// 根据是否有价格判断市价还是限价
 	isMarket := price.IsZero()
 
@@ -101,25 +242,17 @@ func (o *OrderService) binanceOrderType(orderType exchange.OrderType, price deci
 }
 
 func (o *OrderService) CreateOrders(ctx context.Context, req []exchange.CreateOrderReq) ([]exchange.OrderId, error) {
+	// 批量下单的参数在一个 JSON 里，无法附加 goodTillDate，包含 GTD 订单时逐个下单
+	if lo.SomeBy(req, func(r exchange.CreateOrderReq) bool { return r.TimeInForce == exchange.TimeInForceGTD }) {
+		return o.createOrdersOneByOne(ctx, req)
+	}
+
 	var orderList []*futures.CreateOrderService
 	for _, orderReq := range req {
-		// 自动计算 Side 和 BinanceOrderType
-		side := o.calculateOrderSide(orderReq.OrderType, orderReq.PositonSide)
-		binanceType := o.binanceOrderType(orderReq.OrderType, orderReq.Price)
-
-		service := o.cli.NewCreateOrderService().
-			Symbol(orderReq.TradingPair.ToString()).
-			Side(futures.SideType(side)).                                // 自动计算的 BUY / SELL
-			Type(binanceType).                                           // 转换后的币安订单类型
-			Quantity(orderReq.Quantity.String()).                        // 下单数量
-			PositionSide(futures.PositionSideType(orderReq.PositonSide)) // LONG / SHORT
-
-		// 限价单需要设置价格
-		if binanceType == futures.OrderTypeLimit {
-			service = service.Price(orderReq.Price.String())
-			service = service.TimeInForce(futures.TimeInForceTypeGTC)
+		service, err := o.buildCreateOrderService(ctx, orderReq)
+		if err != nil {
+			return nil, err
 		}
-
 		orderList = append(orderList, service)
 	}
 
@@ -127,16 +260,42 @@ func (o *OrderService) CreateOrders(ctx context.Context, req []exchange.CreateOr
 		OrderList(orderList). // 挂单时效
 		Do(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("create order failed: %w", err)
+		return nil, fmt.Errorf("create order failed: %w", rejectedError(err))
 	}
 	var orderIds []exchange.OrderId
 	for _, order := range orders.Orders {
 		orderIds = append(orderIds, exchange.OrderId(strconv.FormatInt(order.OrderID, 10)))
 	}
-	return orderIds, nil
+	// 批量下单时单个订单被拒绝不影响其它订单，返回已成功的订单和被拒绝的原因
+	var errs []error
+	for i, orderErr := range orders.Errors {
+		if orderErr != nil {
+			errs = append(errs, fmt.Errorf("create order %d failed: %w", i, rejectedError(orderErr)))
+		}
+	}
+	return orderIds, errors.Join(errs...)
+}
+
+// createOrdersOneByOne 逐个下单，与批量下单一样返回已成功的订单和失败的原因
+func (o *OrderService) createOrdersOneByOne(ctx context.Context, req []exchange.CreateOrderReq) ([]exchange.OrderId, error) {
+	var orderIds []exchange.OrderId
+	var errs []error
+	for i, orderReq := range req {
+		id, err := o.CreateOrder(ctx, orderReq)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("create order %d failed: %w", i, err))
+			continue
+		}
+		orderIds = append(orderIds, id)
+	}
+	return orderIds, errors.Join(errs...)
 }
 
 func (o *OrderService) ModifyOrder(ctx context.Context, req exchange.ModifyOrderReq) error {
+	req, err := o.completeModifyReq(ctx, req)
+	if err != nil {
+		return err
+	}
 	side := o.calculateOrderSide(req.OrderType, req.PositionSide)
 	service := o.cli.NewModifyOrderService().
 		Symbol(req.TradingPair.ToString()).
@@ -151,7 +310,7 @@ func (o *OrderService) ModifyOrder(ctx context.Context, req exchange.ModifyOrder
 		service = service.OrderID(req.Id.ToInt64())
 	}
 
-	_, err := service.Do(ctx)
+	_, err = service.Do(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to modify order: %w", err)
 	}
@@ -159,9 +318,37 @@ func (o *OrderService) ModifyOrder(ctx context.Context, req exchange.ModifyOrder
 	return nil
 }
 
+// completeModifyReq 币安改单必须同时传数量和价格，没有指定的字段使用订单当前的值
+func (o *OrderService) completeModifyReq(ctx context.Context, req exchange.ModifyOrderReq) (exchange.ModifyOrderReq, error) {
+	if !req.Price.IsZero() && !req.Quantity.IsZero() && req.OrderType != "" && req.PositionSide != "" {
+		return req, nil
+	}
+	order, err := o.GetOrder(ctx, exchange.GetOrderReq{Id: req.Id, TradingPair: req.TradingPair})
+	if err != nil {
+		return req, err
+	}
+	if req.Price.IsZero() {
+		req.Price = order.Price
+	}
+	if req.Quantity.IsZero() {
+		req.Quantity = order.Quantity
+	}
+	if req.OrderType == "" {
+		req.OrderType = order.OrderType
+	}
+	if req.PositionSide == "" {
+		req.PositionSide = order.PositionSide
+	}
+	return req, nil
+}
+
 func (o *OrderService) ModifyOrders(ctx context.Context, req []exchange.ModifyOrderReq) error {
 	var orderList []*futures.ModifyOrder
 	for _, orderReq := range req {
+		orderReq, err := o.completeModifyReq(ctx, orderReq)
+		if err != nil {
+			return err
+		}
 		side := o.calculateOrderSide(orderReq.OrderType, orderReq.PositionSide)
 		orderList = append(orderList, (&futures.ModifyOrder{}).
 			Symbol(orderReq.TradingPair.ToString()).
@@ -189,86 +376,111 @@ func (o *OrderService) GetOrder(ctx context.Context, req exchange.GetOrderReq) (
 		return exchange.OrderInfo{}, fmt.Errorf("get order failed: %w", err)
 	}
 
-	if order.Status != futures.OrderStatusTypeNew && order.Status != futures.OrderStatusTypePartiallyFilled {
-		// 只需要返回未成交或部分成交的订单
-		return exchange.OrderInfo{}, fmt.Errorf("order is not active: %s", order.Status)
-	}
+	return o.convertOrder(order), nil
+}
 
+// convertOrder 将币安订单转换为接口层订单
+func (o *OrderService) convertOrder(order *futures.Order) exchange.OrderInfo {
 	price, _ := decimal.NewFromString(order.Price)
 	stopPrice, _ := decimal.NewFromString(order.StopPrice)
+	activatePrice, _ := decimal.NewFromString(order.ActivatePrice)
+	priceRate, _ := decimal.NewFromString(order.PriceRate)
 	amount, _ := decimal.NewFromString(order.OrigQuantity)
 	executedQty, _ := decimal.NewFromString(order.ExecutedQuantity)
+	avgPrice, _ := decimal.NewFromString(order.AvgPrice)
+	base, quote := exchange.SplitSymbol(order.Symbol)
 	orderType, positionSide := o.getOrderType(order)
 
-	if orderType == exchange.OrderTypeClose {
-		price = stopPrice
-	}
-
 	return exchange.OrderInfo{
 		Id:               strconv.FormatInt(order.OrderID, 10),
-		TradingPair:      req.TradingPair,
+		TradingPair:      exchange.TradingPair{Base: base, Quote: quote},
 		OrderType:        orderType,
 		PositionSide:     positionSide,
 		Price:            price,
 		Quantity:         amount,
 		ExecutedQuantity: executedQty,
-		Status:           exchange.OrderStatus(order.Status),
+		AvgPrice:         avgPrice,
+		Status:           o.orderStatus(order.Status),
+		Conditional:      o.conditionalType(order.OrigType),
+		TriggerPrice:     stopPrice,
+		ReduceOnly:       order.ReduceOnly,
+		ClosePosition:    order.ClosePosition,
+		CallbackRate:     priceRate,
+		ActivationPrice:  activatePrice,
+		GroupId:          orderGroupId(order.ClientOrderID),
+		TimeInForce:      exchange.TimeInForce(order.TimeInForce),
+		GoodTillDate:     goodTillDate(order.GoodTillDate),
 		CreatedAt:        time.UnixMilli(order.Time),
 		UpdatedAt:        time.UnixMilli(order.UpdateTime),
-	}, nil
+	}
+}
+
+// goodTillDate 非 GTD 订单的 goodTillDate 为 0
+func goodTillDate(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
 }
 
+// getOrderType 根据买卖方向和持仓方向推导开平仓类型
+// BUY + LONG / SELL + SHORT 为开仓，其余为平仓
 func (o *OrderService) getOrderType(order *futures.Order) (exchange.OrderType, exchange.PositionSide) {
-	if order.OrigType == futures.OrderTypeStop || order.OrigType == futures.OrderTypeTakeProfit {
-		return exchange.OrderTypeClose, exchange.PositionSide(order.PositionSide)
+	positionSide := exchange.PositionSide(order.PositionSide)
+	if (order.Side == futures.SideTypeBuy && positionSide == exchange.PositionSideLong) ||
+		(order.Side == futures.SideTypeSell && positionSide == exchange.PositionSideShort) {
+		return exchange.OrderTypeOpen, positionSide
 	}
-	return exchange.OrderTypeOpen, exchange.PositionSide(order.PositionSide)
+	return exchange.OrderTypeClose, positionSide
+}
+
+// conditionalType 将币安订单类型转换为条件单类型
+func (o *OrderService) conditionalType(orderType futures.OrderType) exchange.ConditionalType {
+	switch orderType {
+	case futures.OrderTypeStopMarket:
+		return exchange.ConditionalTypeStopMarket
+	case futures.OrderTypeTakeProfitMarket:
+		return exchange.ConditionalTypeTakeProfitMarket
+	case futures.OrderTypeTrailingStopMarket:
+		return exchange.ConditionalTypeTrailingStopMarket
+	}
+	return ""
 }
 
 func (o *OrderService) GetOrders(ctx context.Context, req exchange.GetOrdersReq) ([]exchange.OrderInfo, error) {
 	svc := o.cli.NewListOrdersService()
-	var binanceOrders []*futures.Order
-	var err error
 	// symbol 可选 不传时返回所有
-	if req.TradingPair.IsZero() {
-		binanceOrders, err = svc.Do(ctx)
-	} else {
-		binanceOrders, err = svc.Symbol(req.TradingPair.ToString()).Do(ctx)
+	if !req.TradingPair.IsZero() {
+		svc = svc.Symbol(req.TradingPair.ToString())
+	}
+	if req.IsHistoryQuery() {
+		if !req.StartTime.IsZero() {
+			svc = svc.StartTime(req.StartTime.UnixMilli())
+		}
+		if !req.EndTime.IsZero() {
+			svc = svc.EndTime(req.EndTime.UnixMilli())
+		}
+		// 按状态过滤在本地进行，只查询全部状态时才能把条数限制交给交易所
+		if req.Limit > 0 && len(req.Statuses) == 0 {
+			svc = svc.Limit(req.Limit)
+		}
 	}
 
+	binanceOrders, err := svc.Do(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	results := make([]exchange.OrderInfo, 0, len(binanceOrders))
 	for _, oinfo := range binanceOrders {
-		if oinfo.Status != futures.OrderStatusTypeNew && oinfo.Status != futures.OrderStatusTypePartiallyFilled {
-			// 只需要返回未成交或部分成交的订单
+		order := o.convertOrder(oinfo)
+		if !req.Match(order) {
 			continue
 		}
-		price, _ := decimal.NewFromString(oinfo.Price)
-		stopPrice, _ := decimal.NewFromString(oinfo.StopPrice)
-		amount, _ := decimal.NewFromString(oinfo.OrigQuantity)
-		executedQty, _ := decimal.NewFromString(oinfo.ExecutedQuantity)
-		base, quote := exchange.SplitSymbol(oinfo.Symbol)
-		orderType, positionSide := o.getOrderType(oinfo)
-
-		if orderType == exchange.OrderTypeClose {
-			price = stopPrice
-		}
-
-		results = append(results, exchange.OrderInfo{
-			Id:               strconv.FormatInt(oinfo.OrderID, 10),
-			TradingPair:      exchange.TradingPair{Base: base, Quote: quote},
-			OrderType:        orderType,
-			PositionSide:     positionSide,
-			Price:            price,
-			Quantity:         amount,
-			ExecutedQuantity: executedQty,
-			Status:           o.orderStatus(oinfo.Status),
-			CreatedAt:        time.UnixMilli(oinfo.Time),
-			UpdatedAt:        time.UnixMilli(oinfo.UpdateTime),
-		})
+		results = append(results, order)
+	}
+	if req.Limit > 0 && len(results) > req.Limit {
+		results = results[len(results)-req.Limit:]
 	}
 	return results, nil
 }
@@ -308,6 +520,12 @@ func (o *OrderService) orderStatus(status futures.OrderStatusType) exchange.Orde
 		return exchange.OrderStatusFilled
 	case futures.OrderStatusTypePartiallyFilled:
 		return exchange.OrderStatusPartiallyFilled
+	case futures.OrderStatusTypeCanceled:
+		return exchange.OrderStatusCancelled
+	case futures.OrderStatusTypeRejected:
+		return exchange.OrderStatusRejected
+	case futures.OrderStatusTypeExpired, futures.OrderStatusType("EXPIRED_IN_MATCH"):
+		return exchange.OrderStatusExpired
 	}
 	return exchange.OrderStatus(status)
 }
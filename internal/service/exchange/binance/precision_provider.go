@@ -1,23 +1,251 @@
 package binance
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
 	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/shopspring/decimal"
 )
 
-var _ exchange.QuantityPrecisionProvider = (*PrecisionProvider)(nil)
+var _ exchange.SymbolRulesProvider = (*PrecisionProvider)(nil)
+
+// defaultRulesRefreshInterval exchangeInfo 变化很少，每小时刷新一次
+const defaultRulesRefreshInterval = time.Hour
+
+// PrecisionProvider 币安交易对规则提供器
+// 从 exchangeInfo 加载 LOT_SIZE、MARKET_LOT_SIZE、PRICE_FILTER、MIN_NOTIONAL 过滤器，
+// 有 API Key 时同时加载杠杆档位。规则缓存到磁盘，接口不可用时使用缓存，
+// 还没有加载规则的交易对使用常见交易对的数量精度
+type PrecisionProvider struct {
+	cli             *futures.Client
+	cachePath       string
+	refreshInterval time.Duration
+
+	mu        sync.RWMutex
+	rules     map[string]exchange.SymbolRules // key: tradingPair symbol
+	updatedAt time.Time
+}
+
+// NewPrecisionProvider 创建币安交易对规则提供器，需要调用 Load 或 Run 加载规则
+func NewPrecisionProvider(cli *futures.Client) *PrecisionProvider {
+	return &PrecisionProvider{
+		cli:             cli,
+		refreshInterval: defaultRulesRefreshInterval,
+		rules:           make(map[string]exchange.SymbolRules),
+	}
+}
+
+// SetCachePath 设置规则的磁盘缓存文件，为空时不缓存
+func (p *PrecisionProvider) SetCachePath(path string) {
+	p.cachePath = path
+}
 
-// PrecisionProvider 币安交易对精度提供器
-type PrecisionProvider struct{}
+// SetRefreshInterval 设置规则的刷新间隔，也是磁盘缓存的有效期
+func (p *PrecisionProvider) SetRefreshInterval(interval time.Duration) {
+	p.refreshInterval = interval
+}
 
-// NewPrecisionProvider 创建币安精度提供器
-func NewPrecisionProvider() *PrecisionProvider {
-	return &PrecisionProvider{}
+// symbolRulesCache 磁盘缓存格式
+type symbolRulesCache struct {
+	UpdatedAt time.Time                       `json:"updatedAt"`
+	Rules     map[string]exchange.SymbolRules `json:"rules"`
+}
+
+// Load 加载交易对规则：磁盘缓存未过期时直接使用，否则从交易所拉取并写入缓存
+// 拉取失败时退回到过期的缓存，都没有时返回错误
+func (p *PrecisionProvider) Load(ctx context.Context) error {
+	cache, cacheErr := p.readCache()
+	if cacheErr == nil && time.Since(cache.UpdatedAt) < p.refreshInterval {
+		p.setRules(cache.Rules, cache.UpdatedAt)
+		return nil
+	}
+
+	err := p.Refresh(ctx)
+	if err == nil {
+		return nil
+	}
+	if cacheErr == nil {
+		log.Printf("[symbol rules] refresh failed, using cache from %s: %v", cache.UpdatedAt.Format(time.RFC3339), err)
+		p.setRules(cache.Rules, cache.UpdatedAt)
+		return nil
+	}
+	return err
+}
+
+// Refresh 从交易所拉取最新规则并写入磁盘缓存
+func (p *PrecisionProvider) Refresh(ctx context.Context) error {
+	info, err := p.cli.NewExchangeInfoService().Do(ctx)
+	if err != nil {
+		return fmt.Errorf("get exchange info failed: %w", err)
+	}
+
+	rules := make(map[string]exchange.SymbolRules, len(info.Symbols))
+	for i := range info.Symbols {
+		symbolRules, err := convertSymbolRules(&info.Symbols[i])
+		if err != nil {
+			return fmt.Errorf("parse rules of %s failed: %w", info.Symbols[i].Symbol, err)
+		}
+		rules[info.Symbols[i].Symbol] = symbolRules
+	}
+
+	// 杠杆档位需要签名，没有 API Key 时只加载过滤器
+	if p.cli.APIKey != "" {
+		brackets, err := p.cli.NewGetLeverageBracketService().Do(ctx)
+		if err != nil {
+			return fmt.Errorf("get leverage brackets failed: %w", err)
+		}
+		for _, b := range brackets {
+			if symbolRules, ok := rules[b.Symbol]; ok {
+				symbolRules.LeverageBrackets = convertLeverageBrackets(b.Brackets)
+				rules[b.Symbol] = symbolRules
+			}
+		}
+	}
+
+	now := time.Now()
+	p.setRules(rules, now)
+	if err := p.writeCache(symbolRulesCache{UpdatedAt: now, Rules: rules}); err != nil {
+		log.Printf("[symbol rules] write cache failed: %v", err)
+	}
+	return nil
+}
+
+// Run 定期刷新规则，直到 ctx 被取消，刷新失败时继续使用上一次的规则
+func (p *PrecisionProvider) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Refresh(ctx); err != nil {
+				log.Printf("[symbol rules] refresh failed: %v", err)
+			}
+		}
+	}
+}
+
+// GetSymbolRules 获取交易对规则，没有加载到时只按常见交易对的数量精度限制
+func (p *PrecisionProvider) GetSymbolRules(pair exchange.TradingPair) exchange.SymbolRules {
+	p.mu.RLock()
+	rules, ok := p.rules[pair.ToString()]
+	p.mu.RUnlock()
+	if ok {
+		return rules
+	}
+	return exchange.DefaultSymbolRules(pair, fallbackQuantityPrecision(pair))
 }
 
 // GetQuantityPrecision 获取交易对的数量精度
 func (p *PrecisionProvider) GetQuantityPrecision(pair exchange.TradingPair) int32 {
-	// 常见交易对的精度配置
-	// 参考: https://www.binance.com/en/futures/trading-rules
+	return p.GetSymbolRules(pair).QuantityPrecision
+}
+
+func (p *PrecisionProvider) setRules(rules map[string]exchange.SymbolRules, updatedAt time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = rules
+	p.updatedAt = updatedAt
+}
+
+func (p *PrecisionProvider) readCache() (symbolRulesCache, error) {
+	var cache symbolRulesCache
+	if p.cachePath == "" {
+		return cache, fmt.Errorf("symbol rules cache not configured")
+	}
+	data, err := os.ReadFile(p.cachePath)
+	if err != nil {
+		return cache, fmt.Errorf("read symbol rules cache failed: %w", err)
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return cache, fmt.Errorf("decode symbol rules cache failed: %w", err)
+	}
+	return cache, nil
+}
+
+// writeCache 先写临时文件再重命名，避免进程中断留下不完整的缓存
+func (p *PrecisionProvider) writeCache(cache symbolRulesCache) error {
+	if p.cachePath == "" {
+		return nil
+	}
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.cachePath), 0o755); err != nil {
+		return err
+	}
+	tmp := p.cachePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.cachePath)
+}
+
+// convertSymbolRules 转换 exchangeInfo 中的交易对过滤器
+func convertSymbolRules(s *futures.Symbol) (exchange.SymbolRules, error) {
+	rules := exchange.SymbolRules{
+		TradingPair:       exchange.TradingPair{Base: s.BaseAsset, Quote: s.QuoteAsset},
+		PricePrecision:    int32(s.PricePrecision),
+		QuantityPrecision: int32(s.QuantityPrecision),
+	}
+
+	var err error
+	parse := func(value string, dst *decimal.Decimal) {
+		if err != nil || value == "" {
+			return
+		}
+		*dst, err = decimal.NewFromString(value)
+	}
+
+	if f := s.PriceFilter(); f != nil {
+		parse(f.TickSize, &rules.TickSize)
+		parse(f.MinPrice, &rules.MinPrice)
+		parse(f.MaxPrice, &rules.MaxPrice)
+	}
+	if f := s.LotSizeFilter(); f != nil {
+		parse(f.StepSize, &rules.StepSize)
+		parse(f.MinQuantity, &rules.MinQuantity)
+		parse(f.MaxQuantity, &rules.MaxQuantity)
+	}
+	if f := s.MarketLotSizeFilter(); f != nil {
+		parse(f.StepSize, &rules.MarketStepSize)
+		parse(f.MinQuantity, &rules.MarketMinQuantity)
+		parse(f.MaxQuantity, &rules.MarketMaxQuantity)
+	}
+	if f := s.MinNotionalFilter(); f != nil {
+		parse(f.Notional, &rules.MinNotional)
+	}
+	return rules, err
+}
+
+// convertLeverageBrackets 转换杠杆档位
+func convertLeverageBrackets(brackets []futures.Bracket) []exchange.LeverageBracket {
+	res := make([]exchange.LeverageBracket, 0, len(brackets))
+	for _, b := range brackets {
+		res = append(res, exchange.LeverageBracket{
+			NotionalFloor:    decimal.NewFromFloat(b.NotionalFloor),
+			NotionalCap:      decimal.NewFromFloat(b.NotionalCap),
+			MaxLeverage:      b.InitialLeverage,
+			MaintMarginRatio: decimal.NewFromFloat(b.MaintMarginRatio),
+		})
+	}
+	return res
+}
+
+// fallbackQuantityPrecision 还没有加载规则时使用的常见交易对数量精度
+// 参考: https://www.binance.com/en/futures/trading-rules
+func fallbackQuantityPrecision(pair exchange.TradingPair) int32 {
 	precisionMap := map[string]int32{
 		"BTC":   3, // 0.001
 		"ETH":   3, // 0.001
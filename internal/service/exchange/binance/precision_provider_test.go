@@ -0,0 +1,73 @@
+package binance
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testExchangeInfo = `{"symbols":[{
+	"symbol":"BTCUSDT","baseAsset":"BTC","quoteAsset":"USDT","pricePrecision":2,"quantityPrecision":3,
+	"filters":[
+		{"filterType":"PRICE_FILTER","minPrice":"261.10","maxPrice":"809484","tickSize":"0.10"},
+		{"filterType":"LOT_SIZE","minQty":"0.001","maxQty":"1000","stepSize":"0.001"},
+		{"filterType":"MARKET_LOT_SIZE","minQty":"0.001","maxQty":"120","stepSize":"0.001"},
+		{"filterType":"MIN_NOTIONAL","notional":"100"}
+	]}]}`
+
+// TestPrecisionProvider_LoadAndCache 测试从 exchangeInfo 加载过滤器，接口不可用时使用磁盘缓存
+func TestPrecisionProvider_LoadAndCache(t *testing.T) {
+	var available atomic.Bool
+	available.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(testExchangeInfo))
+	}))
+	defer server.Close()
+
+	cli := futures.NewClient("", "")
+	cli.BaseURL = server.URL
+	cachePath := filepath.Join(t.TempDir(), "symbol_rules.json")
+	btc := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+
+	p := NewPrecisionProvider(cli)
+	p.SetCachePath(cachePath)
+	require.NoError(t, p.Load(context.Background()))
+
+	rules := p.GetSymbolRules(btc)
+	assert.Equal(t, int32(3), p.GetQuantityPrecision(btc))
+	assert.True(t, rules.TickSize.Equal(decimal.NewFromFloat(0.1)), "tick size: %s", rules.TickSize)
+	assert.True(t, rules.MarketMaxQuantity.Equal(decimal.NewFromInt(120)))
+	assert.True(t, rules.MinNotional.Equal(decimal.NewFromInt(100)))
+
+	// 未知交易对使用常见交易对精度
+	assert.Equal(t, int32(1), p.GetQuantityPrecision(exchange.TradingPair{Base: "XRP", Quote: "USDT"}))
+
+	// 接口不可用时使用过期的缓存
+	available.Store(false)
+	cached := NewPrecisionProvider(cli)
+	cached.SetCachePath(cachePath)
+	cached.SetRefreshInterval(time.Nanosecond)
+	require.NoError(t, cached.Load(context.Background()))
+	cachedRules := cached.GetSymbolRules(btc)
+	assert.Equal(t, rules.TradingPair, cachedRules.TradingPair)
+	assert.True(t, cachedRules.TickSize.Equal(rules.TickSize))
+	assert.True(t, cachedRules.StepSize.Equal(rules.StepSize))
+	assert.True(t, cachedRules.MinNotional.Equal(rules.MinNotional))
+
+	// 没有缓存也拉取不到时返回错误
+	assert.Error(t, NewPrecisionProvider(cli).Load(context.Background()))
+}
@@ -1,46 +1,65 @@
 package binance
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/KNICEX/trading-agent/internal/service/exchange"
 	"github.com/adshao/go-binance/v2/futures"
 )
 
-var _ exchange.Service = (*Service)(nil)
+var _ exchange.LiveService = (*Service)(nil)
 
 type Service struct {
-	marketSvc   exchange.MarketService
+	marketSvc   exchange.LiveMarketService
 	orderSvc    exchange.OrderService
 	accountSvc  exchange.AccountService
 	positionSvc exchange.PositionService
+	userDataSvc exchange.UserDataService
 	tradingSvc  exchange.TradingService
+	rulesSvc    *PrecisionProvider
 }
 
-func NewService(cli *futures.Client) *Service {
+// NewService 创建币安交易所服务，加载交易对规则后在后台定期刷新，直到 ctx 被取消
+// 规则加载失败（接口不可用且没有磁盘缓存）时返回错误，避免按猜测的精度下单
+func NewService(ctx context.Context, cli *futures.Client) (*Service, error) {
 	orderSvc := NewOrderService(cli)
 	accountSvc := NewAccountService(cli)
 	positionSvc := NewPositionService(cli)
 	marketSvc := NewMarketService(cli)
+	userDataSvc := NewUserDataService(cli)
 
-	// 使用通用的 TradingService
-	precisionProvider := NewPrecisionProvider()
-	tradingSvc := exchange.NewTradingService(
-		NewService(cli),
-		precisionProvider,
-	)
-
-	return &Service{
+	svc := &Service{
 		marketSvc:   marketSvc,
 		positionSvc: positionSvc,
 		orderSvc:    orderSvc,
 		accountSvc:  accountSvc,
-		tradingSvc:  tradingSvc,
+		userDataSvc: userDataSvc,
+	}
+
+	// 使用通用的 TradingService（基于上面的子服务，不能再调用 NewService，否则无限递归）
+	svc.rulesSvc = NewPrecisionProvider(cli)
+	if err := svc.rulesSvc.Load(ctx); err != nil {
+		return nil, fmt.Errorf("load symbol rules failed: %w", err)
 	}
+	go svc.rulesSvc.Run(ctx)
+
+	svc.tradingSvc = exchange.NewTradingService(
+		svc,
+		svc.rulesSvc,
+	)
+
+	return svc, nil
 }
 
 func (s *Service) MarketService() exchange.MarketService {
 	return s.marketSvc
 }
 
+func (s *Service) KlineStreamService() exchange.KlineStreamService {
+	return s.marketSvc
+}
+
 func (s *Service) PositionService() exchange.PositionService {
 	return s.positionSvc
 }
@@ -53,6 +72,15 @@ func (s *Service) AccountService() exchange.AccountService {
 	return s.accountSvc
 }
 
+// SymbolRulesProvider 交易服务使用的交易对规则，NewService 已经加载并在后台定期刷新
+func (s *Service) SymbolRulesProvider() *PrecisionProvider {
+	return s.rulesSvc
+}
+
+func (s *Service) UserDataService() exchange.UserDataService {
+	return s.userDataSvc
+}
+
 func (s *Service) TradingService() exchange.TradingService {
 	return s.tradingSvc
 }
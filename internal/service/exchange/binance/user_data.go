@@ -0,0 +1,346 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/shopspring/decimal"
+)
+
+var _ exchange.UserDataService = (*UserDataService)(nil)
+
+// defaultListenKeyKeepalive listenKey 60 分钟不续期就会失效，币安建议每 30 分钟续期一次
+const defaultListenKeyKeepalive = 30 * time.Minute
+
+// userDataBufferSize 账户事件通道的缓冲大小，消费跟不上时丢弃新事件
+const userDataBufferSize = 100
+
+// wsUserDataServeFunc 与 futures.WsUserDataServe 签名一致，测试时替换为本地推送
+type wsUserDataServeFunc func(listenKey string, handler futures.WsUserDataHandler, errHandler futures.ErrHandler) (doneC, stopC chan struct{}, err error)
+
+// UserDataService 基于币安合约 user data stream 的账户推送
+type UserDataService struct {
+	cli       *futures.Client
+	orderSvc  *OrderService
+	keepalive time.Duration
+
+	wsUserDataServe wsUserDataServeFunc
+	reconnectMin    time.Duration // 重连等待时间，每次失败翻倍
+	reconnectMax    time.Duration
+}
+
+// NewUserDataService 创建账户推送服务
+func NewUserDataService(cli *futures.Client) *UserDataService {
+	return &UserDataService{
+		cli:             cli,
+		orderSvc:        NewOrderService(cli),
+		keepalive:       defaultListenKeyKeepalive,
+		wsUserDataServe: futures.WsUserDataServe,
+		reconnectMin:    time.Second,
+		reconnectMax:    time.Minute,
+	}
+}
+
+// SetReconnectBackoff 设置账户推送断线重连的等待时间，从 min 开始每次失败翻倍，最长 max
+func (s *UserDataService) SetReconnectBackoff(min, max time.Duration) {
+	s.reconnectMin = min
+	s.reconnectMax = max
+}
+
+// SubscribeUserData 申请 listenKey 并订阅账户推送，定期续期 listenKey
+// 连接断开或 listenKey 过期后按退避时间重新申请 listenKey 并重连，断线期间的事件不会补发，需要调用方通过 REST 对账
+// 推送不等待消费者，通道满时丢弃事件，ctx 取消后关闭通道
+func (s *UserDataService) SubscribeUserData(ctx context.Context) (chan exchange.UserDataEvent, error) {
+	stream := &userDataStream{s: s, ch: make(chan exchange.UserDataEvent, userDataBufferSize)}
+
+	// 首次连接失败直接返回错误，之后的断线由 run 重连
+	conn, err := stream.connect(ctx)
+	if err != nil {
+		close(stream.ch)
+		return nil, err
+	}
+
+	go stream.run(ctx, conn)
+	return stream.ch, nil
+}
+
+// userDataStream 一次账户推送订阅，同一时间只有一个连接向 ch 发送，连接结束后才由 run 关闭 ch
+type userDataStream struct {
+	s       *UserDataService
+	ch      chan exchange.UserDataEvent
+	dropped atomic.Int64 // 通道满时丢弃的事件数
+}
+
+// userDataConn 一次 websocket 连接及其 listenKey
+type userDataConn struct {
+	listenKey string
+	expired   chan struct{}
+	doneC     chan struct{}
+	stopC     chan struct{}
+}
+
+func (st *userDataStream) connect(ctx context.Context) (*userDataConn, error) {
+	listenKey, err := st.s.cli.NewStartUserStreamService().Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("start user data stream failed: %w", err)
+	}
+
+	conn := &userDataConn{listenKey: listenKey, expired: make(chan struct{})}
+	var expireOnce sync.Once
+	doneC, stopC, err := st.s.wsUserDataServe(
+		listenKey,
+		func(event *futures.WsUserDataEvent) {
+			if event.Event == futures.UserDataEventTypeListenKeyExpired {
+				expireOnce.Do(func() { close(conn.expired) })
+				return
+			}
+			for _, e := range st.s.convertEvent(event) {
+				st.emit(e)
+			}
+		},
+		func(err error) {
+			log.Printf("[user data] stream error: %v", err)
+		},
+	)
+	if err != nil {
+		st.closeListenKey(listenKey)
+		return nil, fmt.Errorf("serve user data stream failed: %w", err)
+	}
+	conn.doneC = doneC
+	conn.stopC = stopC
+	return conn, nil
+}
+
+// run 续期 listenKey 直到 ctx 取消，连接断开或 listenKey 过期后重连
+func (st *userDataStream) run(ctx context.Context, conn *userDataConn) {
+	defer close(st.ch)
+
+	for {
+		if !st.serve(ctx, conn) {
+			return
+		}
+		conn = st.reconnect(ctx)
+		if conn == nil {
+			return
+		}
+		log.Printf("[user data] stream reconnected")
+	}
+}
+
+// serve 定期续期 listenKey，连接断开或 listenKey 过期时返回 true，ctx 取消时返回 false
+// 返回时连接已经结束，不会再向 ch 发送
+func (st *userDataStream) serve(ctx context.Context, conn *userDataConn) bool {
+	ticker := time.NewTicker(st.s.keepalive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			close(conn.stopC)
+			<-conn.doneC
+			st.closeListenKey(conn.listenKey)
+			return false
+		case <-conn.expired:
+			log.Printf("[user data] listen key expired, reconnecting")
+			close(conn.stopC)
+			<-conn.doneC
+			return true
+		case <-conn.doneC:
+			log.Printf("[user data] stream disconnected, reconnecting")
+			return true
+		case <-ticker.C:
+			if err := st.s.cli.NewKeepaliveUserStreamService().ListenKey(conn.listenKey).Do(ctx); err != nil {
+				log.Printf("[user data] keepalive listen key failed: %v", err)
+			}
+		}
+	}
+}
+
+// reconnect 按退避时间重新申请 listenKey 并连接，ctx 取消时返回 nil
+func (st *userDataStream) reconnect(ctx context.Context) *userDataConn {
+	backoff := st.s.reconnectMin
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+
+		conn, err := st.connect(ctx)
+		if err == nil {
+			return conn
+		}
+		log.Printf("[user data] reconnect failed: %v", err)
+
+		backoff *= 2
+		if backoff > st.s.reconnectMax {
+			backoff = st.s.reconnectMax
+		}
+	}
+}
+
+// emit 在 websocket 读协程中调用，不能等待消费者，通道满时丢弃事件
+func (st *userDataStream) emit(event exchange.UserDataEvent) {
+	select {
+	case st.ch <- event:
+	default:
+		if st.dropped.Add(1) == 1 {
+			log.Printf("[user data] subscriber is not consuming, buffer of %d is full, dropping events", userDataBufferSize)
+		}
+	}
+}
+
+// closeListenKey 关闭 listenKey，ctx 可能已经取消，使用新的 context
+func (st *userDataStream) closeListenKey(listenKey string) {
+	closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := st.s.cli.NewCloseUserStreamService().ListenKey(listenKey).Do(closeCtx); err != nil {
+		log.Printf("[user data] close listen key failed: %v", err)
+	}
+}
+
+// convertEvent 将币安账户推送转换为接口层事件，一条推送可能对应多个事件
+func (s *UserDataService) convertEvent(event *futures.WsUserDataEvent) []exchange.UserDataEvent {
+	eventTime := time.UnixMilli(event.Time)
+
+	switch event.Event {
+	case futures.UserDataEventTypeOrderTradeUpdate:
+		update := event.OrderTradeUpdate
+		order := s.convertOrderUpdate(update)
+		events := []exchange.UserDataEvent{{
+			Type:  exchange.UserDataEventTypeOrder,
+			Time:  eventTime,
+			Order: &order,
+		}}
+		if update.ExecutionType == futures.OrderExecutionTypeTrade {
+			trade := convertTrade(update, order)
+			events = append(events, exchange.UserDataEvent{
+				Type:  exchange.UserDataEventTypeTrade,
+				Time:  eventTime,
+				Order: &order,
+				Trade: &trade,
+			})
+		}
+		return events
+
+	case futures.UserDataEventTypeAccountUpdate:
+		update := event.AccountUpdate
+		reason := exchange.BalanceChangeReason(update.Reason)
+		var events []exchange.UserDataEvent
+		if len(update.Balances) > 0 {
+			balances := make([]exchange.BalanceChange, 0, len(update.Balances))
+			for _, b := range update.Balances {
+				balances = append(balances, exchange.BalanceChange{
+					Asset:         b.Asset,
+					WalletBalance: parseDecimal(b.Balance),
+					Change:        parseDecimal(b.ChangeBalance),
+				})
+			}
+			events = append(events, exchange.UserDataEvent{
+				Type:     exchange.UserDataEventTypeBalance,
+				Time:     eventTime,
+				Balances: balances,
+				Reason:   reason,
+			})
+		}
+		if len(update.Positions) > 0 {
+			events = append(events, exchange.UserDataEvent{
+				Type:      exchange.UserDataEventTypePosition,
+				Time:      eventTime,
+				Positions: convertWsPositions(update.Positions, eventTime),
+				Reason:    reason,
+			})
+		}
+		return events
+
+	case futures.UserDataEventTypeMarginCall:
+		return []exchange.UserDataEvent{{
+			Type:      exchange.UserDataEventTypeMarginCall,
+			Time:      eventTime,
+			Positions: convertWsPositions(event.MarginCallPositions, eventTime),
+		}}
+	}
+	return nil
+}
+
+// convertOrderUpdate 将订单推送转换为接口层订单，字段与 REST 查询的订单一致
+// 推送中没有下单时间，CreatedAt 为空
+func (s *UserDataService) convertOrderUpdate(update futures.WsOrderTradeUpdate) exchange.OrderInfo {
+	order := s.orderSvc.convertOrder(&futures.Order{
+		Symbol:           update.Symbol,
+		OrderID:          update.ID,
+		ClientOrderID:    update.ClientOrderID,
+		Price:            update.OriginalPrice,
+		ReduceOnly:       update.IsReduceOnly,
+		OrigQuantity:     update.OriginalQty,
+		ExecutedQuantity: update.AccumulatedFilledQty,
+		Status:           update.Status,
+		TimeInForce:      update.TimeInForce,
+		Type:             update.Type,
+		Side:             update.Side,
+		StopPrice:        update.StopPrice,
+		UpdateTime:       update.TradeTime,
+		ActivatePrice:    update.ActivationPrice,
+		PriceRate:        update.CallbackRate,
+		AvgPrice:         update.AveragePrice,
+		OrigType:         update.OriginalType,
+		PositionSide:     update.PositionSide,
+		ClosePosition:    update.IsClosingPosition,
+		GoodTillDate:     update.GTD,
+	})
+	order.CreatedAt = time.Time{}
+	return order
+}
+
+// convertTrade 订单推送中的本次成交
+func convertTrade(update futures.WsOrderTradeUpdate, order exchange.OrderInfo) exchange.Trade {
+	return exchange.Trade{
+		OrderId:      exchange.OrderId(order.Id),
+		TradingPair:  order.TradingPair,
+		OrderType:    order.OrderType,
+		PositionSide: order.PositionSide,
+		Price:        parseDecimal(update.LastFilledPrice),
+		Quantity:     parseDecimal(update.LastFilledQty),
+		Fee:          parseDecimal(update.Commission),
+		FeeAsset:     update.CommissionAsset,
+		RealizedPnl:  parseDecimal(update.RealizedPnL),
+		Maker:        update.IsMaker,
+		Time:         time.UnixMilli(update.TradeTime),
+	}
+}
+
+// convertWsPositions 转换推送中的持仓，数量取绝对值（方向由 PositionSide 表示）
+func convertWsPositions(wsPositions []futures.WsPosition, eventTime time.Time) []exchange.Position {
+	positions := make([]exchange.Position, 0, len(wsPositions))
+	for _, p := range wsPositions {
+		base, quote := exchange.SplitSymbol(p.Symbol)
+		positions = append(positions, exchange.Position{
+			TradingPair:   exchange.TradingPair{Base: base, Quote: quote},
+			PositionSide:  exchange.PositionSide(p.Side),
+			EntryPrice:    parseDecimal(p.EntryPrice),
+			MarkPrice:     parseDecimal(p.MarkPrice),
+			MarginType:    exchange.MarginType(strings.ToUpper(string(p.MarginType))),
+			Quantity:      parseDecimal(p.Amount).Abs(),
+			MarginAmount:  parseDecimal(p.IsolatedWallet),
+			UnrealizedPnl: parseDecimal(p.UnrealizedPnL),
+			UpdatedAt:     eventTime,
+		})
+	}
+	return positions
+}
+
+// parseDecimal 解析推送中的数值，字段缺失时为 0
+func parseDecimal(s string) decimal.Decimal {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		return decimal.Zero
+	}
+	return d
+}
@@ -0,0 +1,177 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KNICEX/trading-agent/internal/service/exchange"
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUserDataConn 本地模拟的一次账户推送连接
+type fakeUserDataConn struct {
+	listenKey string
+	handler   futures.WsUserDataHandler
+	doneC     chan struct{}
+	once      sync.Once
+}
+
+func (c *fakeUserDataConn) pushBalance(change string) {
+	event := &futures.WsUserDataEvent{Event: futures.UserDataEventTypeAccountUpdate, Time: time.Now().UnixMilli()}
+	event.AccountUpdate = futures.WsAccountUpdate{
+		Reason:   futures.UserDataEventReasonTypeOrder,
+		Balances: []futures.WsBalance{{Asset: "USDT", Balance: "1000", ChangeBalance: change}},
+	}
+	c.handler(event)
+}
+
+func (c *fakeUserDataConn) expire() {
+	c.handler(&futures.WsUserDataEvent{Event: futures.UserDataEventTypeListenKeyExpired})
+}
+
+// disconnect 模拟服务端断开连接
+func (c *fakeUserDataConn) disconnect() {
+	c.once.Do(func() { close(c.doneC) })
+}
+
+// listenKeyServer 模拟 listenKey 接口，每次申请返回新的 listenKey，记录被关闭的 listenKey
+type listenKeyServer struct {
+	mu     sync.Mutex
+	next   int
+	closed []string
+}
+
+func (s *listenKeyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPost:
+		s.next++
+		_ = json.NewEncoder(w).Encode(map[string]string{"listenKey": fmt.Sprintf("key-%d", s.next)})
+	case http.MethodDelete:
+		// DELETE 请求的参数在 body 里，ParseForm 不会解析
+		body, _ := io.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+		s.closed = append(s.closed, form.Get("listenKey"))
+		_, _ = w.Write([]byte("{}"))
+	default:
+		_, _ = w.Write([]byte("{}"))
+	}
+}
+
+func (s *listenKeyServer) closedKeys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.closed...)
+}
+
+func newTestUserDataService(t *testing.T) (*UserDataService, *listenKeyServer, chan *fakeUserDataConn) {
+	keys := &listenKeyServer{}
+	server := httptest.NewServer(keys)
+	t.Cleanup(server.Close)
+
+	cli := futures.NewClient("", "")
+	cli.BaseURL = server.URL
+	s := NewUserDataService(cli)
+	s.SetReconnectBackoff(10*time.Millisecond, 50*time.Millisecond)
+
+	conns := make(chan *fakeUserDataConn, 2)
+	s.wsUserDataServe = func(listenKey string, handler futures.WsUserDataHandler, errHandler futures.ErrHandler) (chan struct{}, chan struct{}, error) {
+		conn := &fakeUserDataConn{listenKey: listenKey, handler: handler, doneC: make(chan struct{})}
+		stopC := make(chan struct{})
+		go func() {
+			<-stopC
+			conn.disconnect()
+		}()
+		conns <- conn
+		return conn.doneC, stopC, nil
+	}
+	return s, keys, conns
+}
+
+func nextUserData(t *testing.T, ch chan exchange.UserDataEvent) exchange.UserDataEvent {
+	t.Helper()
+	select {
+	case event, ok := <-ch:
+		require.True(t, ok, "user data channel closed")
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for user data event")
+		return exchange.UserDataEvent{}
+	}
+}
+
+// TestUserDataService_Reconnect 测试连接断开和 listenKey 过期后申请新的 listenKey 重连，ctx 取消后关闭 listenKey 和通道
+func TestUserDataService_Reconnect(t *testing.T) {
+	s, keys, conns := newTestUserDataService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := s.SubscribeUserData(ctx)
+	require.NoError(t, err)
+
+	conn := <-conns
+	assert.Equal(t, "key-1", conn.listenKey)
+	conn.pushBalance("1")
+	event := nextUserData(t, ch)
+	require.Equal(t, exchange.UserDataEventTypeBalance, event.Type)
+	assert.Equal(t, "1", event.Balances[0].Change.String())
+
+	// 服务端断开
+	conn.disconnect()
+	conn = <-conns
+	assert.Equal(t, "key-2", conn.listenKey)
+	conn.pushBalance("2")
+	assert.Equal(t, "2", nextUserData(t, ch).Balances[0].Change.String())
+
+	// listenKey 过期
+	conn.expire()
+	conn = <-conns
+	assert.Equal(t, "key-3", conn.listenKey)
+	conn.pushBalance("3")
+	assert.Equal(t, "3", nextUserData(t, ch).Balances[0].Change.String())
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("user data channel not closed")
+	}
+	assert.Equal(t, []string{"key-3"}, keys.closedKeys())
+}
+
+// TestUserDataService_BufferFull 测试消费者不读取时推送回调不阻塞，通道满后丢弃新事件
+func TestUserDataService_BufferFull(t *testing.T) {
+	s, _, conns := newTestUserDataService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := s.SubscribeUserData(ctx)
+	require.NoError(t, err)
+	conn := <-conns
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < userDataBufferSize+10; i++ {
+			conn.pushBalance("1")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handler blocked on a full channel")
+	}
+	assert.Len(t, ch, userDataBufferSize)
+}
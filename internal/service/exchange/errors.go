@@ -1,5 +1,29 @@
 package exchange
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var ErrInsufficientMargin = errors.New("insufficient margin")
+
+// ErrOrderRejected 订单被交易所拒绝
+// 可以用 errors.Is 判断，用 errors.As 取出 *OrderRejectedError 获取拒绝原因
+var ErrOrderRejected = errors.New("order rejected")
+
+// OrderRejectedError 订单被拒绝的原因
+type OrderRejectedError struct {
+	Code   int64  // 交易所错误码，回测为 0
+	Reason string // 拒绝原因
+}
+
+func (e *OrderRejectedError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("order rejected (code %d): %s", e.Code, e.Reason)
+	}
+	return fmt.Sprintf("order rejected: %s", e.Reason)
+}
+
+func (e *OrderRejectedError) Is(target error) bool {
+	return target == ErrOrderRejected
+}
@@ -53,6 +53,7 @@ func (i Interval) Duration() time.Duration {
 }
 
 var (
+	Interval1m  Interval = Interval{duration: time.Minute, str: "1m"}
 	Interval5m  Interval = Interval{duration: time.Minute * 5, str: "5m"}
 	Interval15m Interval = Interval{duration: time.Minute * 15, str: "15m"}
 	Interval30m Interval = Interval{duration: time.Minute * 30, str: "30m"}
@@ -78,12 +79,60 @@ type Kline struct {
 	QuoteAssetVolume decimal.Decimal // 成交额
 }
 
+// FundingRate 资金费率
+// 费率为正时多头向空头支付，为负时空头向多头支付
+type FundingRate struct {
+	TradingPair TradingPair
+	Rate        decimal.Decimal
+	FundingTime time.Time
+}
+
 type MarketService interface {
 	Ticker(ctx context.Context, tradingPair TradingPair) (decimal.Decimal, error)
 	GetKlines(ctx context.Context, req GetKlinesReq) ([]Kline, error)
+}
+
+// KlineStreamService 实时K线订阅，只有实盘行情提供
+// 回测交易所由模拟时钟回放K线（backtest.ExchangeService.Replay），不实现这个接口
+type KlineStreamService interface {
 	SubscribeKline(ctx context.Context, tradingPair TradingPair, interval Interval) (chan Kline, error)
 }
 
+// LiveMarketService 实盘行情：查询K线和最新价，并且可以订阅实时K线
+type LiveMarketService interface {
+	MarketService
+	KlineStreamService
+}
+
+// StreamStatusReporter 推送实时行情连接状态，实盘行情服务实现
+// 断线重连、补齐缺失K线、连接错误都通过状态通道通知，不会退出进程
+type StreamStatusReporter interface {
+	StreamStatus() <-chan StreamStatus
+}
+
+type StreamState string
+
+const (
+	// 首次连接成功
+	StreamStateConnected StreamState = "CONNECTED"
+	// 连接断开，正在等待重连
+	StreamStateDisconnected StreamState = "DISCONNECTED"
+	// 重连成功并补齐了断线期间的K线
+	StreamStateReconnected StreamState = "RECONNECTED"
+	// 连接或补齐K线出错，Err 为具体错误
+	StreamStateError StreamState = "ERROR"
+)
+
+// StreamStatus K线订阅的连接状态
+type StreamStatus struct {
+	TradingPair TradingPair
+	Interval    Interval
+	State       StreamState
+	Err         error
+	Backfilled  int // RECONNECTED：通过 REST 补齐的K线数量
+	Time        time.Time
+}
+
 type GetKlinesReq struct {
 	TradingPair        TradingPair
 	Interval           Interval
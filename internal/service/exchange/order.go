@@ -2,9 +2,11 @@ package exchange
 
 import (
 	"context"
+	"fmt"
 	"strconv"
 	"time"
 
+	"github.com/samber/lo"
 	"github.com/shopspring/decimal"
 )
 
@@ -26,7 +28,8 @@ func (id OrderId) ToInt64() int64 {
 	return int64(orderId)
 }
 
-// OrderService (Includes only unfulfilled orders ,except GetOrder)
+// OrderService
+// GetOrder 可以查询任意状态的订单；GetOrders 默认只返回未完成的订单，设置过滤条件后可以查询历史订单
 type OrderService interface {
 	// create
 	CreateOrder(ctx context.Context, req CreateOrderReq) (OrderId, error)
@@ -36,7 +39,7 @@ type OrderService interface {
 	ModifyOrder(ctx context.Context, req ModifyOrderReq) error
 	ModifyOrders(ctx context.Context, req []ModifyOrderReq) error
 
-	// get unfulfilled orders
+	// get orders
 	GetOrder(ctx context.Context, req GetOrderReq) (OrderInfo, error)
 	GetOrders(ctx context.Context, req GetOrdersReq) ([]OrderInfo, error)
 
@@ -56,10 +59,52 @@ type CreateOrderReq struct {
 	// - OPEN + SHORT = SELL
 	// - CLOSE + LONG = SELL
 	// - CLOSE + SHORT = BUY
+
+	// 条件单（可选）
+	// Conditional 为空时为普通订单：有 Price 为限价单，无 Price 为市价单
+	Conditional  ConditionalType // STOP_MARKET / TAKE_PROFIT_MARKET
+	TriggerPrice decimal.Decimal // 条件单触发价格
+	// ReduceOnly 只减仓：成交数量不超过触发时的持仓数量，没有持仓则不成交
+	ReduceOnly bool
+	// ClosePosition 触发后平掉该方向的全部仓位（忽略 Quantity），仅条件平仓单有效
+	ClosePosition bool
+
+	// 跟踪止损（TRAILING_STOP_MARKET）参数，CallbackRate 与 CallbackDistance 二选一
+	CallbackRate     decimal.Decimal // 回调比例（百分比），例如 1 表示 1%
+	CallbackDistance decimal.Decimal // 回调距离（价格差），币安只支持回调比例，下单时按激活价或当前价换算
+	ActivationPrice  decimal.Decimal // 激活价格（可选），为空时下单后立即开始跟踪
+
+	// GroupId 订单组（OCO），同组订单一个成交或撤销后其余订单自动撤销，持仓被平掉后同组订单也会撤销
+	// 用于同一仓位的止盈止损，开仓订单不应该加入订单组
+	GroupId string
+
+	// 有效方式（可选），只对限价单有效，为空时为 GTC
+	TimeInForce  TimeInForce
+	GoodTillDate time.Time // 订单自动失效时间，TimeInForce 为 GTD 时必填
+
 	Timestamp time.Time
 }
 
+// ValidateTimeInForce 校验有效方式参数
+func (r CreateOrderReq) ValidateTimeInForce() error {
+	switch r.TimeInForce {
+	case "", TimeInForceGTC:
+		return nil
+	case TimeInForceIOC, TimeInForceFOK, TimeInForceGTX, TimeInForceGTD:
+	default:
+		return fmt.Errorf("unsupported time in force: %s", r.TimeInForce)
+	}
+	if r.Conditional.IsConditional() || r.Price.IsZero() {
+		return fmt.Errorf("time in force %s is only supported by limit orders", r.TimeInForce)
+	}
+	if r.TimeInForce == TimeInForceGTD && r.GoodTillDate.IsZero() {
+		return fmt.Errorf("good till date is required for %s order", r.TimeInForce)
+	}
+	return nil
+}
+
 // modify req
+// 只能修改未完全成交的限价单（与币安一致），Price / Quantity 为空时保持原值
 type ModifyOrderReq struct {
 	Id           OrderId
 	TradingPair  TradingPair
@@ -75,8 +120,42 @@ type GetOrderReq struct {
 }
 
 // get req
+// 只设置 TradingPair 时返回未完成（pending / partially_filled）的订单
 type GetOrdersReq struct {
 	TradingPair TradingPair
+
+	// 历史订单查询条件（可选）
+	IncludeClosed bool          // 同时返回已结束（成交、撤销、拒绝、过期）的订单
+	Statuses      []OrderStatus // 只返回这些状态的订单，设置后忽略 IncludeClosed
+	StartTime     time.Time     // 按创建时间过滤，包含
+	EndTime       time.Time     // 按创建时间过滤，不包含
+	Limit         int           // 最多返回的条数（按创建时间取最近的），0 表示不限制
+}
+
+// IsHistoryQuery 是否需要查询已结束的订单
+func (r GetOrdersReq) IsHistoryQuery() bool {
+	return r.IncludeClosed || len(r.Statuses) > 0
+}
+
+// Match 订单是否满足查询条件
+func (r GetOrdersReq) Match(order OrderInfo) bool {
+	if !r.TradingPair.IsZero() && order.TradingPair != r.TradingPair {
+		return false
+	}
+	if len(r.Statuses) > 0 {
+		if !lo.Contains(r.Statuses, order.Status) {
+			return false
+		}
+	} else if !r.IncludeClosed && !order.IsActive() {
+		return false
+	}
+	if !r.StartTime.IsZero() && order.CreatedAt.Before(r.StartTime) {
+		return false
+	}
+	if !r.EndTime.IsZero() && !order.CreatedAt.Before(r.EndTime) {
+		return false
+	}
+	return true
 }
 
 type CancelOrdersReq struct {
@@ -123,6 +202,9 @@ const (
 	OrderStatusPending         OrderStatus = "pending"
 	OrderStatusFilled          OrderStatus = "filled"
 	OrderStatusPartiallyFilled OrderStatus = "partially_filled"
+	OrderStatusCancelled       OrderStatus = "cancelled" // 主动撤销或被订单组撤销
+	OrderStatusRejected        OrderStatus = "rejected"  // 被交易所拒绝，原因见 OrderInfo.RejectReason
+	OrderStatusExpired         OrderStatus = "expired"   // 过期或触发时已无持仓失效
 )
 
 // IsFilled 判断订单是否已完全成交
@@ -130,6 +212,16 @@ func (s OrderStatus) IsFilled() bool {
 	return s == OrderStatusFilled
 }
 
+// IsActive 订单是否还在挂单（未成交或部分成交）
+func (s OrderStatus) IsActive() bool {
+	return s == OrderStatusPending || s == OrderStatusPartiallyFilled
+}
+
+// IsClosed 订单是否已经结束（成交、撤销、拒绝、过期），不会再有变化
+func (s OrderStatus) IsClosed() bool {
+	return !s.IsActive()
+}
+
 type OrderType string
 
 const (
@@ -137,6 +229,50 @@ const (
 	OrderTypeClose OrderType = "CLOSE"
 )
 
+// ConditionalType 条件单类型
+// 条件单在价格到达触发价之前不会进入撮合，触发后以市价成交
+// 触发方向由买卖方向决定（与币安一致）：
+// - STOP_MARKET：买单价格 >= 触发价时触发，卖单价格 <= 触发价时触发
+// - TAKE_PROFIT_MARKET：买单价格 <= 触发价时触发，卖单价格 >= 触发价时触发
+// - TRAILING_STOP_MARKET：激活后跟踪最有利价格（卖单为最高价，买单为最低价），
+// 价格从该极值反向回撤超过回调幅度时触发，触发价随价格移动
+type ConditionalType string
+
+const (
+	ConditionalTypeStopMarket         ConditionalType = "STOP_MARKET"
+	ConditionalTypeTakeProfitMarket   ConditionalType = "TAKE_PROFIT_MARKET"
+	ConditionalTypeTrailingStopMarket ConditionalType = "TRAILING_STOP_MARKET"
+)
+
+// IsConditional 是否为条件单
+func (t ConditionalType) IsConditional() bool {
+	return t != ""
+}
+
+// TimeInForce 订单有效方式
+type TimeInForce string
+
+const (
+	TimeInForceGTC TimeInForce = "GTC" // 成交为止，一直有效（默认）
+	TimeInForceIOC TimeInForce = "IOC" // 立即成交，未成交的部分撤销
+	TimeInForceFOK TimeInForce = "FOK" // 全部成交，否则全部撤销
+	TimeInForceGTX TimeInForce = "GTX" // 只做挂单（post only），会立即成交时拒绝下单
+	TimeInForceGTD TimeInForce = "GTD" // 到 GoodTillDate 之前一直有效
+)
+
+// IsImmediate 是否只尝试立即成交，不会在盘口挂单
+func (t TimeInForce) IsImmediate() bool {
+	return t == TimeInForceIOC || t == TimeInForceFOK
+}
+
+// IsBuySide 根据 OrderType 和 PositionSide 判断订单是否为买单
+// - OPEN + LONG / CLOSE + SHORT = BUY
+// - OPEN + SHORT / CLOSE + LONG = SELL
+func IsBuySide(orderType OrderType, positionSide PositionSide) bool {
+	return (orderType == OrderTypeOpen && positionSide == PositionSideLong) ||
+		(orderType == OrderTypeClose && positionSide == PositionSideShort)
+}
+
 type OrderInfo struct {
 	Id               string
 	TradingPair      TradingPair
@@ -145,15 +281,39 @@ type OrderInfo struct {
 	Price            decimal.Decimal // 限价单价格
 	Quantity         decimal.Decimal
 	ExecutedQuantity decimal.Decimal // 已成交数量
+	AvgPrice         decimal.Decimal // 成交均价，未成交时为 0
 	Status           OrderStatus
-	CreatedAt        time.Time
-	UpdatedAt        time.Time
-	CompletedAt      time.Time
+	RejectReason     string // 被拒绝的原因，Status 为 rejected 时有效
+
+	// 条件单信息
+	Conditional   ConditionalType
+	TriggerPrice  decimal.Decimal // 触发价格，跟踪止损为当前的止损价（激活前为 0）
+	ReduceOnly    bool
+	ClosePosition bool
+
+	// 跟踪止损信息
+	CallbackRate     decimal.Decimal
+	CallbackDistance decimal.Decimal
+	ActivationPrice  decimal.Decimal
+
+	GroupId string // 订单组（OCO）
+
+	TimeInForce  TimeInForce // 有效方式，为空表示 GTC
+	GoodTillDate time.Time   // GTD 订单的失效时间
+
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	CompletedAt time.Time
 }
 
-// IsActive 判断订单是否处于活跃状态（未完全成交）
+// IsActive 判断订单是否处于活跃状态（未成交或部分成交，还在挂单）
 func (o *OrderInfo) IsActive() bool {
-	return !o.Status.IsFilled()
+	return o.Status.IsActive()
+}
+
+// IsBuy 订单是否为买单
+func (o *OrderInfo) IsBuy() bool {
+	return IsBuySide(o.OrderType, o.PositionSide)
 }
 
 // GetFilledPercentage 获取订单成交百分比
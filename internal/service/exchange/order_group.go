@@ -0,0 +1,176 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var orderGroupSeq atomic.Int64
+
+// NewOrderGroupId 生成订单组 ID
+// 只包含 [0-9a-z-]，长度不超过 20，可以编码进交易所的客户端订单号
+func NewOrderGroupId() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatInt(orderGroupSeq.Add(1)%1296, 36)
+}
+
+// OrderGroupReconciler 实盘订单组（OCO）对账
+// 交易所不支持合约 OCO 时，定期对比未成交订单和持仓：
+// - 同组订单有一个不在未成交列表里了（成交或被撤销），撤销同组的其余订单
+// - 订单组对应的仓位曾经有持仓、现在已经平掉（手动平仓、强平等），撤销整组订单
+type OrderGroupReconciler struct {
+	orderSvc    OrderService
+	positionSvc PositionService
+	interval    time.Duration
+	trigger     chan struct{}
+
+	mu     sync.Mutex
+	groups map[string]*orderGroupState
+}
+
+// orderGroupState 上一次对账时看到的订单组
+type orderGroupState struct {
+	tradingPair  TradingPair
+	positionSide PositionSide
+	members      map[OrderId]bool
+	// hadPosition 对账时是否看到过该方向的持仓，挂单开仓成交前不会因为没有持仓而撤销止盈止损
+	hadPosition bool
+}
+
+// NewOrderGroupReconciler 创建订单组对账器，默认每 5 秒对账一次
+func NewOrderGroupReconciler(svc Service) *OrderGroupReconciler {
+	return &OrderGroupReconciler{
+		orderSvc:    svc.OrderService(),
+		positionSvc: svc.PositionService(),
+		interval:    5 * time.Second,
+		trigger:     make(chan struct{}, 1),
+		groups:      make(map[string]*orderGroupState),
+	}
+}
+
+// SetInterval 设置对账间隔
+func (r *OrderGroupReconciler) SetInterval(interval time.Duration) {
+	r.interval = interval
+}
+
+// Trigger 让 Run 立即对账一次，例如收到订单成交或持仓变化的推送时
+// 已经有待处理的触发时忽略
+func (r *OrderGroupReconciler) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run 定期对账，直到 ctx 被取消
+func (r *OrderGroupReconciler) Run(ctx context.Context, tradingPairs []TradingPair) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.trigger:
+		}
+		if err := r.Reconcile(ctx, tradingPairs); err != nil {
+			log.Printf("[order group] reconcile failed: %v", err)
+		}
+	}
+}
+
+// Reconcile 对账一次，撤销已经失效的订单组订单
+func (r *OrderGroupReconciler) Reconcile(ctx context.Context, tradingPairs []TradingPair) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	positions, err := r.positionSvc.GetActivePositions(ctx, tradingPairs)
+	if err != nil {
+		return fmt.Errorf("get active positions failed: %w", err)
+	}
+	holding := make(map[string]bool, len(positions))
+	for _, position := range positions {
+		if !position.Quantity.IsZero() {
+			holding[position.TradingPair.ToString()+"_"+string(position.PositionSide)] = true
+		}
+	}
+
+	current := make(map[string]*orderGroupState)
+	for _, pair := range tradingPairs {
+		orders, err := r.orderSvc.GetOrders(ctx, GetOrdersReq{TradingPair: pair})
+		if err != nil {
+			return fmt.Errorf("get orders of %s failed: %w", pair.ToString(), err)
+		}
+		for _, order := range orders {
+			if order.GroupId == "" {
+				continue
+			}
+			group, ok := current[order.GroupId]
+			if !ok {
+				group = &orderGroupState{
+					tradingPair:  order.TradingPair,
+					positionSide: order.PositionSide,
+					members:      make(map[OrderId]bool),
+				}
+				if prev, ok := r.groups[order.GroupId]; ok {
+					group.hadPosition = prev.hadPosition
+				}
+				current[order.GroupId] = group
+			}
+			group.members[OrderId(order.Id)] = true
+		}
+	}
+
+	var errs []error
+	for groupId, group := range current {
+		hasPosition := holding[group.tradingPair.ToString()+"_"+string(group.positionSide)]
+		if hasPosition {
+			group.hadPosition = true
+		}
+
+		reason := ""
+		if prev, ok := r.groups[groupId]; ok && memberMissing(prev.members, group.members) {
+			reason = "sibling order filled or cancelled"
+		} else if group.hadPosition && !hasPosition {
+			reason = "position closed"
+		}
+		if reason == "" {
+			continue
+		}
+
+		ids := make([]OrderId, 0, len(group.members))
+		for id := range group.members {
+			ids = append(ids, id)
+		}
+		log.Printf("[order group] cancel group %s (%s): %v", groupId, reason, ids)
+		if err := r.orderSvc.CancelOrders(ctx, CancelOrdersReq{TradingPair: group.tradingPair, Ids: ids}); err != nil {
+			// 撤单失败时保留上一次的状态，下次对账重试
+			errs = append(errs, fmt.Errorf("cancel order group %s failed: %w", groupId, err))
+			current[groupId] = r.groups[groupId]
+			if current[groupId] == nil {
+				current[groupId] = group
+			}
+			continue
+		}
+		delete(current, groupId)
+	}
+
+	r.groups = current
+	return errors.Join(errs...)
+}
+
+// memberMissing 上一次看到的订单是否有不在当前未成交列表里的
+func memberMissing(prev, current map[OrderId]bool) bool {
+	for id := range prev {
+		if !current[id] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGroupExchange 不会自动撤销同组订单的交易所，只实现对账用到的方法
+type fakeGroupExchange struct {
+	Service
+	orders    map[OrderId]OrderInfo
+	positions []Position
+	cancelled []OrderId
+}
+
+type fakeGroupOrderService struct {
+	OrderService
+	*fakeGroupExchange
+}
+
+type fakeGroupPositionService struct {
+	PositionService
+	*fakeGroupExchange
+}
+
+func (f *fakeGroupExchange) PositionService() PositionService {
+	return fakeGroupPositionService{fakeGroupExchange: f}
+}
+func (f *fakeGroupExchange) OrderService() OrderService {
+	return fakeGroupOrderService{fakeGroupExchange: f}
+}
+
+func (f fakeGroupOrderService) GetOrders(ctx context.Context, req GetOrdersReq) ([]OrderInfo, error) {
+	var orders []OrderInfo
+	for _, order := range f.orders {
+		if order.TradingPair == req.TradingPair {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (f fakeGroupOrderService) CancelOrders(ctx context.Context, req CancelOrdersReq) error {
+	for _, id := range req.Ids {
+		delete(f.orders, id)
+		f.cancelled = append(f.cancelled, id)
+	}
+	return nil
+}
+
+func (f fakeGroupPositionService) GetActivePositions(ctx context.Context, pairs []TradingPair) ([]Position, error) {
+	return f.positions, nil
+}
+
+func newFakeGroupExchange(pair TradingPair) *fakeGroupExchange {
+	bracket := func(id string, conditional ConditionalType) OrderInfo {
+		return OrderInfo{
+			Id:           id,
+			TradingPair:  pair,
+			OrderType:    OrderTypeClose,
+			PositionSide: PositionSideLong,
+			Conditional:  conditional,
+			GroupId:      "g1",
+		}
+	}
+	return &fakeGroupExchange{
+		orders: map[OrderId]OrderInfo{
+			"1": bracket("1", ConditionalTypeTakeProfitMarket),
+			"2": bracket("2", ConditionalTypeStopMarket),
+			"3": {Id: "3", TradingPair: pair, OrderType: OrderTypeClose, PositionSide: PositionSideLong},
+		},
+	}
+}
+
+// TestOrderGroupReconciler_SiblingFilled 测试同组订单成交后撤销其余订单，不影响组外订单
+func TestOrderGroupReconciler_SiblingFilled(t *testing.T) {
+	ctx := context.Background()
+	pair := TradingPair{Base: "BTC", Quote: "USDT"}
+	fake := newFakeGroupExchange(pair)
+	fake.positions = []Position{{TradingPair: pair, PositionSide: PositionSideLong, Quantity: decimal.NewFromInt(1)}}
+	reconciler := NewOrderGroupReconciler(fake)
+
+	require.NoError(t, reconciler.Reconcile(ctx, []TradingPair{pair}))
+	assert.Empty(t, fake.cancelled)
+
+	// 止盈成交
+	delete(fake.orders, "1")
+	require.NoError(t, reconciler.Reconcile(ctx, []TradingPair{pair}))
+	assert.Equal(t, []OrderId{"2"}, fake.cancelled)
+	assert.Contains(t, fake.orders, OrderId("3"))
+}
+
+// TestOrderGroupReconciler_PositionClosed 测试仓位被平掉后撤销整组订单，开仓成交前不撤销
+func TestOrderGroupReconciler_PositionClosed(t *testing.T) {
+	ctx := context.Background()
+	pair := TradingPair{Base: "BTC", Quote: "USDT"}
+	fake := newFakeGroupExchange(pair)
+	reconciler := NewOrderGroupReconciler(fake)
+
+	// 开仓挂单还没成交，没有持仓
+	require.NoError(t, reconciler.Reconcile(ctx, []TradingPair{pair}))
+	assert.Empty(t, fake.cancelled)
+
+	fake.positions = []Position{{TradingPair: pair, PositionSide: PositionSideLong, Quantity: decimal.NewFromInt(1)}}
+	require.NoError(t, reconciler.Reconcile(ctx, []TradingPair{pair}))
+	assert.Empty(t, fake.cancelled)
+
+	// 手动平仓
+	fake.positions = nil
+	require.NoError(t, reconciler.Reconcile(ctx, []TradingPair{pair}))
+	assert.ElementsMatch(t, []OrderId{"1", "2"}, fake.cancelled)
+}
@@ -41,12 +41,19 @@ type PositionHistory struct {
 	ClosePrice   decimal.Decimal
 	MaxQuantity  decimal.Decimal
 	RealizedPnl  decimal.Decimal
+	Fee          decimal.Decimal // 累计手续费（正数表示支出）
+	Funding      decimal.Decimal // 累计资金费（正数表示收入，负数表示支出）
 	OpenedAt     time.Time
 	ClosedAt     time.Time
 
 	Events []PositionEvent
 }
 
+// NetPnl 扣除手续费、计入资金费后的净盈亏
+func (h PositionHistory) NetPnl() decimal.Decimal {
+	return h.RealizedPnl.Sub(h.Fee).Add(h.Funding)
+}
+
 type PositionEventType string
 
 const (
@@ -58,6 +65,8 @@ const (
 	PositionEventTypeDecrease PositionEventType = "DECREASE"
 	// 完全平仓
 	PositionEventTypeClose PositionEventType = "CLOSE"
+	// 强制平仓
+	PositionEventTypeLiquidation PositionEventType = "LIQUIDATION"
 )
 
 type PositionEvent struct {
@@ -69,6 +78,7 @@ type PositionEvent struct {
 	Price          decimal.Decimal
 	RealizedPnl    decimal.Decimal
 	Fee            decimal.Decimal // U本位
+	Slippage       decimal.Decimal // 滑点成本（U本位，相对理论成交价多付/少收的金额）
 
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
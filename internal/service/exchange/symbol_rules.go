@@ -0,0 +1,191 @@
+package exchange
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// SymbolRules 交易对的交易规则（币安 exchangeInfo 中的过滤器和杠杆档位）
+// 值为 0 的限制表示不限制
+type SymbolRules struct {
+	TradingPair       TradingPair
+	PricePrecision    int32
+	QuantityPrecision int32
+
+	// PRICE_FILTER
+	TickSize decimal.Decimal
+	MinPrice decimal.Decimal
+	MaxPrice decimal.Decimal
+
+	// LOT_SIZE：限价单和条件单
+	StepSize    decimal.Decimal
+	MinQuantity decimal.Decimal
+	MaxQuantity decimal.Decimal
+
+	// MARKET_LOT_SIZE：市价单，未设置时使用 LOT_SIZE
+	MarketStepSize    decimal.Decimal
+	MarketMinQuantity decimal.Decimal
+	MarketMaxQuantity decimal.Decimal
+
+	// MIN_NOTIONAL：名义价值下限，只减仓订单不受限制
+	MinNotional decimal.Decimal
+
+	// 杠杆档位，按名义价值从小到大排列
+	LeverageBrackets []LeverageBracket
+}
+
+// LeverageBracket 杠杆档位：名义价值在 [NotionalFloor, NotionalCap) 内时最大可用 MaxLeverage 倍
+type LeverageBracket struct {
+	NotionalFloor    decimal.Decimal
+	NotionalCap      decimal.Decimal
+	MaxLeverage      int
+	MaintMarginRatio decimal.Decimal
+}
+
+// QuantityPrecisionProvider 交易对精度提供器接口
+// 不同交易所可以实现这个接口来提供交易对精度信息
+type QuantityPrecisionProvider interface {
+	// GetQuantityPrecision 获取交易对的数量精度
+	GetQuantityPrecision(pair TradingPair) int32
+}
+
+// SymbolRulesProvider 交易对规则提供器，在数量精度之外提供价格步长、数量上下限、最小名义价值和杠杆档位
+type SymbolRulesProvider interface {
+	QuantityPrecisionProvider
+	// GetSymbolRules 获取交易对的交易规则，未知交易对返回只有数量精度的默认规则
+	GetSymbolRules(pair TradingPair) SymbolRules
+}
+
+// DefaultSymbolRules 只按数量精度限制步长的规则，用于没有交易所规则时
+func DefaultSymbolRules(pair TradingPair, quantityPrecision int32) SymbolRules {
+	return SymbolRules{
+		TradingPair:       pair,
+		QuantityPrecision: quantityPrecision,
+		StepSize:          decimal.New(1, -quantityPrecision),
+	}
+}
+
+// MaxLeverage 最大杠杆（最低档位），没有档位信息时返回 0
+func (r SymbolRules) MaxLeverage() int {
+	if len(r.LeverageBrackets) == 0 {
+		return 0
+	}
+	return r.LeverageBrackets[0].MaxLeverage
+}
+
+// MaxLeverageFor 名义价值所在档位的最大杠杆，没有档位信息时返回 0
+func (r SymbolRules) MaxLeverageFor(notional decimal.Decimal) int {
+	for _, b := range r.LeverageBrackets {
+		if notional.LessThan(b.NotionalCap) || b.NotionalCap.IsZero() {
+			return b.MaxLeverage
+		}
+	}
+	if len(r.LeverageBrackets) > 0 {
+		return r.LeverageBrackets[len(r.LeverageBrackets)-1].MaxLeverage
+	}
+	return 0
+}
+
+// lotSize 订单适用的数量步长和上下限
+func (r SymbolRules) lotSize(market bool) (step, min, max decimal.Decimal) {
+	step, min, max = r.StepSize, r.MinQuantity, r.MaxQuantity
+	if market {
+		if r.MarketStepSize.IsPositive() {
+			step = r.MarketStepSize
+		}
+		if r.MarketMinQuantity.IsPositive() {
+			min = r.MarketMinQuantity
+		}
+		if r.MarketMaxQuantity.IsPositive() {
+			max = r.MarketMaxQuantity
+		}
+	}
+	return step, min, max
+}
+
+// RoundQuantity 数量向下取整到步长，market 表示市价单（使用 MARKET_LOT_SIZE）
+func (r SymbolRules) RoundQuantity(quantity decimal.Decimal, market bool) decimal.Decimal {
+	step, _, _ := r.lotSize(market)
+	if !step.IsPositive() {
+		return quantity.Truncate(r.QuantityPrecision)
+	}
+	return floorToStep(quantity, step)
+}
+
+// RoundPrice 价格四舍五入到最小价格变动单位
+func (r SymbolRules) RoundPrice(price decimal.Decimal) decimal.Decimal {
+	if !r.TickSize.IsPositive() || price.IsZero() {
+		return price
+	}
+	return price.Div(r.TickSize).Round(0).Mul(r.TickSize)
+}
+
+// Validate 按交易规则校验订单，refPrice 为估算名义价值用的价格（市价单传当前价）
+func (r SymbolRules) Validate(req CreateOrderReq, refPrice decimal.Decimal) error {
+	market := req.Price.IsZero() && !req.Conditional.IsConditional()
+	step, minQty, maxQty := r.lotSize(market)
+
+	// 触发后全部平仓的条件单忽略数量
+	if !req.ClosePosition {
+		if !req.Quantity.IsPositive() {
+			return fmt.Errorf("LOT_SIZE: quantity must be positive, got %s", req.Quantity)
+		}
+		if step.IsPositive() && !isMultipleOf(req.Quantity, step) {
+			return fmt.Errorf("LOT_SIZE: quantity %s is not a multiple of step size %s", req.Quantity, step)
+		}
+		if minQty.IsPositive() && req.Quantity.LessThan(minQty) {
+			return fmt.Errorf("LOT_SIZE: quantity %s is below minimum %s", req.Quantity, minQty)
+		}
+		if maxQty.IsPositive() && req.Quantity.GreaterThan(maxQty) {
+			return fmt.Errorf("LOT_SIZE: quantity %s exceeds maximum %s", req.Quantity, maxQty)
+		}
+	}
+
+	for _, price := range []decimal.Decimal{req.Price, req.TriggerPrice, req.ActivationPrice} {
+		if err := r.validatePrice(price); err != nil {
+			return err
+		}
+	}
+
+	// 只减仓订单不受最小名义价值限制
+	if r.MinNotional.IsPositive() && !req.ReduceOnly && req.OrderType != OrderTypeClose && refPrice.IsPositive() {
+		notional := req.Quantity.Mul(refPrice)
+		if notional.LessThan(r.MinNotional) {
+			return fmt.Errorf("MIN_NOTIONAL: notional %s is below minimum %s", notional, r.MinNotional)
+		}
+	}
+	return nil
+}
+
+func (r SymbolRules) validatePrice(price decimal.Decimal) error {
+	if price.IsZero() {
+		return nil
+	}
+	if r.TickSize.IsPositive() && !isMultipleOf(price, r.TickSize) {
+		return fmt.Errorf("PRICE_FILTER: price %s is not a multiple of tick size %s", price, r.TickSize)
+	}
+	if r.MinPrice.IsPositive() && price.LessThan(r.MinPrice) {
+		return fmt.Errorf("PRICE_FILTER: price %s is below minimum %s", price, r.MinPrice)
+	}
+	if r.MaxPrice.IsPositive() && price.GreaterThan(r.MaxPrice) {
+		return fmt.Errorf("PRICE_FILTER: price %s exceeds maximum %s", price, r.MaxPrice)
+	}
+	return nil
+}
+
+// ValidateLeverage 校验杠杆不超过交易对的最大杠杆
+func (r SymbolRules) ValidateLeverage(leverage int) error {
+	if max := r.MaxLeverage(); max > 0 && leverage > max {
+		return fmt.Errorf("leverage %d exceeds maximum %d for %s", leverage, max, r.TradingPair.ToString())
+	}
+	return nil
+}
+
+func floorToStep(value, step decimal.Decimal) decimal.Decimal {
+	return value.Div(step).Floor().Mul(step)
+}
+
+func isMultipleOf(value, step decimal.Decimal) bool {
+	return value.Mod(step).IsZero()
+}
@@ -0,0 +1,110 @@
+package exchange
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+// btcRules 与币安 BTCUSDT 永续合约相近的规则
+func btcRules() SymbolRules {
+	return SymbolRules{
+		TradingPair:       TradingPair{Base: "BTC", Quote: "USDT"},
+		PricePrecision:    2,
+		QuantityPrecision: 3,
+		TickSize:          d("0.10"),
+		MinPrice:          d("261.10"),
+		MaxPrice:          d("809484"),
+		StepSize:          d("0.001"),
+		MinQuantity:       d("0.001"),
+		MaxQuantity:       d("1000"),
+		MarketStepSize:    d("0.001"),
+		MarketMinQuantity: d("0.001"),
+		MarketMaxQuantity: d("120"),
+		MinNotional:       d("100"),
+		LeverageBrackets: []LeverageBracket{
+			{NotionalFloor: d("0"), NotionalCap: d("300000"), MaxLeverage: 125},
+			{NotionalFloor: d("300000"), NotionalCap: d("800000"), MaxLeverage: 100},
+			{NotionalFloor: d("800000"), NotionalCap: d("3000000"), MaxLeverage: 75},
+		},
+	}
+}
+
+// TestSymbolRules_Round 测试数量向下取整到步长、价格四舍五入到最小变动单位
+func TestSymbolRules_Round(t *testing.T) {
+	rules := btcRules()
+	assert.True(t, rules.RoundQuantity(d("0.0129"), false).Equal(d("0.012")))
+	assert.True(t, rules.RoundPrice(d("50000.16")).Equal(d("50000.2")))
+	assert.True(t, rules.RoundPrice(d("50000.14")).Equal(d("50000.1")))
+
+	// 没有步长时按数量精度截断
+	rules = DefaultSymbolRules(TradingPair{Base: "XRP", Quote: "USDT"}, 1)
+	assert.True(t, rules.RoundQuantity(d("12.345"), true).Equal(d("12.3")))
+	assert.True(t, rules.RoundPrice(d("0.51234")).Equal(d("0.51234")), "没有最小变动单位时不取整价格")
+}
+
+// TestSymbolRules_Validate 测试各个过滤器的校验
+func TestSymbolRules_Validate(t *testing.T) {
+	rules := btcRules()
+	pair := rules.TradingPair
+	open := func(price, quantity string) CreateOrderReq {
+		req := CreateOrderReq{TradingPair: pair, OrderType: OrderTypeOpen, PositonSide: PositionSideLong, Quantity: d(quantity)}
+		if price != "" {
+			req.Price = d(price)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		req     CreateOrderReq
+		errPart string
+	}{
+		{name: "合法限价单", req: open("50000.1", "0.01")},
+		{name: "数量不是步长的整数倍", req: open("50000", "0.0015"), errPart: "LOT_SIZE"},
+		{name: "价格不是最小变动单位的整数倍", req: open("50000.15", "0.01"), errPart: "PRICE_FILTER"},
+		{name: "价格低于下限", req: open("100", "10"), errPart: "PRICE_FILTER"},
+		{name: "名义价值不足", req: open("50000", "0.001"), errPart: "MIN_NOTIONAL"},
+		{name: "限价单数量上限", req: open("50000", "1001"), errPart: "LOT_SIZE"},
+		{name: "市价单使用 MARKET_LOT_SIZE 的上限", req: open("", "200"), errPart: "LOT_SIZE"},
+		{
+			name: "只减仓订单不受最小名义价值限制",
+			req: CreateOrderReq{TradingPair: pair, OrderType: OrderTypeClose, PositonSide: PositionSideLong,
+				Quantity: d("0.001"), Conditional: ConditionalTypeStopMarket, TriggerPrice: d("49000"), ReduceOnly: true},
+		},
+		{
+			name: "条件单的触发价也要符合最小变动单位",
+			req: CreateOrderReq{TradingPair: pair, OrderType: OrderTypeClose, PositonSide: PositionSideLong,
+				Quantity: d("0.01"), Conditional: ConditionalTypeStopMarket, TriggerPrice: d("49000.05"), ReduceOnly: true},
+			errPart: "PRICE_FILTER",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := rules.Validate(tt.req, d("50000"))
+			if tt.errPart == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.errPart)
+		})
+	}
+}
+
+// TestSymbolRules_Leverage 测试按名义价值查找杠杆档位
+func TestSymbolRules_Leverage(t *testing.T) {
+	rules := btcRules()
+	assert.Equal(t, 125, rules.MaxLeverage())
+	assert.Equal(t, 125, rules.MaxLeverageFor(d("1000")))
+	assert.Equal(t, 100, rules.MaxLeverageFor(d("300000")))
+	assert.Equal(t, 75, rules.MaxLeverageFor(d("5000000")), "超过最高档位时使用最后一档")
+
+	assert.NoError(t, rules.ValidateLeverage(125))
+	assert.Error(t, rules.ValidateLeverage(126))
+	assert.NoError(t, DefaultSymbolRules(rules.TradingPair, 3).ValidateLeverage(125), "没有档位信息时不限制")
+}
@@ -17,13 +17,18 @@ type OpenPositionReq struct {
 	Price        decimal.Decimal // 限价：有值则为限价单，为空则为市价单
 	Quantity     decimal.Decimal // 开仓数量（具体值）
 
+	// 限价开仓单的有效方式（可选），见 CreateOrderReq
+	TimeInForce  TimeInForce
+	GoodTillDate time.Time
+
 	// 使用账户余额的百分比开仓（与 Quantity 互斥）
 	// 例如：BalancePercent = 50 表示使用 50% 的可用余额开仓
 	BalancePercent decimal.Decimal
 
 	// 止盈止损（可选）
-	TakeProfit StopOrder // 止盈单
-	StopLoss   StopOrder // 止损单
+	TakeProfit   StopOrder    // 止盈单
+	StopLoss     StopOrder    // 止损单
+	TrailingStop TrailingStop // 跟踪止损单
 
 	Timestamp time.Time
 }
@@ -50,13 +55,25 @@ type ClosePositionReq struct {
 // StopOrder 止盈止损订单
 type StopOrder struct {
 	Price decimal.Decimal // 触发价格
-	// 内部会自动判断：有触发价格 = 市价止盈止损（TAKE_PROFIT_MARKET / STOP_MARKET）
+	// 有触发价格 = 市价止盈止损（TAKE_PROFIT_MARKET / STOP_MARKET），只减仓
 }
 
 func (s StopOrder) IsValid() bool {
 	return !s.Price.IsZero()
 }
 
+// TrailingStop 跟踪止损（TRAILING_STOP_MARKET），只减仓
+// CallbackRate 与 CallbackDistance 二选一
+type TrailingStop struct {
+	CallbackRate     decimal.Decimal // 回调比例（百分比），例如 1 表示 1%
+	CallbackDistance decimal.Decimal // 回调距离（价格差）
+	ActivationPrice  decimal.Decimal // 激活价格（可选），为空时立即开始跟踪
+}
+
+func (s TrailingStop) IsValid() bool {
+	return !s.CallbackRate.IsZero() || !s.CallbackDistance.IsZero()
+}
+
 // TradingService 交易服务接口
 type TradingService interface {
 	// OpenPosition 开仓/加仓
@@ -75,6 +92,8 @@ type OpenPositionResp struct {
 	OrderId        OrderId         // 开仓订单 ID
 	TakeProfitId   OrderId         // 止盈单 ID（如果设置了）
 	StopLossId     OrderId         // 止损单 ID（如果设置了）
+	TrailingStopId OrderId         // 跟踪止损单 ID（如果设置了）
+	GroupId        string          // 止盈止损所在的订单组（OCO）
 	EstimatedCost  decimal.Decimal // 预估占用保证金
 	EstimatedPrice decimal.Decimal // 预估成交价格（市价单为当前市价）
 }
@@ -85,48 +104,50 @@ type SetStopOrdersReq struct {
 	PositionSide PositionSide // 针对哪个方向的仓位
 	TakeProfit   StopOrder    // 止盈单（可选）
 	StopLoss     StopOrder    // 止损单（可选）
-	Timestamp    time.Time
+	TrailingStop TrailingStop // 跟踪止损单（可选）
+	// 止盈止损数量（可选），为空时使用当前持仓数量
+	// 加减仓订单尚未成交时可以直接指定调整后的数量
+	Quantity  decimal.Decimal
+	Timestamp time.Time
 }
 
 // SetStopOrdersResp 设置止盈止损响应
 type SetStopOrdersResp struct {
-	TakeProfitId OrderId // 止盈单 ID
-	StopLossId   OrderId // 止损单 ID
-}
-
-// QuantityPrecisionProvider 交易对精度提供器接口
-// 不同交易所可以实现这个接口来提供交易对精度信息
-type QuantityPrecisionProvider interface {
-	// GetQuantityPrecision 获取交易对的数量精度
-	GetQuantityPrecision(pair TradingPair) int32
+	TakeProfitId   OrderId // 止盈单 ID
+	StopLossId     OrderId // 止损单 ID
+	TrailingStopId OrderId // 跟踪止损单 ID
+	GroupId        string  // 止盈止损所在的订单组（OCO）
 }
 
 // tradingService 通用交易服务
 // 完全基于 exchange 包的接口实现，不依赖任何具体交易所或第三方库
 type tradingService struct {
-	orderSvc          OrderService
-	accountSvc        AccountService
-	positionSvc       PositionService
-	marketSvc         MarketService
-	precisionProvider QuantityPrecisionProvider
+	orderSvc      OrderService
+	accountSvc    AccountService
+	positionSvc   PositionService
+	marketSvc     MarketService
+	rulesProvider SymbolRulesProvider
 }
 
 // NewTradingService 创建通用交易服务
+// 下单前按 rulesProvider 提供的交易规则取整价格和数量并校验，不满足规则的订单不会发送到交易所
 func NewTradingService(
 	svc Service,
-	precisionProvider QuantityPrecisionProvider,
+	rulesProvider SymbolRulesProvider,
 ) *tradingService {
 	return &tradingService{
-		orderSvc:          svc.OrderService(),
-		accountSvc:        svc.AccountService(),
-		positionSvc:       svc.PositionService(),
-		marketSvc:         svc.MarketService(),
-		precisionProvider: precisionProvider,
+		orderSvc:      svc.OrderService(),
+		accountSvc:    svc.AccountService(),
+		positionSvc:   svc.PositionService(),
+		marketSvc:     svc.MarketService(),
+		rulesProvider: rulesProvider,
 	}
 }
 
 // OpenPosition 开仓/加仓
 func (s *tradingService) OpenPosition(ctx context.Context, req OpenPositionReq) (*OpenPositionResp, error) {
+	req.Price = s.getSymbolRules(req.TradingPair).RoundPrice(req.Price)
+
 	// 1. 计算开仓数量
 	quantity, estimatedCost, estimatedPrice, err := s.calculateOpenQuantity(ctx, req)
 	if err != nil {
@@ -134,13 +155,15 @@ func (s *tradingService) OpenPosition(ctx context.Context, req OpenPositionReq)
 	}
 
 	// 2. 创建开仓订单（Side 会自动计算）
-	orderId, err := s.orderSvc.CreateOrder(ctx, CreateOrderReq{
-		TradingPair: req.TradingPair,
-		OrderType:   OrderTypeOpen, // 开仓类型
-		PositonSide: req.PositionSide,
-		Price:       req.Price,
-		Quantity:    quantity,
-		Timestamp:   req.Timestamp,
+	orderId, err := s.createOrder(ctx, estimatedPrice, CreateOrderReq{
+		TradingPair:  req.TradingPair,
+		OrderType:    OrderTypeOpen, // 开仓类型
+		PositonSide:  req.PositionSide,
+		Price:        req.Price,
+		Quantity:     quantity,
+		TimeInForce:  req.TimeInForce,
+		GoodTillDate: req.GoodTillDate,
+		Timestamp:    req.Timestamp,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("create open position order failed: %w", err)
@@ -152,9 +175,13 @@ func (s *tradingService) OpenPosition(ctx context.Context, req OpenPositionReq)
 		EstimatedPrice: estimatedPrice,
 	}
 
-	// 3. 如果设置了止盈止损，创建对应订单
+	// 3. 如果设置了止盈止损，创建对应订单，同一仓位的止盈止损放在一个订单组里，一个成交后撤销其余的
+	if req.TakeProfit.IsValid() || req.StopLoss.IsValid() || req.TrailingStop.IsValid() {
+		resp.GroupId = NewOrderGroupId()
+	}
+
 	if req.TakeProfit.IsValid() {
-		tpId, err := s.createTakeProfitOrder(ctx, req.TradingPair, req.PositionSide, req.TakeProfit.Price, quantity, req.Timestamp)
+		tpId, err := s.createTakeProfitOrder(ctx, req.TradingPair, req.PositionSide, req.TakeProfit.Price, quantity, resp.GroupId, req.Timestamp)
 		if err != nil {
 			// 止盈单失败不影响主订单，只记录错误
 			return resp, fmt.Errorf("main order created successfully, but take profit order failed: %w", err)
@@ -163,7 +190,7 @@ func (s *tradingService) OpenPosition(ctx context.Context, req OpenPositionReq)
 	}
 
 	if req.StopLoss.IsValid() {
-		slId, err := s.createStopLossOrder(ctx, req.TradingPair, req.PositionSide, req.StopLoss.Price, quantity, req.Timestamp)
+		slId, err := s.createStopLossOrder(ctx, req.TradingPair, req.PositionSide, req.StopLoss.Price, quantity, resp.GroupId, req.Timestamp)
 		if err != nil {
 			// 止损单失败不影响主订单，只记录错误
 			return resp, fmt.Errorf("main order created successfully, but stop loss order failed: %w", err)
@@ -171,11 +198,21 @@ func (s *tradingService) OpenPosition(ctx context.Context, req OpenPositionReq)
 		resp.StopLossId = slId
 	}
 
+	if req.TrailingStop.IsValid() {
+		tsId, err := s.createTrailingStopOrder(ctx, req.TradingPair, req.PositionSide, req.TrailingStop, quantity, resp.GroupId, req.Timestamp)
+		if err != nil {
+			return resp, fmt.Errorf("main order created successfully, but trailing stop order failed: %w", err)
+		}
+		resp.TrailingStopId = tsId
+	}
+
 	return resp, nil
 }
 
 // ClosePosition 平仓
 func (s *tradingService) ClosePosition(ctx context.Context, req ClosePositionReq) (OrderId, error) {
+	req.Price = s.getSymbolRules(req.TradingPair).RoundPrice(req.Price)
+
 	// 1. 计算平仓数量
 	quantity, err := s.calculateCloseQuantity(ctx, req)
 	if err != nil {
@@ -183,7 +220,7 @@ func (s *tradingService) ClosePosition(ctx context.Context, req ClosePositionReq
 	}
 
 	// 2. 创建平仓订单（Side 会自动计算）
-	orderId, err := s.orderSvc.CreateOrder(ctx, CreateOrderReq{
+	orderId, err := s.createOrder(ctx, req.Price, CreateOrderReq{
 		TradingPair: req.TradingPair,
 		OrderType:   OrderTypeClose, // 平仓类型
 		PositonSide: req.PositionSide,
@@ -219,11 +256,16 @@ func (s *tradingService) SetStopOrders(ctx context.Context, req SetStopOrdersReq
 		return nil, fmt.Errorf("no active position found for %s %s", req.TradingPair.ToString(), req.PositionSide)
 	}
 
-	resp := &SetStopOrdersResp{}
+	quantity := position.Quantity.Abs()
+	if !req.Quantity.IsZero() {
+		quantity = s.roundQuantity(req.TradingPair, req.Quantity, false)
+	}
+
+	resp := &SetStopOrdersResp{GroupId: NewOrderGroupId()}
 
 	// 3. 创建止盈单
 	if req.TakeProfit.IsValid() {
-		tpId, err := s.createTakeProfitOrder(ctx, req.TradingPair, req.PositionSide, req.TakeProfit.Price, position.Quantity, req.Timestamp)
+		tpId, err := s.createTakeProfitOrder(ctx, req.TradingPair, req.PositionSide, req.TakeProfit.Price, quantity, resp.GroupId, req.Timestamp)
 		if err != nil {
 			return nil, fmt.Errorf("create take profit order failed: %w", err)
 		}
@@ -232,13 +274,22 @@ func (s *tradingService) SetStopOrders(ctx context.Context, req SetStopOrdersReq
 
 	// 4. 创建止损单
 	if req.StopLoss.IsValid() {
-		slId, err := s.createStopLossOrder(ctx, req.TradingPair, req.PositionSide, req.StopLoss.Price, position.Quantity, req.Timestamp)
+		slId, err := s.createStopLossOrder(ctx, req.TradingPair, req.PositionSide, req.StopLoss.Price, quantity, resp.GroupId, req.Timestamp)
 		if err != nil {
 			return nil, fmt.Errorf("create stop loss order failed: %w", err)
 		}
 		resp.StopLossId = slId
 	}
 
+	// 5. 创建跟踪止损单
+	if req.TrailingStop.IsValid() {
+		tsId, err := s.createTrailingStopOrder(ctx, req.TradingPair, req.PositionSide, req.TrailingStop, quantity, resp.GroupId, req.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("create trailing stop order failed: %w", err)
+		}
+		resp.TrailingStopId = tsId
+	}
+
 	return resp, nil
 }
 
@@ -250,7 +301,7 @@ func (s *tradingService) calculateOpenQuantity(ctx context.Context, req OpenPosi
 
 	// 如果直接指定了数量，直接使用
 	if !req.Quantity.IsZero() {
-		quantity = s.roundQuantity(req.TradingPair, req.Quantity)
+		quantity = s.roundQuantity(req.TradingPair, req.Quantity, req.Price.IsZero())
 		estimatedPrice, err = s.getEstimatedPrice(ctx, req.TradingPair, req.Price)
 		if err != nil {
 			return decimal.Zero, decimal.Zero, decimal.Zero, err
@@ -294,7 +345,7 @@ func (s *tradingService) calculateOpenQuantity(ctx context.Context, req OpenPosi
 		estimatedCost = availableFunds
 
 		// 对数量进行精度处理
-		quantity = s.roundQuantity(req.TradingPair, quantity)
+		quantity = s.roundQuantity(req.TradingPair, quantity, req.Price.IsZero())
 
 		return quantity, estimatedCost, estimatedPrice, nil
 	}
@@ -306,7 +357,7 @@ func (s *tradingService) calculateOpenQuantity(ctx context.Context, req OpenPosi
 func (s *tradingService) calculateCloseQuantity(ctx context.Context, req ClosePositionReq) (decimal.Decimal, error) {
 	// 如果直接指定了数量，直接使用
 	if !req.Quantity.IsZero() {
-		return s.roundQuantity(req.TradingPair, req.Quantity), nil
+		return s.roundQuantity(req.TradingPair, req.Quantity, req.Price.IsZero()), nil
 	}
 
 	// 需要获取当前仓位
@@ -336,13 +387,11 @@ func (s *tradingService) calculateCloseQuantity(ctx context.Context, req ClosePo
 	// 如果使用百分比
 	if !req.Percent.IsZero() {
 		quantity := position.Quantity.Abs().Mul(req.Percent).Div(decimal.NewFromInt(100))
-		rounded := s.roundQuantity(req.TradingPair, quantity)
+		rounded := s.roundQuantity(req.TradingPair, quantity, req.Price.IsZero())
 
-		// 如果截断后为0，说明数量太小，至少保留最小精度单位
+		// 如果截断后为0，说明数量太小，至少保留最小下单数量
 		if rounded.IsZero() && !quantity.IsZero() {
-			precision := s.getQuantityPrecision(req.TradingPair)
-			minQuantity := decimal.New(1, -precision) // 例如：precision=3 -> 0.001
-			return minQuantity, nil
+			return s.minQuantity(req.TradingPair, req.Price.IsZero()), nil
 		}
 
 		return rounded, nil
@@ -351,41 +400,74 @@ func (s *tradingService) calculateCloseQuantity(ctx context.Context, req ClosePo
 	return decimal.Zero, fmt.Errorf("must specify either Quantity, Percent or CloseAll")
 }
 
-// createTakeProfitOrder 创建止盈订单
+// createTakeProfitOrder 创建止盈订单（TAKE_PROFIT_MARKET，只减仓）
 func (s *tradingService) createTakeProfitOrder(
 	ctx context.Context,
 	pair TradingPair,
 	positionSide PositionSide,
 	triggerPrice decimal.Decimal,
 	quantity decimal.Decimal,
+	groupId string,
 	timestamp time.Time,
 ) (OrderId, error) {
-	return s.orderSvc.CreateOrder(ctx, CreateOrderReq{
-		TradingPair: pair,
-		OrderType:   OrderTypeClose,
-		PositonSide: positionSide,
-		Price:       triggerPrice,
-		Quantity:    quantity,
-		Timestamp:   timestamp,
+	return s.createOrder(ctx, triggerPrice, CreateOrderReq{
+		TradingPair:  pair,
+		OrderType:    OrderTypeClose,
+		PositonSide:  positionSide,
+		Quantity:     quantity,
+		Conditional:  ConditionalTypeTakeProfitMarket,
+		TriggerPrice: triggerPrice,
+		ReduceOnly:   true,
+		GroupId:      groupId,
+		Timestamp:    timestamp,
 	})
 }
 
-// createStopLossOrder 创建止损订单
+// createStopLossOrder 创建止损订单（STOP_MARKET，只减仓）
 func (s *tradingService) createStopLossOrder(
 	ctx context.Context,
 	pair TradingPair,
 	positionSide PositionSide,
 	triggerPrice decimal.Decimal,
 	quantity decimal.Decimal,
+	groupId string,
 	timestamp time.Time,
 ) (OrderId, error) {
-	return s.orderSvc.CreateOrder(ctx, CreateOrderReq{
-		TradingPair: pair,
-		OrderType:   OrderTypeClose,
-		PositonSide: positionSide,
-		Price:       triggerPrice,
-		Quantity:    quantity,
-		Timestamp:   timestamp,
+	return s.createOrder(ctx, triggerPrice, CreateOrderReq{
+		TradingPair:  pair,
+		OrderType:    OrderTypeClose,
+		PositonSide:  positionSide,
+		Quantity:     quantity,
+		Conditional:  ConditionalTypeStopMarket,
+		TriggerPrice: triggerPrice,
+		ReduceOnly:   true,
+		GroupId:      groupId,
+		Timestamp:    timestamp,
+	})
+}
+
+// createTrailingStopOrder 创建跟踪止损订单（TRAILING_STOP_MARKET，只减仓）
+func (s *tradingService) createTrailingStopOrder(
+	ctx context.Context,
+	pair TradingPair,
+	positionSide PositionSide,
+	trailing TrailingStop,
+	quantity decimal.Decimal,
+	groupId string,
+	timestamp time.Time,
+) (OrderId, error) {
+	return s.createOrder(ctx, decimal.Zero, CreateOrderReq{
+		TradingPair:      pair,
+		OrderType:        OrderTypeClose,
+		PositonSide:      positionSide,
+		Quantity:         quantity,
+		Conditional:      ConditionalTypeTrailingStopMarket,
+		CallbackRate:     trailing.CallbackRate,
+		CallbackDistance: trailing.CallbackDistance,
+		ActivationPrice:  trailing.ActivationPrice,
+		ReduceOnly:       true,
+		GroupId:          groupId,
+		Timestamp:        timestamp,
 	})
 }
 
@@ -428,18 +510,38 @@ func (s *tradingService) getCurrentLeverage(ctx context.Context, pair TradingPai
 	return 20, nil
 }
 
-// getQuantityPrecision 获取交易对的数量精度
-func (s *tradingService) getQuantityPrecision(pair TradingPair) int32 {
-	if s.precisionProvider != nil {
-		return s.precisionProvider.GetQuantityPrecision(pair)
+// getSymbolRules 获取交易对的交易规则，没有规则提供器时默认数量精度为3位小数
+func (s *tradingService) getSymbolRules(pair TradingPair) SymbolRules {
+	if s.rulesProvider != nil {
+		return s.rulesProvider.GetSymbolRules(pair)
 	}
-	// 默认精度为3位小数
-	return 3
+	return DefaultSymbolRules(pair, 3)
+}
+
+// roundQuantity 根据交易对的数量步长向下取整，market 表示市价单
+func (s *tradingService) roundQuantity(pair TradingPair, quantity decimal.Decimal, market bool) decimal.Decimal {
+	return s.getSymbolRules(pair).RoundQuantity(quantity, market)
 }
 
-// roundQuantity 根据交易对对数量进行精度处理
-func (s *tradingService) roundQuantity(pair TradingPair, quantity decimal.Decimal) decimal.Decimal {
-	precision := s.getQuantityPrecision(pair)
-	// 向下取整到指定精度
-	return quantity.Truncate(precision)
+// minQuantity 最小下单数量：LOT_SIZE 的下限，没有下限时为一个步长
+func (s *tradingService) minQuantity(pair TradingPair, market bool) decimal.Decimal {
+	step, min, _ := s.getSymbolRules(pair).lotSize(market)
+	if min.IsPositive() {
+		return min
+	}
+	return step
+}
+
+// createOrder 价格取整到最小变动单位，按交易规则校验后下单
+// refPrice 用于估算名义价值，不满足规则时返回 OrderRejectedError
+func (s *tradingService) createOrder(ctx context.Context, refPrice decimal.Decimal, req CreateOrderReq) (OrderId, error) {
+	rules := s.getSymbolRules(req.TradingPair)
+	req.Price = rules.RoundPrice(req.Price)
+	req.TriggerPrice = rules.RoundPrice(req.TriggerPrice)
+	req.ActivationPrice = rules.RoundPrice(req.ActivationPrice)
+
+	if err := rules.Validate(req, refPrice); err != nil {
+		return "", &OrderRejectedError{Reason: err.Error()}
+	}
+	return s.orderSvc.CreateOrder(ctx, req)
 }
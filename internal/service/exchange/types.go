@@ -5,4 +5,12 @@ type Service interface {
 	PositionService() PositionService
 	AccountService() AccountService
 	OrderService() OrderService
+	UserDataService() UserDataService
+}
+
+// LiveService 可以订阅实时K线的交易所服务，实盘引擎使用
+// 回测交易所只能通过模拟时钟回放K线，不实现这个接口
+type LiveService interface {
+	Service
+	KlineStreamService() KlineStreamService
 }
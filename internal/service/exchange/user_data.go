@@ -0,0 +1,75 @@
+package exchange
+
+import (
+	"context"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// UserDataService 账户实时推送：订单状态、成交、持仓和余额变化、追加保证金通知
+// 用于代替轮询 GetOrders / GetActivePositions
+type UserDataService interface {
+	// SubscribeUserData 订阅账户事件，ctx 取消后关闭通道
+	SubscribeUserData(ctx context.Context) (chan UserDataEvent, error)
+}
+
+type UserDataEventType string
+
+const (
+	// 订单状态变化（新订单、部分成交、成交、撤销、拒绝、过期）
+	UserDataEventTypeOrder UserDataEventType = "ORDER"
+	// 订单成交，一次撮合一个事件，带手续费和已实现盈亏
+	UserDataEventTypeTrade UserDataEventType = "TRADE"
+	// 持仓变化
+	UserDataEventTypePosition UserDataEventType = "POSITION"
+	// 余额变化（成交、手续费、资金费、划转等）
+	UserDataEventTypeBalance UserDataEventType = "BALANCE"
+	// 追加保证金通知，Positions 为保证金不足的持仓
+	UserDataEventTypeMarginCall UserDataEventType = "MARGIN_CALL"
+)
+
+// UserDataEvent 账户事件，按 Type 读取对应的字段
+type UserDataEvent struct {
+	Type UserDataEventType
+	Time time.Time
+
+	Order     *OrderInfo          // ORDER / TRADE：事件发生后的订单
+	Trade     *Trade              // TRADE
+	Positions []Position          // POSITION / MARGIN_CALL
+	Balances  []BalanceChange     // BALANCE
+	Reason    BalanceChangeReason // POSITION / BALANCE：变化原因
+}
+
+// Trade 一次成交
+type Trade struct {
+	OrderId      OrderId
+	TradingPair  TradingPair
+	OrderType    OrderType
+	PositionSide PositionSide
+	Price        decimal.Decimal
+	Quantity     decimal.Decimal
+	Fee          decimal.Decimal // 手续费（正数表示支出）
+	FeeAsset     string
+	RealizedPnl  decimal.Decimal // 平仓成交的已实现盈亏，不含手续费
+	Maker        bool
+	Time         time.Time
+}
+
+// BalanceChange 资产余额变化
+type BalanceChange struct {
+	Asset         string
+	WalletBalance decimal.Decimal // 变化后的钱包余额
+	Change        decimal.Decimal // 除盈亏和手续费以外的变化量（例如划转）
+}
+
+// BalanceChangeReason 余额和持仓变化的原因
+type BalanceChangeReason string
+
+const (
+	BalanceChangeReasonOrder       BalanceChangeReason = "ORDER"
+	BalanceChangeReasonFundingFee  BalanceChangeReason = "FUNDING_FEE"
+	BalanceChangeReasonLiquidation BalanceChangeReason = "LIQUIDATION"
+	BalanceChangeReasonDeposit     BalanceChangeReason = "DEPOSIT"
+	BalanceChangeReasonWithdraw    BalanceChangeReason = "WITHDRAW"
+)
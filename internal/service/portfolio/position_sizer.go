@@ -54,15 +54,41 @@ func (s *SimplePositionSizer) HandleSignal(ctx context.Context, signal strategy.
 	}
 
 	// 1. 检查信号类型
-	if signal.Action == strategy.SignalActionHold {
+	switch signal.Action {
+	case strategy.SignalActionHold:
 		result.Reason = "信号为观望，无需开仓"
 		return result, nil
-	}
-
-	if signal.Action != strategy.SignalActionLong && signal.Action != strategy.SignalActionShort {
+	case strategy.SignalActionLong:
+		return s.handleOpen(ctx, signal, exchange.PositionSideLong)
+	case strategy.SignalActionShort:
+		return s.handleOpen(ctx, signal, exchange.PositionSideShort)
+	case strategy.SignalActionAdd:
+		// 加仓方向与当前持仓一致
+		position, reason, err := s.findPosition(ctx, signal)
+		if err != nil || position == nil {
+			result.Reason = reason
+			return result, err
+		}
+		return s.handleOpen(ctx, signal, position.PositionSide)
+	case strategy.SignalActionReduce, strategy.SignalActionClose:
+		return s.handleReduce(ctx, signal)
+	default:
 		result.Reason = fmt.Sprintf("不支持的信号类型: %s", signal.Action)
 		return result, nil
 	}
+}
+
+// handleOpen 开仓和加仓的风控检查，根据止损距离和置信度计算数量
+func (s *SimplePositionSizer) handleOpen(ctx context.Context, signal strategy.Signal, positionSide exchange.PositionSide) (HandleSignalResult, error) {
+	result := HandleSignalResult{
+		Validated: false,
+	}
+
+	// 止盈止损的方向检查按持仓方向进行
+	action := strategy.SignalActionLong
+	if positionSide == exchange.PositionSideShort {
+		action = strategy.SignalActionShort
+	}
 
 	// 2. 检查置信度阈值
 	if signal.Confidence < s.riskConfig.ConfidenceThreshold {
@@ -83,7 +109,7 @@ func (s *SimplePositionSizer) HandleSignal(ctx context.Context, signal strategy.
 	}
 
 	// 5. 计算止损距离比例
-	stopLossRatio, err := s.calculateStopLossRatio(signal.Action, currentPrice, signal.StopLoss)
+	stopLossRatio, err := s.calculateStopLossRatio(action, currentPrice, signal.StopLoss)
 	if err != nil {
 		result.Reason = err.Error()
 		return result, nil
@@ -91,7 +117,7 @@ func (s *SimplePositionSizer) HandleSignal(ctx context.Context, signal strategy.
 
 	// 6. 检查止盈止损比例（如果设置了止盈）
 	if !signal.TakeProfit.IsZero() {
-		profitLossRatio, err := s.calculateProfitLossRatio(signal.Action, currentPrice, signal.TakeProfit, signal.StopLoss)
+		profitLossRatio, err := s.calculateProfitLossRatio(action, currentPrice, signal.TakeProfit, signal.StopLoss)
 		if err != nil {
 			result.Reason = err.Error()
 			return result, nil
@@ -156,13 +182,9 @@ func (s *SimplePositionSizer) HandleSignal(ctx context.Context, signal strategy.
 	quantity := positionValue.Div(currentPrice)
 
 	// 15. 构建增强信号
-	positionSide := exchange.PositionSideLong
-	if signal.Action == strategy.SignalActionShort {
-		positionSide = exchange.PositionSideShort
-	}
-
 	result.EnhancedSignal = EnhancedSignal{
 		TradingPair:  signal.TradingPair,
+		Action:       signal.Action,
 		PositionSide: positionSide,
 		Quantity:     quantity,
 		TakeProfit:   signal.TakeProfit,
@@ -176,6 +198,76 @@ func (s *SimplePositionSizer) HandleSignal(ctx context.Context, signal strategy.
 	return result, nil
 }
 
+// handleReduce 减仓和平仓：只降低风险，不检查置信度和止损，只校验持仓和比例
+func (s *SimplePositionSizer) handleReduce(ctx context.Context, signal strategy.Signal) (HandleSignalResult, error) {
+	result := HandleSignalResult{
+		Validated: false,
+	}
+
+	hundred := decimal.NewFromInt(100)
+	percent := signal.Percent
+	if percent.IsZero() {
+		if signal.Action == strategy.SignalActionReduce {
+			result.Reason = "减仓比例未设置"
+			return result, nil
+		}
+		percent = hundred
+	}
+	if !percent.IsPositive() || percent.GreaterThan(hundred) {
+		result.Reason = fmt.Sprintf("平仓比例 %s 应在 (0, 100] 之间", percent.String())
+		return result, nil
+	}
+
+	position, reason, err := s.findPosition(ctx, signal)
+	if err != nil || position == nil {
+		result.Reason = reason
+		return result, err
+	}
+
+	result.EnhancedSignal = EnhancedSignal{
+		TradingPair:  signal.TradingPair,
+		Action:       signal.Action,
+		PositionSide: position.PositionSide,
+		Quantity:     position.Quantity.Abs().Mul(percent).Div(hundred),
+		CloseAll:     percent.Equal(hundred),
+		TakeProfit:   signal.TakeProfit,
+		StopLoss:     signal.StopLoss,
+		Timestamp:    signal.Timestamp,
+	}
+	result.Validated = true
+	result.Reason = fmt.Sprintf("通过风控检查 - %s %s %s%%", signal.Action, position.PositionSide, percent.String())
+	return result, nil
+}
+
+// findPosition 查找信号针对的持仓
+// 指定了 PositionSide 时按方向查找，否则要求只有一个方向的持仓；没有找到时返回原因
+func (s *SimplePositionSizer) findPosition(ctx context.Context, signal strategy.Signal) (*exchange.Position, string, error) {
+	positions, err := s.exchangeSvc.PositionService().GetActivePositions(ctx, []exchange.TradingPair{signal.TradingPair})
+	if err != nil {
+		return nil, "", fmt.Errorf("获取持仓信息失败: %w", err)
+	}
+
+	var found []exchange.Position
+	for _, position := range positions {
+		if position.TradingPair != signal.TradingPair || position.Quantity.IsZero() {
+			continue
+		}
+		if signal.PositionSide != "" && position.PositionSide != signal.PositionSide {
+			continue
+		}
+		found = append(found, position)
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Sprintf("%s 没有可操作的持仓", signal.TradingPair.ToString()), nil
+	case 1:
+		return &found[0], "", nil
+	default:
+		return nil, fmt.Sprintf("%s 同时持有多空仓位，需要指定 PositionSide", signal.TradingPair.ToString()), nil
+	}
+}
+
 // calculateStopLossRatio 计算止损距离比例
 func (s *SimplePositionSizer) calculateStopLossRatio(
 	action strategy.SignalAction,
@@ -43,6 +43,11 @@ func (m *MockExchangeService) TradingService() exchange.TradingService {
 	return args.Get(0).(exchange.TradingService)
 }
 
+func (m *MockExchangeService) UserDataService() exchange.UserDataService {
+	args := m.Called()
+	return args.Get(0).(exchange.UserDataService)
+}
+
 type MockMarketService struct {
 	mock.Mock
 }
@@ -593,3 +598,160 @@ func TestSimplePositionSizer_CalculateProfitLossRatio(t *testing.T) {
 		})
 	}
 }
+
+func newReduceTestSizer(t *testing.T, positions []exchange.Position) *SimplePositionSizer {
+	mockExchange := new(MockExchangeService)
+	mockPosition := new(MockPositionService)
+	mockExchange.On("PositionService").Return(mockPosition)
+	mockPosition.On("GetActivePositions", mock.Anything, mock.Anything).Return(positions, nil)
+
+	sizer := NewSimplePositionSizer(mockExchange)
+	assert.NoError(t, sizer.Initialize(context.Background(), RiskConfig{
+		MaxStopLossRatio:    0.05,
+		MaxLeverage:         10,
+		ConfidenceThreshold: 0.6,
+	}))
+	return sizer
+}
+
+func TestSimplePositionSizer_HandleSignal_CloseAndReduce(t *testing.T) {
+	btc := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	long := exchange.Position{TradingPair: btc, PositionSide: exchange.PositionSideLong, Quantity: decimal.NewFromInt(2)}
+	short := exchange.Position{TradingPair: btc, PositionSide: exchange.PositionSideShort, Quantity: decimal.NewFromInt(-4)}
+
+	tests := []struct {
+		name         string
+		positions    []exchange.Position
+		signal       strategy.Signal
+		validated    bool
+		positionSide exchange.PositionSide
+		quantity     decimal.Decimal
+		closeAll     bool
+	}{
+		{
+			name:         "CLOSE 未指定比例时全部平仓",
+			positions:    []exchange.Position{long},
+			signal:       strategy.Signal{TradingPair: btc, Action: strategy.SignalActionClose},
+			validated:    true,
+			positionSide: exchange.PositionSideLong,
+			quantity:     decimal.NewFromInt(2),
+			closeAll:     true,
+		},
+		{
+			name:         "CLOSE 按比例平空仓",
+			positions:    []exchange.Position{short},
+			signal:       strategy.Signal{TradingPair: btc, Action: strategy.SignalActionClose, Percent: decimal.NewFromInt(25)},
+			validated:    true,
+			positionSide: exchange.PositionSideShort,
+			quantity:     decimal.NewFromInt(1),
+		},
+		{
+			name:         "REDUCE 指定方向",
+			positions:    []exchange.Position{long, short},
+			signal:       strategy.Signal{TradingPair: btc, Action: strategy.SignalActionReduce, Percent: decimal.NewFromInt(50), PositionSide: exchange.PositionSideShort},
+			validated:    true,
+			positionSide: exchange.PositionSideShort,
+			quantity:     decimal.NewFromInt(2),
+		},
+		{
+			name:      "REDUCE 未指定比例",
+			positions: []exchange.Position{long},
+			signal:    strategy.Signal{TradingPair: btc, Action: strategy.SignalActionReduce},
+		},
+		{
+			name:      "比例超过 100",
+			positions: []exchange.Position{long},
+			signal:    strategy.Signal{TradingPair: btc, Action: strategy.SignalActionClose, Percent: decimal.NewFromInt(150)},
+		},
+		{
+			name:   "没有持仓",
+			signal: strategy.Signal{TradingPair: btc, Action: strategy.SignalActionClose},
+		},
+		{
+			name:      "多空同时持有且未指定方向",
+			positions: []exchange.Position{long, short},
+			signal:    strategy.Signal{TradingPair: btc, Action: strategy.SignalActionClose},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sizer := newReduceTestSizer(t, tt.positions)
+			result, err := sizer.HandleSignal(context.Background(), tt.signal)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.validated, result.Validated, result.Reason)
+			if !tt.validated {
+				assert.NotEmpty(t, result.Reason)
+				return
+			}
+			assert.Equal(t, tt.signal.Action, result.EnhancedSignal.Action)
+			assert.Equal(t, tt.positionSide, result.EnhancedSignal.PositionSide)
+			assert.True(t, tt.quantity.Equal(result.EnhancedSignal.Quantity), result.EnhancedSignal.Quantity.String())
+			assert.Equal(t, tt.closeAll, result.EnhancedSignal.CloseAll)
+		})
+	}
+}
+
+func TestSimplePositionSizer_HandleSignal_Add(t *testing.T) {
+	btc := exchange.TradingPair{Base: "BTC", Quote: "USDT"}
+	mockExchange := new(MockExchangeService)
+	mockMarket := new(MockMarketService)
+	mockAccount := new(MockAccountService)
+	mockPosition := new(MockPositionService)
+
+	mockExchange.On("MarketService").Return(mockMarket)
+	mockExchange.On("AccountService").Return(mockAccount)
+	mockExchange.On("PositionService").Return(mockPosition)
+	mockMarket.On("Ticker", mock.Anything, mock.Anything).Return(decimal.NewFromInt(50000), nil)
+	mockAccount.On("GetAccountInfo", mock.Anything).Return(exchange.AccountInfo{
+		TotalBalance:     decimal.NewFromInt(10000),
+		AvailableBalance: decimal.NewFromInt(9000),
+	}, nil)
+
+	// 已有 0.2 BTC 空仓（杠杆 1x）
+	mockPosition.On("GetActivePositions", mock.Anything, mock.Anything).Return([]exchange.Position{{
+		TradingPair:  btc,
+		PositionSide: exchange.PositionSideShort,
+		Quantity:     decimal.NewFromFloat(-0.2),
+		MarkPrice:    decimal.NewFromInt(50000),
+	}}, nil)
+
+	sizer := NewSimplePositionSizer(mockExchange)
+	assert.NoError(t, sizer.Initialize(context.Background(), RiskConfig{
+		MaxStopLossRatio:    0.05,
+		MaxLeverage:         10,
+		ConfidenceThreshold: 0.6,
+	}))
+
+	// 加仓方向跟随空仓，止损必须高于当前价
+	result, err := sizer.HandleSignal(context.Background(), strategy.Signal{
+		TradingPair: btc,
+		Action:      strategy.SignalActionAdd,
+		Confidence:  0.8,
+		StopLoss:    decimal.NewFromInt(49000),
+	})
+	assert.NoError(t, err)
+	assert.False(t, result.Validated)
+
+	result, err = sizer.HandleSignal(context.Background(), strategy.Signal{
+		TradingPair: btc,
+		Action:      strategy.SignalActionAdd,
+		Confidence:  0.8,
+		StopLoss:    decimal.NewFromInt(51000),
+	})
+	assert.NoError(t, err)
+	assert.True(t, result.Validated, result.Reason)
+	assert.Equal(t, strategy.SignalActionAdd, result.EnhancedSignal.Action)
+	assert.Equal(t, exchange.PositionSideShort, result.EnhancedSignal.PositionSide)
+	assert.True(t, result.EnhancedSignal.Quantity.IsPositive())
+
+	// 低于置信度阈值不允许加仓
+	result, err = sizer.HandleSignal(context.Background(), strategy.Signal{
+		TradingPair: btc,
+		Action:      strategy.SignalActionAdd,
+		Confidence:  0.5,
+		StopLoss:    decimal.NewFromInt(51000),
+	})
+	assert.NoError(t, err)
+	assert.False(t, result.Validated)
+}
@@ -43,9 +43,11 @@ type HandleSignalResult struct {
 
 type EnhancedSignal struct {
 	TradingPair  exchange.TradingPair
+	Action       strategy.SignalAction
 	PositionSide exchange.PositionSide
-	Quantity     decimal.Decimal
+	Quantity     decimal.Decimal // 开仓、加仓或减仓的数量
+	CloseAll     bool            // 平掉该方向的全部仓位（仅 CLOSE）
 	TakeProfit   decimal.Decimal
-	StopLoss     decimal.Decimal // 必须不为0
+	StopLoss     decimal.Decimal // 开仓和加仓时必须不为0
 	Timestamp    time.Time
 }
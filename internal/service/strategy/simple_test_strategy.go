@@ -40,6 +40,21 @@ func NewSimpleTestStrategy(tradingPair exchange.TradingPair) *SimpleTestStrategy
 	}
 }
 
+// SetPeriods 设置短期、长期均线周期，需要在 Initialize 之前调用
+func (s *SimpleTestStrategy) SetPeriods(shortPeriod, longPeriod int) error {
+	if shortPeriod <= 0 || shortPeriod >= longPeriod {
+		return fmt.Errorf("invalid ma periods: short=%d, long=%d", shortPeriod, longPeriod)
+	}
+	s.shortPeriod = shortPeriod
+	s.longPeriod = longPeriod
+	return nil
+}
+
+// SetInterval 设置策略运行的K线周期，需要在 Initialize 之前调用
+func (s *SimpleTestStrategy) SetInterval(interval exchange.Interval) {
+	s.interval = interval
+}
+
 // Name 策略名称
 func (s *SimpleTestStrategy) Name() string {
 	return s.name
@@ -240,3 +240,18 @@ func TestSimpleTestStrategy_Shutdown(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Nil(t, strategy.klines)
 }
+
+// TestSimpleTestStrategy_SetPeriods 测试设置均线周期，短期周期必须小于长期周期
+func TestSimpleTestStrategy_SetPeriods(t *testing.T) {
+	strategy := NewSimpleTestStrategy(exchange.TradingPair{Base: "BTC", Quote: "USDT"})
+
+	assert.NoError(t, strategy.SetPeriods(10, 30))
+	assert.Equal(t, 10, strategy.shortPeriod)
+	assert.Equal(t, 30, strategy.longPeriod)
+
+	assert.Error(t, strategy.SetPeriods(30, 30))
+	assert.Error(t, strategy.SetPeriods(0, 30))
+	// 无效参数不修改原值
+	assert.Equal(t, 10, strategy.shortPeriod)
+	assert.Equal(t, 30, strategy.longPeriod)
+}
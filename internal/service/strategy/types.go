@@ -2,6 +2,7 @@ package strategy
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/KNICEX/trading-agent/internal/service/exchange"
@@ -28,6 +29,46 @@ type Strategy interface {
 	Shutdown(ctx context.Context) error
 }
 
+// Subscription 策略订阅的一路K线（交易对 + 周期）
+type Subscription struct {
+	TradingPair exchange.TradingPair
+	Interval    exchange.Interval
+}
+
+// MultiStreamStrategy 订阅多个交易对或多个周期的策略，例如用 4h 趋势确认 15m 入场、多个交易对的配对交易
+// 引擎按 Subscriptions 订阅K线并通过 OnStreamKline 分发，不再调用 OnKline；
+// TradingPair / Interval 仍然表示策略的主交易对和主周期
+type MultiStreamStrategy interface {
+	Strategy
+
+	// Subscriptions 策略需要的全部K线流
+	Subscriptions() []Subscription
+
+	// OnStreamKline 某一路K线收盘时调用，可以为任意订阅的交易对返回多个信号
+	// 同一时刻收盘的多路K线按交易对、周期从小到大依次调用，此时 Context 中已经可以读取到这些K线
+	OnStreamKline(ctx context.Context, sub Subscription, kline exchange.Kline) ([]Signal, error)
+}
+
+// SubscriptionsOf 策略订阅的K线流，普通策略只有主交易对和主周期一路
+func SubscriptionsOf(sg Strategy) []Subscription {
+	if ms, ok := sg.(MultiStreamStrategy); ok {
+		return ms.Subscriptions()
+	}
+	return []Subscription{{TradingPair: sg.TradingPair(), Interval: sg.Interval()}}
+}
+
+// HandleKline 把一路K线交给策略处理，普通策略调用 OnKline，多路策略调用 OnStreamKline
+func HandleKline(ctx context.Context, sg Strategy, sub Subscription, kline exchange.Kline) ([]Signal, error) {
+	if ms, ok := sg.(MultiStreamStrategy); ok {
+		return ms.OnStreamKline(ctx, sub, kline)
+	}
+	signal, err := sg.OnKline(ctx, kline)
+	if err != nil {
+		return nil, err
+	}
+	return []Signal{signal}, nil
+}
+
 // SignalAction 信号动作（简化版：只有6种操作）
 type SignalAction string
 
@@ -38,9 +79,9 @@ const (
 	SignalActionHold  SignalAction = "HOLD"  // 观望（不操作）
 
 	// 有持仓时的操作
-	// SignalActionAdd    SignalAction = "ADD"    // 加仓
-	// SignalActionReduce SignalAction = "REDUCE" // 减仓
-	SignalActionClose SignalAction = "CLOSE" // 平仓
+	SignalActionAdd    SignalAction = "ADD"    // 加仓（与开仓相同的风控检查）
+	SignalActionReduce SignalAction = "REDUCE" // 减仓（按 Percent 平掉部分仓位）
+	SignalActionClose  SignalAction = "CLOSE"  // 平仓（Percent 为空时全部平仓）
 )
 
 // Signal 交易信号（简化版）
@@ -53,21 +94,31 @@ type Signal struct {
 	Confidence float64
 
 	// 止盈止损（可选）
+	// ADD / REDUCE / CLOSE 会把该方向的止盈止损调整为新的持仓数量，为空的一项沿用原来的触发价格
 	TakeProfit decimal.Decimal
 	StopLoss   decimal.Decimal
 
+	// 平仓百分比 (0, 100]，REDUCE 必填，CLOSE 为空时全部平仓
+	Percent decimal.Decimal
+	// ADD / REDUCE / CLOSE 针对的持仓方向，为空时使用当前唯一的持仓
+	PositionSide exchange.PositionSide
+
 	Reason string // 信号原因（用于日志和分析）
 	// 元数据
 	Metadata map[string]any
 }
 
+// ErrLookAhead 策略请求了当前时间之后的数据（回测中的未来数据）
+var ErrLookAhead = errors.New("look-ahead: data after current time requested")
+
 // Context 策略上下文
+// 所有数据都截止到 Now()：只返回已经收盘的K线和已经存在的持仓
 type Context interface {
 	Now() time.Time
 
 	TradingPair() exchange.TradingPair
 
-	// GetKlines 获取历史K线数据
+	// GetKlines 获取历史K线数据，EndTime 为空或晚于 Now() 时截断到 Now()，不包含还没收盘的K线
 	GetKlines(ctx context.Context, req GetKlinesReq) ([]exchange.Kline, error)
 
 	// GetPositions 获取当前持仓
@@ -75,7 +126,9 @@ type Context interface {
 }
 
 type GetKlinesReq struct {
-	Interval  exchange.Interval
-	StartTime time.Time
-	EndTime   time.Time
+	// TradingPair 为空时使用策略的主交易对，多交易对策略可以读取其他订阅的交易对
+	TradingPair exchange.TradingPair
+	Interval    exchange.Interval
+	StartTime   time.Time
+	EndTime     time.Time
 }
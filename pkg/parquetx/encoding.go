@@ -0,0 +1,268 @@
+package parquetx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+var errShortBuffer = errors.New("parquet: unexpected end of page")
+
+// bitWidth 表示 [0, max] 范围内的值所需的位数
+func bitWidth(max int) int {
+	return bits.Len(uint(max))
+}
+
+// decodeHybrid 解码 RLE / bit-packing 混合编码，最多返回 count 个值
+func decodeHybrid(data []byte, width, count int) ([]int32, error) {
+	values := make([]int32, 0, count)
+	byteWidth := (width + 7) / 8
+
+	for len(values) < count {
+		header, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errShortBuffer
+		}
+		data = data[n:]
+
+		if header&1 == 0 {
+			// RLE：重复次数 + 按字节对齐的值
+			run := int(header >> 1)
+			if len(data) < byteWidth {
+				return nil, errShortBuffer
+			}
+			var v int32
+			for i := 0; i < byteWidth; i++ {
+				v |= int32(data[i]) << (8 * i)
+			}
+			data = data[byteWidth:]
+			for i := 0; i < run && len(values) < count; i++ {
+				values = append(values, v)
+			}
+			continue
+		}
+
+		// bit-packing：每组 8 个值，低位在前
+		groups := int(header >> 1)
+		size := groups * width
+		if len(data) < size {
+			return nil, errShortBuffer
+		}
+		packed := data[:size]
+		data = data[size:]
+		for i := 0; i < groups*8 && len(values) < count; i++ {
+			var v int32
+			for b := 0; b < width; b++ {
+				bit := i*width + b
+				if packed[bit/8]&(1<<(bit%8)) != 0 {
+					v |= 1 << b
+				}
+			}
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+// encodeHybridRLE 用 RLE 编码一组值（写入时只使用 RLE 游程，足够紧凑且实现简单）
+func encodeHybridRLE(values []int32, width int) []byte {
+	byteWidth := (width + 7) / 8
+	var buf []byte
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j] == values[i] {
+			j++
+		}
+		buf = binary.AppendUvarint(buf, uint64(j-i)<<1)
+		for b := 0; b < byteWidth; b++ {
+			buf = append(buf, byte(values[i]>>(8*b)))
+		}
+		i = j
+	}
+	return buf
+}
+
+// decodePlain 按 PLAIN 编码解码 count 个值，追加到 column
+func decodePlain(column *ColumnData, typ Type, typeLength int, data []byte, count int) error {
+	switch typ {
+	case TypeBoolean:
+		if len(data)*8 < count {
+			return errShortBuffer
+		}
+		for i := 0; i < count; i++ {
+			column.Ints = append(column.Ints, int64(data[i/8]>>(i%8)&1))
+		}
+	case TypeInt32:
+		if len(data) < count*4 {
+			return errShortBuffer
+		}
+		for i := 0; i < count; i++ {
+			column.Ints = append(column.Ints, int64(int32(binary.LittleEndian.Uint32(data[i*4:]))))
+		}
+	case TypeInt64:
+		if len(data) < count*8 {
+			return errShortBuffer
+		}
+		for i := 0; i < count; i++ {
+			column.Ints = append(column.Ints, int64(binary.LittleEndian.Uint64(data[i*8:])))
+		}
+	case TypeFloat:
+		if len(data) < count*4 {
+			return errShortBuffer
+		}
+		for i := 0; i < count; i++ {
+			column.Floats = append(column.Floats, float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))))
+		}
+	case TypeDouble:
+		if len(data) < count*8 {
+			return errShortBuffer
+		}
+		for i := 0; i < count; i++ {
+			column.Floats = append(column.Floats, math.Float64frombits(binary.LittleEndian.Uint64(data[i*8:])))
+		}
+	case TypeByteArray:
+		for i := 0; i < count; i++ {
+			if len(data) < 4 {
+				return errShortBuffer
+			}
+			size := int(binary.LittleEndian.Uint32(data))
+			if len(data) < 4+size {
+				return errShortBuffer
+			}
+			column.Bytes = append(column.Bytes, data[4:4+size])
+			data = data[4+size:]
+		}
+	case TypeFixedLenByteArray:
+		if typeLength <= 0 || len(data) < count*typeLength {
+			return errShortBuffer
+		}
+		for i := 0; i < count; i++ {
+			column.Bytes = append(column.Bytes, data[i*typeLength:(i+1)*typeLength])
+		}
+	default:
+		return fmt.Errorf("parquet: unsupported physical type %s", typ)
+	}
+	return nil
+}
+
+// appendDictionary 按字典索引追加值
+func appendDictionary(column *ColumnData, dict *ColumnData, indices []int32) error {
+	for _, idx := range indices {
+		if idx < 0 || int(idx) >= dict.Len() {
+			return fmt.Errorf("parquet: dictionary index %d out of range", idx)
+		}
+		switch dict.Type {
+		case TypeFloat, TypeDouble:
+			column.Floats = append(column.Floats, dict.Floats[idx])
+		case TypeByteArray, TypeFixedLenByteArray:
+			column.Bytes = append(column.Bytes, dict.Bytes[idx])
+		default:
+			column.Ints = append(column.Ints, dict.Ints[idx])
+		}
+	}
+	return nil
+}
+
+// appendNull 为空值追加零值占位，保证各列按行对齐
+func appendNull(column *ColumnData, typ Type) {
+	switch typ {
+	case TypeFloat, TypeDouble:
+		column.Floats = append(column.Floats, 0)
+	case TypeByteArray, TypeFixedLenByteArray:
+		column.Bytes = append(column.Bytes, nil)
+	default:
+		column.Ints = append(column.Ints, 0)
+	}
+}
+
+// decodeDeltaBinaryPacked 解码 DELTA_BINARY_PACKED 编码的整数，最多返回 count 个值
+//
+// 页头：块大小、每块的小块数、值总数、首个值（zigzag）；之后每个块为最小差值（zigzag）、
+// 各小块的位宽和按位宽 bit-packing 的相对差值。差值按 64 位回绕累加。
+func decodeDeltaBinaryPacked(data []byte, count int) ([]int64, error) {
+	blockSize, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, errShortBuffer
+	}
+	data = data[n:]
+	miniBlocks, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, errShortBuffer
+	}
+	data = data[n:]
+	total, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, errShortBuffer
+	}
+	data = data[n:]
+	first, n := binary.Varint(data)
+	if n <= 0 {
+		return nil, errShortBuffer
+	}
+	data = data[n:]
+
+	if blockSize == 0 || blockSize%128 != 0 || miniBlocks == 0 || blockSize%miniBlocks != 0 {
+		return nil, fmt.Errorf("parquet: invalid delta block size %d with %d miniblocks", blockSize, miniBlocks)
+	}
+	perMini := int(blockSize / miniBlocks)
+	if perMini%32 != 0 {
+		return nil, fmt.Errorf("parquet: invalid delta miniblock size %d", perMini)
+	}
+	if int(total) < count {
+		count = int(total)
+	}
+
+	values := make([]int64, 0, count)
+	if count == 0 {
+		return values, nil
+	}
+	values = append(values, first)
+	last := first
+	for len(values) < count {
+		minDelta, n := binary.Varint(data)
+		if n <= 0 {
+			return nil, errShortBuffer
+		}
+		data = data[n:]
+		if len(data) < int(miniBlocks) {
+			return nil, errShortBuffer
+		}
+		widths := data[:miniBlocks]
+		data = data[miniBlocks:]
+
+		// 最后一个块中没有值的小块不占空间
+		for m := 0; m < int(miniBlocks) && len(values) < count; m++ {
+			width := int(widths[m])
+			if width > 64 {
+				return nil, fmt.Errorf("parquet: invalid delta bit width %d", width)
+			}
+			size := perMini * width / 8
+			if len(data) < size {
+				return nil, errShortBuffer
+			}
+			packed := data[:size]
+			data = data[size:]
+			for i := 0; i < perMini && len(values) < count; i++ {
+				last += minDelta + int64(unpackBits(packed, width, i))
+				values = append(values, last)
+			}
+		}
+	}
+	return values, nil
+}
+
+// unpackBits 读取 bit-packing（低位在前）数据中第 i 个 width 位的值
+func unpackBits(packed []byte, width, i int) uint64 {
+	var v uint64
+	bit := i * width
+	for got := 0; got < width; {
+		shift := bit % 8
+		n := min(8-shift, width-got)
+		v |= uint64(packed[bit/8]>>shift&(1<<n-1)) << got
+		got += n
+		bit += n
+	}
+	return v
+}
@@ -0,0 +1,328 @@
+// Package parquetx 纯 Go 实现的精简 Parquet 读写
+//
+// 只支持扁平（无嵌套、无 repeated 字段）的表结构，足以读写K线这类列式行情数据：
+//   - 物理类型：BOOLEAN / INT32 / INT64 / FLOAT / DOUBLE / BYTE_ARRAY / FIXED_LEN_BYTE_ARRAY
+//   - 编码：PLAIN、PLAIN_DICTIONARY / RLE_DICTIONARY、DELTA_BINARY_PACKED，定义级别使用 RLE / bit-packing 混合编码
+//   - 压缩：UNCOMPRESSED、SNAPPY、GZIP、ZSTD
+//   - 数据页：DATA_PAGE 与 DATA_PAGE_V2
+//
+// 读取按行组进行，每次只把一个行组的列块载入内存，适合流式处理大文件。
+package parquetx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var magic = []byte("PAR1")
+
+// Type 物理类型
+type Type int32
+
+const (
+	TypeBoolean           Type = 0
+	TypeInt32             Type = 1
+	TypeInt64             Type = 2
+	TypeInt96             Type = 3
+	TypeFloat             Type = 4
+	TypeDouble            Type = 5
+	TypeByteArray         Type = 6
+	TypeFixedLenByteArray Type = 7
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeBoolean:
+		return "BOOLEAN"
+	case TypeInt32:
+		return "INT32"
+	case TypeInt64:
+		return "INT64"
+	case TypeInt96:
+		return "INT96"
+	case TypeFloat:
+		return "FLOAT"
+	case TypeDouble:
+		return "DOUBLE"
+	case TypeByteArray:
+		return "BYTE_ARRAY"
+	case TypeFixedLenByteArray:
+		return "FIXED_LEN_BYTE_ARRAY"
+	default:
+		return fmt.Sprintf("Type(%d)", int32(t))
+	}
+}
+
+// TimeUnit TIMESTAMP 逻辑类型的时间单位
+type TimeUnit int
+
+const (
+	TimeUnitNone TimeUnit = iota
+	TimeUnitMillis
+	TimeUnitMicros
+	TimeUnitNanos
+)
+
+// Field 列定义
+type Field struct {
+	Name       string
+	Type       Type
+	TypeLength int      // FIXED_LEN_BYTE_ARRAY 的字节长度
+	Optional   bool     // 是否允许空值
+	Unit       TimeUnit // 列为 TIMESTAMP 逻辑类型时的时间单位
+}
+
+// ColumnData 一列数据，按物理类型存放在对应的切片中
+//   - BOOLEAN / INT32 / INT64 → Ints
+//   - FLOAT / DOUBLE → Floats
+//   - BYTE_ARRAY / FIXED_LEN_BYTE_ARRAY → Bytes
+//
+// 空值位置填充零值，Defined 标记每一行是否非空；必填列的 Defined 为 nil
+type ColumnData struct {
+	Type    Type
+	Ints    []int64
+	Floats  []float64
+	Bytes   [][]byte
+	Defined []bool
+}
+
+// Len 行数
+func (c *ColumnData) Len() int {
+	switch c.Type {
+	case TypeFloat, TypeDouble:
+		return len(c.Floats)
+	case TypeByteArray, TypeFixedLenByteArray:
+		return len(c.Bytes)
+	default:
+		return len(c.Ints)
+	}
+}
+
+// IsNull 第 i 行是否为空值
+func (c *ColumnData) IsNull(i int) bool {
+	return c.Defined != nil && !c.Defined[i]
+}
+
+const (
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+	codecZstd         = 6
+
+	encodingPlain           = 0
+	encodingPlainDictionary = 2
+	encodingRLE             = 3
+	encodingDeltaBinary     = 5
+	encodingRLEDictionary   = 8
+
+	pageTypeData       = 0
+	pageTypeDictionary = 2
+	pageTypeDataV2     = 3
+)
+
+type columnChunk struct {
+	field     int // 对应 fields 的下标
+	codec     int64
+	numValues int64
+	offset    int64
+	size      int64
+}
+
+type rowGroup struct {
+	numRows int64
+	columns []columnChunk
+}
+
+// File 已打开的 Parquet 文件
+type File struct {
+	r         io.ReaderAt
+	fields    []Field
+	numRows   int64
+	rowGroups []rowGroup
+}
+
+// Open 读取文件尾部的元数据
+func Open(r io.ReaderAt, size int64) (*File, error) {
+	if size < int64(len(magic))*2+4 {
+		return nil, errors.New("parquet: file too small")
+	}
+
+	footer := make([]byte, 8)
+	if _, err := r.ReadAt(footer, size-8); err != nil {
+		return nil, fmt.Errorf("parquet: read footer: %w", err)
+	}
+	if !bytes.Equal(footer[4:], magic) {
+		return nil, errors.New("parquet: invalid magic number")
+	}
+	metaLen := int64(binary.LittleEndian.Uint32(footer))
+	if metaLen <= 0 || metaLen > size-12 {
+		return nil, fmt.Errorf("parquet: invalid metadata length %d", metaLen)
+	}
+
+	meta := make([]byte, metaLen)
+	if _, err := r.ReadAt(meta, size-8-metaLen); err != nil {
+		return nil, fmt.Errorf("parquet: read metadata: %w", err)
+	}
+	tr := &thriftReader{r: bytes.NewReader(meta)}
+	fileMeta, err := tr.readStruct()
+	if err != nil {
+		return nil, fmt.Errorf("parquet: decode metadata: %w", err)
+	}
+
+	f := &File{r: r, numRows: fileMeta.int(3)}
+	if err := f.parseSchema(fileMeta.list(2)); err != nil {
+		return nil, err
+	}
+	if err := f.parseRowGroups(fileMeta.list(4)); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// parseSchema 解析扁平表结构，第一个元素为根节点
+func (f *File) parseSchema(elements []any) error {
+	if len(elements) == 0 {
+		return errors.New("parquet: empty schema")
+	}
+	for _, e := range elements[1:] {
+		element, ok := e.(tstruct)
+		if !ok {
+			return errors.New("parquet: invalid schema element")
+		}
+		name := element.str(4)
+		if element.int(5) > 0 {
+			return fmt.Errorf("parquet: nested column %q is not supported", name)
+		}
+		if !element.has(1) {
+			return fmt.Errorf("parquet: column %q has no physical type", name)
+		}
+
+		field := Field{
+			Name:       name,
+			Type:       Type(element.int(1)),
+			TypeLength: int(element.int(2)),
+		}
+		switch element.int(3) {
+		case 0:
+		case 1:
+			field.Optional = true
+		default:
+			return fmt.Errorf("parquet: repeated column %q is not supported", name)
+		}
+		field.Unit = timeUnit(element)
+		f.fields = append(f.fields, field)
+	}
+	return nil
+}
+
+// timeUnit 从逻辑类型（或旧版的 converted_type）中解析时间戳单位
+func timeUnit(element tstruct) TimeUnit {
+	if timestamp := element.child(10).child(8); timestamp != nil {
+		unit := timestamp.child(2)
+		switch {
+		case unit.has(1):
+			return TimeUnitMillis
+		case unit.has(2):
+			return TimeUnitMicros
+		case unit.has(3):
+			return TimeUnitNanos
+		}
+	}
+	switch element.int(6) {
+	case 9:
+		return TimeUnitMillis
+	case 10:
+		return TimeUnitMicros
+	}
+	return TimeUnitNone
+}
+
+func (f *File) parseRowGroups(groups []any) error {
+	for _, g := range groups {
+		group, ok := g.(tstruct)
+		if !ok {
+			return errors.New("parquet: invalid row group")
+		}
+
+		rg := rowGroup{numRows: group.int(3)}
+		for _, c := range group.list(1) {
+			chunk, ok := c.(tstruct)
+			if !ok {
+				return errors.New("parquet: invalid column chunk")
+			}
+			if chunk.str(1) != "" {
+				return errors.New("parquet: external column chunks are not supported")
+			}
+			meta := chunk.child(3)
+			if meta == nil {
+				return errors.New("parquet: column chunk has no metadata")
+			}
+
+			path := meta.list(3)
+			if len(path) != 1 {
+				return errors.New("parquet: nested column path is not supported")
+			}
+			name, _ := path[0].([]byte)
+			field := f.fieldIndex(string(name))
+			if field < 0 {
+				return fmt.Errorf("parquet: column %q not found in schema", name)
+			}
+
+			// 字典页在数据页之前
+			offset := meta.int(9)
+			if dictOffset := meta.int(11); dictOffset > 0 && dictOffset < offset {
+				offset = dictOffset
+			}
+			rg.columns = append(rg.columns, columnChunk{
+				field:     field,
+				codec:     meta.int(4),
+				numValues: meta.int(5),
+				offset:    offset,
+				size:      meta.int(7),
+			})
+		}
+		f.rowGroups = append(f.rowGroups, rg)
+	}
+	return nil
+}
+
+func (f *File) fieldIndex(name string) int {
+	for i, field := range f.fields {
+		if field.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Fields 列定义
+func (f *File) Fields() []Field {
+	return f.fields
+}
+
+// Field 按列名获取列定义
+func (f *File) Field(name string) (Field, bool) {
+	idx := f.fieldIndex(name)
+	if idx < 0 {
+		return Field{}, false
+	}
+	return f.fields[idx], true
+}
+
+// NumRows 总行数
+func (f *File) NumRows() int64 {
+	return f.numRows
+}
+
+// NumRowGroups 行组数量
+func (f *File) NumRowGroups() int {
+	return len(f.rowGroups)
+}
+
+// RowGroupRows 第 i 个行组的行数
+func (f *File) RowGroupRows(i int) int64 {
+	return f.rowGroups[i].numRows
+}
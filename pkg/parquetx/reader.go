@@ -0,0 +1,271 @@
+package parquetx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdDecoder 共享的 ZSTD 解码器，DecodeAll 可以并发调用
+var zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+	return zstd.NewReader(nil)
+})
+
+// ReadRowGroup 读取第 i 个行组中的指定列，columns 为空时读取全部列
+// 返回 列名 → 列数据
+func (f *File) ReadRowGroup(i int, columns ...string) (map[string]*ColumnData, error) {
+	if i < 0 || i >= len(f.rowGroups) {
+		return nil, fmt.Errorf("parquet: row group %d out of range", i)
+	}
+
+	wanted := make(map[string]bool, len(columns))
+	for _, name := range columns {
+		if f.fieldIndex(name) < 0 {
+			return nil, fmt.Errorf("parquet: column %q not found", name)
+		}
+		wanted[name] = true
+	}
+
+	result := make(map[string]*ColumnData)
+	for _, chunk := range f.rowGroups[i].columns {
+		field := f.fields[chunk.field]
+		if len(wanted) > 0 && !wanted[field.Name] {
+			continue
+		}
+		column, err := f.readColumnChunk(chunk, field)
+		if err != nil {
+			return nil, fmt.Errorf("parquet: read column %q in row group %d: %w", field.Name, i, err)
+		}
+		result[field.Name] = column
+	}
+	return result, nil
+}
+
+func (f *File) readColumnChunk(chunk columnChunk, field Field) (*ColumnData, error) {
+	if chunk.size <= 0 || chunk.size > 1<<31 {
+		return nil, fmt.Errorf("invalid column chunk size %d", chunk.size)
+	}
+	buf := make([]byte, chunk.size)
+	if _, err := f.r.ReadAt(buf, chunk.offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	column := &ColumnData{Type: field.Type}
+	if field.Optional {
+		column.Defined = make([]bool, 0, chunk.numValues)
+	}
+
+	var dict *ColumnData
+	r := bytes.NewReader(buf)
+	for read := int64(0); read < chunk.numValues; {
+		header, err := (&thriftReader{r: r}).readStruct()
+		if err != nil {
+			return nil, fmt.Errorf("read page header: %w", err)
+		}
+		pos := len(buf) - r.Len()
+		compressedSize := int(header.int(3))
+		if compressedSize < 0 || pos+compressedSize > len(buf) {
+			return nil, errShortBuffer
+		}
+		page := buf[pos : pos+compressedSize]
+		if _, err := r.Seek(int64(compressedSize), io.SeekCurrent); err != nil {
+			return nil, err
+		}
+
+		switch header.int(1) {
+		case pageTypeDictionary:
+			data, err := decompress(chunk.codec, page, int(header.int(2)))
+			if err != nil {
+				return nil, err
+			}
+			dictHeader := header.child(7)
+			dict = &ColumnData{Type: field.Type}
+			if err := decodePlain(dict, field.Type, field.TypeLength, data, int(dictHeader.int(1))); err != nil {
+				return nil, fmt.Errorf("decode dictionary: %w", err)
+			}
+		case pageTypeData:
+			data, err := decompress(chunk.codec, page, int(header.int(2)))
+			if err != nil {
+				return nil, err
+			}
+			pageHeader := header.child(5)
+			count := int(pageHeader.int(1))
+
+			var defs []int32
+			if field.Optional {
+				// v1 数据页：4 字节长度前缀 + 定义级别
+				if len(data) < 4 {
+					return nil, errShortBuffer
+				}
+				size := int(binary.LittleEndian.Uint32(data))
+				if len(data) < 4+size {
+					return nil, errShortBuffer
+				}
+				if defs, err = decodeHybrid(data[4:4+size], 1, count); err != nil {
+					return nil, fmt.Errorf("decode definition levels: %w", err)
+				}
+				data = data[4+size:]
+			}
+			if err := decodeValues(column, dict, field, int(pageHeader.int(2)), data, count, defs); err != nil {
+				return nil, err
+			}
+			read += int64(count)
+		case pageTypeDataV2:
+			pageHeader := header.child(8)
+			count := int(pageHeader.int(1))
+			defSize := int(pageHeader.int(5))
+			repSize := int(pageHeader.int(6))
+			if repSize+defSize > len(page) {
+				return nil, errShortBuffer
+			}
+
+			var defs []int32
+			if field.Optional {
+				// v2 数据页的级别数据不压缩，也没有长度前缀
+				if defs, err = decodeHybrid(page[repSize:repSize+defSize], 1, count); err != nil {
+					return nil, fmt.Errorf("decode definition levels: %w", err)
+				}
+			}
+
+			data := page[repSize+defSize:]
+			if compressed, ok := pageHeader.bool(7); !ok || compressed {
+				uncompressedSize := int(header.int(2)) - repSize - defSize
+				if data, err = decompress(chunk.codec, data, uncompressedSize); err != nil {
+					return nil, err
+				}
+			}
+			if err := decodeValues(column, dict, field, int(pageHeader.int(4)), data, count, defs); err != nil {
+				return nil, err
+			}
+			read += int64(count)
+		default:
+			// 索引页等其他页直接跳过
+		}
+	}
+	return column, nil
+}
+
+// decodeValues 解码一个数据页的值，count 为包含空值在内的行数
+func decodeValues(column, dict *ColumnData, field Field, encoding int, data []byte, count int, defs []int32) error {
+	nonNull := count
+	if defs != nil {
+		nonNull = 0
+		for _, d := range defs {
+			if d == 1 {
+				nonNull++
+			}
+		}
+	}
+
+	values := &ColumnData{Type: field.Type}
+	switch encoding {
+	case encodingPlain:
+		if err := decodePlain(values, field.Type, field.TypeLength, data, nonNull); err != nil {
+			return err
+		}
+	case encodingPlainDictionary, encodingRLEDictionary:
+		if dict == nil {
+			return fmt.Errorf("dictionary encoded page without dictionary")
+		}
+		if nonNull > 0 {
+			if len(data) < 1 {
+				return errShortBuffer
+			}
+			indices, err := decodeHybrid(data[1:], int(data[0]), nonNull)
+			if err != nil {
+				return fmt.Errorf("decode dictionary indices: %w", err)
+			}
+			if err := appendDictionary(values, dict, indices); err != nil {
+				return err
+			}
+		}
+	case encodingDeltaBinary:
+		if field.Type != TypeInt32 && field.Type != TypeInt64 {
+			return fmt.Errorf("DELTA_BINARY_PACKED is not valid for %s", field.Type)
+		}
+		ints, err := decodeDeltaBinaryPacked(data, nonNull)
+		if err != nil {
+			return fmt.Errorf("decode delta binary packed: %w", err)
+		}
+		if field.Type == TypeInt32 {
+			// INT32 的差值按 32 位回绕计算
+			for i, v := range ints {
+				ints[i] = int64(int32(v))
+			}
+		}
+		values.Ints = ints
+	default:
+		return fmt.Errorf("unsupported encoding %d", encoding)
+	}
+
+	if defs == nil {
+		column.Ints = append(column.Ints, values.Ints...)
+		column.Floats = append(column.Floats, values.Floats...)
+		column.Bytes = append(column.Bytes, values.Bytes...)
+		return nil
+	}
+
+	next := 0
+	for _, d := range defs {
+		if d != 1 {
+			appendNull(column, field.Type)
+			column.Defined = append(column.Defined, false)
+			continue
+		}
+		if err := appendDictionary(column, values, []int32{int32(next)}); err != nil {
+			return err
+		}
+		column.Defined = append(column.Defined, true)
+		next++
+	}
+	return nil
+}
+
+// decompress 按压缩编码解压页数据
+func decompress(codec int64, data []byte, uncompressedSize int) ([]byte, error) {
+	switch codec {
+	case codecUncompressed:
+		return data, nil
+	case codecSnappy:
+		out, err := snappy.Decode(nil, data)
+		if err != nil {
+			return nil, fmt.Errorf("snappy: %w", err)
+		}
+		return out, nil
+	case codecGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		defer zr.Close()
+		if uncompressedSize < 0 {
+			uncompressedSize = 0
+		}
+		out := bytes.NewBuffer(make([]byte, 0, uncompressedSize))
+		if _, err := io.Copy(out, zr); err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		return out.Bytes(), nil
+	case codecZstd:
+		decoder, err := zstdDecoder()
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		if uncompressedSize < 0 {
+			uncompressedSize = 0
+		}
+		out, err := decoder.DecodeAll(data, make([]byte, 0, uncompressedSize))
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %d", codec)
+	}
+}
@@ -0,0 +1,91 @@
+// 用 Apache Arrow 的 Go 实现（arrow-go/parquet）生成 Parquet 样本，供 TestRead_ExternalFixtures 校验兼容性
+//
+// 用法（在 pkg/parquetx/testdata/arrowgen 目录下）：
+//
+//	go run .
+//
+// 数据与 gen_fixtures.py 的 rows() 相同，文件写到上一级 testdata 目录
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+const (
+	n      = 300
+	baseMS = 1704067200000 // 2024-01-01T00:00:00Z
+)
+
+func record() arrow.Record {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "open_time", Type: &arrow.TimestampType{Unit: arrow.Millisecond}},
+		{Name: "close", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "symbol", Type: arrow.BinaryTypes.String},
+		{Name: "trades", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "funding", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	for i := 0; i < n; i++ {
+		b.Field(0).(*array.TimestampBuilder).Append(arrow.Timestamp(baseMS + int64(i)*60000))
+		b.Field(1).(*array.Float64Builder).Append(100 + float64(i%50)*0.5)
+		symbol := "ETHUSDT"
+		if i%2 == 0 {
+			symbol = "BTCUSDT"
+		}
+		b.Field(2).(*array.StringBuilder).Append(symbol)
+		b.Field(3).(*array.Int32Builder).Append(int32(i*7 - 100))
+		if i%5 == 0 {
+			b.Field(4).(*array.Float64Builder).AppendNull()
+		} else {
+			b.Field(4).(*array.Float64Builder).Append(float64(i) * 0.001)
+		}
+	}
+	return b.NewRecord()
+}
+
+func write(name string, rowGroupSize int64, opts ...parquet.WriterProperty) {
+	rec := record()
+	defer rec.Release()
+	table := array.NewTableFromRecords(rec.Schema(), []arrow.Record{rec})
+	defer table.Release()
+
+	f, err := os.Create(filepath.Join("..", name))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	props := parquet.NewWriterProperties(opts...)
+	arrowProps := pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema())
+	if err := pqarrow.WriteTable(table, f, rowGroupSize, props, arrowProps); err != nil {
+		log.Fatalf("write %s: %v", name, err)
+	}
+}
+
+func main() {
+	write("arrow_snappy_v1.parquet", 128,
+		parquet.WithCompression(compress.Codecs.Snappy),
+		parquet.WithDataPageVersion(parquet.DataPageV1))
+	write("arrow_zstd_v2.parquet", 128,
+		parquet.WithCompression(compress.Codecs.Zstd),
+		parquet.WithDataPageVersion(parquet.DataPageV2))
+	write("arrow_delta_gzip.parquet", n,
+		parquet.WithCompression(compress.Codecs.Gzip),
+		parquet.WithDictionaryDefault(false),
+		parquet.WithDictionaryFor("symbol", true),
+		parquet.WithEncodingFor("open_time", parquet.Encodings.DeltaBinaryPacked),
+		parquet.WithEncodingFor("trades", parquet.Encodings.DeltaBinaryPacked))
+	write("arrow_plain_uncompressed.parquet", 100,
+		parquet.WithCompression(compress.Codecs.Uncompressed),
+		parquet.WithDictionaryDefault(false))
+}
@@ -0,0 +1,66 @@
+"""生成 pyarrow / polars 写出的 Parquet 样本，供 TestRead_ExternalFixtures 校验兼容性。
+
+用法（在 pkg/parquetx 目录下）：
+
+    pip install pyarrow polars
+    python3 testdata/gen_fixtures.py
+
+每个文件的内容相同，见 rows()；测试中的期望值与这里保持一致。
+"""
+import os
+
+import polars as pl
+import pyarrow as pa
+import pyarrow.parquet as pq
+
+N = 300
+BASE_MS = 1704067200000  # 2024-01-01T00:00:00Z
+OUT = os.path.dirname(os.path.abspath(__file__))
+
+
+def rows():
+    return {
+        "open_time": [BASE_MS + i * 60000 for i in range(N)],
+        "close": [100 + (i % 50) * 0.5 for i in range(N)],
+        "symbol": ["BTCUSDT" if i % 2 == 0 else "ETHUSDT" for i in range(N)],
+        "trades": [i * 7 - 100 for i in range(N)],
+        "funding": [None if i % 5 == 0 else i * 0.001 for i in range(N)],
+    }
+
+
+def arrow_table():
+    r = rows()
+    return pa.table({
+        "open_time": pa.array(r["open_time"], pa.timestamp("ms")),
+        "close": pa.array(r["close"], pa.float64()),
+        "symbol": pa.array(r["symbol"], pa.string()),
+        "trades": pa.array(r["trades"], pa.int32()),
+        "funding": pa.array(r["funding"], pa.float64()),
+    })
+
+
+def main():
+    table = arrow_table()
+    pq.write_table(table, os.path.join(OUT, "pyarrow_snappy_v1.parquet"),
+                   compression="snappy", data_page_version="1.0", row_group_size=128)
+    pq.write_table(table, os.path.join(OUT, "pyarrow_zstd_v2.parquet"),
+                   compression="zstd", data_page_version="2.0", row_group_size=128)
+    pq.write_table(table, os.path.join(OUT, "pyarrow_delta_gzip.parquet"),
+                   compression="gzip", use_dictionary=["symbol"],
+                   column_encoding={"open_time": "DELTA_BINARY_PACKED", "trades": "DELTA_BINARY_PACKED"})
+
+    r = rows()
+    df = pl.DataFrame({
+        "open_time": pl.Series(r["open_time"]).cast(pl.Datetime("ms")),
+        "close": pl.Series(r["close"], dtype=pl.Float64),
+        "symbol": pl.Series(r["symbol"], dtype=pl.Utf8),
+        "trades": pl.Series(r["trades"], dtype=pl.Int32),
+        "funding": pl.Series(r["funding"], dtype=pl.Float64),
+    })
+    # polars 默认使用 ZSTD 压缩
+    df.write_parquet(os.path.join(OUT, "polars_default.parquet"))
+    df.write_parquet(os.path.join(OUT, "polars_snappy.parquet"), compression="snappy", row_group_size=100)
+
+
+if __name__ == "__main__":
+    main()
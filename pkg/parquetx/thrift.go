@@ -0,0 +1,305 @@
+package parquetx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Parquet 元数据使用 Thrift Compact Protocol 编码
+// 这里只实现通用的解码/编码：结构体解析为 字段ID → 值 的映射，再由上层按字段ID取值
+
+const (
+	ctStop         = 0
+	ctBooleanTrue  = 1
+	ctBooleanFalse = 2
+	ctByte         = 3
+	ctI16          = 4
+	ctI32          = 5
+	ctI64          = 6
+	ctDouble       = 7
+	ctBinary       = 8
+	ctList         = 9
+	ctSet          = 10
+	ctMap          = 11
+	ctStruct       = 12
+)
+
+// tstruct Thrift 结构体，值类型为 bool / int64 / float64 / []byte / []any / tstruct
+type tstruct map[int16]any
+
+func (s tstruct) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s tstruct) has(id int16) bool {
+	_, ok := s[id]
+	return ok
+}
+
+func (s tstruct) bool(id int16) (bool, bool) {
+	v, ok := s[id].(bool)
+	return v, ok
+}
+
+func (s tstruct) str(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s tstruct) list(id int16) []any {
+	v, _ := s[id].([]any)
+	return v
+}
+
+func (s tstruct) child(id int16) tstruct {
+	v, _ := s[id].(tstruct)
+	return v
+}
+
+type thriftReader struct {
+	r interface {
+		io.Reader
+		io.ByteReader
+	}
+	depth int
+}
+
+func (t *thriftReader) readStruct() (tstruct, error) {
+	t.depth++
+	defer func() { t.depth-- }()
+	if t.depth > 64 {
+		return nil, errors.New("thrift: struct nesting too deep")
+	}
+
+	s := tstruct{}
+	var lastId int16
+	for {
+		header, err := t.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		fieldType := header & 0x0f
+		if fieldType == ctStop {
+			return s, nil
+		}
+
+		var id int16
+		if delta := int16(header >> 4); delta != 0 {
+			id = lastId + delta
+		} else {
+			v, err := t.readVarint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		lastId = id
+
+		var value any
+		switch fieldType {
+		case ctBooleanTrue:
+			value = true
+		case ctBooleanFalse:
+			value = false
+		default:
+			value, err = t.readValue(fieldType)
+			if err != nil {
+				return nil, fmt.Errorf("thrift: read field %d: %w", id, err)
+			}
+		}
+		s[id] = value
+	}
+}
+
+func (t *thriftReader) readValue(fieldType byte) (any, error) {
+	switch fieldType {
+	case ctBooleanTrue, ctBooleanFalse:
+		// 集合中的布尔值单独占一个字节
+		b, err := t.r.ReadByte()
+		return b == ctBooleanTrue, err
+	case ctByte:
+		b, err := t.r.ReadByte()
+		return int64(int8(b)), err
+	case ctI16, ctI32, ctI64:
+		return t.readVarint()
+	case ctDouble:
+		var buf [8]byte
+		if _, err := io.ReadFull(t.r, buf[:]); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(buf[:])), nil
+	case ctBinary:
+		n, err := binary.ReadUvarint(t.r)
+		if err != nil {
+			return nil, err
+		}
+		if n > 1<<30 {
+			return nil, fmt.Errorf("thrift: binary too large: %d", n)
+		}
+		buf := make([]byte, n)
+		_, err = io.ReadFull(t.r, buf)
+		return buf, err
+	case ctList, ctSet:
+		header, err := t.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		size := uint64(header >> 4)
+		if size == 15 {
+			if size, err = binary.ReadUvarint(t.r); err != nil {
+				return nil, err
+			}
+		}
+		if size > 1<<24 {
+			return nil, fmt.Errorf("thrift: list too large: %d", size)
+		}
+		elemType := header & 0x0f
+		list := make([]any, 0, size)
+		for i := uint64(0); i < size; i++ {
+			v, err := t.readValue(elemType)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case ctMap:
+		size, err := binary.ReadUvarint(t.r)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return map[any]any{}, nil
+		}
+		types, err := t.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		// 元数据中的 map 只会被跳过，不需要保留
+		for i := uint64(0); i < size; i++ {
+			if _, err := t.readValue(types >> 4); err != nil {
+				return nil, err
+			}
+			if _, err := t.readValue(types & 0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return map[any]any{}, nil
+	case ctStruct:
+		return t.readStruct()
+	default:
+		return nil, fmt.Errorf("thrift: unknown type %d", fieldType)
+	}
+}
+
+func (t *thriftReader) readVarint() (int64, error) {
+	u, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		return 0, err
+	}
+	// zigzag 解码
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+// thriftWriter Thrift Compact Protocol 编码，字段需按ID升序写入
+type thriftWriter struct {
+	buf    []byte
+	lastId []int16
+}
+
+func (t *thriftWriter) structBegin() {
+	t.lastId = append(t.lastId, 0)
+}
+
+func (t *thriftWriter) structEnd() {
+	t.buf = append(t.buf, ctStop)
+	t.lastId = t.lastId[:len(t.lastId)-1]
+}
+
+func (t *thriftWriter) fieldHeader(id int16, fieldType byte) {
+	last := t.lastId[len(t.lastId)-1]
+	if delta := id - last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta<<4)|fieldType)
+	} else {
+		t.buf = append(t.buf, fieldType)
+		t.varint(int64(id))
+	}
+	t.lastId[len(t.lastId)-1] = id
+}
+
+func (t *thriftWriter) varint(v int64) {
+	t.buf = binary.AppendUvarint(t.buf, uint64((v<<1)^(v>>63)))
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.fieldHeader(id, ctI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.fieldHeader(id, ctI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) bool(id int16, v bool) {
+	if v {
+		t.fieldHeader(id, ctBooleanTrue)
+	} else {
+		t.fieldHeader(id, ctBooleanFalse)
+	}
+}
+
+func (t *thriftWriter) binary(id int16, v []byte) {
+	t.fieldHeader(id, ctBinary)
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(v)))
+	t.buf = append(t.buf, v...)
+}
+
+func (t *thriftWriter) listBegin(id int16, elemType byte, size int) {
+	t.fieldHeader(id, ctList)
+	if size < 15 {
+		t.buf = append(t.buf, byte(size<<4)|elemType)
+	} else {
+		t.buf = append(t.buf, 0xf0|elemType)
+		t.buf = binary.AppendUvarint(t.buf, uint64(size))
+	}
+}
+
+// listI32 写入 i32 列表
+func (t *thriftWriter) listI32(id int16, values []int32) {
+	t.listBegin(id, ctI32, len(values))
+	for _, v := range values {
+		t.varint(int64(v))
+	}
+}
+
+// listBinary 写入字符串列表
+func (t *thriftWriter) listBinary(id int16, values []string) {
+	t.listBegin(id, ctBinary, len(values))
+	for _, v := range values {
+		t.buf = binary.AppendUvarint(t.buf, uint64(len(v)))
+		t.buf = append(t.buf, v...)
+	}
+}
+
+// structField 写入结构体类型的字段，body 负责写入字段内容
+func (t *thriftWriter) structField(id int16, body func()) {
+	t.fieldHeader(id, ctStruct)
+	t.structBegin()
+	body()
+	t.structEnd()
+}
+
+// listStruct 写入结构体列表
+func (t *thriftWriter) listStruct(id int16, size int, body func(i int)) {
+	t.listBegin(id, ctStruct, size)
+	for i := 0; i < size; i++ {
+		t.structBegin()
+		body(i)
+		t.structEnd()
+	}
+}
@@ -0,0 +1,260 @@
+package parquetx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Writer 顺序写入 Parquet 文件
+// 每个行组的每一列写成一个 PLAIN 编码、不压缩的 DATA_PAGE，兼容主流读取端
+type Writer struct {
+	w         io.Writer
+	fields    []Field
+	offset    int64
+	numRows   int64
+	rowGroups []writtenRowGroup
+	closed    bool
+}
+
+type writtenRowGroup struct {
+	numRows int64
+	size    int64
+	chunks  []writtenChunk
+}
+
+type writtenChunk struct {
+	numValues int64
+	offset    int64
+	size      int64
+}
+
+// NewWriter 创建 Writer 并写入文件头
+func NewWriter(w io.Writer, fields []Field) (*Writer, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("parquet: no fields")
+	}
+	for _, field := range fields {
+		if field.Type == TypeInt96 {
+			return nil, fmt.Errorf("parquet: unsupported physical type %s", field.Type)
+		}
+		if field.Type == TypeFixedLenByteArray && field.TypeLength <= 0 {
+			return nil, fmt.Errorf("parquet: column %q requires type length", field.Name)
+		}
+	}
+
+	writer := &Writer{w: w, fields: fields}
+	if err := writer.write(magic); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *Writer) write(p []byte) error {
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	if err != nil {
+		return fmt.Errorf("parquet: write: %w", err)
+	}
+	return nil
+}
+
+// WriteRowGroup 写入一个行组，columns 与 fields 一一对应且行数相同
+func (w *Writer) WriteRowGroup(columns []*ColumnData) error {
+	if w.closed {
+		return errors.New("parquet: writer closed")
+	}
+	if len(columns) != len(w.fields) {
+		return fmt.Errorf("parquet: expected %d columns, got %d", len(w.fields), len(columns))
+	}
+
+	numRows := columns[0].Len()
+	for i, column := range columns {
+		field := w.fields[i]
+		if column.Type != field.Type {
+			return fmt.Errorf("parquet: column %q type %s, expected %s", field.Name, column.Type, field.Type)
+		}
+		if column.Len() != numRows {
+			return fmt.Errorf("parquet: column %q has %d rows, expected %d", field.Name, column.Len(), numRows)
+		}
+		if column.Defined != nil && (!field.Optional || len(column.Defined) != numRows) {
+			return fmt.Errorf("parquet: column %q has invalid definition levels", field.Name)
+		}
+	}
+
+	group := writtenRowGroup{numRows: int64(numRows)}
+	for i, column := range columns {
+		page, err := encodeDataPage(w.fields[i], column)
+		if err != nil {
+			return err
+		}
+		header := encodePageHeader(pageTypeData, len(page), func(t *thriftWriter) {
+			t.structField(5, func() {
+				t.i32(1, int32(numRows))
+				t.i32(2, encodingPlain)
+				t.i32(3, encodingRLE)
+				t.i32(4, encodingRLE)
+			})
+		})
+
+		chunk := writtenChunk{numValues: int64(numRows), offset: w.offset, size: int64(len(header) + len(page))}
+		if err := w.write(header); err != nil {
+			return err
+		}
+		if err := w.write(page); err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+		group.size += chunk.size
+	}
+
+	w.rowGroups = append(w.rowGroups, group)
+	w.numRows += int64(numRows)
+	return nil
+}
+
+// Close 写入文件尾部元数据，不会关闭底层的 io.Writer
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	t := &thriftWriter{}
+	t.structBegin()
+	t.i32(1, 1)
+	t.listStruct(2, len(w.fields)+1, func(i int) {
+		if i == 0 {
+			t.binary(4, []byte("schema"))
+			t.i32(5, int32(len(w.fields)))
+			return
+		}
+		writeSchemaElement(t, w.fields[i-1])
+	})
+	t.i64(3, w.numRows)
+	t.listStruct(4, len(w.rowGroups), func(i int) {
+		group := w.rowGroups[i]
+		t.listStruct(1, len(group.chunks), func(j int) {
+			chunk := group.chunks[j]
+			field := w.fields[j]
+			t.i64(2, chunk.offset)
+			t.structField(3, func() {
+				t.i32(1, int32(field.Type))
+				t.listI32(2, []int32{encodingPlain, encodingRLE})
+				t.listBinary(3, []string{field.Name})
+				t.i32(4, codecUncompressed)
+				t.i64(5, chunk.numValues)
+				t.i64(6, chunk.size)
+				t.i64(7, chunk.size)
+				t.i64(9, chunk.offset)
+			})
+		})
+		t.i64(2, group.size)
+		t.i64(3, group.numRows)
+	})
+	t.binary(6, []byte("parquetx"))
+	t.structEnd()
+
+	if err := w.write(t.buf); err != nil {
+		return err
+	}
+	footer := binary.LittleEndian.AppendUint32(nil, uint32(len(t.buf)))
+	return w.write(append(footer, magic...))
+}
+
+func writeSchemaElement(t *thriftWriter, field Field) {
+	t.i32(1, int32(field.Type))
+	if field.Type == TypeFixedLenByteArray {
+		t.i32(2, int32(field.TypeLength))
+	}
+	if field.Optional {
+		t.i32(3, 1)
+	} else {
+		t.i32(3, 0)
+	}
+	t.binary(4, []byte(field.Name))
+	if field.Unit == TimeUnitNone {
+		return
+	}
+
+	// 同时写入旧版 converted_type，纳秒没有对应的旧版类型
+	switch field.Unit {
+	case TimeUnitMillis:
+		t.i32(6, 9)
+	case TimeUnitMicros:
+		t.i32(6, 10)
+	}
+	t.structField(10, func() {
+		t.structField(8, func() {
+			t.bool(1, true)
+			t.structField(2, func() {
+				t.structField(int16(field.Unit), func() {})
+			})
+		})
+	})
+}
+
+// encodePageHeader 编码页头，body 写入页类型对应的子结构
+func encodePageHeader(pageType int32, size int, body func(t *thriftWriter)) []byte {
+	t := &thriftWriter{}
+	t.structBegin()
+	t.i32(1, pageType)
+	t.i32(2, int32(size))
+	t.i32(3, int32(size))
+	body(t)
+	t.structEnd()
+	return t.buf
+}
+
+// encodeDataPage 编码 v1 数据页：可选列先写定义级别，再写非空值
+func encodeDataPage(field Field, column *ColumnData) ([]byte, error) {
+	var page []byte
+	if field.Optional {
+		defs := make([]int32, column.Len())
+		for i := range defs {
+			if !column.IsNull(i) {
+				defs[i] = 1
+			}
+		}
+		levels := encodeHybridRLE(defs, 1)
+		page = binary.LittleEndian.AppendUint32(page, uint32(len(levels)))
+		page = append(page, levels...)
+	}
+
+	var bitsBuf []byte
+	var bitCount int
+	for i := 0; i < column.Len(); i++ {
+		if column.IsNull(i) {
+			continue
+		}
+		switch field.Type {
+		case TypeBoolean:
+			if bitCount%8 == 0 {
+				bitsBuf = append(bitsBuf, 0)
+			}
+			if column.Ints[i] != 0 {
+				bitsBuf[len(bitsBuf)-1] |= 1 << (bitCount % 8)
+			}
+			bitCount++
+		case TypeInt32:
+			page = binary.LittleEndian.AppendUint32(page, uint32(int32(column.Ints[i])))
+		case TypeInt64:
+			page = binary.LittleEndian.AppendUint64(page, uint64(column.Ints[i]))
+		case TypeFloat:
+			page = binary.LittleEndian.AppendUint32(page, math.Float32bits(float32(column.Floats[i])))
+		case TypeDouble:
+			page = binary.LittleEndian.AppendUint64(page, math.Float64bits(column.Floats[i]))
+		case TypeByteArray:
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(column.Bytes[i])))
+			page = append(page, column.Bytes[i]...)
+		case TypeFixedLenByteArray:
+			if len(column.Bytes[i]) != field.TypeLength {
+				return nil, fmt.Errorf("parquet: column %q value length %d, expected %d", field.Name, len(column.Bytes[i]), field.TypeLength)
+			}
+			page = append(page, column.Bytes[i]...)
+		}
+	}
+	return append(page, bitsBuf...), nil
+}